@@ -1,6 +1,10 @@
 package app
 
 import (
+	"context"
+	"github.com/bufbuild/protocompile"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"matrix-ai-framework/internal/config"
 	"matrix-ai-framework/internal/grpc_manager"
@@ -12,6 +16,7 @@ import (
 	"matrix-ai-framework/pkg/db"
 	ipfs "matrix-ai-framework/pkg/ipfs"
 	"maunium.net/go/mautrix/event"
+	"net/http"
 	"time"
 )
 
@@ -20,8 +25,8 @@ type App struct {
 	Fiber        *server.FiberServer
 	Ethereum     blockchain.Ethereum
 	MatrixClient matrix.Service
-	IPFSClient   ipfs.IPFSClient
-	Syncer       snet_syncer.SnetSyncer
+	IPFSClient   snet_syncer.ContentFetcher
+	Syncer       *snet_syncer.SnetSyncer
 	GRPCManager  *grpc_manager.GRPCClientManager
 }
 
@@ -30,14 +35,71 @@ func New() App {
 	config.Init()
 	database := db.New()
 	eth := blockchain.Init()
-	ipfsClient := ipfs.Init()
-	snetSyncer := snet_syncer.New(eth, ipfsClient, database)
+	var ipfsClient snet_syncer.ContentFetcher
+	if config.IPFS.MirrorDir != "" {
+		log.Info().Str("dir", config.IPFS.MirrorDir).Msg("Serving IPFS content from the local mirror")
+		ipfsClient = ipfs.NewMirror(config.IPFS.MirrorDir, config.IPFS.MaxFileSize)
+	} else {
+		ipfsClient = ipfs.Init()
+	}
+	syncLogger := log.Logger
+	if config.Syncer.LogLevel != "" {
+		level, err := zerolog.ParseLevel(config.Syncer.LogLevel)
+		if err != nil {
+			log.Error().Err(err).Str("level", config.Syncer.LogLevel).Msg("Failed to parse SYNC_LOG_LEVEL, using the global level")
+		} else {
+			syncLogger = syncLogger.Level(level)
+		}
+	}
+	snetSyncer, err := snet_syncer.New(eth, ipfsClient, database, &syncLogger)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create snet syncer")
+	}
+	snetSyncer.LenientCompile = config.Syncer.LenientProtoCompile
+	snetSyncer.MergeDuplicates = config.Syncer.MergeDuplicates
+	snetSyncer.LazyCompile = config.Syncer.LazyProtoCompile
+	snetSyncer.DryRun = config.Syncer.DryRun
+	snetSyncer.SetCompileConcurrency(config.Syncer.CompileConcurrency)
+	snetSyncer.SetRPCConcurrency(config.Syncer.RPCMinConcurrency, config.Syncer.RPCMaxConcurrency)
+	snetSyncer.SetRPCBreaker(config.Syncer.RPCBreakerThreshold, config.Syncer.RPCBreakerCooldown)
+	snetSyncer.SyncInterval = config.Syncer.Interval
+	snetSyncer.Concurrency = config.Syncer.Concurrency
+	snetSyncer.OrgPageSize = config.Syncer.OrgPageSize
+	snetSyncer.IncludeOrgs = config.Syncer.IncludeOrgs
+	snetSyncer.ExcludeOrgs = config.Syncer.ExcludeOrgs
+	snetSyncer.ForceFullSync = config.Syncer.ForceFullSync
+	snetSyncer.IPFSRetry = snet_syncer.RetryPolicy{
+		MaxAttempts: config.Syncer.IPFSMaxAttempts,
+		BaseDelay:   config.Syncer.IPFSRetryBackoff,
+		MaxDelay:    config.Syncer.IPFSMaxBackoff,
+	}
+	snetSyncer.HealthCheckInterval = config.Syncer.HealthCheckInterval
+	snetSyncer.HealthCheckConcurrency = config.Syncer.HealthCheckConcurrency
+	snetSyncer.CallTimeout = config.App.GRPCCallTimeout
+	snetSyncer.InvokableOnly = config.Syncer.InvokableOnly
+	snetSyncer.PruneHardDelete = config.Syncer.PruneHardDelete
+	snetSyncer.ArchiveLimits = ipfs.ArchiveLimits{MaxBytes: config.IPFS.ArchiveMaxBytes, MaxFiles: config.IPFS.ArchiveMaxFiles}
+	snetSyncer.MaxMetadataSize = config.IPFS.MaxFileSize
+	if len(config.Syncer.ProtoImportPaths) > 0 {
+		snetSyncer.ImportResolver = &protocompile.SourceResolver{ImportPaths: config.Syncer.ProtoImportPaths}
+	}
+	var registry *prometheus.Registry
+	if config.App.MetricsEnabled {
+		registry = prometheus.NewRegistry()
+		if err := snetSyncer.SetMetricsRegisterer(registry); err != nil {
+			log.Error().Err(err).Msg("Failed to register sync metrics")
+		}
+	}
 	grpcManager := grpc_manager.NewGRPCClientManager()
-	app := App{DB: database, Fiber: server.New(database), MatrixClient: matrix.New(database, snetSyncer, grpcManager, eth), IPFSClient: ipfsClient, Ethereum: eth, Syncer: snetSyncer, GRPCManager: grpcManager}
+	grpcManager.IdleTimeout = config.App.GRPCIdleTimeout
+	if err := grpcManager.SetTransport(grpc_manager.TransportConfig{Insecure: config.App.GRPCInsecure, CAFile: config.App.GRPCCAFile}); err != nil {
+		log.Error().Err(err).Msg("Failed to configure gRPC transport, using the system roots")
+	}
+	app := App{DB: database, Fiber: server.New(database, snetSyncer), MatrixClient: matrix.New(database, snetSyncer, grpcManager, eth), IPFSClient: ipfsClient, Ethereum: eth, Syncer: snetSyncer, GRPCManager: grpcManager}
 
-	app.Syncer.DB = app.DB
-	app.Syncer.Ethereum = app.Ethereum
-	app.Syncer.IPFSClient = app.IPFSClient
+	if registry != nil {
+		app.Fiber.RegisterMetrics(registry)
+	}
 
 	return app
 }
@@ -52,7 +114,15 @@ func (app App) Run() {
 		return
 	}
 
-	go app.Syncer.Start()
+	go app.Syncer.Start(context.Background())
+
+	if config.Syncer.AdminAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(config.Syncer.AdminAddr, app.Syncer.AdminHandler(context.Background())); err != nil {
+				log.Error().Err(err).Msg("Sync admin server stopped")
+			}
+		}()
+	}
 
 	go func() {
 		ticker := time.NewTicker(3 * time.Minute)
@@ -4,14 +4,19 @@ import (
 	"github.com/caarlos0/env/v10"
 	"github.com/joho/godotenv"
 	"log"
+	"time"
 )
 
 var (
-	Postgres   PostgresConfig
-	App        AppConfig
-	Matrix     MatrixConfig
-	Blockchain BlockchainConfig
-	IPFS       IPFSConfig
+	Postgres     PostgresConfig
+	App          AppConfig
+	Matrix       MatrixConfig
+	Blockchain   BlockchainConfig
+	IPFS         IPFSConfig
+	Syncer       SyncerConfig
+	RateLimit    RateLimitConfig
+	Output       OutputConfig
+	MetadataHTTP MetadataHTTPConfig
 )
 
 type PostgresConfig struct {
@@ -21,11 +26,118 @@ type PostgresConfig struct {
 type AppConfig struct {
 	Port         string `env:"PORT" envDefault:"3000"`
 	IsProduction bool   `env:"PRODUCTION"`
+	// GRPCProxyAddr enables the gRPC reflection proxy for synced services, e.g. GRPC_PROXY_ADDR=":50051"
+	GRPCProxyAddr string `env:"GRPC_PROXY_ADDR"`
+	// GRPCProxyToken is required from proxy clients as the "authorization: Bearer <token>" metadata
+	GRPCProxyToken string `env:"GRPC_PROXY_TOKEN"`
+	// GRPCProxyAllowedPeers are the only IPs or networks the proxy accepts calls from,
+	// e.g. GRPC_PROXY_ALLOWED_PEERS="127.0.0.1,10.0.0.0/8". The proxy isn't started without a token or allowed peers.
+	GRPCProxyAllowedPeers []string `env:"GRPC_PROXY_ALLOWED_PEERS"`
+	// MetricsEnabled serves Prometheus metrics of the sync on GET /metrics
+	MetricsEnabled bool `env:"METRICS_ENABLED"`
+	// GRPCIdleTimeout closes connections to service daemons unused for this long
+	GRPCIdleTimeout time.Duration `env:"GRPC_IDLE_TIMEOUT" envDefault:"10m"`
+	// GRPCCallTimeout bounds each call to a service method
+	GRPCCallTimeout time.Duration `env:"GRPC_CALL_TIMEOUT" envDefault:"30s"`
+	// GRPCInsecure dials daemon endpoints without a scheme in plaintext, https:// endpoints are refused then
+	GRPCInsecure bool `env:"GRPC_INSECURE"`
+	// GRPCCAFile is a PEM bundle trusted for daemon TLS instead of the system roots
+	GRPCCAFile string `env:"GRPC_CA_FILE"`
 }
 
 type IPFSConfig struct {
 	IPFSProviderURL string `env:"IPFS_PROVIDER_URL"`
-	Timeout         string `env:"IPFS_TIMEOUT"`
+	// MirrorDir serves IPFS content from files named after their CID in this directory instead of
+	// the gateways, e.g. IPFS_MIRROR_DIR="/var/lib/ipfs-mirror"
+	MirrorDir string `env:"IPFS_MIRROR_DIR"`
+	// FallbackURLs are gateways tried in order when IPFS_PROVIDER_URL fails,
+	// e.g. IPFS_FALLBACK_URLS="http://ipfs-2.example.org:5001,http://127.0.0.1:5001"
+	FallbackURLs []string `env:"IPFS_FALLBACK_URLS"`
+	Timeout      string   `env:"IPFS_TIMEOUT"`
+	// RequestTimeout bounds each fetch from a gateway, 0 disables the timeout
+	RequestTimeout time.Duration `env:"IPFS_REQUEST_TIMEOUT" envDefault:"30s"`
+	// MaxConcurrentFetches bounds the requests to the gateways in flight at once, 0 means no limit
+	MaxConcurrentFetches int `env:"IPFS_MAX_CONCURRENT_FETCHES" envDefault:"8"`
+	// OrgGateways maps an org snet id to a gateway tried first for that org's content,
+	// e.g. IPFS_ORG_GATEWAYS="snet=http://ipfs.example.org:80,other-org=http://127.0.0.1:5001"
+	OrgGateways map[string]string `env:"IPFS_ORG_GATEWAYS" envKeyValSeparator:"="`
+	// CacheMaxBytes bounds the in-memory cache of fetched files by CID, 0 disables it.
+	// IPFS content is immutable, so entries only expire after CacheTTL when it is set.
+	CacheMaxBytes int64         `env:"IPFS_CACHE_MAX_BYTES" envDefault:"67108864"`
+	CacheTTL      time.Duration `env:"IPFS_CACHE_TTL"`
+	// MaxFileSize caps fetched files, archive limits cap what model archives extract to; 0 means no limit
+	MaxFileSize     int64 `env:"IPFS_MAX_FILE_BYTES" envDefault:"16777216"`
+	ArchiveMaxBytes int64 `env:"IPFS_ARCHIVE_MAX_BYTES" envDefault:"33554432"`
+	ArchiveMaxFiles int   `env:"IPFS_ARCHIVE_MAX_FILES" envDefault:"1000"`
+}
+
+// MetadataHTTPConfig limits fetches of metadata published on HTTP(S) URLs.
+// Requests to BlockedCIDRs (private and local ranges by default) are refused unless the IP is in AllowedCIDRs.
+type MetadataHTTPConfig struct {
+	Timeout        time.Duration `env:"METADATA_HTTP_TIMEOUT" envDefault:"10s"`
+	MaxSize        int64         `env:"METADATA_HTTP_MAX_BYTES" envDefault:"10485760"`
+	AllowedSchemes []string      `env:"METADATA_HTTP_ALLOWED_SCHEMES" envDefault:"https,http"`
+	AllowedHosts   []string      `env:"METADATA_HTTP_ALLOWED_HOSTS"`
+	AllowedCIDRs   []string      `env:"METADATA_HTTP_ALLOWED_CIDRS"`
+	BlockedCIDRs   []string      `env:"METADATA_HTTP_BLOCKED_CIDRS" envDefault:"0.0.0.0/8,10.0.0.0/8,100.64.0.0/10,127.0.0.0/8,169.254.0.0/16,172.16.0.0/12,192.168.0.0/16,::1/128,fc00::/7,fe80::/10"`
+}
+
+type SyncerConfig struct {
+	Interval time.Duration `env:"SYNC_INTERVAL" envDefault:"1h"`
+	// Concurrency is the number of orgs, and of services per org, synced at once
+	Concurrency int `env:"SYNC_CONCURRENCY" envDefault:"4"`
+	// OrgPageSize is the number of orgs synced at a time, 0 syncs the whole registry at once
+	OrgPageSize int `env:"SYNC_ORG_PAGE_SIZE"`
+	// IncludeOrgs and ExcludeOrgs filter the orgs synced by snet id, an empty include list means all of them
+	IncludeOrgs []string `env:"SYNC_INCLUDE_ORGS"`
+	ExcludeOrgs []string `env:"SYNC_EXCLUDE_ORGS"`
+	// ForceFullSync re-syncs services whose metadata didn't change since the last sync
+	ForceFullSync bool `env:"SYNC_FORCE_FULL"`
+	// IPFS fetches are retried with exponential backoff and jitter
+	IPFSMaxAttempts     int           `env:"SYNC_IPFS_MAX_ATTEMPTS" envDefault:"3"`
+	IPFSRetryBackoff    time.Duration `env:"SYNC_IPFS_RETRY_BACKOFF" envDefault:"500ms"`
+	IPFSMaxBackoff      time.Duration `env:"SYNC_IPFS_MAX_BACKOFF" envDefault:"10s"`
+	LenientProtoCompile bool          `env:"SYNC_LENIENT_PROTO_COMPILE"`
+	MergeDuplicates     bool          `env:"SYNC_MERGE_DUPLICATE_SERVICES"`
+	// LazyProtoCompile compiles the protos of a service on first access instead of during the sync
+	LazyProtoCompile bool `env:"SYNC_LAZY_PROTO_COMPILE"`
+	// DryRun syncs without writing to the DB and logs the writes it skipped
+	DryRun bool `env:"SYNC_DRY_RUN"`
+	// CompileConcurrency bounds concurrent proto compilations (CPU-bound) separately from
+	// network fetches (IO-bound), 0 means GOMAXPROCS
+	CompileConcurrency int `env:"SYNC_COMPILE_CONCURRENCY"`
+	// RPCMinConcurrency and RPCMaxConcurrency bound the in-flight Ethereum RPC calls,
+	// the limit backs off between them when the provider rate limits the sync
+	RPCMinConcurrency int `env:"SYNC_RPC_MIN_CONCURRENCY" envDefault:"1"`
+	RPCMaxConcurrency int `env:"SYNC_RPC_MAX_CONCURRENCY" envDefault:"8"`
+	// RPCBreakerThreshold consecutive transient RPC failures pause the calls for RPCBreakerCooldown, 0 disables it
+	RPCBreakerThreshold int           `env:"SYNC_RPC_BREAKER_THRESHOLD" envDefault:"5"`
+	RPCBreakerCooldown  time.Duration `env:"SYNC_RPC_BREAKER_COOLDOWN" envDefault:"30s"`
+	// SelfTestSampleSize is the number of services checked by the !selftest command, 0 means all
+	SelfTestSampleSize int  `env:"SELFTEST_SAMPLE_SIZE" envDefault:"3"`
+	SelfTestLive       bool `env:"SELFTEST_LIVE"` // also open a gRPC connection to each daemon
+	// HealthCheckInterval is how often service endpoints are dialed, 0 disables the checks
+	HealthCheckInterval time.Duration `env:"HEALTH_CHECK_INTERVAL" envDefault:"5m"`
+	// HealthCheckConcurrency is the number of endpoints dialed at once by the health checks
+	HealthCheckConcurrency int `env:"HEALTH_CHECK_CONCURRENCY" envDefault:"8"`
+	// InvokableOnly hides services with an unreachable endpoint from the services info
+	InvokableOnly bool `env:"CATALOG_INVOKABLE_ONLY"`
+	// PruneHardDelete deletes orgs and services removed from the registry instead of soft-deleting them
+	PruneHardDelete bool `env:"SYNC_PRUNE_HARD_DELETE"`
+	// ProtoImportPaths are directories of shared proto libraries that model bundles import without shipping
+	ProtoImportPaths []string `env:"SYNC_PROTO_IMPORT_PATHS"`
+	// LogLevel is the minimum level of the syncer logs, e.g. "warn", empty means the global level
+	LogLevel string `env:"SYNC_LOG_LEVEL"`
+	// AdminAddr enables the admin HTTP server of the syncer, e.g. SYNC_ADMIN_ADDR="127.0.0.1:8081"
+	AdminAddr string `env:"SYNC_ADMIN_ADDR"`
+}
+
+// OutputConfig controls how metadata-derived text is rendered in service listings
+type OutputConfig struct {
+	DescriptionMaxLength int  `env:"DESCRIPTION_MAX_LENGTH" envDefault:"300"`
+	DescriptionLinkify   bool `env:"DESCRIPTION_LINKIFY"`
+	// MessageMaxBytes splits long listings sent by the bot into messages of at most this many bytes
+	MessageMaxBytes int `env:"MATRIX_MESSAGE_MAX_BYTES" envDefault:"16384"`
 }
 
 type BlockchainConfig struct {
@@ -39,6 +151,16 @@ type MatrixConfig struct {
 	Servername    string `env:"SERVERNAME"`
 	Username      string `env:"BOT_USERNAME"`
 	Password      string `env:"BOT_PASSWORD"`
+	// Admins are matrix user ids not affected by rate limits, e.g. BOT_ADMINS="@alice:matrix.org,@bob:matrix.org"
+	Admins []string `env:"BOT_ADMINS"`
+}
+
+// RateLimitConfig limits service calls per matrix user and per room, a zero rate disables the limit
+type RateLimitConfig struct {
+	UserPerMinute float64 `env:"RATE_LIMIT_USER_PER_MINUTE" envDefault:"5"`
+	UserBurst     int     `env:"RATE_LIMIT_USER_BURST" envDefault:"3"`
+	RoomPerMinute float64 `env:"RATE_LIMIT_ROOM_PER_MINUTE" envDefault:"20"`
+	RoomBurst     int     `env:"RATE_LIMIT_ROOM_BURST" envDefault:"10"`
 }
 
 func Init() {
@@ -67,4 +189,20 @@ func Init() {
 	if err := env.Parse(&IPFS); err != nil {
 		log.Printf("%+v\n", err)
 	}
+
+	if err := env.Parse(&Syncer); err != nil {
+		log.Printf("%+v\n", err)
+	}
+
+	if err := env.Parse(&RateLimit); err != nil {
+		log.Printf("%+v\n", err)
+	}
+
+	if err := env.Parse(&Output); err != nil {
+		log.Printf("%+v\n", err)
+	}
+
+	if err := env.Parse(&MetadataHTTP); err != nil {
+		log.Printf("%+v\n", err)
+	}
 }
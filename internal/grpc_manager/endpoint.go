@@ -0,0 +1,82 @@
+package grpc_manager
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidEndpoint is returned for service endpoints that can't be dialed
+var ErrInvalidEndpoint = errors.New("invalid endpoint")
+
+// Endpoint is the canonical form of a daemon endpoint of a service
+type Endpoint struct {
+	Address string // host:port, the host lowercased
+	// Scheme is "https", "http", or empty when the metadata gave none, in which case TLS is used
+	// unless the transport is configured otherwise
+	Scheme string
+}
+
+// Secure reports whether the endpoint is dialed with TLS by default
+func (e Endpoint) Secure() bool {
+	return e.Scheme != "http"
+}
+
+// String returns the endpoint as stored: scheme://host:port, or host:port when it has no scheme
+func (e Endpoint) String() string {
+	if e.Scheme == "" {
+		return e.Address
+	}
+	return e.Scheme + "://" + e.Address
+}
+
+// ParseEndpoint validates an endpoint from service metadata and returns its canonical form. Spaces and
+// a trailing slash are trimmed, and the default port of the scheme is added when there is none.
+// Endpoints with another scheme, a path, a query, credentials, no host or an invalid port are rejected
+// with ErrInvalidEndpoint. Endpoints without a scheme must have a port.
+func ParseEndpoint(raw string) (Endpoint, error) {
+	trimmed := strings.TrimRight(strings.TrimSpace(raw), "/")
+	if trimmed == "" {
+		return Endpoint{}, fmt.Errorf("%w: empty", ErrInvalidEndpoint)
+	}
+	scheme, _, hasScheme := strings.Cut(trimmed, "://")
+	scheme = strings.ToLower(scheme)
+	if !hasScheme {
+		// parsed as a URL without a scheme, so "host:port" isn't read as a scheme and an opaque part
+		scheme, trimmed = "", "//"+trimmed
+	} else if scheme != "http" && scheme != "https" {
+		return Endpoint{}, fmt.Errorf("%w: unsupported scheme %q in %q", ErrInvalidEndpoint, scheme, raw)
+	}
+	u, err := url.Parse(trimmed)
+	if err != nil {
+		return Endpoint{}, fmt.Errorf("%w: %q: %w", ErrInvalidEndpoint, raw, err)
+	}
+	switch {
+	case u.Hostname() == "":
+		return Endpoint{}, fmt.Errorf("%w: %q has no host", ErrInvalidEndpoint, raw)
+	case u.User != nil:
+		return Endpoint{}, fmt.Errorf("%w: %q has credentials", ErrInvalidEndpoint, raw)
+	case u.Path != "" || u.RawQuery != "" || u.Fragment != "":
+		return Endpoint{}, fmt.Errorf("%w: %q has a path or query, gRPC expects host:port", ErrInvalidEndpoint, raw)
+	}
+
+	port := u.Port()
+	switch {
+	case port != "":
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return Endpoint{}, fmt.Errorf("%w: %q has an invalid port", ErrInvalidEndpoint, raw)
+		}
+	case strings.HasSuffix(u.Host, ":"):
+		return Endpoint{}, fmt.Errorf("%w: %q has an empty port", ErrInvalidEndpoint, raw)
+	case scheme == "https":
+		port = "443"
+	case scheme == "http":
+		port = "80"
+	default:
+		return Endpoint{}, fmt.Errorf("%w: %q has neither a scheme nor a port", ErrInvalidEndpoint, raw)
+	}
+	return Endpoint{Address: net.JoinHostPort(strings.ToLower(u.Hostname()), port), Scheme: scheme}, nil
+}
@@ -2,25 +2,95 @@ package grpc_manager
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"os"
 	"sync"
 	"time"
 )
 
-// GRPCClientManager manages a pool of GRPCService connections.
+// DefaultIdleTimeout is how long a connection may go unused before the manager closes it
+const DefaultIdleTimeout = 10 * time.Minute
+
+// GRPCClientManager manages a pool of GRPCService connections, one per target. Connections are
+// dialed on first use, shared by concurrent callers and closed after IdleTimeout without a call in
+// progress.
 type GRPCClientManager struct {
-	clients map[string]*GRPCService
+	clients map[string]*GRPCService // key: dialed address and whether TLS is used, see dialTarget
 	mu      sync.Mutex
+	creds   credentials.TransportCredentials // TLS credentials, system roots unless SetTransport sets a CA
+	plain   bool                             // Insecure of the transport config
+	// IdleTimeout overrides DefaultIdleTimeout, it must be set before the first GetClient
+	IdleTimeout time.Duration
+	evictOnce   sync.Once
+	done        chan struct{}
+	closed      bool
 }
 
 // NewGRPCClientManager creates a new GRPCClientManager.
 func NewGRPCClientManager() *GRPCClientManager {
 	return &GRPCClientManager{
 		clients: make(map[string]*GRPCService),
+		creds:   credentials.NewClientTLSFromCert(nil, ""),
+		done:    make(chan struct{}),
+	}
+}
+
+// TransportConfig selects how connections are secured. Endpoints with an http:// scheme are always
+// dialed in plaintext, https:// endpoints always use TLS, the config decides for the others.
+type TransportConfig struct {
+	Insecure bool   // dial endpoints without a scheme in plaintext, for local daemons
+	CAFile   string // PEM bundle trusted instead of the system roots
+}
+
+// ErrInsecureTLSEndpoint is returned for https endpoints while the transport is configured as insecure
+var ErrInsecureTLSEndpoint = errors.New("https endpoint can't be dialed with insecure transport")
+
+// SetTransport configures the credentials of new connections, connections already open are kept
+func (manager *GRPCClientManager) SetTransport(config TransportConfig) error {
+	creds := credentials.NewClientTLSFromCert(nil, "")
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return fmt.Errorf("read CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates in CA file %s", config.CAFile)
+		}
+		creds = credentials.NewTLS(&tls.Config{RootCAs: roots})
+	}
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.creds = creds
+	manager.plain = config.Insecure
+	return nil
+}
+
+// dialTarget returns the address to dial for an endpoint and whether TLS is used, see ParseEndpoint
+func (manager *GRPCClientManager) dialTarget(endpoint string) (address string, secure bool, err error) {
+	parsed, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return "", false, err
+	}
+	switch parsed.Scheme {
+	case "https":
+		if manager.plain {
+			return "", false, fmt.Errorf("%w: %s", ErrInsecureTLSEndpoint, endpoint)
+		}
+		return parsed.Address, true, nil
+	case "http":
+		return parsed.Address, false, nil
+	default:
+		return parsed.Address, !manager.plain, nil
 	}
 }
 
@@ -28,25 +98,50 @@ type GRPCService struct {
 	Target      string
 	DialOptions grpc.DialOption
 	Conn        *grpc.ClientConn
+	lastUsed    time.Time // guarded by the manager's mutex, as inFlight
+	inFlight    int       // calls and streams in progress on the connection
 }
 
-// GetClient provides a managed connection to a gRPC service.
-func (manager *GRPCClientManager) GetClient(target string) (*GRPCService, error) {
+// ErrManagerClosed is returned by GetClient after Close
+var ErrManagerClosed = errors.New("grpc client manager is closed")
+
+// GetClient provides a managed connection to a gRPC service. The endpoint is a daemon URL such as
+// "https://example.org:7000", or an address without a scheme, see TransportConfig.
+func (manager *GRPCClientManager) GetClient(endpoint string) (*GRPCService, error) {
+	manager.evictOnce.Do(func() { go manager.evictIdle() })
+
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
+	if manager.closed {
+		return nil, ErrManagerClosed
+	}
+	address, secure, err := manager.dialTarget(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	target := address
+	if secure {
+		target = "tls " + address
+	}
 
 	if client, exists := manager.clients[target]; exists {
-		// Check if connection is still alive
-		if client.Conn.GetState() == connectivity.Ready {
+		// an idle or reconnecting connection is still usable, gRPC reconnects it on the next call
+		if client.Conn.GetState() != connectivity.Shutdown {
+			client.lastUsed = time.Now()
 			return client, nil
 		}
-		// Close and delete stale connection
-		client.Close()
 		delete(manager.clients, target)
 	}
 
 	// Create new client if not existing or deleted
-	newClient, err := NewGRPCService(target)
+	creds := insecure.NewCredentials()
+	if secure {
+		creds = manager.creds
+	}
+	newClient := &GRPCService{Target: address, DialOptions: grpc.WithTransportCredentials(creds), lastUsed: time.Now()}
+	newClient.Conn, err = grpc.Dial(address, newClient.DialOptions,
+		grpc.WithChainUnaryInterceptor(manager.trackUnary(newClient)),
+		grpc.WithChainStreamInterceptor(manager.trackStream(newClient)))
 	if err != nil {
 		return nil, err
 	}
@@ -54,9 +149,116 @@ func (manager *GRPCClientManager) GetClient(target string) (*GRPCService, error)
 	return newClient, nil
 }
 
-// NewGRPCService creates and returns a new GRPCService.
+// startCall counts a call in progress on the client, the returned func ends it and may be called
+// several times
+func (manager *GRPCClientManager) startCall(client *GRPCService) func() {
+	manager.mu.Lock()
+	client.inFlight++
+	manager.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			manager.mu.Lock()
+			client.inFlight--
+			client.lastUsed = time.Now()
+			manager.mu.Unlock()
+		})
+	}
+}
+
+// trackUnary counts the unary calls in progress on the client
+func (manager *GRPCClientManager) trackUnary(client *GRPCService) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		defer manager.startCall(client)()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// trackStream counts the streams in progress on the client, a stream ends when receiving from it fails,
+// including with io.EOF at its end, or when its ctx is done
+func (manager *GRPCClientManager) trackStream(client *GRPCService) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		done := manager.startCall(client)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			done()
+			return nil, err
+		}
+		stop := context.AfterFunc(ctx, done)
+		return &trackedStream{ClientStream: stream, done: func() { stop(); done() }}, nil
+	}
+}
+
+// trackedStream ends its call once receiving fails
+type trackedStream struct {
+	grpc.ClientStream
+	done func()
+}
+
+func (s *trackedStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.done()
+	}
+	return err
+}
+
+func (manager *GRPCClientManager) idleTimeout() time.Duration {
+	if manager.IdleTimeout > 0 {
+		return manager.IdleTimeout
+	}
+	return DefaultIdleTimeout
+}
+
+// evictIdle closes the idle connections, see closeIdle, until the manager is closed
+func (manager *GRPCClientManager) evictIdle() {
+	idle := manager.idleTimeout()
+	ticker := time.NewTicker(max(idle/2, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-manager.done:
+			return
+		case <-ticker.C:
+		}
+		manager.closeIdle(idle)
+	}
+}
+
+// closeIdle closes the connections without a call in progress whose last call ended longer than idle ago
+func (manager *GRPCClientManager) closeIdle(idle time.Duration) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	for target, client := range manager.clients {
+		if client.inFlight == 0 && time.Since(client.lastUsed) > idle {
+			log.Debug().Str("target", target).Msg("Closing idle gRPC connection")
+			client.Close()
+			delete(manager.clients, target)
+		}
+	}
+}
+
+// Close closes all connections, later GetClient calls fail with ErrManagerClosed
+func (manager *GRPCClientManager) Close() {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if manager.closed {
+		return
+	}
+	manager.closed = true
+	close(manager.done)
+	for target, client := range manager.clients {
+		client.Close()
+		delete(manager.clients, target)
+	}
+}
+
+// NewGRPCService creates and returns a new GRPCService dialed in plaintext.
 func NewGRPCService(target string) (*GRPCService, error) {
-	dialOptions := grpc.WithTransportCredentials(insecure.NewCredentials())
+	return dialGRPCService(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
+
+func dialGRPCService(target string, dialOptions grpc.DialOption) (*GRPCService, error) {
 	conn, err := grpc.Dial(target, dialOptions)
 	if err != nil {
 		return nil, err
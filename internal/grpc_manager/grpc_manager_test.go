@@ -0,0 +1,113 @@
+package grpc_manager
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// streamingDaemon answers every stream once release is closed, it returns its endpoint
+func streamingDaemon(t *testing.T, release <-chan struct{}) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+			return err
+		}
+		select {
+		case <-release:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+		return stream.SendMsg(&emptypb.Empty{})
+	}))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return "http://" + listener.Addr().String()
+}
+
+func (manager *GRPCClientManager) pooled() int {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	return len(manager.clients)
+}
+
+func openStream(t *testing.T, ctx context.Context, client *GRPCService) grpc.ClientStream {
+	t.Helper()
+	stream, err := client.Conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/echo.Echo/Watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendMsg(&emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+func TestCloseIdleKeepsConnectionsInUse(t *testing.T) {
+	release := make(chan struct{})
+	endpoint := streamingDaemon(t, release)
+	manager := NewGRPCClientManager()
+	defer manager.Close()
+	client, err := manager.GetClient(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream := openStream(t, context.Background(), client)
+	time.Sleep(time.Millisecond)
+	manager.closeIdle(0)
+	if manager.pooled() != 1 {
+		t.Fatal("connection with a stream in progress closed as idle")
+	}
+
+	close(release)
+	if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.RecvMsg(&emptypb.Empty{}); !errors.Is(err, io.EOF) {
+		t.Fatalf("stream ends with %v, want io.EOF", err)
+	}
+	time.Sleep(time.Millisecond)
+	manager.closeIdle(time.Minute)
+	if manager.pooled() != 1 {
+		t.Fatal("connection closed right after its last stream ended, want the idle time to start then")
+	}
+	manager.closeIdle(0)
+	if manager.pooled() != 0 {
+		t.Fatal("idle connection kept once its stream ended")
+	}
+}
+
+func TestCanceledStreamEndsItsCall(t *testing.T) {
+	endpoint := streamingDaemon(t, make(chan struct{}))
+	manager := NewGRPCClientManager()
+	defer manager.Close()
+	client, err := manager.GetClient(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stream is abandoned without reading it to the end
+	ctx, cancel := context.WithCancel(context.Background())
+	openStream(t, ctx, client)
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for manager.closeIdle(0); manager.pooled() != 0; manager.closeIdle(0) {
+		if time.Now().After(deadline) {
+			t.Fatal("connection of a canceled stream kept in use")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"golang.org/x/net/html"
 	"matrix-ai-framework/internal/config"
 	"matrix-ai-framework/internal/grpc_manager"
+	"matrix-ai-framework/internal/sanitizer"
 	"matrix-ai-framework/internal/snet_syncer"
 	"matrix-ai-framework/pkg/blockchain"
 	"matrix-ai-framework/pkg/db"
@@ -40,12 +41,12 @@ type service struct {
 	Syncer      *mautrix.DefaultSyncer
 	startTime   time.Time
 	db          db.Service
-	snetSyncer  snet_syncer.SnetSyncer
+	snetSyncer  *snet_syncer.SnetSyncer
 	grpcManager *grpc_manager.GRPCClientManager
 	eth         blockchain.Ethereum
 }
 
-func New(db db.Service, snetSyncer snet_syncer.SnetSyncer, grpcManager *grpc_manager.GRPCClientManager, eth blockchain.Ethereum) Service {
+func New(db db.Service, snetSyncer *snet_syncer.SnetSyncer, grpcManager *grpc_manager.GRPCClientManager, eth blockchain.Ethereum) Service {
 	client, err := mautrix.NewClient(config.Matrix.HomeserverURL, "", "")
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to create Matrix client")
@@ -210,8 +211,9 @@ func ExtractTexts(formattedBody string) (originalText, replyText string, err err
 func (s *service) SendMessage(roomID id.RoomID, text string) (*mautrix.RespSendEvent, error) {
 
 	content := event.MessageEventContent{
-		MsgType:       event.MsgText,
-		Body:          text,
+		MsgType: event.MsgText,
+		// clients that don't render HTML show the body
+		Body:          sanitizer.PlainText(text),
 		Format:        event.FormatHTML,
 		FormattedBody: fmt.Sprintf("<p>%s</p>", text),
 	}
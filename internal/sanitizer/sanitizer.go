@@ -0,0 +1,188 @@
+package sanitizer
+
+import (
+	"golang.org/x/net/html"
+	"matrix-ai-framework/internal/config"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const ellipsis = "…"
+
+var (
+	urlRegexp        = regexp.MustCompile(`https?://[^\s<>"']+`)
+	whitespaceRegexp = regexp.MustCompile(`\s+`)
+)
+
+// Sanitizer cleans service and organization descriptions coming from untrusted metadata
+type Sanitizer struct {
+	MaxLength int  // max description length in runes, 0 means no limit
+	Linkify   bool // render http(s) URLs as links in HTML output
+}
+
+// New creates a Sanitizer from the output config
+func New() Sanitizer {
+	return Sanitizer{
+		MaxLength: config.Output.DescriptionMaxLength,
+		Linkify:   config.Output.DescriptionLinkify,
+	}
+}
+
+// Text strips markup, collapses whitespace and truncates the description.
+// The result is plain text, suitable for JSON, Markdown or further escaping.
+func (s Sanitizer) Text(description string) string {
+	text := whitespaceRegexp.ReplaceAllString(stripTags(description), " ")
+	return s.truncate(strings.TrimSpace(text))
+}
+
+// HTML returns the sanitized description escaped for embedding into HTML, with URLs turned into links if enabled
+func (s Sanitizer) HTML(description string) string {
+	text := s.Text(description)
+	if !s.Linkify {
+		return html.EscapeString(text)
+	}
+
+	var builder strings.Builder
+	last := 0
+	for _, loc := range urlRegexp.FindAllStringIndex(text, -1) {
+		builder.WriteString(html.EscapeString(text[last:loc[0]]))
+		link := html.EscapeString(text[loc[0]:loc[1]])
+		builder.WriteString(`<a href="` + link + `" rel="nofollow noopener">` + link + `</a>`)
+		last = loc[1]
+	}
+	builder.WriteString(html.EscapeString(text[last:]))
+	return builder.String()
+}
+
+func (s Sanitizer) truncate(text string) string {
+	if s.MaxLength <= 0 || utf8.RuneCountInString(text) <= s.MaxLength {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:s.MaxLength])) + ellipsis
+}
+
+// stripTags keeps only the text content of HTML markup, dropping scripts and styles
+func stripTags(description string) string {
+	var builder strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(description))
+	skip := false
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return builder.String()
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			skip = string(name) == "script" || string(name) == "style"
+			builder.WriteString(" ")
+		case html.EndTagToken, html.SelfClosingTagToken:
+			skip = false
+			builder.WriteString(" ")
+		case html.TextToken:
+			if !skip {
+				builder.Write(tokenizer.Text())
+			}
+		}
+	}
+}
+
+// plainList is a list being converted by PlainText
+type plainList struct {
+	ordered bool
+	items   int
+}
+
+// PlainText converts an HTML message to the plain text fallback of clients that don't render HTML:
+// tags are dropped, paragraphs and list items start new lines, list items are numbered or bulleted and
+// indented by nesting, and preformatted text keeps its layout.
+func PlainText(htmlText string) string {
+	var builder strings.Builder
+	var lists []plainList
+	pre := 0
+	lineStart := true
+	newline := func(depth int) {
+		builder.WriteString("\n" + strings.Repeat("  ", max(depth, 0)))
+		lineStart = true
+	}
+	tokenizer := html.NewTokenizer(strings.NewReader(htmlText))
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			return cleanLines(builder.String())
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			switch string(name) {
+			case "ol", "ul":
+				lists = append(lists, plainList{ordered: string(name) == "ol"})
+			case "li":
+				newline(len(lists) - 1)
+				if len(lists) == 0 {
+					builder.WriteString("- ")
+				} else if list := &lists[len(lists)-1]; list.ordered {
+					list.items++
+					builder.WriteString(strconv.Itoa(list.items) + ". ")
+				} else {
+					builder.WriteString("- ")
+				}
+			case "p", "div", "br", "tr", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote":
+				newline(len(lists))
+			case "pre":
+				newline(len(lists))
+				if tokenType == html.StartTagToken {
+					pre++
+				}
+			case "img":
+				for hasAttr {
+					var key, value []byte
+					key, value, hasAttr = tokenizer.TagAttr()
+					if string(key) == "alt" {
+						builder.WriteString(string(value))
+					}
+				}
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "ol", "ul":
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+			case "pre":
+				pre = max(pre-1, 0)
+				newline(len(lists))
+			case "p", "div", "tr", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote":
+				newline(len(lists))
+			}
+		case html.TextToken:
+			text := string(tokenizer.Text())
+			if pre > 0 {
+				builder.WriteString(strings.ReplaceAll(text, "\n", "\n"+strings.Repeat("  ", len(lists))))
+				lineStart = false
+				continue
+			}
+			text = whitespaceRegexp.ReplaceAllString(text, " ")
+			if lineStart {
+				text = strings.TrimLeft(text, " ")
+			}
+			if text != "" {
+				builder.WriteString(text)
+				lineStart = false
+			}
+		}
+	}
+}
+
+// cleanLines trims trailing spaces and drops empty lines
+func cleanLines(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimRight(line, " \t"); strings.TrimSpace(line) != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
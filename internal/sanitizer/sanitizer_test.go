@@ -0,0 +1,22 @@
+package sanitizer
+
+import "testing"
+
+func TestPlainText(t *testing.T) {
+	for _, test := range []struct {
+		html, want string
+	}{
+		{html: "plain", want: "plain"},
+		{html: "<p>first</p><p>second <em>line</em></p>", want: "first\nsecond line"},
+		{html: "<ol><li>one</li><li>two<ul><li>nested</li></ul></li></ol>", want: "1. one\n2. two\n  - nested"},
+		{html: "<p>a<br>b</p>", want: "a\nb"},
+		{html: "<pre><code>{\n    \"text\": string\n}</code></pre>", want: "{\n    \"text\": string\n}"},
+		{html: "<p>  spaced   out  </p>", want: "spaced out"},
+		{html: `<img src="x.png" alt="logo">`, want: "logo"},
+		{html: "<p>Tom &amp; Jerry &lt;3</p>", want: "Tom & Jerry <3"},
+	} {
+		if got := PlainText(test.html); got != test.want {
+			t.Errorf("PlainText(%q) = %q, want %q", test.html, got, test.want)
+		}
+	}
+}
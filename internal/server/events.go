@@ -0,0 +1,44 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// eventsKeepAlive is how often a comment is sent on idle event streams, so gone clients are noticed
+const eventsKeepAlive = 30 * time.Second
+
+// syncEventsHandler streams the sync events as server-sent events until the client disconnects
+func (s *FiberServer) syncEventsHandler(c fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+
+	events, unsubscribe := s.syncer.Subscribe()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+		keepAlive := time.NewTicker(eventsKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case event := <-events:
+				data, err := json.Marshal(event)
+				if err != nil {
+					log.Error().Err(err).Msg("Failed to marshal sync event")
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			case <-keepAlive.C:
+				w.WriteString(": keep-alive\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
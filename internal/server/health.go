@@ -1,7 +1,53 @@
 package server
 
-import "github.com/gofiber/fiber/v3"
+import (
+	"github.com/gofiber/fiber/v3"
+	"strconv"
+	"time"
+)
 
 func (s *FiberServer) healthHandler(c fiber.Ctx) error {
-	return c.JSON(s.db.Health())
+	health := s.db.Health(c.UserContext())
+	result, ok := s.syncer.LastSyncResult()
+	switch {
+	case !ok:
+		health["sync_status"] = "pending"
+	case result.Err != nil:
+		health["sync_status"] = "failed"
+		health["sync_error"] = result.Err.Error()
+	default:
+		health["sync_status"] = "ok"
+	}
+	if ok {
+		health["sync_finished_at"] = result.FinishedAt.UTC().Format(time.RFC3339)
+	}
+	stats := s.syncer.IPFSClient.CacheStats()
+	health["ipfs_cache_hits"] = strconv.FormatUint(stats.Hits, 10)
+	health["ipfs_cache_misses"] = strconv.FormatUint(stats.Misses, 10)
+	return c.JSON(health)
+}
+
+// healthzHandler answers 503 when no sync went through the whole registry within two sync intervals,
+// including before the first sync finished
+func (s *FiberServer) healthzHandler(c fiber.Ctx) error {
+	status := s.syncer.SyncStatus()
+	body := map[string]any{
+		"running":     status.Running,
+		"orgs":        status.Orgs,
+		"services":    status.Services,
+		"failures":    status.Failures,
+		"rpc_breaker": status.RPCBreaker,
+	}
+	if !status.LastSuccessAt.IsZero() {
+		body["last_success_at"] = status.LastSuccessAt.UTC().Format(time.RFC3339)
+	}
+	if status.LastError != nil {
+		body["last_error"] = status.LastError.Error()
+	}
+	if !s.syncer.Healthy() {
+		body["status"] = "unhealthy"
+		return c.Status(fiber.StatusServiceUnavailable).JSON(body)
+	}
+	body["status"] = "ok"
+	return c.JSON(body)
 }
@@ -0,0 +1,12 @@
+package server
+
+import (
+	"github.com/gofiber/fiber/v3/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// RegisterMetrics serves the metrics of gatherer on GET /metrics
+func (s *FiberServer) RegisterMetrics(gatherer prometheus.Gatherer) {
+	s.App.Get("/metrics", adaptor.HTTPHandler(promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})))
+}
@@ -2,6 +2,13 @@ package server
 
 func (s *FiberServer) RegisterFiberRoutes() {
 	s.App.Get("/services", s.GetServices)
+	s.App.Get("/services/:snetID/bundle", s.GetServiceBundle)
+	s.App.Get("/services/:snetID/descriptor_set", s.GetDescriptorSet)
+	s.App.Get("/services/:snetID/typescript/:service", s.GetServiceTypeScript)
+	s.App.Get("/catalog", s.GetCatalog)
 	s.App.Get("/orgs", s.GetOrgs)
+	s.App.Get("/orgs/:orgID/groups", s.GetOrgGroups)
 	s.App.Get("/health", s.healthHandler)
+	s.App.Get("/healthz", s.healthzHandler)
+	s.App.Get("/sync/events", s.syncEventsHandler)
 }
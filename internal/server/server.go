@@ -2,18 +2,24 @@ package server
 
 import (
 	"github.com/gofiber/fiber/v3"
+	"matrix-ai-framework/internal/sanitizer"
+	"matrix-ai-framework/internal/snet_syncer"
 	"matrix-ai-framework/pkg/db"
 )
 
 type FiberServer struct {
 	*fiber.App
-	db db.Service
+	db        db.Service
+	syncer    *snet_syncer.SnetSyncer
+	sanitizer sanitizer.Sanitizer
 }
 
-func New(db db.Service) *FiberServer {
+func New(db db.Service, syncer *snet_syncer.SnetSyncer) *FiberServer {
 	server := &FiberServer{
-		App: fiber.New(),
-		db:  db,
+		App:       fiber.New(),
+		db:        db,
+		syncer:    syncer,
+		sanitizer: sanitizer.New(),
 	}
 
 	return server
@@ -1,22 +1,113 @@
 package server
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v3"
 	"github.com/rs/zerolog/log"
+	"matrix-ai-framework/internal/snet_syncer"
+	"matrix-ai-framework/pkg/db"
 )
 
+// serviceResponse is a service with the last health check of its endpoint
+type serviceResponse struct {
+	db.SnetService
+	Health snet_syncer.EndpointHealth `json:"health"`
+}
+
+// GetServices lists the services ordered by snet id, ?org=<org id> lists the services of an org only.
+// With ?invokable_only=true services that can't be called are left out.
 func (s *FiberServer) GetServices(c fiber.Ctx) error {
-	services, err := s.db.GetSnetServices()
+	services, err := s.db.ListSnetServices(c.UserContext(), c.Query("org"))
 	if err != nil {
 		log.Error().Err(err).Msg("Cannot get services")
 	}
-	return c.JSON(services)
+	invokableOnly := c.Query("invokable_only") == "true"
+	response := make([]serviceResponse, 0, len(services))
+	for _, service := range services {
+		if invokableOnly && !s.syncer.Invokable(service.SnetID) {
+			continue
+		}
+		service.Description = s.sanitizer.Text(service.Description)
+		service.ShortDescription = s.sanitizer.Text(service.ShortDescription)
+		response = append(response, serviceResponse{SnetService: service, Health: s.syncer.EndpointHealth(service.SnetID)})
+	}
+	return c.JSON(response)
 }
 
 func (s *FiberServer) GetOrgs(c fiber.Ctx) error {
-	orgs, err := s.db.GetSnetOrgs()
+	orgs, err := s.db.ListSnetOrgs(c.UserContext())
 	if err != nil {
 		log.Error().Err(err).Msg("Cannot get orgs")
 	}
+	for i := range orgs {
+		orgs[i].Description = s.sanitizer.Text(orgs[i].Description)
+		orgs[i].ShortDescription = s.sanitizer.Text(orgs[i].ShortDescription)
+	}
 	return c.JSON(orgs)
 }
+
+// GetOrgGroups returns the groups of an org, with the payment address calls to its services are paid to
+func (s *FiberServer) GetOrgGroups(c fiber.Ctx) error {
+	orgID := c.Params("orgID")
+	groups, err := s.db.GetOrgGroups(c.UserContext(), orgID)
+	if errors.Is(err, db.ErrNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		log.Error().Err(err).Str("org", orgID).Msg("Cannot get org groups")
+		return fiber.NewError(fiber.StatusInternalServerError, "can't get org groups")
+	}
+	return c.JSON(groups)
+}
+
+// GetServiceBundle returns the client stubs generation bundle of a service.
+// With ?format=binary only the raw FileDescriptorSet is returned, see GetDescriptorSet.
+func (s *FiberServer) GetServiceBundle(c fiber.Ctx) error {
+	if c.Query("format") == "binary" {
+		return s.GetDescriptorSet(c)
+	}
+	snetID := c.Params("snetID")
+	bundle, err := s.syncer.ExportServiceBundle(snetID)
+	if err != nil {
+		log.Error().Err(err).Str("snet-id", snetID).Msg("Cannot export service bundle")
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	return c.JSON(bundle)
+}
+
+// GetDescriptorSet returns the self-contained FileDescriptorSet of a service, ready for
+// `grpcurl -protoset` or `protoc --descriptor_set_in`
+func (s *FiberServer) GetDescriptorSet(c fiber.Ctx) error {
+	snetID := c.Params("snetID")
+	set, err := s.syncer.ExportDescriptorSet(snetID)
+	if err != nil {
+		log.Error().Err(err).Str("snet-id", snetID).Msg("Cannot export descriptor set")
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	c.Set(fiber.HeaderContentType, "application/octet-stream")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+snetID+`.pb"`)
+	return c.Send(set)
+}
+
+// GetServiceTypeScript returns TypeScript interfaces for the method inputs and outputs of a gRPC service
+func (s *FiberServer) GetServiceTypeScript(c fiber.Ctx) error {
+	snetID, service := c.Params("snetID"), c.Params("service")
+	types, err := s.syncer.ExportTypeScript(snetID, service)
+	if err != nil {
+		log.Error().Err(err).Str("snet-id", snetID).Str("service", service).Msg("Cannot export TypeScript types")
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	c.Set(fiber.HeaderContentType, "application/typescript; charset=utf-8")
+	return c.SendString(types)
+}
+
+// GetCatalog returns the synced services with their gRPC methods and typed input/output fields
+func (s *FiberServer) GetCatalog(c fiber.Ctx) error {
+	catalog, err := s.syncer.GetSnetServicesJSON()
+	if err != nil {
+		log.Error().Err(err).Msg("Cannot build services catalog")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(catalog)
+}
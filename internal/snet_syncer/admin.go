@@ -0,0 +1,86 @@
+package snet_syncer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// adminStatus is SyncStatus as served by the admin handler
+type adminStatus struct {
+	Running        bool         `json:"running"`
+	LastStartedAt  string       `json:"last_started_at,omitempty"`
+	LastFinishedAt string       `json:"last_finished_at,omitempty"`
+	LastSuccessAt  string       `json:"last_success_at,omitempty"`
+	LastError      string       `json:"last_error,omitempty"`
+	Orgs           int          `json:"orgs"`
+	Services       int          `json:"services"`
+	Unchanged      int          `json:"unchanged"`
+	Failures       int          `json:"failures"`
+	RPCBreaker     BreakerState `json:"rpc_breaker"`
+}
+
+// AdminHandler returns an HTTP handler to operate the syncer without restarts, it isn't served unless
+// an embedder mounts it:
+//   - POST /sync starts a sync in the background, bounded by ctx, and answers 202, or 409 while a sync pass or SyncService runs
+//   - GET /status returns the SyncStatus
+//   - GET /services returns the services, see GetSnetServicesJSON
+func (s *SnetSyncer) AdminHandler(ctx context.Context) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sync", func(w http.ResponseWriter, r *http.Request) {
+		// the run is claimed before answering, so of concurrent requests a single one starts a sync
+		if !s.syncMu.TryLock() {
+			writeAdminJSON(w, http.StatusConflict, map[string]string{"status": "running"})
+			return
+		}
+		go func() {
+			defer s.syncMu.Unlock()
+			// failures are logged and kept in the status
+			_ = s.syncLocked(ctx)
+		}()
+		writeAdminJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		status := s.SyncStatus()
+		body := adminStatus{
+			Running:        status.Running,
+			LastStartedAt:  formatAdminTime(status.LastStartedAt),
+			LastFinishedAt: formatAdminTime(status.LastFinishedAt),
+			LastSuccessAt:  formatAdminTime(status.LastSuccessAt),
+			Orgs:           status.Orgs,
+			Services:       status.Services,
+			Unchanged:      status.Unchanged,
+			Failures:       status.Failures,
+			RPCBreaker:     status.RPCBreaker,
+		}
+		if status.LastError != nil {
+			body.LastError = status.LastError.Error()
+		}
+		writeAdminJSON(w, http.StatusOK, body)
+	})
+	mux.HandleFunc("GET /services", func(w http.ResponseWriter, r *http.Request) {
+		services, err := s.GetSnetServicesJSON()
+		if err != nil {
+			s.log.Error().Err(err).Msg("Failed to marshal services")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(services)
+	})
+	return mux
+}
+
+func writeAdminJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func formatAdminTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,81 @@
+package snet_syncer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// blockingRegistry holds every listing of the orgs until release is closed, keeping a sync pass running
+type blockingRegistry struct {
+	Registry
+	listed  chan struct{}
+	release chan struct{}
+}
+
+func (r blockingRegistry) GetOrgs(ctx context.Context) ([][32]byte, error) {
+	r.listed <- struct{}{}
+	<-r.release
+	return r.Registry.GetOrgs(ctx)
+}
+
+func TestAdminSyncStartsOnePass(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1")
+	s := n.syncer()
+	registry := blockingRegistry{Registry: n.registry, listed: make(chan struct{}, 8), release: make(chan struct{})}
+	s.Ethereum = registry
+	handler := s.AdminHandler(context.Background())
+
+	// concurrent requests, only one of them starts a pass
+	const requests = 8
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/sync", nil))
+			codes <- recorder.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	accepted := 0
+	for code := range codes {
+		switch code {
+		case http.StatusAccepted:
+			accepted++
+		case http.StatusConflict:
+		default:
+			t.Fatalf("POST /sync answered %d, want 202 or 409", code)
+		}
+	}
+	if accepted != 1 {
+		t.Fatalf("%d requests started a sync, want 1", accepted)
+	}
+
+	<-registry.listed
+	close(registry.release)
+	// the next request waits for nothing but the pass started above
+	s.syncMu.Lock()
+	s.syncMu.Unlock()
+	if len(registry.listed) != 0 {
+		t.Fatalf("%d more passes listed the orgs, want only the accepted one", len(registry.listed))
+	}
+	if got := n.storedServices(); len(got) != 1 || got[0] != "svc1" {
+		t.Fatalf("stored services %v, want the pass to have synced svc1", got)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/sync", nil))
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("POST /sync after the pass answered %d, want 202", recorder.Code)
+	}
+	<-registry.listed
+	s.syncMu.Lock()
+	s.syncMu.Unlock()
+}
@@ -0,0 +1,186 @@
+package snet_syncer
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRPCMinConcurrency = 1
+	defaultRPCMaxConcurrency = 8
+	rpcMaxAttempts           = 5
+	rpcRetryBaseDelay        = 500 * time.Millisecond
+	// rpcDecreaseCooldown keeps a burst of errors from calls started at the same limit from halving it several times
+	rpcDecreaseCooldown = time.Second
+	// rpcLimitExceededCode is returned by Infura and other providers when the request rate is too high
+	rpcLimitExceededCode = -32005
+)
+
+// AIMDLimiter bounds the number of in-flight RPC calls. The limit is halved when retryable errors
+// (rate limits, overloaded provider) come back and grows by one after a full window of successful calls,
+// staying within [min, max].
+type AIMDLimiter struct {
+	mu           sync.Mutex
+	min, max     int
+	limit        int
+	inFlight     int
+	successes    int
+	lastDecrease time.Time
+	changed      chan struct{} // closed and replaced whenever a slot is released
+	log          zerolog.Logger
+}
+
+// NewAIMDLimiter creates a limiter starting at the max concurrency
+func NewAIMDLimiter(min, max int) *AIMDLimiter {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	return &AIMDLimiter{min: min, max: max, limit: max, changed: make(chan struct{}), log: log.Logger}
+}
+
+// Acquire waits for a free slot
+func (l *AIMDLimiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Release frees a slot and adjusts the limit depending on whether the call hit a retryable error
+func (l *AIMDLimiter) Release(retryable bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+
+	switch {
+	case retryable:
+		l.successes = 0
+		if l.limit > l.min && time.Since(l.lastDecrease) >= rpcDecreaseCooldown {
+			previous := l.limit
+			l.limit = max(l.min, l.limit/2)
+			l.lastDecrease = time.Now()
+			l.log.Warn().Int("from", previous).Int("to", l.limit).Msg("RPC errors, decreasing sync concurrency")
+		}
+	case l.limit < l.max:
+		l.successes++
+		if l.successes >= l.limit {
+			l.successes = 0
+			l.limit++
+			l.log.Info().Int("from", l.limit-1).Int("to", l.limit).Msg("RPC recovered, increasing sync concurrency")
+		}
+	}
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Limit returns the current concurrency limit
+func (l *AIMDLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// SetRPCConcurrency sets the bounds the RPC concurrency adapts within
+func (s *SnetSyncer) SetRPCConcurrency(min, max int) {
+	if min <= 0 {
+		min = defaultRPCMinConcurrency
+	}
+	if max <= 0 {
+		max = defaultRPCMaxConcurrency
+	}
+	s.rpcLimiter = NewAIMDLimiter(min, max)
+	s.rpcLimiter.log = s.log
+}
+
+// callRPC runs an Ethereum RPC call within the concurrency limit and the circuit breaker, retrying with
+// exponential backoff while the call fails transiently. Calls are refused with ErrCircuitOpen while the
+// breaker is open.
+func (s *SnetSyncer) callRPC(ctx context.Context, call func() error) (err error) {
+	for attempt := 0; attempt < rpcMaxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return errors.Join(err, ctx.Err())
+			case <-time.After(rpcRetryBaseDelay << (attempt - 1)):
+			}
+		}
+		if openErr := s.rpcBreaker.Allow(); openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		if err := s.rpcLimiter.Acquire(ctx); err != nil {
+			s.rpcBreaker.Abort()
+			return err
+		}
+		err = call()
+		rateLimited := isRetryableRPCError(err)
+		s.rpcLimiter.Release(rateLimited)
+		switch {
+		case ctx.Err() != nil:
+			s.rpcBreaker.Abort()
+			return err
+		case rateLimited || isTransientRPCError(err):
+			s.rpcBreaker.Failure()
+		default:
+			// errors of the call itself, e.g. reverts, mean the node is fine
+			s.rpcBreaker.Success()
+			return err
+		}
+	}
+	return err
+}
+
+// isTransientRPCError reports whether the call failed because the node couldn't be reached or errored,
+// rather than because of the call itself
+func isTransientRPCError(err error) bool {
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// isRetryableRPCError reports whether the error means the provider is rate limiting or overloaded
+func isRetryableRPCError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode == http.StatusServiceUnavailable
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == rpcLimitExceededCode {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "rate limit") || strings.Contains(message, "too many requests") ||
+		strings.Contains(message, "limit exceeded")
+}
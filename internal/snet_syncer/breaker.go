@@ -0,0 +1,141 @@
+package snet_syncer
+
+import (
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRPCBreakerThreshold = 5
+	defaultRPCBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned for RPC calls refused while the circuit breaker is open
+var ErrCircuitOpen = errors.New("ethereum rpc circuit breaker is open")
+
+// BreakerState is the state of a CircuitBreaker
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // calls go through
+	BreakerOpen     BreakerState = "open"      // calls are refused until the cooldown elapsed
+	BreakerHalfOpen BreakerState = "half_open" // a single trial call decides whether to close again
+)
+
+// CircuitBreaker stops calling a struggling Ethereum node: it opens after threshold consecutive
+// transient failures, refuses calls for the cooldown, then lets one trial call through and closes again
+// when it succeeds. A nil breaker never opens.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	trial     bool // the trial call of the half-open state is in flight
+	log       zerolog.Logger
+}
+
+// NewCircuitBreaker creates a closed breaker, a non-positive threshold returns nil which disables it
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown, state: BreakerClosed, log: log.Logger}
+}
+
+// Allow returns ErrCircuitOpen when the call must not be made, otherwise the outcome of the call
+// must be reported with Success, Failure or Abort
+func (b *CircuitBreaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.log.Info().Msg("RPC circuit breaker half-open, trying a call")
+	case BreakerHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+	default:
+		return nil
+	}
+	b.trial = true
+	return nil
+}
+
+// Success records a call that went through, which closes the breaker
+func (b *CircuitBreaker) Success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BreakerClosed {
+		b.log.Info().Msg("RPC circuit breaker closed, the node recovered")
+	}
+	b.state = BreakerClosed
+	b.failures = 0
+	b.trial = false
+}
+
+// Failure records a transient failure, opening the breaker after threshold of them in a row
+// or when the trial call failed
+func (b *CircuitBreaker) Failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		b.log.Warn().Int("failures", b.failures).Dur("cooldown", b.cooldown).Msg("RPC circuit breaker open, pausing calls")
+	}
+	b.trial = false
+}
+
+// Abort releases a call that says nothing about the node, e.g. one canceled by its context
+func (b *CircuitBreaker) Abort() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// State returns the state of the breaker, an open breaker whose cooldown elapsed is half-open
+func (b *CircuitBreaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// SetRPCBreaker sets the consecutive transient failures opening the RPC circuit breaker and how long it
+// stays open, a non-positive threshold disables the breaker
+func (s *SnetSyncer) SetRPCBreaker(threshold int, cooldown time.Duration) {
+	if cooldown <= 0 {
+		cooldown = defaultRPCBreakerCooldown
+	}
+	s.rpcBreaker = NewCircuitBreaker(threshold, cooldown)
+	if s.rpcBreaker != nil {
+		s.rpcBreaker.log = s.log
+	}
+}
@@ -0,0 +1,209 @@
+package snet_syncer
+
+import (
+	"context"
+	"encoding/json"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"sort"
+)
+
+// ServiceInfo describes the gRPC services compiled for a snet service
+type ServiceInfo struct {
+	SnetID      string            `json:"snet_id"`
+	OrgSnetID   string            `json:"org_snet_id"`
+	PriceInCogs int               `json:"price_in_cogs"` // of calls to methods without a price of their own
+	Services    []GRPCServiceInfo `json:"services"`
+}
+
+// GRPCServiceInfo describes a gRPC service and its methods
+type GRPCServiceInfo struct {
+	Name     string       `json:"name"`
+	FullName string       `json:"full_name"`
+	File     string       `json:"file"`
+	Methods  []MethodInfo `json:"methods"`
+}
+
+// MethodInfo describes a method with the types of its input and output. Service is the fully-qualified
+// name of the gRPC service, it is only set by GetServiceMethods. PriceInCogs is the price of a call,
+// see ServicePrice.
+type MethodInfo struct {
+	Service     string      `json:"service,omitempty"`
+	Name        string      `json:"name"`
+	PriceInCogs int         `json:"price_in_cogs"`
+	Streaming   string      `json:"streaming,omitempty"` // see StreamingKind, empty for unary methods
+	Input       MessageInfo `json:"input"`
+	Output      MessageInfo `json:"output"`
+	// Options are the custom options of the method, see methodOptions
+	Options []MethodOption `json:"options,omitempty"`
+}
+
+// Streaming kinds of methods
+const (
+	StreamingServer = "server"
+	StreamingClient = "client"
+	StreamingBidi   = "bidi"
+)
+
+// StreamingKind returns which sides of the method stream, "" for unary methods
+func StreamingKind(method protoreflect.MethodDescriptor) string {
+	switch {
+	case method.IsStreamingClient() && method.IsStreamingServer():
+		return StreamingBidi
+	case method.IsStreamingServer():
+		return StreamingServer
+	case method.IsStreamingClient():
+		return StreamingClient
+	}
+	return ""
+}
+
+// MessageInfo describes a message type. Fields is left empty for a message already being described
+// higher up in the tree (Recursive is set then), so self-referential messages don't recurse forever.
+type MessageInfo struct {
+	Name      string      `json:"name"`
+	Fields    []FieldInfo `json:"fields,omitempty"`
+	Recursive bool        `json:"recursive,omitempty"`
+}
+
+// FieldInfo describes a message field, Message is set for message-typed fields.
+// For map fields MapKey is the key kind, Type and Message then describe the map values.
+type FieldInfo struct {
+	Name     string       `json:"name"` // JSON name
+	Type     string       `json:"type"` // proto kind, e.g. "string", "message"
+	Repeated bool         `json:"repeated,omitempty"`
+	MapKey   string       `json:"map_key,omitempty"`
+	Message  *MessageInfo `json:"message,omitempty"`
+	// Oneof is the oneof the field belongs to, at most one of its fields is set
+	Oneof string `json:"oneof,omitempty"`
+	// Optional is set for fields with explicit presence (proto3 optional), which may be left out or null
+	Optional bool `json:"optional,omitempty"`
+	// Required is set for proto2 required fields, an input without them is refused
+	Required bool `json:"required,omitempty"`
+}
+
+// GetServiceMethods lists the methods of every gRPC service of a snet service, in declaration order.
+// It fails with ErrServiceNotFound or ErrDescriptorNotCompiled for services without descriptors.
+func (s *SnetSyncer) GetServiceMethods(snetID string) ([]MethodInfo, error) {
+	descriptors, err := s.GetServiceDescriptors(snetID)
+	if err != nil {
+		return nil, err
+	}
+	// unpriced when the service isn't stored, e.g. descriptors loaded before the DB was synced
+	service, serviceErr := s.DB.GetSnetService(context.Background(), snetID)
+	prices, err := s.DB.GetServiceMethodPrices(context.Background(), snetID)
+	if err != nil {
+		s.log.Error().Err(err).Str("snet-id", snetID).Msg("Failed to get method prices")
+	}
+	var methods []MethodInfo
+	for _, descriptor := range descriptors {
+		for _, grpcService := range describeServices(descriptor) {
+			for _, method := range grpcService.Methods {
+				method.Service = grpcService.FullName
+				if serviceErr == nil {
+					method.PriceInCogs = methodPrice(service, prices, grpcService.FullName+"/"+method.Name)
+				}
+				methods = append(methods, method)
+			}
+		}
+	}
+	return methods, nil
+}
+
+// GetSnetServicesJSON returns the synced services with their methods and typed input/output fields as JSON
+func (s *SnetSyncer) GetSnetServicesJSON() ([]byte, error) {
+	return json.Marshal(s.GetSnetServicesTree())
+}
+
+// GetSnetServicesTree describes every synced service, sorted by snet id
+func (s *SnetSyncer) GetSnetServicesTree() []ServiceInfo {
+	catalog := s.catalogServices()
+	descriptors := s.Descriptors()
+	snetIDs := make([]string, 0, len(descriptors))
+	for snetID := range descriptors {
+		snetIDs = append(snetIDs, snetID)
+	}
+	sort.Strings(snetIDs)
+
+	prices, err := s.DB.GetMethodPrices(context.Background())
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to get method prices")
+	}
+	infos := make([]ServiceInfo, 0, len(snetIDs))
+	for _, snetID := range snetIDs {
+		service := catalog[snetID]
+		info := ServiceInfo{SnetID: snetID, OrgSnetID: service.SnetOrgID, PriceInCogs: service.Price, Services: []GRPCServiceInfo{}}
+		for _, descriptor := range descriptors[snetID] {
+			info.Services = append(info.Services, describeServices(descriptor)...)
+		}
+		for _, grpcService := range info.Services {
+			for i := range grpcService.Methods {
+				grpcService.Methods[i].PriceInCogs = methodPrice(service, prices[snetID], grpcService.FullName+"/"+grpcService.Methods[i].Name)
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// describeServices describes the gRPC services declared in a file
+func describeServices(descriptor protoreflect.FileDescriptor) []GRPCServiceInfo {
+	var infos []GRPCServiceInfo
+	services := descriptor.Services()
+	for i := 0; i < services.Len(); i++ {
+		service := services.Get(i)
+		info := GRPCServiceInfo{
+			Name:     string(service.Name()),
+			FullName: string(service.FullName()),
+			File:     descriptor.Path(),
+			Methods:  []MethodInfo{},
+		}
+		methods := service.Methods()
+		for j := 0; j < methods.Len(); j++ {
+			method := methods.Get(j)
+			info.Methods = append(info.Methods, MethodInfo{
+				Name:      string(method.Name()),
+				Streaming: StreamingKind(method),
+				Input:     describeMessage(method.Input(), map[protoreflect.FullName]bool{}),
+				Output:    describeMessage(method.Output(), map[protoreflect.FullName]bool{}),
+				Options:   methodOptions(method),
+			})
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// describeMessage describes a message and, recursively, its message-typed fields.
+// visiting holds the messages on the current path, it guards against cycles.
+func describeMessage(message protoreflect.MessageDescriptor, visiting map[protoreflect.FullName]bool) MessageInfo {
+	info := MessageInfo{Name: string(message.FullName())}
+	if visiting[message.FullName()] {
+		info.Recursive = true
+		return info
+	}
+	visiting[message.FullName()] = true
+	defer delete(visiting, message.FullName())
+
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		fieldInfo := FieldInfo{Name: field.JSONName(), Repeated: field.IsList(), Required: field.Cardinality() == protoreflect.Required}
+		if oneof := field.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			fieldInfo.Oneof = string(oneof.Name())
+		} else {
+			fieldInfo.Optional = field.HasOptionalKeyword() && field.Syntax() == protoreflect.Proto3
+		}
+		value := field
+		if field.IsMap() {
+			fieldInfo.MapKey = field.MapKey().Kind().String()
+			value = field.MapValue()
+		}
+		fieldInfo.Type = value.Kind().String()
+		if value.Message() != nil {
+			nested := describeMessage(value.Message(), visiting)
+			fieldInfo.Message = &nested
+		}
+		info.Fields = append(info.Fields, fieldInfo)
+	}
+	return info
+}
@@ -0,0 +1,60 @@
+package snet_syncer
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+	"testing"
+)
+
+func TestDescribeMessageRepeatedAndMap(t *testing.T) {
+	fd := compileFile(t, map[string]string{"bag.proto": collectionsProto}, "bag.proto")
+	info := describeMessage(fd.Messages().ByName("Bag"), map[protoreflect.FullName]bool{})
+	if len(info.Fields) != 3 {
+		t.Fatalf("got %d fields, want 3", len(info.Fields))
+	}
+	tags, foos, names := info.Fields[0], info.Fields[1], info.Fields[2]
+	if tags.Type != "string" || !tags.Repeated || tags.MapKey != "" {
+		t.Errorf("tags described as %+v, want a repeated string", tags)
+	}
+	if foos.MapKey != "string" || foos.Type != "message" || foos.Repeated || foos.Message == nil || foos.Message.Name != "collections.Foo" {
+		t.Errorf("foos described as %+v, want a map of string to collections.Foo", foos)
+	}
+	if names.MapKey != "int32" || names.Type != "string" || names.Message != nil {
+		t.Errorf("names described as %+v, want a map of int32 to string", names)
+	}
+}
+
+func TestDescribeMessageOneofAndOptional(t *testing.T) {
+	fd := compileFile(t, map[string]string{"query.proto": presenceProto}, "query.proto")
+	info := describeMessage(fd.Messages().ByName("Query"), map[protoreflect.FullName]bool{})
+	want := []FieldInfo{
+		{Name: "text", Type: "string"},
+		{Name: "url", Type: "string", Oneof: "source"},
+		{Name: "image", Type: "bytes", Oneof: "source"},
+		{Name: "limit", Type: "int32", Optional: true},
+		{Name: "lang", Type: "string", Optional: true},
+	}
+	if len(info.Fields) != len(want) {
+		t.Fatalf("got %d fields, want %d", len(info.Fields), len(want))
+	}
+	for i, field := range info.Fields {
+		if field.Name != want[i].Name || field.Type != want[i].Type || field.Oneof != want[i].Oneof ||
+			field.Optional != want[i].Optional || field.Required {
+			t.Errorf("field %d described as %+v, want %+v", i, field, want[i])
+		}
+	}
+}
+
+func TestDescribeMessageRequired(t *testing.T) {
+	fd := compileFile(t, map[string]string{"legacy.proto": `syntax = "proto2";
+package legacy;
+message Request { required string id = 1; optional string note = 2; }
+`}, "legacy.proto")
+	info := describeMessage(fd.Messages().ByName("Request"), map[protoreflect.FullName]bool{})
+	if id, note := info.Fields[0], info.Fields[1]; !id.Required || id.Optional || note.Required || note.Optional {
+		t.Fatalf("fields described as %+v and %+v, want id required and note neither", id, note)
+	}
+	if got := RenderMessage(fd.Messages().ByName("Request"), nil); !strings.Contains(got, `"id": string (required)`) {
+		t.Fatalf("required field isn't marked:\n%s", got)
+	}
+}
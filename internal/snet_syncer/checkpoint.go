@@ -0,0 +1,99 @@
+package snet_syncer
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"matrix-ai-framework/pkg/db"
+	"sync"
+)
+
+// syncProgress tracks the orgs of a pass synced so far and stores them as the checkpoint after every
+// org, so a pass stopped halfway resumes after them. Orgs are synced concurrently, the checkpoint is
+// the first org not synced yet, everything before it is.
+type syncProgress struct {
+	mu   sync.Mutex
+	db   db.Service
+	log  zerolog.Logger
+	next int          // index in the registry of the first org not synced yet
+	done map[int]bool // orgs synced after next
+	// total is the number of orgs in the registry, the checkpoint is only valid while it doesn't change
+	total int
+	// resumed is set when the pass started from the checkpoint of an earlier one
+	resumed bool
+}
+
+// startProgress returns the progress of a new pass, resuming from the stored checkpoint unless
+// ForceFullSync is set. A dry run neither resumes nor stores checkpoints.
+func (s *SnetSyncer) startProgress(ctx context.Context) *syncProgress {
+	progress := &syncProgress{db: s.DB, log: s.log, done: make(map[int]bool), total: -1}
+	if s.DryRun {
+		progress.db = nil
+		return progress
+	}
+	if s.ForceFullSync {
+		return progress
+	}
+	checkpoint, ok, err := s.DB.GetSyncCheckpoint(ctx)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to get sync checkpoint, syncing from the start")
+		return progress
+	}
+	if ok && checkpoint.OrgOffset > 0 {
+		s.log.Info().Int("offset", checkpoint.OrgOffset).Int("total", checkpoint.OrgTotal).Time("saved", checkpoint.UpdatedAt).Msg("Resuming sync from checkpoint")
+		progress.next, progress.total, progress.resumed = checkpoint.OrgOffset, checkpoint.OrgTotal, true
+	}
+	return progress
+}
+
+// listed checks a listing of the registry against the checkpoint. ok is false when the pass resumed
+// but the number of orgs changed since, the ids may have shifted, so the pass has to start over.
+func (p *syncProgress) listed(total int) (ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed && total != p.total {
+		p.log.Info().Int("checkpoint-total", p.total).Int("total", total).Msg("Registry changed since the checkpoint, syncing from the start")
+		p.next, p.done, p.resumed = 0, make(map[int]bool), false
+		p.total = total
+		return false
+	}
+	p.total = total
+	return true
+}
+
+// start returns the index of the first org to sync
+func (p *syncProgress) start() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.next
+}
+
+// orgDone records that the org at index was synced and stores the checkpoint when it moved
+func (p *syncProgress) orgDone(ctx context.Context, index int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done[index] = true
+	moved := false
+	for p.done[p.next] {
+		delete(p.done, p.next)
+		p.next++
+		moved = true
+	}
+	if !moved || p.db == nil {
+		return
+	}
+	// stored even when the sync is being canceled, the orgs synced so far don't need to be synced again
+	checkpoint := db.SyncCheckpoint{OrgOffset: p.next, OrgTotal: p.total}
+	if err := p.db.SaveSyncCheckpoint(context.WithoutCancel(ctx), checkpoint); err != nil {
+		p.log.Error().Err(err).Int("offset", p.next).Msg("Failed to save sync checkpoint")
+	}
+}
+
+// finish clears the checkpoint once the pass went through the whole registry
+func (p *syncProgress) finish(ctx context.Context) {
+	if p.db == nil {
+		return
+	}
+	if err := p.db.ClearSyncCheckpoint(ctx); err != nil {
+		p.log.Error().Err(err).Msg("Failed to clear sync checkpoint")
+	}
+}
@@ -0,0 +1,93 @@
+package snet_syncer
+
+import (
+	"context"
+	"matrix-ai-framework/pkg/db"
+	"slices"
+	"testing"
+)
+
+// cancelingFetcher cancels the sync when the metadata of an org is fetched, like a restart halfway
+type cancelingFetcher struct {
+	ContentFetcher
+	cid    string
+	cancel context.CancelFunc
+}
+
+func (f cancelingFetcher) GetIpfsFileForOrg(ctx context.Context, orgSnetID, hash string) ([]byte, string, error) {
+	if hash == f.cid {
+		f.cancel()
+		return nil, "", ctx.Err()
+	}
+	return f.ContentFetcher.GetIpfsFileForOrg(ctx, orgSnetID, hash)
+}
+
+func TestSyncResumesFromCheckpoint(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1")
+	n.addOrg("org2", "svc2")
+	n.addOrg("org3", "svc3")
+	s := n.syncer()
+	// orgs are synced one at a time in registry order, so the pass stops right after org1
+	s.Concurrency = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.IPFSClient = cancelingFetcher{ContentFetcher: n.ipfs, cid: cidOf("org2"), cancel: cancel}
+	if _, complete, _ := s.syncOnce(ctx); complete {
+		t.Fatal("canceled pass completed")
+	}
+	checkpoint, ok, err := n.db.GetSyncCheckpoint(context.Background())
+	if err != nil || !ok || checkpoint.OrgOffset != 1 || checkpoint.OrgTotal != 3 {
+		t.Fatalf("checkpoint %+v (stored: %t, %v), want org1 of 3 orgs synced", checkpoint, ok, err)
+	}
+
+	s.IPFSClient = n.ipfs
+	syncOnce(t, s)
+	if got := n.ipfs.Fetches(cidOf("org1")); got != 1 {
+		t.Fatalf("org1 fetched %d times, want it skipped by the resumed pass", got)
+	}
+	if got := n.storedServices(); !slices.Equal(got, []string{"svc1", "svc2", "svc3"}) {
+		t.Fatalf("stored services %v after resuming, want all three", got)
+	}
+	if _, ok, _ := n.db.GetSyncCheckpoint(context.Background()); ok {
+		t.Fatal("checkpoint wasn't cleared by the completed pass")
+	}
+
+	// the next pass starts over
+	syncOnce(t, s)
+	if got := n.ipfs.Fetches(cidOf("org1")); got != 2 {
+		t.Fatalf("org1 fetched %d times, want it synced again once the checkpoint is cleared", got)
+	}
+}
+
+func TestSyncIgnoresCheckpointWhenForced(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1")
+	n.addOrg("org2", "svc2")
+	s := n.syncer()
+	if err := n.db.SaveSyncCheckpoint(context.Background(), db.SyncCheckpoint{OrgOffset: 1, OrgTotal: 2}); err != nil {
+		t.Fatal(err)
+	}
+	s.ForceFullSync = true
+
+	syncOnce(t, s)
+	if got := n.ipfs.Fetches(cidOf("org1")); got != 1 {
+		t.Fatalf("org1 fetched %d times by a forced sync, want it synced despite the checkpoint", got)
+	}
+}
+
+func TestSyncStartsOverWhenRegistryChanged(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1")
+	n.addOrg("org2", "svc2")
+	s := n.syncer()
+	// stored when the registry had three orgs, the ids may have shifted since
+	if err := n.db.SaveSyncCheckpoint(context.Background(), db.SyncCheckpoint{OrgOffset: 1, OrgTotal: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	syncOnce(t, s)
+	if got := n.ipfs.Fetches(cidOf("org1")); got != 1 {
+		t.Fatalf("org1 fetched %d times, want the pass started over", got)
+	}
+}
@@ -0,0 +1,73 @@
+package snet_syncer
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetCompileConcurrencyWhileCompiling(t *testing.T) {
+	s := &SnetSyncer{}
+	s.SetCompileConcurrency(1)
+	bundle := map[string]string{"a.proto": `syntax = "proto3"; package a; message A {}`}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.compileProto(bundle, "a.proto"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	for n := 1; n <= 4; n++ {
+		s.SetCompileConcurrency(n)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("compilations blocked after the limit was changed")
+	}
+}
+
+func TestCompileOrderIsStable(t *testing.T) {
+	files := map[string]string{
+		"common.proto": `syntax = "proto3"; package common; message Empty {}`,
+	}
+	for _, name := range []string{"delta", "alpha", "echo", "charlie", "bravo"} {
+		files[name+".proto"] = fmt.Sprintf(`syntax = "proto3";
+package %s;
+import "common.proto";
+service S { rpc Call(common.Empty) returns (common.Empty); }
+`, name)
+	}
+	n := newTestNet(t)
+	n.addService("svc1", modelOf("svc1"), files)
+	n.registerOrg("org1", map[string]string{"svc1": "ipfs://" + cidOf("svc1")})
+
+	paths := func(s *SnetSyncer) []string {
+		var paths []string
+		for _, fd := range s.ServiceDescriptors("svc1") {
+			paths = append(paths, fd.Path())
+		}
+		return paths
+	}
+	want := []string{"alpha.proto", "bravo.proto", "charlie.proto", "common.proto", "delta.proto", "echo.proto"}
+	for i := 0; i < 20; i++ {
+		s := n.syncer()
+		s.ForceFullSync = true
+		syncOnce(t, s)
+		if got := paths(s); !slices.Equal(got, want) {
+			t.Fatalf("pass %d compiled %v, want %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package snet_syncer
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// CompileStat is how long the last compilation of the protos of a service took, waiting for a free
+// compile slot included
+type CompileStat struct {
+	SnetID     string        `json:"snet_id"`
+	Files      int           `json:"files"`
+	Duration   time.Duration `json:"duration"`
+	CompiledAt time.Time     `json:"compiled_at"`
+}
+
+// compileStatsStore is shared by all copies of the syncer, so it is held by pointer
+type compileStatsStore struct {
+	mu    sync.RWMutex
+	stats map[string]CompileStat // key: service snet id
+}
+
+func (st *compileStatsStore) record(snetID string, files int, started time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.stats[snetID] = CompileStat{SnetID: snetID, Files: files, Duration: time.Since(started), CompiledAt: started}
+}
+
+// retain drops the stats of the services not in keep
+func (st *compileStatsStore) retain(keep map[string]bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for snetID := range st.stats {
+		if !keep[snetID] {
+			delete(st.stats, snetID)
+		}
+	}
+}
+
+// CompileStats returns the last compilation time of every compiled service, slowest first, to find the
+// services worth moving to lazy compilation
+func (s *SnetSyncer) CompileStats() []CompileStat {
+	s.compileStats.mu.RLock()
+	stats := make([]CompileStat, 0, len(s.compileStats.stats))
+	for _, stat := range s.compileStats.stats {
+		stats = append(stats, stat)
+	}
+	s.compileStats.mu.RUnlock()
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Duration != stats[j].Duration {
+			return stats[i].Duration > stats[j].Duration
+		}
+		return stats[i].SnetID < stats[j].SnetID
+	})
+	return stats
+}
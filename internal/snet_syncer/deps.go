@@ -0,0 +1,38 @@
+package snet_syncer
+
+import (
+	"context"
+	"matrix-ai-framework/pkg/blockchain"
+	ipfs "matrix-ai-framework/pkg/ipfs"
+)
+
+// Registry reads the orgs and services of the SingularityNET registry, blockchain.Ethereum implements it
+type Registry interface {
+	GetOrgs(ctx context.Context) ([][32]byte, error)
+	GetOrgsPaged(ctx context.Context, offset, limit int) (orgIDs [][32]byte, total int, err error)
+	GetOrg(ctx context.Context, orgID [32]byte) (blockchain.Org, error)
+	GetService(ctx context.Context, orgID, serviceID [32]byte) (blockchain.Service, error)
+}
+
+// ContentFetcher fetches metadata and model archives by CID, ipfs.IPFSClient and ipfs.Mirror implement it
+type ContentFetcher interface {
+	// GetIpfsFileForOrg returns the content of a CID or content URI and the normalized CID fetched
+	GetIpfsFileForOrg(ctx context.Context, orgSnetID, hash string) (content []byte, cID string, err error)
+	CacheStats() ipfs.CacheStats
+}
+
+// missingClient reports whether a dependency passed to New is unset, including the zero values of the
+// concrete clients which can't make any call
+func missingClient(client any) bool {
+	switch client := client.(type) {
+	case nil:
+		return true
+	case blockchain.Ethereum:
+		return client.Client == nil || client.Registry == nil
+	case ipfs.IPFSClient:
+		return client.HttpApi == nil
+	case ipfs.Mirror:
+		return client.Root == ""
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package snet_syncer
+
+import (
+	"fmt"
+	"github.com/bufbuild/protocompile/reporter"
+)
+
+// CompileDiagnostic is a problem protocompile found in the protos of a service
+type CompileDiagnostic struct {
+	SnetID  string `json:"snet_id"`
+	File    string `json:"file"`   // the file the problem is in, possibly an import of the compiled one
+	Line    int    `json:"line"`   // 1-based, 0 when the problem has no position
+	Column  int    `json:"column"` // 1-based, 0 when the problem has no position
+	Message string `json:"message"`
+}
+
+func (d CompileDiagnostic) Error() string {
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s", d.File, d.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// compileDiagnostics splits the error of compiling a file of a service into one diagnostic per problem
+// protocompile reported with a position, or a single diagnostic of the file when it reported none
+func compileDiagnostics(snetID, fileName string, err error) []CompileDiagnostic {
+	var diagnostics []CompileDiagnostic
+	for _, positioned := range positionedErrors(err) {
+		position := positioned.GetPosition()
+		file := position.Filename
+		if file == "" {
+			file = fileName
+		}
+		diagnostics = append(diagnostics, CompileDiagnostic{
+			SnetID:  snetID,
+			File:    file,
+			Line:    position.Line,
+			Column:  position.Col,
+			Message: positioned.Unwrap().Error(),
+		})
+	}
+	if len(diagnostics) == 0 {
+		diagnostics = append(diagnostics, CompileDiagnostic{SnetID: snetID, File: fileName, Message: err.Error()})
+	}
+	return diagnostics
+}
+
+// positionedErrors returns the errors with a position wrapped in err, following joined and wrapped errors
+func positionedErrors(err error) []reporter.ErrorWithPos {
+	switch wrapped := err.(type) {
+	case reporter.ErrorWithPos:
+		return []reporter.ErrorWithPos{wrapped}
+	case interface{ Unwrap() []error }:
+		var all []reporter.ErrorWithPos
+		for _, err := range wrapped.Unwrap() {
+			all = append(all, positionedErrors(err)...)
+		}
+		return all
+	case interface{ Unwrap() error }:
+		return positionedErrors(wrapped.Unwrap())
+	}
+	return nil
+}
+
+// diagnosticErrors returns the diagnostics as errors, e.g. to join them
+func diagnosticErrors(diagnostics []CompileDiagnostic) []error {
+	errs := make([]error, len(diagnostics))
+	for i, diagnostic := range diagnostics {
+		errs[i] = diagnostic
+	}
+	return errs
+}
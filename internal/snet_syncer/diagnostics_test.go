@@ -0,0 +1,61 @@
+package snet_syncer
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompileDiagnostics(t *testing.T) {
+	n := newTestNet(t)
+	// a syntax error in an import of the compiled file
+	n.addService("svc1", modelOf("svc1"), map[string]string{
+		"echo.proto": `syntax = "proto3";
+package svc1;
+
+import "types.proto";
+
+service Echo {
+  rpc Say(Request) returns (Response);
+}
+`,
+		"types.proto": `syntax = "proto3";
+package svc1;
+
+message Request { string text = 1 }
+`,
+	})
+	// every unknown type is reported, not just the first one
+	n.addService("svc2", modelOf("svc2"), map[string]string{"echo.proto": `syntax = "proto3";
+package svc2;
+
+message Request { strin text = 1; }
+message Response { Txt text = 1; }
+`})
+	n.registerOrg("org1", map[string]string{"svc1": "ipfs://" + cidOf("svc1"), "svc2": "ipfs://" + cidOf("svc2")})
+	s := n.syncer()
+
+	if _, _, err := s.syncOnce(context.Background()); err == nil {
+		t.Fatal("sync of malformed protos succeeded")
+	}
+	diagnostics := s.CompileErrors()
+	want := map[string][]CompileDiagnostic{
+		"svc1": {{SnetID: "svc1", File: "types.proto", Line: 4, Column: 35, Message: "syntax error: expecting ';'"}},
+		"svc2": {
+			{SnetID: "svc2", File: "echo.proto", Line: 4, Column: 19, Message: `field svc2.Request.text: unknown type strin`},
+			{SnetID: "svc2", File: "echo.proto", Line: 5, Column: 20, Message: `field svc2.Response.text: unknown type Txt`},
+		},
+	}
+	for snetID, wantDiagnostics := range want {
+		if got := diagnostics[snetID]; !slices.Equal(got, wantDiagnostics) {
+			t.Errorf("diagnostics of %s:\n%+v\nwant\n%+v", snetID, got, wantDiagnostics)
+		}
+		if len(s.ServiceDescriptors(snetID)) != 0 {
+			t.Errorf("%s has descriptors despite failing to compile", snetID)
+		}
+	}
+	if info := s.GetSnetServicesInfo(); !strings.Contains(info, "types.proto:4:35: syntax error: expecting &#39;;&#39;") {
+		t.Fatalf("services info doesn't list the diagnostic of svc1:\n%s", info)
+	}
+}
@@ -0,0 +1,152 @@
+package snet_syncer
+
+import (
+	"sort"
+	"time"
+)
+
+// SyncSnapshot is the registry as seen by a sync pass, captured at its end and kept in its SyncResult
+type SyncSnapshot struct {
+	TakenAt time.Time
+	// Orgs are the metadata hashes of the orgs listed, key: org snet id. The hash is empty when the
+	// metadata couldn't be fetched.
+	Orgs map[string]string
+	// Services are the services of the orgs listed, key: service snet id
+	Services map[string]ServiceSnapshot
+	// Partial is set when the pass didn't see the whole registry: it was stopped, resumed from a
+	// checkpoint, couldn't list the services of an org, or the registry changed while it was paged through
+	Partial bool
+}
+
+// ServiceSnapshot is a service as seen by a sync pass
+type ServiceSnapshot struct {
+	OrgSnetID string
+	// MetadataHash is empty when the metadata couldn't be fetched, see hashMetadata
+	MetadataHash string
+}
+
+// SyncDiff lists the orgs and services added, removed or whose metadata changed between two sync
+// passes, by snet id in sorted order. A service moved to another org is changed.
+type SyncDiff struct {
+	AddedOrgs       []string
+	RemovedOrgs     []string
+	ChangedOrgs     []string
+	AddedServices   []string
+	RemovedServices []string
+	ChangedServices []string
+}
+
+// Empty reports whether nothing changed between the passes
+func (d SyncDiff) Empty() bool {
+	return len(d.AddedOrgs)+len(d.RemovedOrgs)+len(d.ChangedOrgs)+
+		len(d.AddedServices)+len(d.RemovedServices)+len(d.ChangedServices) == 0
+}
+
+// DiffSync compares the snapshots of two sync passes. What a partial snapshot is missing may just not
+// have been seen: nothing is reported removed when curr is partial, nor added when prev is. A metadata
+// hash that is empty in either snapshot isn't reported as a change.
+func DiffSync(prev, curr SyncSnapshot) SyncDiff {
+	var diff SyncDiff
+	for snetID, hash := range curr.Orgs {
+		prevHash, ok := prev.Orgs[snetID]
+		switch {
+		case !ok:
+			if !prev.Partial {
+				diff.AddedOrgs = append(diff.AddedOrgs, snetID)
+			}
+		case hashChanged(prevHash, hash):
+			diff.ChangedOrgs = append(diff.ChangedOrgs, snetID)
+		}
+	}
+	for snetID, service := range curr.Services {
+		prevService, ok := prev.Services[snetID]
+		switch {
+		case !ok:
+			if !prev.Partial {
+				diff.AddedServices = append(diff.AddedServices, snetID)
+			}
+		case prevService.OrgSnetID != service.OrgSnetID || hashChanged(prevService.MetadataHash, service.MetadataHash):
+			diff.ChangedServices = append(diff.ChangedServices, snetID)
+		}
+	}
+	if !curr.Partial {
+		for snetID := range prev.Orgs {
+			if _, ok := curr.Orgs[snetID]; !ok {
+				diff.RemovedOrgs = append(diff.RemovedOrgs, snetID)
+			}
+		}
+		for snetID := range prev.Services {
+			if _, ok := curr.Services[snetID]; !ok {
+				diff.RemovedServices = append(diff.RemovedServices, snetID)
+			}
+		}
+	}
+	for _, ids := range [][]string{diff.AddedOrgs, diff.RemovedOrgs, diff.ChangedOrgs, diff.AddedServices, diff.RemovedServices, diff.ChangedServices} {
+		sort.Strings(ids)
+	}
+	return diff
+}
+
+// logSyncDiff logs the changes of the registry since the last run
+func (s *SnetSyncer) logSyncDiff(diff SyncDiff) {
+	if diff.Empty() {
+		return
+	}
+	s.log.Info().
+		Strs("added-orgs", diff.AddedOrgs).
+		Strs("removed-orgs", diff.RemovedOrgs).
+		Strs("changed-orgs", diff.ChangedOrgs).
+		Strs("added-services", diff.AddedServices).
+		Strs("removed-services", diff.RemovedServices).
+		Strs("changed-services", diff.ChangedServices).
+		Msg("Registry changed since the last sync")
+}
+
+func hashChanged(prev, curr string) bool {
+	return prev != "" && curr != "" && prev != curr
+}
+
+// snapshot returns the orgs and services seen so far with their metadata hashes
+func (s *seenIDs) snapshot(partial bool) SyncSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := SyncSnapshot{
+		TakenAt:  time.Now(),
+		Orgs:     make(map[string]string, len(s.orgs)),
+		Services: make(map[string]ServiceSnapshot, len(s.owners)),
+		Partial:  partial || s.incomplete || s.changed,
+	}
+	for _, snetID := range s.orgs {
+		snapshot.Orgs[snetID] = s.orgHashes[snetID]
+	}
+	for snetID, orgSnetID := range s.owners {
+		snapshot.Services[snetID] = ServiceSnapshot{OrgSnetID: orgSnetID, MetadataHash: s.serviceHashes[snetID]}
+	}
+	return snapshot
+}
+
+// orgMetadata records the metadata hash of an org, nothing is recorded by a nil seenIDs
+func (s *seenIDs) orgMetadata(snetID, hash string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.orgHashes == nil {
+		s.orgHashes = make(map[string]string)
+	}
+	s.orgHashes[snetID] = hash
+}
+
+// serviceMetadata records the metadata hash of a service, nothing is recorded by a nil seenIDs
+func (s *seenIDs) serviceMetadata(snetID, hash string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.serviceHashes == nil {
+		s.serviceHashes = make(map[string]string)
+	}
+	s.serviceHashes[snetID] = hash
+}
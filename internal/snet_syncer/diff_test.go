@@ -0,0 +1,83 @@
+package snet_syncer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSync(t *testing.T) {
+	prev := SyncSnapshot{
+		Orgs: map[string]string{"org1": "h1", "org2": "h2", "org3": ""},
+		Services: map[string]ServiceSnapshot{
+			"svc1": {OrgSnetID: "org1", MetadataHash: "s1"},
+			"svc2": {OrgSnetID: "org1", MetadataHash: "s2"},
+			"svc3": {OrgSnetID: "org2", MetadataHash: "s3"},
+			"svc4": {OrgSnetID: "org1", MetadataHash: "s4"},
+		},
+	}
+	curr := SyncSnapshot{
+		Orgs: map[string]string{"org1": "h1-changed", "org3": "h3", "org4": "h4"},
+		Services: map[string]ServiceSnapshot{
+			"svc1": {OrgSnetID: "org1", MetadataHash: "s1"},
+			"svc2": {OrgSnetID: "org1", MetadataHash: "s2-changed"},
+			"svc4": {OrgSnetID: "org3", MetadataHash: "s4"},
+			"svc5": {OrgSnetID: "org4", MetadataHash: ""},
+		},
+	}
+	want := SyncDiff{
+		AddedOrgs:       []string{"org4"},
+		RemovedOrgs:     []string{"org2"},
+		ChangedOrgs:     []string{"org1"}, // org3 had no hash before, it isn't reported as changed
+		AddedServices:   []string{"svc5"},
+		RemovedServices: []string{"svc3"},
+		ChangedServices: []string{"svc2", "svc4"}, // svc4 moved to another org
+	}
+	if got := DiffSync(prev, curr); !reflect.DeepEqual(got, want) {
+		t.Fatalf("diff\n%+v\nwant\n%+v", got, want)
+	}
+	if diff := DiffSync(curr, curr); !diff.Empty() {
+		t.Fatalf("diff of a snapshot with itself is %+v, want empty", diff)
+	}
+}
+
+func TestDiffSyncPartial(t *testing.T) {
+	prev := SyncSnapshot{Orgs: map[string]string{"org1": "h1", "org2": "h2"}}
+	curr := SyncSnapshot{Orgs: map[string]string{"org1": "h1", "org3": "h3"}, Partial: true}
+	// org2 may just not have been seen by the partial pass
+	if diff := DiffSync(prev, curr); !reflect.DeepEqual(diff, SyncDiff{AddedOrgs: []string{"org3"}}) {
+		t.Fatalf("diff against a partial pass %+v, want org3 added only", diff)
+	}
+	prev.Partial, curr.Partial = true, false
+	// org3 may have been missed by the partial pass before
+	if diff := DiffSync(prev, curr); !reflect.DeepEqual(diff, SyncDiff{RemovedOrgs: []string{"org2"}}) {
+		t.Fatalf("diff after a partial pass %+v, want org2 removed only", diff)
+	}
+}
+
+func TestSyncSnapshotsDiff(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1", "svc2")
+	n.addOrg("org2", "svc3")
+	s := n.syncer()
+	prev := syncOnce(t, s)
+
+	service := serviceMeta("svc1", modelOf("svc1"))
+	service.DisplayName = "Renamed"
+	if err := n.ipfs.AddJSON(cidOf("svc1"), service); err != nil {
+		t.Fatal(err)
+	}
+	n.registry.RemoveOrg("org2")
+	n.addOrg("org3", "svc4")
+	curr := syncOnce(t, s)
+
+	want := SyncDiff{
+		AddedOrgs:       []string{"org3"},
+		RemovedOrgs:     []string{"org2"},
+		AddedServices:   []string{"svc4"},
+		RemovedServices: []string{"svc3"},
+		ChangedServices: []string{"svc1"},
+	}
+	if got := DiffSync(prev, curr); !reflect.DeepEqual(got, want) {
+		t.Fatalf("diff of the passes\n%+v\nwant\n%+v", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+package snet_syncer
+
+import (
+	"context"
+	"matrix-ai-framework/pkg/db"
+	"slices"
+	"sync"
+)
+
+// DryRunCounts are the writes skipped by a dry run
+type DryRunCounts struct {
+	Orgs           int
+	Groups         int
+	Services       int
+	Endpoints      int
+	MethodPrices   int
+	Descriptors    int   // services whose descriptors would have been stored or removed
+	MetadataHashes int   // services that would have been marked as completely synced
+	PrunedOrgs     int64 // orgs that would have been pruned
+	PrunedServices int64 // services that would have been pruned
+}
+
+// runner returns the syncer to run a sync with: s itself, or with DryRun a copy writing to a dryRunDB,
+// which is returned too. The copy shares the descriptors, events and state of s.
+func (s *SnetSyncer) runner() (*SnetSyncer, *dryRunDB) {
+	if !s.DryRun {
+		return s, nil
+	}
+	dryRun := &dryRunDB{Service: s.DB}
+	copied := *s
+	copied.DB = dryRun
+	// lazily compiled descriptors would be stored on first access, after the dry run
+	copied.LazyCompile = false
+	return &copied, dryRun
+}
+
+// dryRunDB reads through the wrapped service and counts the writes instead of running them
+type dryRunDB struct {
+	db.Service
+	mu     sync.Mutex
+	counts DryRunCounts
+}
+
+func (d *dryRunDB) count(add func(counts *DryRunCounts)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	add(&d.counts)
+}
+
+func (d *dryRunDB) snapshot() DryRunCounts {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.counts
+}
+
+func (d *dryRunDB) WithTx(_ context.Context, fn func(tx db.Tx) error) error {
+	return fn(d)
+}
+
+func (d *dryRunDB) CreateSnetOrg(context.Context, db.SnetOrganization) (int, error) {
+	d.count(func(counts *DryRunCounts) { counts.Orgs++ })
+	return 0, nil
+}
+
+func (d *dryRunDB) CreateSnetOrgGroups(_ context.Context, _ int, groups []db.SnetOrgGroup) error {
+	d.count(func(counts *DryRunCounts) { counts.Groups += len(groups) })
+	return nil
+}
+
+func (d *dryRunDB) CreateSnetService(context.Context, db.SnetService) (int, error) {
+	d.count(func(counts *DryRunCounts) { counts.Services++ })
+	return 0, nil
+}
+
+func (d *dryRunDB) CreateSnetServiceEndpoints(_ context.Context, _ string, endpoints []db.SnetServiceEndpoint) error {
+	d.count(func(counts *DryRunCounts) { counts.Endpoints += len(endpoints) })
+	return nil
+}
+
+func (d *dryRunDB) CreateSnetMethodPrices(_ context.Context, _ string, prices []db.SnetMethodPrice) error {
+	d.count(func(counts *DryRunCounts) { counts.MethodPrices += len(prices) })
+	return nil
+}
+
+func (d *dryRunDB) SaveServiceDescriptors(context.Context, string, []byte) error {
+	d.count(func(counts *DryRunCounts) { counts.Descriptors++ })
+	return nil
+}
+
+func (d *dryRunDB) SetSnetServiceMetadataHash(context.Context, string, string) error {
+	d.count(func(counts *DryRunCounts) { counts.MetadataHashes++ })
+	return nil
+}
+
+// DeleteSnetOrgsNotIn counts the stored orgs that would be pruned
+func (d *dryRunDB) DeleteSnetOrgsNotIn(ctx context.Context, seen []string, _ bool) (int64, error) {
+	orgs, err := d.Service.GetSnetOrgs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, org := range orgs {
+		if !slices.Contains(seen, org.SnetID) {
+			deleted++
+		}
+	}
+	d.count(func(counts *DryRunCounts) { counts.PrunedOrgs += deleted })
+	return deleted, nil
+}
+
+// DeleteSnetServicesNotIn counts the stored services that would be pruned
+func (d *dryRunDB) DeleteSnetServicesNotIn(ctx context.Context, seen []string, _ bool) (int64, error) {
+	services, err := d.Service.GetSnetServices(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, service := range services {
+		if !slices.Contains(seen, service.SnetID) {
+			deleted++
+		}
+	}
+	d.count(func(counts *DryRunCounts) { counts.PrunedServices += deleted })
+	return deleted, nil
+}
@@ -0,0 +1,42 @@
+package snet_syncer
+
+import (
+	"matrix-ai-framework/pkg/db"
+	"sort"
+)
+
+// DuplicateServices groups synced services which are published by several orgs with the same
+// model bundle CID. The key is the canonical service snet id rendered in the services info,
+// the value lists the other providers of the same service with their own endpoints and pricing.
+func (s *SnetSyncer) DuplicateServices() map[string][]db.SnetService {
+	return duplicateServices(s.catalogServices())
+}
+
+func duplicateServices(services map[string]db.SnetService) map[string][]db.SnetService {
+	byModel := make(map[string][]db.SnetService)
+	for _, service := range services {
+		if service.ModelIpfsHash == "" {
+			continue
+		}
+		byModel[service.ModelIpfsHash] = append(byModel[service.ModelIpfsHash], service)
+	}
+
+	duplicates := make(map[string][]db.SnetService)
+	for _, group := range byModel {
+		if len(group) < 2 {
+			continue
+		}
+		// the cheapest provider becomes canonical, ties are broken by ids to keep the choice stable
+		sort.Slice(group, func(i, j int) bool {
+			if group[i].Price != group[j].Price {
+				return group[i].Price < group[j].Price
+			}
+			if group[i].SnetOrgID != group[j].SnetOrgID {
+				return group[i].SnetOrgID < group[j].SnetOrgID
+			}
+			return group[i].SnetID < group[j].SnetID
+		})
+		duplicates[group[0].SnetID] = group[1:]
+	}
+	return duplicates
+}
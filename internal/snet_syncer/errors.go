@@ -0,0 +1,38 @@
+package snet_syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrServiceNotSynced is returned for snet services without compiled descriptors, it is wrapped by
+	// ErrServiceNotFound and ErrDescriptorNotCompiled which tell why
+	ErrServiceNotSynced = errors.New("service not synced")
+	// ErrServiceNotFound is returned for snet services the syncer doesn't know of
+	ErrServiceNotFound = fmt.Errorf("%w: unknown service", ErrServiceNotSynced)
+	// ErrDescriptorNotCompiled is returned for synced services whose protos are missing or failed to compile
+	ErrDescriptorNotCompiled = fmt.Errorf("%w: descriptors not compiled", ErrServiceNotSynced)
+	// ErrIPFSUnavailable is wrapped by the errors of IPFS fetches still failing after all retries, failures
+	// that won't go away on their own, like content over the size limits, aside
+	ErrIPFSUnavailable = errors.New("ipfs unavailable")
+)
+
+// notSyncedError returns the error of a service without descriptors: ErrDescriptorNotCompiled when
+// it is stored or failed to compile, ErrServiceNotFound otherwise
+func (s *SnetSyncer) notSyncedError(snetID string) error {
+	s.descriptorsMu.RLock()
+	compileErrs, pending := s.compileErrors[snetID], s.pendingProtos[snetID]
+	s.descriptorsMu.RUnlock()
+	switch {
+	case len(compileErrs) > 0:
+		return fmt.Errorf("%w: %s: %w", ErrDescriptorNotCompiled, snetID, errors.Join(diagnosticErrors(compileErrs)...))
+	case pending != nil:
+		return fmt.Errorf("%w: %s", ErrDescriptorNotCompiled, snetID)
+	}
+	if _, err := s.DB.GetSnetService(context.Background(), snetID); err == nil {
+		return fmt.Errorf("%w: %s", ErrDescriptorNotCompiled, snetID)
+	}
+	return fmt.Errorf("%w: %s", ErrServiceNotFound, snetID)
+}
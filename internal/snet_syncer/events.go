@@ -0,0 +1,79 @@
+package snet_syncer
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SyncEventType is the kind of a SyncEvent
+type SyncEventType string
+
+const (
+	EventSyncStarted   SyncEventType = "sync_started"
+	EventOrgStarted    SyncEventType = "org_started"
+	EventServiceSynced SyncEventType = "service_synced"
+	EventError         SyncEventType = "error"
+	EventSyncFinished  SyncEventType = "sync_finished"
+)
+
+// eventBufferSize is the number of events buffered per subscriber, newer events are dropped once it is full
+const eventBufferSize = 64
+
+// SyncEvent reports the progress of a sync to subscribers
+type SyncEvent struct {
+	Type      SyncEventType `json:"type"`
+	Time      time.Time     `json:"time"`
+	OrgSnetID string        `json:"org,omitempty"`
+	SnetID    string        `json:"snet_id,omitempty"`
+	Error     string        `json:"error,omitempty"` // of error events, and of sync_finished when the sync failed
+}
+
+// eventHub fans the sync events out to subscribers, it is shared by all copies of the syncer
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan SyncEvent]struct{}
+	dropped     atomic.Uint64
+}
+
+// Subscribe returns a channel receiving the events of the following syncs and a func to unsubscribe,
+// which closes the channel. Publishing never blocks the sync: events that don't fit in the buffer of
+// a slow subscriber are dropped and counted by DroppedEvents.
+func (s *SnetSyncer) Subscribe() (<-chan SyncEvent, func()) {
+	events := make(chan SyncEvent, eventBufferSize)
+	s.events.mu.Lock()
+	if s.events.subscribers == nil {
+		s.events.subscribers = make(map[chan SyncEvent]struct{})
+	}
+	s.events.subscribers[events] = struct{}{}
+	s.events.mu.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			s.events.mu.Lock()
+			defer s.events.mu.Unlock()
+			delete(s.events.subscribers, events)
+			close(events)
+		})
+	}
+}
+
+// DroppedEvents returns the number of events dropped because a subscriber's buffer was full
+func (s *SnetSyncer) DroppedEvents() uint64 {
+	return s.events.dropped.Load()
+}
+
+// publish sends an event to every subscriber that has room for it
+func (s *SnetSyncer) publish(event SyncEvent) {
+	event.Time = time.Now()
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	for events := range s.events.subscribers {
+		select {
+		case events <- event:
+		default:
+			s.events.dropped.Add(1)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package snet_syncer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrMethodNotFound is returned for methods that no gRPC service of a synced service has
+	ErrMethodNotFound = errors.New("method not found")
+	// ErrAmbiguousMethod is returned for bare method names found in several gRPC services of a service
+	ErrAmbiguousMethod = errors.New("method is ambiguous")
+)
+
+// GenerateExampleRequest returns an indented JSON object with a zero or placeholder value for every input
+// field of a method, in the protobuf JSON mapping: nested messages are expanded, repeated fields are empty
+// arrays, maps empty objects and enums the name of their zero value. Only the first field of a oneof is
+// included, as setting several is an error. The method is named as FindMethod takes it.
+func (s *SnetSyncer) GenerateExampleRequest(snetID, methodName string) ([]byte, error) {
+	method, err := s.findMethod(snetID, methodName)
+	if err != nil {
+		return nil, err
+	}
+	var example bytes.Buffer
+	if err = json.Indent(&example, []byte(exampleMessage(method.Input(), map[protoreflect.FullName]bool{})), "", "  "); err != nil {
+		return nil, fmt.Errorf("example request of %s: %w", method.FullName(), err)
+	}
+	return example.Bytes(), nil
+}
+
+// FindMethod looks a method up among the gRPC services of a synced service. The method is a bare name,
+// "<service>/<method>" or its fully-qualified name "<package>.<service>.<method>", a bare name must belong
+// to exactly one gRPC service. Unknown methods fail with ErrMethodNotFound.
+func (s *SnetSyncer) FindMethod(snetID, name string) (protoreflect.MethodDescriptor, error) {
+	return s.findMethod(snetID, name)
+}
+
+func (s *SnetSyncer) findMethod(snetID, name string) (protoreflect.MethodDescriptor, error) {
+	descriptors, err := s.GetServiceDescriptors(snetID)
+	if err != nil {
+		return nil, err
+	}
+	serviceName, methodName := "", strings.TrimPrefix(name, "/")
+	if i := strings.LastIndex(methodName, "/"); i >= 0 {
+		serviceName, methodName = methodName[:i], methodName[i+1:]
+	} else if i := strings.LastIndex(methodName, "."); i >= 0 {
+		serviceName, methodName = methodName[:i], methodName[i+1:]
+	}
+	var found protoreflect.MethodDescriptor
+	for _, descriptor := range descriptors {
+		services := descriptor.Services()
+		for i := 0; i < services.Len(); i++ {
+			service := services.Get(i)
+			if serviceName != "" && !sameService(string(service.FullName()), serviceName) {
+				continue
+			}
+			method := service.Methods().ByName(protoreflect.Name(methodName))
+			if method == nil {
+				continue
+			}
+			if found != nil {
+				return nil, fmt.Errorf("%w: %s is in %s and %s", ErrAmbiguousMethod, methodName, found.Parent().FullName(), service.FullName())
+			}
+			found = method
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s in %s", ErrMethodNotFound, name, snetID)
+	}
+	return found, nil
+}
+
+// exampleMessage renders the example JSON of a message, a message already being expanded is null
+func exampleMessage(message protoreflect.MessageDescriptor, visiting map[protoreflect.FullName]bool) string {
+	if example, ok := wellKnownExamples[message.FullName()]; ok {
+		return example
+	}
+	if visiting[message.FullName()] {
+		return "null"
+	}
+	visiting[message.FullName()] = true
+	defer delete(visiting, message.FullName())
+
+	var builder strings.Builder
+	builder.WriteString("{")
+	fields := message.Fields()
+	for n, first := 0, true; n < fields.Len(); n++ {
+		field := fields.Get(n)
+		if oneof := field.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() && oneof.Fields().Get(0) != field {
+			continue
+		}
+		if !first {
+			builder.WriteString(",")
+		}
+		first = false
+		builder.WriteString(strconv.Quote(field.JSONName()) + ":")
+		switch {
+		case field.IsMap():
+			builder.WriteString("{}")
+		case field.IsList():
+			builder.WriteString("[]")
+		default:
+			builder.WriteString(exampleValue(field, visiting))
+		}
+	}
+	builder.WriteString("}")
+	return builder.String()
+}
+
+// exampleValue renders the zero value of a single value of the field
+func exampleValue(field protoreflect.FieldDescriptor, visiting map[protoreflect.FullName]bool) string {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return exampleMessage(field.Message(), visiting)
+	case protoreflect.EnumKind:
+		if field.Enum().FullName() == "google.protobuf.NullValue" {
+			return "null"
+		}
+		return strconv.Quote(string(field.Enum().Values().Get(0).Name()))
+	case protoreflect.BoolKind:
+		return "false"
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return `""`
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// 64-bit integers are JSON strings in the protobuf JSON mapping
+		return `"0"`
+	default:
+		return "0"
+	}
+}
+
+// wellKnownExamples are the examples of the well-known types with a special JSON mapping
+var wellKnownExamples = map[protoreflect.FullName]string{
+	"google.protobuf.Any":         "{}",
+	"google.protobuf.Duration":    `"0s"`,
+	"google.protobuf.Empty":       "{}",
+	"google.protobuf.FieldMask":   `""`,
+	"google.protobuf.ListValue":   "[]",
+	"google.protobuf.Struct":      "{}",
+	"google.protobuf.Timestamp":   `"1970-01-01T00:00:00Z"`,
+	"google.protobuf.Value":       "null",
+	"google.protobuf.BoolValue":   "false",
+	"google.protobuf.BytesValue":  `""`,
+	"google.protobuf.DoubleValue": "0",
+	"google.protobuf.FloatValue":  "0",
+	"google.protobuf.Int32Value":  "0",
+	"google.protobuf.Int64Value":  `"0"`,
+	"google.protobuf.StringValue": `""`,
+	"google.protobuf.UInt32Value": "0",
+	"google.protobuf.UInt64Value": `"0"`,
+}
@@ -0,0 +1,113 @@
+package snet_syncer
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"math/big"
+)
+
+// ServiceBundle contains everything needed to generate and use client stubs for a snet service:
+// a self-contained FileDescriptorSet accepted by `protoc --descriptor_set_in` or `buf generate`,
+// the daemon endpoint and the payment requirements of the service group.
+type ServiceBundle struct {
+	SnetID        string      `json:"snet_id"`
+	OrgSnetID     string      `json:"org_snet_id"`
+	Endpoint      string      `json:"endpoint"`
+	Services      []string    `json:"services"`       // fully-qualified gRPC service names
+	DescriptorSet []byte      `json:"descriptor_set"` // serialized descriptorpb.FileDescriptorSet
+	Payment       PaymentInfo `json:"payment"`
+}
+
+// PaymentInfo describes how calls to a snet service are paid.
+type PaymentInfo struct {
+	Type                       string   `json:"type"`
+	MPEAddress                 string   `json:"mpe_address"`
+	GroupID                    string   `json:"group_id"`
+	PaymentAddress             string   `json:"payment_address"`
+	PaymentExpirationThreshold *big.Int `json:"payment_expiration_threshold"`
+	PriceInCogs                int      `json:"price_in_cogs"`
+	FreeCalls                  int      `json:"free_calls"`
+	FreeCallSignerAddress      string   `json:"free_call_signer_address"`
+}
+
+// ExportDescriptorSet returns the serialized descriptorpb.FileDescriptorSet of a service, with the files
+// of every import so it compiles standalone, e.g. for `grpcurl -protoset` or `protoc --descriptor_set_in`.
+// The output is deterministic: the same synced protos always serialize to the same bytes.
+func (s *SnetSyncer) ExportDescriptorSet(snetID string) ([]byte, error) {
+	descriptors, err := s.GetServiceDescriptors(snetID)
+	if err != nil {
+		return nil, err
+	}
+	set, err := proto.MarshalOptions{Deterministic: true}.Marshal(buildFileDescriptorSet(descriptors))
+	if err != nil {
+		return nil, fmt.Errorf("marshal descriptor set of %s: %w", snetID, err)
+	}
+	return set, nil
+}
+
+// ExportServiceBundle bundles the compiled descriptors of a service with its endpoint and payment details.
+func (s *SnetSyncer) ExportServiceBundle(snetID string) (bundle ServiceBundle, err error) {
+	bundle.DescriptorSet, err = s.ExportDescriptorSet(snetID)
+	if err != nil {
+		return bundle, err
+	}
+	descriptors := s.ServiceDescriptors(snetID)
+	for _, descriptor := range descriptors {
+		services := descriptor.Services()
+		for i := 0; i < services.Len(); i++ {
+			bundle.Services = append(bundle.Services, string(services.Get(i).FullName()))
+		}
+	}
+
+	aggregate, err := s.DB.GetSnetServiceAggregate(context.Background(), snetID)
+	if err != nil {
+		return bundle, fmt.Errorf("get service %s: %w", snetID, err)
+	}
+	service := aggregate.Service
+	group, ok := aggregate.Group()
+	if !ok {
+		return bundle, fmt.Errorf("group %s of service %s not found", service.GroupID, snetID)
+	}
+
+	bundle.SnetID = snetID
+	bundle.OrgSnetID = service.SnetOrgID
+	bundle.Endpoint = service.URL
+	bundle.Payment = PaymentInfo{
+		Type:                       "escrow",
+		MPEAddress:                 service.MPEAddress,
+		GroupID:                    service.GroupID,
+		PaymentAddress:             group.PaymentAddress,
+		PaymentExpirationThreshold: group.PaymentExpirationThreshold,
+		PriceInCogs:                service.Price,
+		FreeCalls:                  service.FreeCalls,
+		FreeCallSignerAddress:      service.FreeCallSignerAddress,
+	}
+	return bundle, nil
+}
+
+// buildFileDescriptorSet collects the files together with all their transitive imports,
+// dependencies first, so the set can be compiled standalone.
+func buildFileDescriptorSet(descriptors []protoreflect.FileDescriptor) *descriptorpb.FileDescriptorSet {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	for _, descriptor := range descriptors {
+		add(descriptor)
+	}
+	return set
+}
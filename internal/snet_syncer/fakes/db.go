@@ -0,0 +1,471 @@
+package fakes
+
+import (
+	"context"
+	"maps"
+	"matrix-ai-framework/pkg/db"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DB is an in-memory db.Service with the semantics of the postgres one: creates upsert on the snet id,
+// deletions are soft unless hard is set, and WithTx leaves nothing of a failed transaction behind
+type DB struct {
+	mu    sync.Mutex
+	state dbState
+	// CreateOrgErr, when set, is called by CreateSnetOrg and a non-nil error it returns fails the call
+	CreateOrgErr func(org db.SnetOrganization) error
+}
+
+// dbState holds the rows by value, so copying the maps snapshots them
+type dbState struct {
+	nextID      int
+	orgs        map[string]db.SnetOrganization      // key: snet id
+	groups      map[string]db.SnetOrgGroup          // key: group id
+	services    map[string]db.SnetService           // key: snet id
+	endpoints   map[string][]db.SnetServiceEndpoint // key: service snet id
+	prices      map[string][]db.SnetMethodPrice     // key: service snet id
+	descriptors map[string][]byte                   // key: service snet id
+	checkpoint  *db.SyncCheckpoint
+	audit       []db.AuditEntry
+}
+
+// NewDB returns an empty in-memory DB
+func NewDB() *DB {
+	return &DB{state: dbState{
+		orgs:        make(map[string]db.SnetOrganization),
+		groups:      make(map[string]db.SnetOrgGroup),
+		services:    make(map[string]db.SnetService),
+		endpoints:   make(map[string][]db.SnetServiceEndpoint),
+		prices:      make(map[string][]db.SnetMethodPrice),
+		descriptors: make(map[string][]byte),
+	}}
+}
+
+func (s dbState) clone() dbState {
+	s.orgs = maps.Clone(s.orgs)
+	s.groups = maps.Clone(s.groups)
+	s.services = maps.Clone(s.services)
+	s.endpoints = maps.Clone(s.endpoints)
+	s.prices = maps.Clone(s.prices)
+	s.descriptors = maps.Clone(s.descriptors)
+	s.audit = slices.Clone(s.audit)
+	return s
+}
+
+// memTx writes to the state of a DB whose lock is held
+type memTx struct {
+	state        *dbState
+	createOrgErr func(org db.SnetOrganization) error
+}
+
+// tx returns a memTx of the state, the caller must hold the lock
+func (d *DB) tx() memTx {
+	return memTx{state: &d.state, createOrgErr: d.CreateOrgErr}
+}
+
+func (d *DB) WithTx(ctx context.Context, fn func(tx db.Tx) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	snapshot := d.state.clone()
+	if err := fn(d.tx()); err != nil {
+		d.state = snapshot
+		return err
+	}
+	return nil
+}
+
+func (d *DB) CreateSnetService(ctx context.Context, service db.SnetService) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tx().CreateSnetService(ctx, service)
+}
+
+func (d *DB) CreateSnetOrg(ctx context.Context, org db.SnetOrganization) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tx().CreateSnetOrg(ctx, org)
+}
+
+func (d *DB) CreateSnetOrgGroups(ctx context.Context, orgID int, groups []db.SnetOrgGroup) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tx().CreateSnetOrgGroups(ctx, orgID, groups)
+}
+
+func (d *DB) CreateSnetServiceEndpoints(ctx context.Context, snetID string, endpoints []db.SnetServiceEndpoint) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tx().CreateSnetServiceEndpoints(ctx, snetID, endpoints)
+}
+
+func (d *DB) CreateSnetMethodPrices(ctx context.Context, snetID string, prices []db.SnetMethodPrice) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tx().CreateSnetMethodPrices(ctx, snetID, prices)
+}
+
+func (t memTx) id() int {
+	t.state.nextID++
+	return t.state.nextID
+}
+
+func (t memTx) CreateSnetService(_ context.Context, service db.SnetService) (int, error) {
+	now := time.Now()
+	if stored, ok := t.state.services[service.SnetID]; ok {
+		service.ID, service.CreatedAt, service.MetadataHash = stored.ID, stored.CreatedAt, stored.MetadataHash
+	} else {
+		service.ID, service.CreatedAt = t.id(), now
+	}
+	service.UpdatedAt, service.DeletedAt = now, nil
+	t.state.services[service.SnetID] = service
+	return service.ID, nil
+}
+
+func (t memTx) CreateSnetOrg(_ context.Context, org db.SnetOrganization) (int, error) {
+	if t.createOrgErr != nil {
+		if err := t.createOrgErr(org); err != nil {
+			return 0, err
+		}
+	}
+	now := time.Now()
+	if stored, ok := t.state.orgs[org.SnetID]; ok {
+		org.ID, org.CreatedAt = stored.ID, stored.CreatedAt
+	} else {
+		org.ID, org.CreatedAt = t.id(), now
+	}
+	org.UpdatedAt, org.DeletedAt = now, nil
+	t.state.orgs[org.SnetID] = org
+	return org.ID, nil
+}
+
+func (t memTx) CreateSnetOrgGroups(_ context.Context, orgID int, groups []db.SnetOrgGroup) error {
+	now := time.Now()
+	for _, group := range groups {
+		if stored, ok := t.state.groups[group.GroupID]; ok {
+			group.ID, group.CreatedAt = stored.ID, stored.CreatedAt
+		} else {
+			group.ID, group.CreatedAt = t.id(), now
+		}
+		group.OrgID, group.UpdatedAt, group.DeletedAt = orgID, now, nil
+		t.state.groups[group.GroupID] = group
+	}
+	return nil
+}
+
+func (t memTx) CreateSnetServiceEndpoints(_ context.Context, snetID string, endpoints []db.SnetServiceEndpoint) error {
+	var stored []db.SnetServiceEndpoint
+	for _, endpoint := range endpoints {
+		endpoint.ServiceSnetID = snetID
+		if !slices.ContainsFunc(stored, func(e db.SnetServiceEndpoint) bool {
+			return e.GroupID == endpoint.GroupID && e.URL == endpoint.URL
+		}) {
+			endpoint.ID = t.id()
+			stored = append(stored, endpoint)
+		}
+	}
+	t.state.endpoints[snetID] = stored
+	return nil
+}
+
+func (t memTx) CreateSnetMethodPrices(_ context.Context, snetID string, prices []db.SnetMethodPrice) error {
+	stored := make([]db.SnetMethodPrice, 0, len(prices))
+	for _, price := range prices {
+		price.ID, price.ServiceSnetID = t.id(), snetID
+		stored = append(stored, price)
+	}
+	t.state.prices[snetID] = stored
+	return nil
+}
+
+func (d *DB) GetSnetOrgs(ctx context.Context) ([]db.SnetOrganization, error) {
+	return d.ListSnetOrgs(ctx)
+}
+
+func (d *DB) GetSnetServices(ctx context.Context) ([]db.SnetService, error) {
+	return d.ListSnetServices(ctx, "")
+}
+
+func (d *DB) ListSnetOrgs(context.Context) ([]db.SnetOrganization, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var orgs []db.SnetOrganization
+	for _, org := range d.state.orgs {
+		if org.DeletedAt == nil {
+			orgs = append(orgs, org)
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].SnetID < orgs[j].SnetID })
+	return orgs, nil
+}
+
+func (d *DB) ListSnetServices(_ context.Context, orgSnetID string) ([]db.SnetService, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var services []db.SnetService
+	for _, service := range d.state.services {
+		if service.DeletedAt == nil && (orgSnetID == "" || service.SnetOrgID == orgSnetID) {
+			services = append(services, service)
+		}
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].SnetID < services[j].SnetID })
+	return services, nil
+}
+
+func (d *DB) GetSnetService(_ context.Context, snetID string) (db.SnetService, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	service, ok := d.state.services[snetID]
+	if !ok || service.DeletedAt != nil {
+		return db.SnetService{}, &db.NotFoundError{Kind: "service", SnetID: snetID}
+	}
+	return service, nil
+}
+
+func (d *DB) GetSnetServiceAggregate(_ context.Context, snetID string) (*db.ServiceAggregate, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	service, ok := d.state.services[snetID]
+	if !ok || service.DeletedAt != nil {
+		return nil, &db.NotFoundError{Kind: "service", SnetID: snetID}
+	}
+	aggregate := &db.ServiceAggregate{Service: service, Endpoints: slices.Clone(d.state.endpoints[snetID])}
+	org, ok := d.orgByID(service.OrgID)
+	if !ok {
+		return nil, &db.NotFoundError{Kind: "org", SnetID: service.SnetOrgID}
+	}
+	aggregate.Org = org
+	aggregate.Groups = d.groupsOf(org.ID)
+	return aggregate, nil
+}
+
+func (d *DB) GetSnetOrgGroup(_ context.Context, groupID string) (db.SnetOrgGroup, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	group, ok := d.state.groups[groupID]
+	if !ok || group.DeletedAt != nil {
+		return db.SnetOrgGroup{}, &db.NotFoundError{Kind: "group", SnetID: groupID}
+	}
+	return group, nil
+}
+
+func (d *DB) GetOrgGroups(_ context.Context, orgSnetID string) ([]db.SnetOrgGroup, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	org, ok := d.state.orgs[orgSnetID]
+	if !ok || org.DeletedAt != nil {
+		return nil, &db.NotFoundError{Kind: "org", SnetID: orgSnetID}
+	}
+	return d.groupsOf(org.ID), nil
+}
+
+// orgByID returns the org with the given row id, the lock must be held
+func (d *DB) orgByID(id int) (db.SnetOrganization, bool) {
+	for _, org := range d.state.orgs {
+		if org.ID == id {
+			return org, true
+		}
+	}
+	return db.SnetOrganization{}, false
+}
+
+// groupsOf returns the groups of an org ordered by id, the lock must be held
+func (d *DB) groupsOf(orgID int) []db.SnetOrgGroup {
+	var groups []db.SnetOrgGroup
+	for _, group := range d.state.groups {
+		if group.OrgID == orgID && group.DeletedAt == nil {
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups
+}
+
+func (d *DB) GetServiceEndpoints(_ context.Context, snetID string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var urls []string
+	for _, endpoint := range d.state.endpoints[snetID] {
+		urls = append(urls, endpoint.URL)
+	}
+	return urls, nil
+}
+
+func (d *DB) GetServiceMethodPrices(_ context.Context, snetID string) ([]db.SnetMethodPrice, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.state.prices[snetID]), nil
+}
+
+func (d *DB) GetMethodPrices(context.Context) (map[string][]db.SnetMethodPrice, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	prices := make(map[string][]db.SnetMethodPrice, len(d.state.prices))
+	for snetID, servicePrices := range d.state.prices {
+		if len(servicePrices) > 0 {
+			prices[snetID] = slices.Clone(servicePrices)
+		}
+	}
+	return prices, nil
+}
+
+func (d *DB) SetSnetServiceMetadataHash(_ context.Context, snetID, hash string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if service, ok := d.state.services[snetID]; ok {
+		service.MetadataHash = hash
+		d.state.services[snetID] = service
+	}
+	return nil
+}
+
+func (d *DB) GetSnetServiceMetadataHashes(context.Context) (map[string]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	hashes := make(map[string]string)
+	for snetID, service := range d.state.services {
+		if service.DeletedAt == nil && service.MetadataHash != "" {
+			hashes[snetID] = service.MetadataHash
+		}
+	}
+	return hashes, nil
+}
+
+func (d *DB) SaveServiceDescriptors(_ context.Context, snetID string, raw []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(raw) == 0 {
+		delete(d.state.descriptors, snetID)
+	} else {
+		d.state.descriptors[snetID] = slices.Clone(raw)
+	}
+	return nil
+}
+
+func (d *DB) GetServiceDescriptors(context.Context) (map[string][]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	descriptors := make(map[string][]byte, len(d.state.descriptors))
+	for snetID, raw := range d.state.descriptors {
+		if service, ok := d.state.services[snetID]; ok && service.DeletedAt == nil {
+			descriptors[snetID] = raw
+		}
+	}
+	return descriptors, nil
+}
+
+func (d *DB) DeleteSnetServicesNotIn(_ context.Context, seen []string, hard bool) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var deleted int64
+	now := time.Now()
+	for snetID, service := range d.state.services {
+		if slices.Contains(seen, snetID) {
+			continue
+		}
+		if hard {
+			d.deleteService(snetID)
+			deleted++
+		} else if service.DeletedAt == nil {
+			service.DeletedAt = &now
+			d.state.services[snetID] = service
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (d *DB) DeleteSnetOrgsNotIn(_ context.Context, seen []string, hard bool) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var deleted int64
+	now := time.Now()
+	for snetID, org := range d.state.orgs {
+		if slices.Contains(seen, snetID) {
+			continue
+		}
+		if !hard {
+			if org.DeletedAt == nil {
+				org.DeletedAt = &now
+				d.state.orgs[snetID] = org
+				deleted++
+			}
+			continue
+		}
+		for serviceSnetID, service := range d.state.services {
+			if service.OrgID == org.ID {
+				d.deleteService(serviceSnetID)
+			}
+		}
+		for groupID, group := range d.state.groups {
+			if group.OrgID == org.ID {
+				delete(d.state.groups, groupID)
+			}
+		}
+		delete(d.state.orgs, snetID)
+		deleted++
+	}
+	return deleted, nil
+}
+
+// deleteService removes a service and its rows, the lock must be held
+func (d *DB) deleteService(snetID string) {
+	delete(d.state.services, snetID)
+	delete(d.state.endpoints, snetID)
+	delete(d.state.prices, snetID)
+	delete(d.state.descriptors, snetID)
+}
+
+func (d *DB) GetSyncCheckpoint(context.Context) (db.SyncCheckpoint, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state.checkpoint == nil {
+		return db.SyncCheckpoint{}, false, nil
+	}
+	return *d.state.checkpoint, true, nil
+}
+
+func (d *DB) SaveSyncCheckpoint(_ context.Context, checkpoint db.SyncCheckpoint) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	checkpoint.UpdatedAt = time.Now()
+	d.state.checkpoint = &checkpoint
+	return nil
+}
+
+func (d *DB) ClearSyncCheckpoint(context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.state.checkpoint = nil
+	return nil
+}
+
+func (d *DB) CreateAuditEntry(_ context.Context, entry db.AuditEntry) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry.ID = d.tx().id()
+	entry.CreatedAt = time.Now()
+	d.state.audit = append(d.state.audit, entry)
+	return entry.ID, nil
+}
+
+func (d *DB) GetAuditEntries(_ context.Context, limit int) ([]db.AuditEntry, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entries := make([]db.AuditEntry, 0, min(limit, len(d.state.audit)))
+	for i := len(d.state.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, d.state.audit[i])
+	}
+	return entries, nil
+}
+
+func (d *DB) Health(context.Context) map[string]string {
+	return map[string]string{"message": "It's healthy"}
+}
+
+var _ db.Service = (*DB)(nil)
@@ -0,0 +1,196 @@
+// Package fakes has in-memory implementations of the registry, IPFS and DB dependencies of the
+// snet syncer, serving canned orgs, metadata and proto bundles so syncs can run without a chain,
+// a gateway or postgres
+package fakes
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"matrix-ai-framework/pkg/blockchain"
+	ipfs "matrix-ai-framework/pkg/ipfs"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// Registry serves orgs and services added with AddOrg, in the order they were added
+type Registry struct {
+	mu       sync.Mutex
+	orgs     []blockchain.Org
+	services map[[32]byte]map[[32]byte]blockchain.Service // key: org id, service id
+	// Err, when set, is returned by every call
+	Err error
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{services: make(map[[32]byte]map[[32]byte]blockchain.Service)}
+}
+
+// AddOrg registers an org with its metadata URI, and its services with theirs, key: service snet id
+func (r *Registry) AddOrg(orgSnetID, metadataURI string, serviceMetadataURIs map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	org := blockchain.Org{Found: true, Id: ID(orgSnetID), OrgMetadataURI: []byte(metadataURI)}
+	services := make(map[[32]byte]blockchain.Service, len(serviceMetadataURIs))
+	serviceSnetIDs := make([]string, 0, len(serviceMetadataURIs))
+	for serviceSnetID := range serviceMetadataURIs {
+		serviceSnetIDs = append(serviceSnetIDs, serviceSnetID)
+	}
+	sort.Strings(serviceSnetIDs)
+	for _, serviceSnetID := range serviceSnetIDs {
+		id := ID(serviceSnetID)
+		org.ServiceIds = append(org.ServiceIds, id)
+		services[id] = blockchain.Service{Found: true, Id: id, MetadataURI: []byte(serviceMetadataURIs[serviceSnetID])}
+	}
+	r.orgs = append(r.orgs, org)
+	r.services[org.Id] = services
+}
+
+// RemoveOrg unregisters an org and its services
+func (r *Registry) RemoveOrg(orgSnetID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := ID(orgSnetID)
+	r.orgs = slices.DeleteFunc(r.orgs, func(org blockchain.Org) bool { return org.Id == id })
+	delete(r.services, id)
+}
+
+func (r *Registry) GetOrgs(context.Context) ([][32]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	ids := make([][32]byte, 0, len(r.orgs))
+	for _, org := range r.orgs {
+		ids = append(ids, org.Id)
+	}
+	return ids, nil
+}
+
+func (r *Registry) GetOrgsPaged(ctx context.Context, offset, limit int) ([][32]byte, int, error) {
+	ids, err := r.GetOrgs(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset >= len(ids) {
+		return nil, len(ids), nil
+	}
+	return ids[offset:min(offset+limit, len(ids))], len(ids), nil
+}
+
+// GetOrg returns the org with the id, an org that isn't registered has Found unset like on-chain
+func (r *Registry) GetOrg(_ context.Context, orgID [32]byte) (blockchain.Org, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return blockchain.Org{}, r.Err
+	}
+	for _, org := range r.orgs {
+		if org.Id == orgID {
+			return org, nil
+		}
+	}
+	return blockchain.Org{}, nil
+}
+
+func (r *Registry) GetService(_ context.Context, orgID, serviceID [32]byte) (blockchain.Service, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return blockchain.Service{}, r.Err
+	}
+	return r.services[orgID][serviceID], nil
+}
+
+// ID converts a snet id to its on-chain form, zero-padded to 32 bytes
+func ID(snetID string) (id [32]byte) {
+	copy(id[:], snetID)
+	return id
+}
+
+// IPFS serves the files added with Add by CID or content URI, unknown CIDs fail like a gateway error
+type IPFS struct {
+	mu      sync.Mutex
+	files   map[string][]byte // key: normalized CID
+	fetches map[string]int
+}
+
+// NewIPFS returns an IPFS without files
+func NewIPFS() *IPFS {
+	return &IPFS{files: make(map[string][]byte), fetches: make(map[string]int)}
+}
+
+// Add stores a file under a CID, which doesn't have to be the hash of the content
+func (f *IPFS) Add(cID string, content []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[cID] = content
+}
+
+// AddJSON stores the JSON of v under a CID, e.g. org or service metadata
+func (f *IPFS) AddJSON(cID string, v any) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f.Add(cID, content)
+	return nil
+}
+
+// Fetches returns how many times a CID was fetched
+func (f *IPFS) Fetches(cID string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetches[cID]
+}
+
+func (f *IPFS) GetIpfsFileForOrg(ctx context.Context, _, hash string) ([]byte, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	cID, err := ipfs.ParseContentURI(hash)
+	if err != nil {
+		return nil, "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetches[cID]++
+	content, ok := f.files[cID]
+	if !ok {
+		return nil, cID, &ipfs.GatewayError{Hash: cID, Message: "not found"}
+	}
+	return content, cID, nil
+}
+
+func (f *IPFS) CacheStats() ipfs.CacheStats {
+	return ipfs.CacheStats{}
+}
+
+// Archive packs proto files into a tar archive like the model bundles of services, key: file name
+func Archive(files map[string]string) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	for _, name := range names {
+		header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}
+		if err := writer.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("archive %s: %w", name, err)
+		}
+		if _, err := writer.Write([]byte(files[name])); err != nil {
+			return nil, fmt.Errorf("archive %s: %w", name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return archive.Bytes(), nil
+}
@@ -0,0 +1,11 @@
+package snet_syncer
+
+import "slices"
+
+// syncsOrg reports whether an org passes IncludeOrgs and ExcludeOrgs, an org in both lists is excluded
+func (s *SnetSyncer) syncsOrg(orgSnetID string) bool {
+	if slices.Contains(s.ExcludeOrgs, orgSnetID) {
+		return false
+	}
+	return len(s.IncludeOrgs) == 0 || slices.Contains(s.IncludeOrgs, orgSnetID)
+}
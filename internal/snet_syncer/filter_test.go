@@ -0,0 +1,40 @@
+package snet_syncer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSyncOrgFilters(t *testing.T) {
+	for _, test := range []struct {
+		name             string
+		include, exclude []string
+		want             []string
+	}{
+		{name: "no lists", want: []string{"svc1", "svc2", "svc3"}},
+		{name: "include", include: []string{"org1", "org3"}, want: []string{"svc1", "svc3"}},
+		{name: "exclude", exclude: []string{"org2"}, want: []string{"svc1", "svc3"}},
+		{name: "exclude wins", include: []string{"org1", "org2"}, exclude: []string{"org2"}, want: []string{"svc1"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			n := newTestNet(t)
+			n.addOrg("org1", "svc1")
+			n.addOrg("org2", "svc2")
+			n.addOrg("org3", "svc3")
+			s := n.syncer()
+			s.IncludeOrgs, s.ExcludeOrgs = test.include, test.exclude
+
+			syncOnce(t, s)
+			if got := n.storedServices(); !slices.Equal(got, test.want) {
+				t.Fatalf("stored services %v, want %v", got, test.want)
+			}
+			// filtered orgs are skipped before any IPFS work
+			for _, org := range []string{"org1", "org2", "org3"} {
+				synced := slices.Contains(test.want, "svc"+org[len("org"):])
+				if fetched := n.ipfs.Fetches(cidOf(org)) > 0; fetched != synced {
+					t.Errorf("metadata of %s fetched: %t, want %t", org, fetched, synced)
+				}
+			}
+		})
+	}
+}
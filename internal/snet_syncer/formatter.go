@@ -0,0 +1,183 @@
+package snet_syncer
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"html"
+	"matrix-ai-framework/internal/sanitizer"
+	"matrix-ai-framework/pkg/db"
+	"strings"
+	"time"
+)
+
+// DescriptorFormatter renders the services info. The syncer walks the services in the order of
+// GetSnetServicesInfo and joins what the formatter returns for each part, implementations escape the
+// names and values coming from the published metadata and protos as their format needs.
+type DescriptorFormatter interface {
+	// ListOpen and ListClose surround the items of the services, Empty is rendered instead of both when
+	// there are none
+	ListOpen() string
+	ListClose() string
+	Empty() string
+	// File renders a proto file of a service, the first file of a stored service is followed by Service
+	File(snetID string, file protoreflect.FileDescriptor) string
+	// Service renders the details a stored service has in the catalog
+	Service(service ServiceView) string
+	// GRPCService renders a gRPC service of a file around its rendered methods
+	GRPCService(service protoreflect.ServiceDescriptor, methods []string) string
+	Method(method MethodView) string
+	// CompileErrors renders the item of a service whose protos failed to compile
+	CompileErrors(snetID string, errs []CompileDiagnostic) string
+}
+
+// ServiceView is a stored service as passed to DescriptorFormatter.Service
+type ServiceView struct {
+	SnetID      string
+	Price       int    // cogs per call
+	Description string // sanitized HTML, the short description if there is one
+	// Duplicates are the services merged into this one by MergeDuplicates
+	Duplicates []db.SnetService
+	Health     EndpointHealth
+}
+
+// MethodView is a method as passed to DescriptorFormatter.Method
+type MethodView struct {
+	Descriptor protoreflect.MethodDescriptor
+	// Price is the price of a call in cogs, CustomPrice reports whether it differs from the price of the
+	// service. Both are unset for services that aren't stored.
+	Price       int
+	CustomPrice bool
+	Streaming   string // StreamingKind of the method
+	Options     []MethodOption
+}
+
+// RenderMessage renders the fields of a message as a JSON-like object, see renderFields. escape is
+// applied to the names and types of the fields, nil leaves them as they are.
+func RenderMessage(message protoreflect.MessageDescriptor, escape func(string) string) string {
+	if escape == nil {
+		escape = func(text string) string { return text }
+	}
+	return renderFields(message, 0, map[protoreflect.FullName]bool{}, escape)
+}
+
+// HTMLFormatter renders the services info as the HTML list of GetSnetServicesInfo, for Matrix messages
+type HTMLFormatter struct{}
+
+func (HTMLFormatter) ListOpen() string  { return "<div style=\"line-height: 0.8;\"><ol>" }
+func (HTMLFormatter) ListClose() string { return "</ol></div>" }
+func (HTMLFormatter) Empty() string     { return "<p>No services are synced yet.</p>" }
+
+func (HTMLFormatter) File(snetID string, file protoreflect.FileDescriptor) string {
+	return "<li><strong>Path: " + html.EscapeString(file.Path()) + " Snet ID: " + html.EscapeString(snetID) +
+		" Descriptor: " + html.EscapeString(string(file.FullName().Name())) + "</strong></li>"
+}
+
+func (HTMLFormatter) Service(service ServiceView) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("<p>💰Price: %d cogs per call</p>", service.Price))
+	if service.Description != "" {
+		builder.WriteString("<p>📝" + service.Description + "</p>")
+	}
+	for _, other := range service.Duplicates {
+		builder.WriteString(fmt.Sprintf("<p>🔀Also available from: %s/%s, price: %d cogs</p>",
+			html.EscapeString(other.SnetOrgID), html.EscapeString(other.SnetID), other.Price))
+	}
+	if service.Health.Status == EndpointUnreachable {
+		builder.WriteString(fmt.Sprintf("<p>⚠️Endpoint unreachable, checked at %s</p>", service.Health.CheckedAt.UTC().Format(time.RFC3339)))
+	}
+	return builder.String()
+}
+
+func (HTMLFormatter) GRPCService(service protoreflect.ServiceDescriptor, methods []string) string {
+	return "<p><em>Service: " + html.EscapeString(string(service.Name())) + "</em></p><p>🔁Methods: </p><ul>" +
+		strings.Join(methods, "") + "</ul>"
+}
+
+func (HTMLFormatter) Method(method MethodView) string {
+	var builder strings.Builder
+	builder.WriteString("<li>" + html.EscapeString(string(method.Descriptor.Name())))
+	if method.CustomPrice {
+		builder.WriteString(fmt.Sprintf(" — %d cogs", method.Price))
+	}
+	if method.Streaming != "" {
+		builder.WriteString(" <em>(" + method.Streaming + " stream)</em>")
+	}
+	for _, option := range method.Options {
+		builder.WriteString(" <em>(" + html.EscapeString(option.Label+": "+option.Value) + ")</em>")
+	}
+	builder.WriteString("<br>")
+	builder.WriteString("<p>➡️Input:</p>")
+	builder.WriteString("<pre><code>" + RenderMessage(method.Descriptor.Input(), html.EscapeString) + "</code></pre>")
+	builder.WriteString("<p>➡️Output:</p>")
+	builder.WriteString("<pre><code>" + RenderMessage(method.Descriptor.Output(), html.EscapeString) + "</code></pre>")
+	builder.WriteString("</li>")
+	return builder.String()
+}
+
+func (HTMLFormatter) CompileErrors(snetID string, errs []CompileDiagnostic) string {
+	var builder strings.Builder
+	builder.WriteString("<li><strong>Snet ID: " + html.EscapeString(snetID) + "</strong><p>⚠️Methods unavailable, proto compilation failed:</p><ul>")
+	for _, err := range errs {
+		builder.WriteString("<li>" + html.EscapeString(err.Error()) + "</li>")
+	}
+	builder.WriteString("</ul></li>")
+	return builder.String()
+}
+
+// PlainTextFormatter renders the services info as indented plain text, for the body of Matrix messages,
+// logs and terminals
+type PlainTextFormatter struct{}
+
+func (PlainTextFormatter) ListOpen() string  { return "" }
+func (PlainTextFormatter) ListClose() string { return "" }
+func (PlainTextFormatter) Empty() string     { return "No services are synced yet.\n" }
+
+func (PlainTextFormatter) File(snetID string, file protoreflect.FileDescriptor) string {
+	return "Path: " + file.Path() + " Snet ID: " + snetID + " Descriptor: " + string(file.FullName().Name()) + "\n"
+}
+
+func (PlainTextFormatter) Service(service ServiceView) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("  💰Price: %d cogs per call\n", service.Price))
+	if description := sanitizer.PlainText(service.Description); description != "" {
+		builder.WriteString("  📝" + strings.ReplaceAll(description, "\n", "\n  ") + "\n")
+	}
+	for _, other := range service.Duplicates {
+		builder.WriteString(fmt.Sprintf("  🔀Also available from: %s/%s, price: %d cogs\n", other.SnetOrgID, other.SnetID, other.Price))
+	}
+	if service.Health.Status == EndpointUnreachable {
+		builder.WriteString(fmt.Sprintf("  ⚠️Endpoint unreachable, checked at %s\n", service.Health.CheckedAt.UTC().Format(time.RFC3339)))
+	}
+	return builder.String()
+}
+
+func (PlainTextFormatter) GRPCService(service protoreflect.ServiceDescriptor, methods []string) string {
+	return "  Service: " + string(service.Name()) + "\n  🔁Methods:\n" + strings.Join(methods, "")
+}
+
+func (PlainTextFormatter) Method(method MethodView) string {
+	var builder strings.Builder
+	builder.WriteString("  - " + string(method.Descriptor.Name()))
+	if method.CustomPrice {
+		builder.WriteString(fmt.Sprintf(" — %d cogs", method.Price))
+	}
+	if method.Streaming != "" {
+		builder.WriteString(" (" + method.Streaming + " stream)")
+	}
+	for _, option := range method.Options {
+		builder.WriteString(" (" + option.Label + ": " + option.Value + ")")
+	}
+	// the fields are indented under the method
+	builder.WriteString("\n    ➡️Input:\n      " + strings.ReplaceAll(RenderMessage(method.Descriptor.Input(), nil), "\n", "\n      "))
+	builder.WriteString("\n    ➡️Output:\n      " + strings.ReplaceAll(RenderMessage(method.Descriptor.Output(), nil), "\n", "\n      ") + "\n")
+	return builder.String()
+}
+
+func (PlainTextFormatter) CompileErrors(snetID string, errs []CompileDiagnostic) string {
+	var builder strings.Builder
+	builder.WriteString("Snet ID: " + snetID + "\n  ⚠️Methods unavailable, proto compilation failed:\n")
+	for _, err := range errs {
+		builder.WriteString("  - " + err.Error() + "\n")
+	}
+	return builder.String()
+}
@@ -0,0 +1,141 @@
+package snet_syncer
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+	"testing"
+)
+
+func TestHTMLFormatterEscapesNames(t *testing.T) {
+	name := "<b>&.proto"
+	fd := compileFile(t, map[string]string{name: fmt.Sprintf(echoProto, "echo")}, name)
+	s := newTestNet(t).syncer()
+	s.setDescriptors("org1", "svc<i>", []protoreflect.FileDescriptor{fd}, nil)
+	s.compileErrors["bad<script>"] = []CompileDiagnostic{{SnetID: "bad<script>", File: "x.proto", Message: "unknown type <T>"}}
+
+	info := s.GetSnetServicesInfo()
+	for _, want := range []string{"Path: &lt;b&gt;&amp;.proto", "Snet ID: svc&lt;i&gt;", "Snet ID: bad&lt;script&gt;", "unknown type &lt;T&gt;"} {
+		if !strings.Contains(info, want) {
+			t.Errorf("services info doesn't contain %q:\n%s", want, info)
+		}
+	}
+	for _, raw := range []string{"<b>", "<i>", "<script>", "<T>"} {
+		if strings.Contains(info, raw) {
+			t.Errorf("services info contains %q unescaped:\n%s", raw, info)
+		}
+	}
+	if err := wellFormed(info); err != nil {
+		t.Fatalf("services info isn't well-formed: %v", err)
+	}
+}
+
+// goldenProto is the model of the service rendered by the golden tests
+const goldenProto = `syntax = "proto3";
+package shop;
+
+message Order { string item = 1; int32 count = 2; }
+message Receipt { int64 total = 1; }
+
+service Shop {
+  rpc Buy(Order) returns (Receipt);
+  rpc Watch(Order) returns (stream Receipt);
+}
+`
+
+// goldenSyncer returns a syncer of a service of goldenProto and of a service failing to compile
+func goldenSyncer(t *testing.T) *SnetSyncer {
+	t.Helper()
+	n := newTestNet(t)
+	n.addService("svc1", modelOf("svc1"), map[string]string{"shop.proto": goldenProto})
+	n.registerOrg("org1", map[string]string{"svc1": "ipfs://" + cidOf("svc1")})
+	s := n.syncer()
+	syncOnce(t, s)
+	s.compileErrors["svc2"] = []CompileDiagnostic{{SnetID: "svc2", File: "bad.proto", Line: 3, Column: 5, Message: "syntax error"}}
+	return s
+}
+
+func TestRenderHTMLGolden(t *testing.T) {
+	fields := "<p>➡️Input:</p><pre><code>{\n    \"item\": string\n    \"count\": int32\n}</code></pre>" +
+		"<p>➡️Output:</p><pre><code>{\n    \"total\": int64 (JSON string)\n}</code></pre>"
+	want := "<div style=\"line-height: 0.8;\"><ol>" +
+		"<li><strong>Path: shop.proto Snet ID: svc1 Descriptor: shop</strong></li>" +
+		"<p>💰Price: 7 cogs per call</p><p>📝Echoes svc1</p>" +
+		"<p><em>Service: Shop</em></p><p>🔁Methods: </p><ul>" +
+		"<li>Buy<br>" + fields + "</li>" +
+		"<li>Watch <em>(server stream)</em><br>" + fields + "</li>" +
+		"</ul>" +
+		"<li><strong>Snet ID: svc2</strong><p>⚠️Methods unavailable, proto compilation failed:</p><ul><li>bad.proto:3:5: syntax error</li></ul></li>" +
+		"</ol></div>"
+
+	s := goldenSyncer(t)
+	if got := s.Render(HTMLFormatter{}); got != want {
+		t.Fatalf("rendered\n%s\nwant\n%s", got, want)
+	}
+	if got := s.GetSnetServicesInfo(); got != want {
+		t.Fatalf("GetSnetServicesInfo differs from Render(HTMLFormatter{}):\n%s", got)
+	}
+}
+
+func TestRenderPlainTextGolden(t *testing.T) {
+	const fields = `    ➡️Input:
+      {
+          "item": string
+          "count": int32
+      }
+    ➡️Output:
+      {
+          "total": int64 (JSON string)
+      }
+`
+	want := `Path: shop.proto Snet ID: svc1 Descriptor: shop
+  💰Price: 7 cogs per call
+  📝Echoes svc1
+  Service: Shop
+  🔁Methods:
+  - Buy
+` + fields + `  - Watch (server stream)
+` + fields + `Snet ID: svc2
+  ⚠️Methods unavailable, proto compilation failed:
+  - bad.proto:3:5: syntax error
+`
+
+	if got := goldenSyncer(t).Render(PlainTextFormatter{}); got != want {
+		t.Fatalf("rendered\n%s\nwant\n%s", got, want)
+	}
+}
+
+// recordingFormatter renders each part as its kind and name, so the order of the walk shows
+type recordingFormatter struct{}
+
+func (recordingFormatter) ListOpen() string  { return "open|" }
+func (recordingFormatter) ListClose() string { return "close" }
+func (recordingFormatter) Empty() string     { return "empty" }
+func (recordingFormatter) File(snetID string, file protoreflect.FileDescriptor) string {
+	return "file " + snetID + "/" + file.Path() + "|"
+}
+func (recordingFormatter) Service(service ServiceView) string {
+	return fmt.Sprintf("service %s %d|", service.SnetID, service.Price)
+}
+func (recordingFormatter) GRPCService(service protoreflect.ServiceDescriptor, methods []string) string {
+	return "grpc " + string(service.Name()) + "[" + strings.Join(methods, ",") + "]|"
+}
+func (recordingFormatter) Method(method MethodView) string {
+	if method.Streaming != "" {
+		return string(method.Descriptor.Name()) + "(" + method.Streaming + ")"
+	}
+	return string(method.Descriptor.Name())
+}
+func (recordingFormatter) CompileErrors(snetID string, errs []CompileDiagnostic) string {
+	return fmt.Sprintf("errors %s %d|", snetID, len(errs))
+}
+
+func TestRenderWalk(t *testing.T) {
+	want := "open|file svc1/shop.proto|service svc1 7|grpc Shop[Buy,Watch(server)]|errors svc2 1|close"
+	if got := goldenSyncer(t).Render(recordingFormatter{}); got != want {
+		t.Fatalf("walked %q, want %q", got, want)
+	}
+	if got := newTestNet(t).syncer().Render(recordingFormatter{}); got != "empty" {
+		t.Fatalf("walked %q without services, want %q", got, "empty")
+	}
+}
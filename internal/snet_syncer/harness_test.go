@@ -0,0 +1,164 @@
+package snet_syncer
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"matrix-ai-framework/internal/snet_syncer/fakes"
+	"matrix-ai-framework/pkg/blockchain"
+	"strings"
+	"testing"
+)
+
+// echoProto is a bundle file with a single unary method, %s is its package
+const echoProto = `syntax = "proto3";
+package %s;
+
+message Request { string text = 1; }
+message Response { string text = 1; }
+
+service Echo {
+  rpc Say(Request) returns (Response);
+}
+`
+
+// testNet is a registry, IPFS and DB of fakes, serving the orgs and services added by the helpers
+type testNet struct {
+	t        *testing.T
+	registry *fakes.Registry
+	ipfs     *fakes.IPFS
+	db       *fakes.DB
+}
+
+func newTestNet(t *testing.T) *testNet {
+	t.Helper()
+	return &testNet{t: t, registry: fakes.NewRegistry(), ipfs: fakes.NewIPFS(), db: fakes.NewDB()}
+}
+
+// cidOf returns the CID the metadata of an org or service is stored under, ids must be alphanumeric
+func cidOf(snetID string) string {
+	return "Qm" + snetID
+}
+
+// modelOf returns the CID of the model of a service added by addOrg
+func modelOf(snetID string) string {
+	return "QmModel" + snetID
+}
+
+// addOrg registers an org with a group and services, each with a model of its own holding echoProto
+func (n *testNet) addOrg(orgSnetID string, serviceSnetIDs ...string) {
+	n.t.Helper()
+	uris := make(map[string]string, len(serviceSnetIDs))
+	for _, serviceSnetID := range serviceSnetIDs {
+		n.addService(serviceSnetID, modelOf(serviceSnetID), map[string]string{
+			"echo.proto": fmt.Sprintf(echoProto, serviceSnetID),
+		})
+		uris[serviceSnetID] = "ipfs://" + cidOf(serviceSnetID)
+	}
+	n.registerOrg(orgSnetID, uris)
+}
+
+// registerOrg stores the metadata of an org and registers it with the metadata URIs of its services
+func (n *testNet) registerOrg(orgSnetID string, serviceURIs map[string]string) {
+	n.t.Helper()
+	org := blockchain.OrganizationMetaData{
+		OrgName: "Org " + orgSnetID,
+		OrgID:   orgSnetID,
+		Groups: []blockchain.Group{{
+			GroupName:      "default",
+			GroupID:        "Zw==",
+			PaymentDetails: blockchain.Payment{PaymentAddress: "0x0000000000000000000000000000000000000001"},
+		}},
+	}
+	if err := n.ipfs.AddJSON(cidOf(orgSnetID), org); err != nil {
+		n.t.Fatal(err)
+	}
+	n.registry.AddOrg(orgSnetID, "ipfs://"+cidOf(orgSnetID), serviceURIs)
+}
+
+// addService stores the metadata of a service priced 7 cogs per call, and its model made of files
+// unless files is nil
+func (n *testNet) addService(serviceSnetID, modelHash string, files map[string]string) {
+	n.t.Helper()
+	if err := n.ipfs.AddJSON(cidOf(serviceSnetID), serviceMeta(serviceSnetID, modelHash)); err != nil {
+		n.t.Fatal(err)
+	}
+	if files != nil {
+		n.addModel(modelHash, files)
+	}
+}
+
+// addModel stores a model bundle under a CID
+func (n *testNet) addModel(modelHash string, files map[string]string) {
+	n.t.Helper()
+	archive, err := fakes.Archive(files)
+	if err != nil {
+		n.t.Fatal(err)
+	}
+	n.ipfs.Add(modelHash, archive)
+}
+
+func serviceMeta(serviceSnetID, modelHash string) blockchain.ServiceMetadata {
+	service := blockchain.ServiceMetadata{
+		DisplayName:   "Service " + serviceSnetID,
+		ModelIpfsHash: modelHash,
+		Groups: []blockchain.ServiceGroup{{
+			GroupName: "default",
+			GroupID:   "Zw==",
+			Endpoints: []string{"https://" + strings.ToLower(serviceSnetID) + ".example.com:443"},
+			Pricing:   []blockchain.Pricing{{Default: true, PriceModel: blockchain.PriceModelFixed, PriceInCogs: 7}},
+		}},
+	}
+	service.ServiceDescription.ShortDescription = "Echoes " + serviceSnetID
+	return service
+}
+
+// syncer returns a syncer of the fakes, logging nothing and not retrying missing files
+func (n *testNet) syncer() *SnetSyncer {
+	n.t.Helper()
+	logger := zerolog.Nop()
+	s, err := New(n.registry, n.ipfs, n.db, &logger)
+	if err != nil {
+		n.t.Fatal(err)
+	}
+	s.IPFSRetry = RetryPolicy{MaxAttempts: 1}
+	return s
+}
+
+// syncOnce runs a pass of s, failing the test on an error or an incomplete pass
+func syncOnce(t *testing.T, s *SnetSyncer) SyncSnapshot {
+	t.Helper()
+	snapshot, complete, err := s.syncOnce(context.Background())
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if !complete {
+		t.Fatal("sync pass didn't complete")
+	}
+	return snapshot
+}
+
+// storedServices returns the snet ids of the services in the DB
+func (n *testNet) storedServices() []string {
+	n.t.Helper()
+	services, err := n.db.GetSnetServices(context.Background())
+	if err != nil {
+		n.t.Fatal(err)
+	}
+	snetIDs := make([]string, 0, len(services))
+	for _, service := range services {
+		snetIDs = append(snetIDs, service.SnetID)
+	}
+	return snetIDs
+}
+
+// compileFile compiles a file of a bundle, failing the test on an error
+func compileFile(t *testing.T, bundle map[string]string, name string) protoreflect.FileDescriptor {
+	t.Helper()
+	fd, err := getFileDescriptor(bundle, name, nil)
+	if err != nil {
+		t.Fatalf("compile %s: %v", name, err)
+	}
+	return fd
+}
@@ -0,0 +1,173 @@
+package snet_syncer
+
+import (
+	"context"
+	"matrix-ai-framework/pkg/db"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint health statuses
+const (
+	EndpointUnknown     = "unknown" // not checked yet
+	EndpointHealthy     = "healthy"
+	EndpointUnreachable = "endpoint_unreachable"
+)
+
+const (
+	endpointDialTimeout           = 5 * time.Second
+	defaultHealthCheckConcurrency = 8
+)
+
+// EndpointHealth is the last known reachability of the daemons of a service. A service is healthy when
+// one of its endpoints accepted a connection and unreachable when none did.
+type EndpointHealth struct {
+	Status    string    `json:"status"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+	// Healthy are the endpoints that accepted a connection, in the order of the metadata
+	Healthy []string `json:"healthy_endpoints,omitempty"`
+}
+
+// healthStore is shared by all copies of the syncer, so it is held by pointer
+type healthStore struct {
+	mu       sync.RWMutex
+	statuses map[string]EndpointHealth // key: service snet id
+}
+
+// EndpointHealth returns the last health check result of the service, EndpointUnknown before the first check
+func (s *SnetSyncer) EndpointHealth(snetID string) EndpointHealth {
+	s.health.mu.RLock()
+	defer s.health.mu.RUnlock()
+	if health, ok := s.health.statuses[snetID]; ok {
+		return health
+	}
+	return EndpointHealth{Status: EndpointUnknown}
+}
+
+// Invokable reports whether calls to the service can succeed: it compiled, or waits for lazy compilation,
+// and its endpoints were not all found unreachable. Services not checked yet are considered invokable.
+func (s *SnetSyncer) Invokable(snetID string) bool {
+	return s.hasProtos(snetID) && s.EndpointHealth(snetID).Status != EndpointUnreachable
+}
+
+// CheckEndpoints dials every endpoint of every synced service, up to HealthCheckConcurrency at once, and
+// records the health of the services
+func (s *SnetSyncer) CheckEndpoints(ctx context.Context) {
+	services, err := s.DB.GetSnetServices(ctx)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to get services for health check")
+		return
+	}
+	endpoints := make([][]string, len(services))
+	dialErrs := make([][]error, len(services))
+	for i, service := range services {
+		endpoints[i] = s.serviceEndpoints(ctx, service)
+		dialErrs[i] = make([]error, len(endpoints[i]))
+	}
+
+	concurrency := s.HealthCheckConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultHealthCheckConcurrency
+	}
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for i := range services {
+		for j, endpoint := range endpoints[i] {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				wg.Wait()
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer func() { <-slots; wg.Done() }()
+				_, _, dialErrs[i][j] = dialEndpoint(ctx, endpoint)
+			}()
+		}
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	for i, service := range services {
+		health := EndpointHealth{Status: EndpointUnreachable, CheckedAt: time.Now()}
+		var failures []string
+		for j, endpoint := range endpoints[i] {
+			if err := dialErrs[i][j]; err != nil {
+				failures = append(failures, endpoint+": "+err.Error())
+				continue
+			}
+			health.Healthy = append(health.Healthy, endpoint)
+		}
+		if len(health.Healthy) > 0 {
+			health.Status = EndpointHealthy
+		} else {
+			s.log.Warn().Strs("errors", failures).Str("snet-id", service.SnetID).Msg("Service endpoints unreachable")
+		}
+		health.Error = strings.Join(failures, "; ")
+		s.health.mu.Lock()
+		s.health.statuses[service.SnetID] = health
+		s.health.mu.Unlock()
+	}
+}
+
+// serviceEndpoints returns the endpoints of the group of the service, or its URL when there is none
+func (s *SnetSyncer) serviceEndpoints(ctx context.Context, service db.SnetService) []string {
+	if endpoints, err := s.DB.GetServiceEndpoints(ctx, service.SnetID); err == nil && len(endpoints) > 0 {
+		return endpoints
+	}
+	return []string{service.URL}
+}
+
+// ServiceEndpoint returns the endpoint calls to the service are sent to: the first endpoint the last
+// health check found healthy, or the first endpoint of its group when none was or before the first check
+func (s *SnetSyncer) ServiceEndpoint(ctx context.Context, service db.SnetService) string {
+	endpoints := s.serviceEndpoints(ctx, service)
+	health := s.EndpointHealth(service.SnetID)
+	for _, endpoint := range endpoints {
+		if slices.Contains(health.Healthy, endpoint) {
+			return endpoint
+		}
+	}
+	return endpoints[0]
+}
+
+// StartHealthChecks checks the service endpoints every HealthCheckInterval until ctx is done, a zero
+// interval disables the checks
+func (s *SnetSyncer) StartHealthChecks(ctx context.Context) {
+	if s.HealthCheckInterval <= 0 {
+		return
+	}
+	s.CheckEndpoints(ctx)
+	ticker := s.newTicker(s.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			s.CheckEndpoints(ctx)
+		}
+	}
+}
+
+// dialEndpoint checks that the service endpoint accepts TCP connections
+func dialEndpoint(ctx context.Context, endpoint string) (address string, secure bool, err error) {
+	address, secure, err = endpointAddress(endpoint)
+	if err != nil {
+		return "", false, err
+	}
+	dialer := net.Dialer{Timeout: endpointDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return address, secure, err
+	}
+	_ = conn.Close()
+	return address, secure, nil
+}
@@ -0,0 +1,105 @@
+package snet_syncer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// closedEndpoint returns an endpoint nothing listens on
+func closedEndpoint(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := "http://" + listener.Addr().String()
+	listener.Close()
+	return endpoint
+}
+
+// openEndpoint returns an endpoint accepting connections until the test ends
+func openEndpoint(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return "http://" + listener.Addr().String()
+}
+
+// addServiceWithEndpoints adds a service of echoProto whose group lists endpoints
+func (n *testNet) addServiceWithEndpoints(serviceSnetID string, endpoints ...string) {
+	n.t.Helper()
+	meta := serviceMeta(serviceSnetID, modelOf(serviceSnetID))
+	meta.Groups[0].Endpoints = endpoints
+	if err := n.ipfs.AddJSON(cidOf(serviceSnetID), meta); err != nil {
+		n.t.Fatal(err)
+	}
+	n.addModel(modelOf(serviceSnetID), map[string]string{"echo.proto": fmt.Sprintf(echoProto, serviceSnetID)})
+}
+
+func TestCheckEndpointsChecksEveryEndpoint(t *testing.T) {
+	n := newTestNet(t)
+	closed, open := closedEndpoint(t), openEndpoint(t)
+	n.addServiceWithEndpoints("svc1", closed, open)
+	n.addServiceWithEndpoints("svc2", closed)
+	n.registerOrg("org1", map[string]string{"svc1": "ipfs://" + cidOf("svc1"), "svc2": "ipfs://" + cidOf("svc2")})
+	s := n.syncer()
+	syncOnce(t, s)
+
+	service, err := n.db.GetSnetService(context.Background(), "svc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// before the first check calls go to the first endpoint
+	if got := s.ServiceEndpoint(context.Background(), service); got != closed {
+		t.Fatalf("svc1 is called at %s before the checks, want its first endpoint", got)
+	}
+
+	s.HealthCheckConcurrency = 1
+	s.CheckEndpoints(context.Background())
+	health := s.EndpointHealth("svc1")
+	if health.Status != EndpointHealthy || !slices.Equal(health.Healthy, []string{open}) || !strings.Contains(health.Error, closed) {
+		t.Fatalf("svc1 health %+v, want healthy at its second endpoint only", health)
+	}
+	if got := s.ServiceEndpoint(context.Background(), service); got != open {
+		t.Fatalf("svc1 is called at %s, want the endpoint found healthy", got)
+	}
+	if health := s.EndpointHealth("svc2"); health.Status != EndpointUnreachable || len(health.Healthy) != 0 {
+		t.Fatalf("svc2 health %+v, want unreachable", health)
+	}
+}
+
+func TestStartHealthChecksStopsWithContext(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1")
+	s := n.syncer()
+	s.HealthCheckInterval = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.StartHealthChecks(ctx)
+		close(stopped)
+	}()
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("health checks still running after ctx was canceled")
+	}
+}
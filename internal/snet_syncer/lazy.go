@@ -0,0 +1,197 @@
+package snet_syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// lazyBundle holds the proto sources of a service synced with LazyCompile until they are first compiled
+type lazyBundle struct {
+	orgSnetID   string
+	bundle      map[string]string
+	once        sync.Once
+	descriptors []protoreflect.FileDescriptor
+	errs        []CompileDiagnostic
+}
+
+// compileBundle compiles the files of a bundle in a fixed order, so the descriptors don't depend on map
+// iteration. Files that fail to compile are logged and their problems returned as diagnostics. A bundle
+// declaring no gRPC service, e.g. only message types, has nothing to call and returns no descriptors.
+// How long it took is recorded for CompileStats.
+func (s *SnetSyncer) compileBundle(snetID string, bundle map[string]string) (descriptors []protoreflect.FileDescriptor, compileErrs []CompileDiagnostic) {
+	if len(bundle) > 0 {
+		defer s.compileStats.record(snetID, len(bundle), time.Now())
+	}
+	fileNames := make([]string, 0, len(bundle))
+	for fileName := range bundle {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	for _, fileName := range fileNames {
+		fd, err := s.compileProto(bundle, fileName)
+		if err != nil {
+			s.log.Error().Err(err).Str("snet-id", snetID).Str("file", fileName).Msg("Failed to compile proto file")
+			for _, diagnostic := range compileDiagnostics(snetID, fileName, err) {
+				// a broken import fails every file importing it with the same problem
+				if !slices.Contains(compileErrs, diagnostic) {
+					compileErrs = append(compileErrs, diagnostic)
+				}
+			}
+			s.metrics.compileFailed()
+			continue
+		}
+		descriptors = append(descriptors, fd)
+	}
+	if len(descriptors) > 0 && !declaresService(descriptors) {
+		s.log.Warn().Str("snet-id", snetID).Int("files", len(descriptors)).Msg("Protos declare no gRPC service, service isn't callable")
+		return nil, compileErrs
+	}
+	return descriptors, compileErrs
+}
+
+// declaresService reports whether any of the files declares a gRPC service
+func declaresService(descriptors []protoreflect.FileDescriptor) bool {
+	for _, descriptor := range descriptors {
+		if descriptor.Services().Len() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// descriptorKey returns the key of the descriptors of a service in FileDescriptors. Service ids are only
+// unique within an org, the key keeps the descriptors of one org from being taken for another's.
+func descriptorKey(orgSnetID, snetID string) string {
+	return orgSnetID + "/" + snetID
+}
+
+// descriptorsOf returns the descriptors of a service for the org it was synced for, the caller must hold descriptorsMu
+func (s *SnetSyncer) descriptorsOf(snetID string) []protoreflect.FileDescriptor {
+	orgSnetID, ok := s.descriptorOrgs[snetID]
+	if !ok {
+		return nil
+	}
+	return s.FileDescriptors[descriptorKey(orgSnetID, snetID)]
+}
+
+// setDescriptors replaces the descriptors, compile errors and pending sources of a service synced for an
+// org, dropping the descriptors of another org it was synced for before. The caller must hold descriptorsMu.
+// Re-syncs replace rather than append, so they don't pile up copies of the same files.
+func (s *SnetSyncer) setDescriptors(orgSnetID, snetID string, descriptors []protoreflect.FileDescriptor, compileErrs []CompileDiagnostic) {
+	delete(s.pendingProtos, snetID)
+	delete(s.compileErrors, snetID)
+	delete(s.serviceless, snetID)
+	if previous, ok := s.descriptorOrgs[snetID]; ok {
+		delete(s.FileDescriptors, descriptorKey(previous, snetID))
+		delete(s.descriptorOrgs, snetID)
+	}
+	if len(compileErrs) > 0 {
+		s.compileErrors[snetID] = compileErrs
+	}
+	if len(descriptors) > 0 {
+		s.FileDescriptors[descriptorKey(orgSnetID, snetID)] = descriptors
+		s.descriptorOrgs[snetID] = orgSnetID
+	}
+}
+
+// setCompiled sets the result of compiling the bundle of a service like setDescriptors, remembering a
+// bundle that compiled cleanly without a gRPC service so unchanged metadata doesn't compile it again.
+// The caller must hold descriptorsMu.
+func (s *SnetSyncer) setCompiled(orgSnetID, snetID string, bundle map[string]string, descriptors []protoreflect.FileDescriptor, compileErrs []CompileDiagnostic) {
+	s.setDescriptors(orgSnetID, snetID, descriptors, compileErrs)
+	if len(bundle) > 0 && len(descriptors) == 0 && len(compileErrs) == 0 {
+		s.serviceless[snetID] = true
+	}
+}
+
+// setPendingProtos stores the proto sources of a service to be compiled on first access,
+// dropping the descriptors of previous syncs
+func (s *SnetSyncer) setPendingProtos(orgSnetID, snetID string, bundle map[string]string) {
+	s.descriptorsMu.Lock()
+	defer s.descriptorsMu.Unlock()
+	s.setDescriptors(orgSnetID, snetID, nil, nil)
+	if len(bundle) > 0 {
+		s.pendingProtos[snetID] = &lazyBundle{orgSnetID: orgSnetID, bundle: bundle}
+	}
+}
+
+// GetServiceDescriptors returns the descriptors of a service. When the service was synced with LazyCompile
+// and not accessed since, its protos are compiled first and the result is cached and stored, concurrent
+// callers wait for the same compilation. A service without descriptors fails with ErrServiceNotFound,
+// or ErrDescriptorNotCompiled joining the compile errors when it was synced.
+func (s *SnetSyncer) GetServiceDescriptors(snetID string) ([]protoreflect.FileDescriptor, error) {
+	descriptors, err := s.compiledDescriptors(snetID)
+	if err == nil && len(descriptors) == 0 {
+		return nil, s.notSyncedError(snetID)
+	}
+	return descriptors, err
+}
+
+// compiledDescriptors is GetServiceDescriptors without looking up why a service has no descriptors, the
+// error is only set when its lazy compilation failed
+func (s *SnetSyncer) compiledDescriptors(snetID string) ([]protoreflect.FileDescriptor, error) {
+	s.descriptorsMu.RLock()
+	descriptors, pending := s.descriptorsOf(snetID), s.pendingProtos[snetID]
+	s.descriptorsMu.RUnlock()
+	if pending == nil {
+		return slices.Clone(descriptors), nil
+	}
+
+	pending.once.Do(func() {
+		pending.descriptors, pending.errs = s.compileBundle(snetID, pending.bundle)
+		s.descriptorsMu.Lock()
+		// a re-sync may have replaced the sources meanwhile, its result takes precedence
+		current := s.pendingProtos[snetID] == pending
+		if current {
+			s.setCompiled(pending.orgSnetID, snetID, pending.bundle, pending.descriptors, pending.errs)
+		}
+		s.descriptorsMu.Unlock()
+		if !current {
+			return
+		}
+		if err := s.saveDescriptors(context.Background(), snetID, pending.descriptors); err != nil {
+			s.log.Error().Err(err).Str("snet-id", snetID).Msg("Failed to store descriptors")
+		}
+	})
+	if len(pending.descriptors) == 0 && len(pending.errs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDescriptorNotCompiled, snetID)
+	}
+	if len(pending.descriptors) == 0 {
+		return nil, fmt.Errorf("%w: %s: %w", ErrDescriptorNotCompiled, snetID, errors.Join(diagnosticErrors(pending.errs)...))
+	}
+	return slices.Clone(pending.descriptors), nil
+}
+
+// compilePending compiles the protos of every service still waiting for its first access
+func (s *SnetSyncer) compilePending() {
+	s.descriptorsMu.RLock()
+	snetIDs := sortedKeys(s.pendingProtos)
+	s.descriptorsMu.RUnlock()
+	for _, snetID := range snetIDs {
+		// failures are logged and recorded in the compile errors
+		_, _ = s.compiledDescriptors(snetID)
+	}
+}
+
+// hasProtos reports whether a service has descriptors or sources waiting to be compiled, without compiling them
+func (s *SnetSyncer) hasProtos(snetID string) bool {
+	s.descriptorsMu.RLock()
+	defer s.descriptorsMu.RUnlock()
+	return len(s.descriptorsOf(snetID)) > 0 || s.pendingProtos[snetID] != nil
+}
+
+// syncedProtos reports whether the protos of a service are up to date with its last sync, a service whose
+// protos declare no gRPC service has none but has nothing to compile again either
+func (s *SnetSyncer) syncedProtos(snetID string) bool {
+	s.descriptorsMu.RLock()
+	serviceless := s.serviceless[snetID]
+	s.descriptorsMu.RUnlock()
+	return serviceless || s.hasProtos(snetID)
+}
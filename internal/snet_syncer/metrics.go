@@ -0,0 +1,82 @@
+package snet_syncer
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// syncMetrics are the Prometheus metrics of the sync, a nil *syncMetrics records nothing
+type syncMetrics struct {
+	orgsSynced        prometheus.Counter
+	servicesSynced    prometheus.Counter
+	ipfsFetchFailures prometheus.Counter
+	compileFailures   prometheus.Counter
+	syncDuration      prometheus.Histogram
+}
+
+// SetMetricsRegisterer registers the sync metrics with reg, a nil reg disables the metrics.
+// It must be called before the syncer is copied or started.
+func (s *SnetSyncer) SetMetricsRegisterer(reg prometheus.Registerer) error {
+	if reg == nil {
+		s.metrics = nil
+		return nil
+	}
+	m := &syncMetrics{
+		orgsSynced: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "snet_syncer", Name: "orgs_synced_total", Help: "Orgs synced from the registry.",
+		}),
+		servicesSynced: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "snet_syncer", Name: "services_synced_total", Help: "Services synced from the registry.",
+		}),
+		ipfsFetchFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "snet_syncer", Name: "ipfs_fetch_failures_total", Help: "IPFS fetches that failed after all retries.",
+		}),
+		compileFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "snet_syncer", Name: "proto_compile_failures_total", Help: "Proto files that failed to compile.",
+		}),
+		syncDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "snet_syncer", Name: "sync_duration_seconds", Help: "Duration of full sync passes.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12), // 1s to ~1h
+		}),
+	}
+	var err error
+	for _, collector := range []prometheus.Collector{m.orgsSynced, m.servicesSynced, m.ipfsFetchFailures, m.compileFailures, m.syncDuration} {
+		err = errors.Join(err, reg.Register(collector))
+	}
+	if err != nil {
+		return err
+	}
+	s.metrics = m
+	return nil
+}
+
+func (m *syncMetrics) orgSynced() {
+	if m != nil {
+		m.orgsSynced.Inc()
+	}
+}
+
+func (m *syncMetrics) serviceSynced() {
+	if m != nil {
+		m.servicesSynced.Inc()
+	}
+}
+
+func (m *syncMetrics) ipfsFetchFailed() {
+	if m != nil {
+		m.ipfsFetchFailures.Inc()
+	}
+}
+
+func (m *syncMetrics) compileFailed() {
+	if m != nil {
+		m.compileFailures.Inc()
+	}
+}
+
+func (m *syncMetrics) observeSync(started time.Time) {
+	if m != nil {
+		m.syncDuration.Observe(time.Since(started).Seconds())
+	}
+}
@@ -0,0 +1,77 @@
+package snet_syncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/rs/zerolog"
+	"matrix-ai-framework/internal/snet_syncer/fakes"
+	"matrix-ai-framework/pkg/blockchain"
+	ipfs "matrix-ai-framework/pkg/ipfs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// mirrorFile writes content to dir named after its CID, as a mirror serves it, and returns the CID
+func mirrorFile(t *testing.T, dir string, content []byte) string {
+	t.Helper()
+	sum, err := multihash.Sum(content, multihash.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cID := cid.NewCidV0(sum).String()
+	if err := os.WriteFile(filepath.Join(dir, cID), content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return cID
+}
+
+func mirrorJSON(t *testing.T, dir string, v any) string {
+	t.Helper()
+	content, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mirrorFile(t, dir, content)
+}
+
+func TestSyncFromMirror(t *testing.T) {
+	dir := t.TempDir()
+	registry, db := fakes.NewRegistry(), fakes.NewDB()
+	uris := map[string]string{}
+	for _, serviceSnetID := range []string{"svc1", "svc2"} {
+		archive, err := fakes.Archive(map[string]string{"echo.proto": fmt.Sprintf(echoProto, serviceSnetID)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		model := mirrorFile(t, dir, archive)
+		uris[serviceSnetID] = "ipfs://" + mirrorJSON(t, dir, serviceMeta(serviceSnetID, model))
+	}
+	org := mirrorJSON(t, dir, blockchain.OrganizationMetaData{
+		OrgName: "Org org1",
+		OrgID:   "org1",
+		Groups:  []blockchain.Group{{GroupName: "default", GroupID: "Zw=="}},
+	})
+	registry.AddOrg("org1", "ipfs://"+org, uris)
+
+	logger := zerolog.Nop()
+	s, err := New(registry, ipfs.NewMirror(dir, 0), db, &logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.IPFSRetry = RetryPolicy{MaxAttempts: 1}
+	syncOnce(t, s)
+
+	n := &testNet{t: t, db: db}
+	if got := n.storedServices(); !slices.Equal(got, []string{"svc1", "svc2"}) {
+		t.Fatalf("stored services %v, want both services of the mirror", got)
+	}
+	for _, serviceSnetID := range []string{"svc1", "svc2"} {
+		if got := s.ServiceDescriptors(serviceSnetID); len(got) != 1 || string(got[0].Package()) != serviceSnetID {
+			t.Fatalf("%s has descriptors %v, want its model from the mirror", serviceSnetID, got)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package snet_syncer
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	ipfs "matrix-ai-framework/pkg/ipfs"
+	"sync"
+)
+
+// modelCache shares the models of the services of an org during a sync pass: services pointing at the
+// same model hash fetch, read and compile it once, and get the same descriptors, which are never modified
+type modelCache struct {
+	mu     sync.Mutex
+	models map[string]*sharedModel // key: model ipfs hash
+}
+
+// sharedModel is a model loaded and compiled at most once for all the services using it
+type sharedModel struct {
+	loadOnce sync.Once
+	bundle   map[string]string
+	err      error
+
+	compileOnce sync.Once
+	snetID      string // the service the model was compiled for, the one its diagnostics name
+	descriptors []protoreflect.FileDescriptor
+	compileErrs []CompileDiagnostic
+}
+
+// get returns the model of a hash, a nil cache shares nothing
+func (c *modelCache) get(hash string) *sharedModel {
+	if c == nil {
+		return &sharedModel{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.models == nil {
+		c.models = make(map[string]*sharedModel)
+	}
+	model, ok := c.models[hash]
+	if !ok {
+		model = &sharedModel{}
+		c.models[hash] = model
+	}
+	return model
+}
+
+// load fetches and reads the model the first time it is called, later calls return the same result
+func (m *sharedModel) load(ctx context.Context, s *SnetSyncer, orgSnetID, hash string) (map[string]string, error) {
+	m.loadOnce.Do(func() {
+		content, err := s.fetchIPFS(ctx, orgSnetID, hash)
+		if err != nil {
+			m.err = fmt.Errorf("fetch model: %w", err)
+			return
+		}
+		protoFiles, err := ipfs.ReadFilesCompressed(string(content), s.ArchiveLimits)
+		if err != nil {
+			m.err = fmt.Errorf("read model: %w", err)
+			return
+		}
+		m.bundle = protoBundle(protoFiles)
+	})
+	return m.bundle, m.err
+}
+
+// compile compiles the bundle for the first service calling it, the others get the same descriptors and
+// the diagnostics renamed after them. Only the first compilation is recorded in the compile stats.
+func (m *sharedModel) compile(s *SnetSyncer, snetID string) ([]protoreflect.FileDescriptor, []CompileDiagnostic) {
+	m.compileOnce.Do(func() {
+		m.snetID = snetID
+		m.descriptors, m.compileErrs = s.compileBundle(snetID, m.bundle)
+	})
+	if snetID == m.snetID || len(m.compileErrs) == 0 {
+		return m.descriptors, m.compileErrs
+	}
+	compileErrs := make([]CompileDiagnostic, len(m.compileErrs))
+	for i, diagnostic := range m.compileErrs {
+		diagnostic.SnetID = snetID
+		compileErrs[i] = diagnostic
+	}
+	return m.descriptors, compileErrs
+}
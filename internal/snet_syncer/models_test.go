@@ -0,0 +1,42 @@
+package snet_syncer
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestServicesSharingModelFetchItOnce(t *testing.T) {
+	n := newTestNet(t)
+	n.addService("svc1", "QmModelShared", map[string]string{"echo.proto": fmt.Sprintf(echoProto, "shared")})
+	n.addService("svc2", "QmModelShared", nil)
+	n.addService("svc3", modelOf("svc3"), map[string]string{"echo.proto": fmt.Sprintf(echoProto, "svc3")})
+	n.registerOrg("org1", map[string]string{
+		"svc1": "ipfs://" + cidOf("svc1"),
+		"svc2": "ipfs://" + cidOf("svc2"),
+		"svc3": "ipfs://" + cidOf("svc3"),
+	})
+	s := n.syncer()
+
+	syncOnce(t, s)
+	if got := n.ipfs.Fetches("QmModelShared"); got != 1 {
+		t.Fatalf("shared model fetched %d times, want once", got)
+	}
+	if got := n.storedServices(); !slices.Equal(got, []string{"svc1", "svc2", "svc3"}) {
+		t.Fatalf("stored services %v, want all three", got)
+	}
+	first, second := s.ServiceDescriptors("svc1"), s.ServiceDescriptors("svc2")
+	if len(first) != 1 || len(second) != 1 || first[0] != second[0] {
+		t.Fatalf("services sharing the model have descriptors %v and %v, want the same ones", first, second)
+	}
+	if got := s.ServiceDescriptors("svc3"); len(got) != 1 || got[0].Package() != "svc3" {
+		t.Fatalf("svc3 has descriptors %v, want its own model", got)
+	}
+
+	// the cache lives for a pass, a forced sync fetches the model again, once
+	s.ForceFullSync = true
+	syncOnce(t, s)
+	if got := n.ipfs.Fetches("QmModelShared"); got != 2 {
+		t.Fatalf("shared model fetched %d times after two passes, want twice", got)
+	}
+}
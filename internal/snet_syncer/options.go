@@ -0,0 +1,158 @@
+package snet_syncer
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"sort"
+)
+
+// MethodOption is a custom option set on a method through an extension of google.protobuf.MethodOptions
+type MethodOption struct {
+	Name  string `json:"name"`  // fully-qualified name of the extension
+	Label string `json:"label"` // what the option means for the known snet options, the name otherwise
+	// Value is the value of the option, messages in the protobuf JSON mapping. The value of a known snet
+	// option is the field that matters of it.
+	Value string `json:"value"`
+}
+
+// knownMethodOption describes an option of the snet protos, field is the field of its message shown as
+// its value, if any
+type knownMethodOption struct {
+	label string
+	field protoreflect.Name
+}
+
+// knownMethodOptions are the method options of the snet protos, key: extension full name
+var knownMethodOptions = map[protoreflect.FullName]knownMethodOption{
+	// pricing.proto of the snet daemon, the method estimating the dynamic price of calls to the method
+	"pricing.my_method_option": {label: "dynamic price", field: "estimatePriceMethod"},
+}
+
+// methodOptions returns the custom options of a method, sorted by name. The options are set as
+// extensions by the compiler and as unknown fields once loaded from the DB, either way they are read
+// back with the extensions declared in the file of the method and its imports. Options whose extension
+// can't be found are skipped.
+func methodOptions(method protoreflect.MethodDescriptor) []MethodOption {
+	options, ok := method.Options().(*descriptorpb.MethodOptions)
+	if !ok || options == nil || !hasCustomOptions(options) {
+		return nil
+	}
+	raw, err := proto.Marshal(options)
+	if err != nil {
+		return nil
+	}
+	resolver := &protoregistry.Types{}
+	registerExtensions(resolver, method.ParentFile(), map[string]bool{})
+	decoded := dynamicpb.NewMessage(options.ProtoReflect().Descriptor())
+	if err = (proto.UnmarshalOptions{Resolver: resolver}).Unmarshal(raw, decoded); err != nil {
+		return nil
+	}
+
+	var found []MethodOption
+	decoded.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if !field.IsExtension() {
+			return true
+		}
+		option := MethodOption{Name: string(field.FullName()), Label: string(field.FullName())}
+		known, isKnown := knownMethodOptions[field.FullName()]
+		if isKnown {
+			option.Label = known.label
+			if message := field.Message(); message != nil && known.field != "" {
+				if inner := message.Fields().ByName(known.field); inner != nil && value.Message().Has(inner) {
+					field, value = inner, value.Message().Get(inner)
+				}
+			}
+		}
+		option.Value = optionValue(field, value)
+		found = append(found, option)
+		return true
+	})
+	sort.Slice(found, func(i, j int) bool { return found[i].Name < found[j].Name })
+	return found
+}
+
+// hasCustomOptions reports whether options has extensions or unknown fields, the standard options alone
+// need no decoding
+func hasCustomOptions(options *descriptorpb.MethodOptions) bool {
+	if len(options.ProtoReflect().GetUnknown()) > 0 {
+		return true
+	}
+	found := false
+	options.ProtoReflect().Range(func(field protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		found = field.IsExtension()
+		return !found
+	})
+	return found
+}
+
+// registerExtensions registers the extensions of MethodOptions declared in file and its imports
+func registerExtensions(types *protoregistry.Types, file protoreflect.FileDescriptor, seen map[string]bool) {
+	if seen[file.Path()] {
+		return
+	}
+	seen[file.Path()] = true
+	registerExtensionList(types, file.Extensions())
+	registerNestedExtensions(types, file.Messages())
+	imports := file.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		registerExtensions(types, imports.Get(i).FileDescriptor, seen)
+	}
+}
+
+func registerNestedExtensions(types *protoregistry.Types, messages protoreflect.MessageDescriptors) {
+	for i := 0; i < messages.Len(); i++ {
+		registerExtensionList(types, messages.Get(i).Extensions())
+		registerNestedExtensions(types, messages.Get(i).Messages())
+	}
+}
+
+func registerExtensionList(types *protoregistry.Types, extensions protoreflect.ExtensionDescriptors) {
+	for i := 0; i < extensions.Len(); i++ {
+		extension := extensions.Get(i)
+		if extension.ContainingMessage().FullName() != "google.protobuf.MethodOptions" {
+			continue
+		}
+		// an extension declared twice keeps its first declaration
+		_ = types.RegisterExtension(dynamicpb.NewExtensionType(extension))
+	}
+}
+
+// optionValue renders the value of an option field, lists joined with commas
+func optionValue(field protoreflect.FieldDescriptor, value protoreflect.Value) string {
+	if field.IsList() {
+		list := value.List()
+		rendered := ""
+		for i := 0; i < list.Len(); i++ {
+			if i > 0 {
+				rendered += ", "
+			}
+			rendered += singleOptionValue(field, list.Get(i))
+		}
+		return rendered
+	}
+	return singleOptionValue(field, value)
+}
+
+func singleOptionValue(field protoreflect.FieldDescriptor, value protoreflect.Value) string {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		rendered, err := protojson.Marshal(value.Message().Interface())
+		if err != nil {
+			return ""
+		}
+		return string(rendered)
+	case protoreflect.EnumKind:
+		if enumValue := field.Enum().Values().ByNumber(value.Enum()); enumValue != nil {
+			return string(enumValue.Name())
+		}
+		return fmt.Sprint(value.Enum())
+	case protoreflect.BytesKind:
+		return fmt.Sprintf("%x", value.Bytes())
+	}
+	return fmt.Sprint(value.Interface())
+}
@@ -0,0 +1,130 @@
+package snet_syncer
+
+import (
+	"context"
+	"encoding/json"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// pricingProto declares the method option of the pricing.proto of the snet daemon
+const pricingProto = `syntax = "proto3";
+package pricing;
+import "google/protobuf/descriptor.proto";
+
+message PricingRule { string estimatePriceMethod = 1; }
+
+extend google.protobuf.MethodOptions {
+  PricingRule my_method_option = 50001;
+}
+`
+
+// shopProto sets the snet pricing option and an option of its own on Buy
+const shopProto = `syntax = "proto3";
+package shop;
+import "google/protobuf/descriptor.proto";
+import "pricing.proto";
+
+extend google.protobuf.MethodOptions {
+  int32 free_calls = 50100;
+}
+
+message Request { string item = 1; }
+message Response { int64 total = 1; }
+
+service Shop {
+  rpc Buy(Request) returns (Response) {
+    option (pricing.my_method_option).estimatePriceMethod = "/shop.Shop/Estimate";
+    option (shop.free_calls) = 10;
+  }
+  rpc Estimate(Request) returns (Response);
+}
+`
+
+var shopOptions = []MethodOption{
+	{Name: "pricing.my_method_option", Label: "dynamic price", Value: "/shop.Shop/Estimate"},
+	{Name: "shop.free_calls", Label: "shop.free_calls", Value: "10"},
+}
+
+func TestMethodOptionsCompiled(t *testing.T) {
+	fd := compileFile(t, map[string]string{"pricing.proto": pricingProto, "shop.proto": shopProto}, "shop.proto")
+	methods := fd.Services().ByName("Shop").Methods()
+	if got := methodOptions(methods.ByName("Buy")); !slices.Equal(got, shopOptions) {
+		t.Fatalf("Buy has options %+v, want %+v", got, shopOptions)
+	}
+	if got := methodOptions(methods.ByName("Estimate")); got != nil {
+		t.Fatalf("Estimate has options %+v, want none", got)
+	}
+
+	buy := methods.ByName("Buy")
+	html := HTMLFormatter{}.Method(MethodView{Descriptor: buy, Options: methodOptions(buy)})
+	for _, want := range []string{"<em>(dynamic price: /shop.Shop/Estimate)</em>", "<em>(shop.free_calls: 10)</em>"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("rendered method doesn't contain %q:\n%s", want, html)
+		}
+	}
+	raw, err := json.Marshal(describeServices(fd)[0].Methods[0].Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"name":"pricing.my_method_option","label":"dynamic price","value":"/shop.Shop/Estimate"}`; !strings.Contains(string(raw), want) {
+		t.Errorf("catalog options %s don't contain %s", raw, want)
+	}
+}
+
+func TestMethodOptionsLoadedFromDB(t *testing.T) {
+	n := newTestNet(t)
+	n.addService("svc1", modelOf("svc1"), map[string]string{"pricing.proto": pricingProto, "shop.proto": shopProto})
+	n.registerOrg("org1", map[string]string{"svc1": "ipfs://" + cidOf("svc1")})
+	syncOnce(t, n.syncer())
+
+	// a restarted syncer reads the options back from the unknown fields of the stored descriptors
+	s := n.syncer()
+	if err := s.LoadDescriptors(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var buy protoreflect.MethodDescriptor
+	for _, fd := range s.ServiceDescriptors("svc1") {
+		if service := fd.Services().ByName("Shop"); service != nil {
+			buy = service.Methods().ByName("Buy")
+		}
+	}
+	if buy == nil {
+		t.Fatal("Shop.Buy wasn't loaded")
+	}
+	if unknown := buy.Options().(*descriptorpb.MethodOptions).ProtoReflect().GetUnknown(); len(unknown) == 0 {
+		t.Fatal("loaded options have no unknown fields, the reload path isn't exercised")
+	}
+	if got := methodOptions(buy); !slices.Equal(got, shopOptions) {
+		t.Fatalf("loaded Buy has options %+v, want %+v", got, shopOptions)
+	}
+}
+
+func TestMethodOptionsSkipsUndeclared(t *testing.T) {
+	bundle := map[string]string{"pricing.proto": pricingProto, "shop.proto": shopProto}
+	pricing, shop := compileFile(t, bundle, "pricing.proto"), compileFile(t, bundle, "shop.proto")
+
+	// an option whose extension isn't declared by the file or its imports
+	fdProto := protodesc.ToFileDescriptorProto(shop)
+	options := fdProto.Service[0].Method[0].Options.ProtoReflect()
+	undeclared := protowire.AppendVarint(protowire.AppendTag(nil, 50200, protowire.VarintType), 1)
+	options.SetUnknown(append(options.GetUnknown(), undeclared...))
+	files := &protoregistry.Files{}
+	if err := files.RegisterFile(pricing); err != nil {
+		t.Fatal(err)
+	}
+	fd, err := protodesc.NewFile(fdProto, chainResolver{files, protoregistry.GlobalFiles})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := methodOptions(fd.Services().ByName("Shop").Methods().ByName("Buy")); !slices.Equal(got, shopOptions) {
+		t.Fatalf("Buy has options %+v, want the declared ones %+v", got, shopOptions)
+	}
+}
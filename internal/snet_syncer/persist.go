@@ -0,0 +1,131 @@
+package snet_syncer
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// marshalDescriptors serializes the descriptors of a service to a FileDescriptorSet. Imports are
+// included before the files importing them, except for the well-known types every binary links in.
+func marshalDescriptors(descriptors []protoreflect.FileDescriptor) ([]byte, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	added := make(map[string]bool)
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if added[fd.Path()] {
+			return
+		}
+		added[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			if _, err := protoregistry.GlobalFiles.FindFileByPath(imports.Get(i).Path()); err == nil {
+				continue
+			}
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	for _, fd := range descriptors {
+		add(fd)
+	}
+	return proto.Marshal(set)
+}
+
+// unmarshalDescriptors rebuilds the descriptors serialized by marshalDescriptors
+func unmarshalDescriptors(raw []byte) ([]protoreflect.FileDescriptor, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(raw, set); err != nil {
+		return nil, err
+	}
+	files := &protoregistry.Files{}
+	resolver := chainResolver{files, protoregistry.GlobalFiles}
+	descriptors := make([]protoreflect.FileDescriptor, 0, len(set.File))
+	for _, fdProto := range set.File {
+		fd, err := protodesc.NewFile(fdProto, resolver)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fdProto.GetName(), err)
+		}
+		if err := files.RegisterFile(fd); err != nil {
+			return nil, fmt.Errorf("%s: %w", fdProto.GetName(), err)
+		}
+		descriptors = append(descriptors, fd)
+	}
+	return descriptors, nil
+}
+
+// chainResolver resolves imports from the first resolver knowing them
+type chainResolver []protodesc.Resolver
+
+func (c chainResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	for _, resolver := range c {
+		if fd, err := resolver.FindFileByPath(path); err == nil {
+			return fd, nil
+		}
+	}
+	return nil, protoregistry.NotFound
+}
+
+func (c chainResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	for _, resolver := range c {
+		if d, err := resolver.FindDescriptorByName(name); err == nil {
+			return d, nil
+		}
+	}
+	return nil, protoregistry.NotFound
+}
+
+// saveDescriptors stores the descriptors of a service so they survive restarts, nil descriptors remove them
+func (s *SnetSyncer) saveDescriptors(ctx context.Context, snetID string, descriptors []protoreflect.FileDescriptor) error {
+	var raw []byte
+	if len(descriptors) > 0 {
+		var err error
+		if raw, err = marshalDescriptors(descriptors); err != nil {
+			return fmt.Errorf("marshal descriptors: %w", err)
+		}
+	}
+	return s.DB.SaveServiceDescriptors(ctx, snetID, raw)
+}
+
+// LoadDescriptors loads the descriptors stored by previous syncs, so services can be listed and
+// called right after a restart. Services already synced by this process are kept as they are.
+func (s *SnetSyncer) LoadDescriptors(ctx context.Context) error {
+	stored, err := s.DB.GetServiceDescriptors(ctx)
+	if err != nil {
+		return fmt.Errorf("get stored descriptors: %w", err)
+	}
+	services, err := s.DB.GetSnetServices(ctx)
+	if err != nil {
+		return fmt.Errorf("get stored services: %w", err)
+	}
+	orgs := make(map[string]string, len(services))
+	for _, service := range services {
+		orgs[service.SnetID] = service.SnetOrgID
+	}
+	s.descriptorsMu.Lock()
+	defer s.descriptorsMu.Unlock()
+	loaded := 0
+	for snetID, raw := range stored {
+		if _, ok := s.descriptorOrgs[snetID]; ok || s.pendingProtos[snetID] != nil {
+			continue
+		}
+		descriptors, err := unmarshalDescriptors(raw)
+		if err != nil {
+			s.log.Error().Err(err).Str("snet-id", snetID).Msg("Failed to load stored descriptors")
+			continue
+		}
+		// stored before service-less protos were skipped, unchanged services aren't compiled again
+		if !declaresService(descriptors) {
+			continue
+		}
+		s.FileDescriptors[descriptorKey(orgs[snetID], snetID)] = descriptors
+		s.descriptorOrgs[snetID] = orgs[snetID]
+		loaded++
+	}
+	s.log.Info().Int("services", loaded).Msg("Loaded stored descriptors")
+	return nil
+}
@@ -0,0 +1,52 @@
+package snet_syncer
+
+import (
+	"context"
+	"matrix-ai-framework/pkg/db"
+	"strings"
+)
+
+// ServicePrice returns the price in cogs of a call to a method of the service: the method's own price
+// when the service group is priced per method, the service price otherwise. The method is a method
+// name or "<service>/<method>", the service being the gRPC service name or fully-qualified name.
+func ServicePrice(ctx context.Context, database db.Service, service db.SnetService, method string) (int, error) {
+	prices, err := database.GetServiceMethodPrices(ctx, service.SnetID)
+	if err != nil {
+		return 0, err
+	}
+	return methodPrice(service, prices, method), nil
+}
+
+// GetServicePrice returns the price in cogs of a call to a method of a synced service, see ServicePrice
+func (s *SnetSyncer) GetServicePrice(ctx context.Context, snetID, methodName string) (int, error) {
+	service, err := s.DB.GetSnetService(ctx, snetID)
+	if err != nil {
+		return 0, err
+	}
+	return ServicePrice(ctx, s.DB, service, methodName)
+}
+
+func methodPrice(service db.SnetService, prices []db.SnetMethodPrice, method string) int {
+	serviceName, methodName := "", strings.TrimPrefix(method, "/")
+	if i := strings.LastIndex(methodName, "/"); i >= 0 {
+		serviceName, methodName = methodName[:i], methodName[i+1:]
+	}
+	for _, price := range prices {
+		if price.GroupID != service.GroupID || price.MethodName != methodName {
+			continue
+		}
+		if serviceName == "" || price.ServiceName == "" || sameService(price.ServiceName, serviceName) {
+			return price.PriceInCogs
+		}
+	}
+	return service.Price
+}
+
+// sameService compares gRPC service names, either of which may be fully-qualified
+func sameService(a, b string) bool {
+	if a == b {
+		return true
+	}
+	short := func(name string) string { return name[strings.LastIndex(name, ".")+1:] }
+	return (a == short(a) || b == short(b)) && short(a) == short(b)
+}
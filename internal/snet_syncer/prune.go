@@ -0,0 +1,158 @@
+package snet_syncer
+
+import (
+	"context"
+	"fmt"
+	"matrix-ai-framework/pkg/blockchain"
+	"sync"
+)
+
+// seenIDs collects the snet ids of the orgs and services found on-chain during a sync
+type seenIDs struct {
+	mu       sync.Mutex
+	orgs     []string
+	services []string
+	// incomplete is set when the services of an org couldn't be listed, pruning services would
+	// then remove ones that still exist
+	incomplete bool
+	// changed is set when the registry changed while it was paged through, orgs may have been missed
+	changed bool
+	// owners maps the snet id of each service claimed during the pass to the snet id of its org
+	owners map[string]string
+	// orgHashes and serviceHashes are the metadata hashes fetched during the pass, key: snet id
+	orgHashes     map[string]string
+	serviceHashes map[string]string
+}
+
+func (s *seenIDs) addOrg(id [32]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orgs = append(s.orgs, bytes32ToString(id))
+}
+
+func (s *seenIDs) addServices(ids [][32]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		s.services = append(s.services, bytes32ToString(id))
+	}
+}
+
+// claimServices decides which org syncs each service id listed by the orgs, nil ones being skipped. Service
+// ids are only unique within an org, but services are stored and their descriptors served by service id,
+// so a single org keeps each id for the pass: the org the service is stored for when it lists it, the lowest
+// org id otherwise. The decision doesn't depend on the order of the orgs. An org of a later page may take
+// over an id claimed by an earlier one, the service is then synced again for it.
+func (s *seenIDs) claimServices(orgs []*blockchain.Org, stored map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.owners == nil {
+		s.owners = make(map[string]string)
+	}
+	for _, borg := range orgs {
+		if borg == nil {
+			continue
+		}
+		orgSnetID := bytes32ToString(borg.Id)
+		for _, id := range borg.ServiceIds {
+			snetID := bytes32ToString(id)
+			owner, claimed := s.owners[snetID]
+			if !claimed || prefersOwner(stored[snetID], orgSnetID, owner) {
+				s.owners[snetID] = orgSnetID
+			}
+		}
+	}
+}
+
+// prefersOwner reports whether candidate should own a service id claimed by owner, storedOwner being the
+// org the service is stored for
+func prefersOwner(storedOwner, candidate, owner string) bool {
+	switch {
+	case candidate == owner:
+		return false
+	case candidate == storedOwner:
+		return true
+	case owner == storedOwner:
+		return false
+	}
+	return candidate < owner
+}
+
+// owner returns the org that claimed the service id, see claimServices
+func (s *seenIDs) owner(snetID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.owners[snetID]
+}
+
+func (s *seenIDs) markChanged() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changed = true
+}
+
+func (s *seenIDs) markIncomplete() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.incomplete = true
+}
+
+// prune removes the orgs and services no longer in the registry from the DB and drops their descriptors.
+// Services are only pruned when every org could be read. A dry run keeps the descriptors.
+func (s *SnetSyncer) prune(ctx context.Context, seen *seenIDs) error {
+	seen.mu.Lock()
+	defer seen.mu.Unlock()
+	if seen.changed {
+		s.log.Warn().Msg("Not pruning, the registry changed during the sync")
+		return nil
+	}
+
+	deleted, err := s.DB.DeleteSnetOrgsNotIn(ctx, seen.orgs, s.PruneHardDelete)
+	if err != nil {
+		return fmt.Errorf("prune orgs: %w", err)
+	}
+	if deleted > 0 {
+		s.log.Info().Int64("count", deleted).Bool("hard", s.PruneHardDelete).Msg("Pruned orgs removed from the registry")
+	}
+	if seen.incomplete {
+		s.log.Warn().Msg("Not pruning services, some orgs couldn't be read")
+		return nil
+	}
+
+	deleted, err = s.DB.DeleteSnetServicesNotIn(ctx, seen.services, s.PruneHardDelete)
+	if err != nil {
+		return fmt.Errorf("prune services: %w", err)
+	}
+	if deleted > 0 {
+		s.log.Info().Int64("count", deleted).Bool("hard", s.PruneHardDelete).Msg("Pruned services removed from the registry")
+	}
+	if s.DryRun {
+		return nil
+	}
+
+	services := make(map[string]bool, len(seen.services))
+	for _, id := range seen.services {
+		services[id] = true
+	}
+	s.descriptorsMu.Lock()
+	defer s.descriptorsMu.Unlock()
+	for id, orgSnetID := range s.descriptorOrgs {
+		if !services[id] {
+			delete(s.FileDescriptors, descriptorKey(orgSnetID, id))
+			delete(s.descriptorOrgs, id)
+			delete(s.compileErrors, id)
+		}
+	}
+	for id := range s.pendingProtos {
+		if !services[id] {
+			delete(s.pendingProtos, id)
+		}
+	}
+	for id := range s.serviceless {
+		if !services[id] {
+			delete(s.serviceless, id)
+		}
+	}
+	s.compileStats.retain(services)
+	return nil
+}
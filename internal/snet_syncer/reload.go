@@ -0,0 +1,90 @@
+package snet_syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"matrix-ai-framework/pkg/blockchain"
+	"slices"
+)
+
+// ErrNotInRegistry is returned by SyncService for orgs and services that aren't in the registry
+var ErrNotInRegistry = errors.New("not found in the registry")
+
+// SyncService syncs a single service of an org on demand, e.g. right after it was updated on-chain:
+// its metadata is fetched again, even when unchanged, and it is stored and compiled like in a sync pass.
+// The org is stored too, its other services are left as they are. It waits for a running sync pass to
+// finish and returns an ErrNotInRegistry error when the org or the service doesn't exist on-chain.
+func (s *SnetSyncer) SyncService(ctx context.Context, orgSnetID, serviceSnetID string) error {
+	orgIDBytes, ok := stringToBytes32(orgSnetID)
+	if !ok {
+		return fmt.Errorf("org %s: %w", orgSnetID, ErrNotInRegistry)
+	}
+	serviceIDBytes, ok := stringToBytes32(serviceSnetID)
+	if !ok {
+		return fmt.Errorf("service %s/%s: %w", orgSnetID, serviceSnetID, ErrNotInRegistry)
+	}
+	if !s.syncsOrg(orgSnetID) {
+		return fmt.Errorf("org %s is filtered out of the sync", orgSnetID)
+	}
+
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	run, _ := s.runner()
+
+	var borg blockchain.Org
+	err := run.callRPC(ctx, func() (err error) {
+		borg, err = run.Ethereum.GetOrg(ctx, orgIDBytes)
+		return
+	})
+	if err != nil {
+		return fmt.Errorf("get org %s: %w", orgSnetID, err)
+	}
+	if !borg.Found {
+		return fmt.Errorf("org %s: %w", orgSnetID, ErrNotInRegistry)
+	}
+	if !slices.Contains(borg.ServiceIds, serviceIDBytes) {
+		return fmt.Errorf("service %s/%s: %w", orgSnetID, serviceSnetID, ErrNotInRegistry)
+	}
+	// like in a sync pass, a service id taken by another org is left to it
+	if stored, err := run.DB.GetSnetService(ctx, serviceSnetID); err == nil && stored.SnetOrgID != "" && stored.SnetOrgID != orgSnetID {
+		return fmt.Errorf("service %s is already synced for org %s", serviceSnetID, stored.SnetOrgID)
+	}
+
+	org, err := run.resolveOrg(ctx, borg, nil)
+	if err != nil {
+		return err
+	}
+	errs := &syncErrors{onAdd: func(err error) {
+		run.publish(SyncEvent{Type: EventError, Error: err.Error()})
+	}}
+	// no known hashes, so the service is synced even when its metadata didn't change
+	service, err := run.resolveService(ctx, orgIDBytes, org, serviceIDBytes, errs, nil, nil)
+	if err != nil {
+		return err
+	}
+	if service == nil {
+		return errs.join()
+	}
+	if err = run.storeOrg(ctx, &org, []*pendingService{service}); err != nil {
+		s.log.Error().Err(err).Str("org", orgSnetID).Str("snet-id", serviceSnetID).Msg("Failed to store service")
+		return fmt.Errorf("service %s/%s: %w", orgSnetID, serviceSnetID, err)
+	}
+	if err = run.compileService(ctx, org, service, errs, nil); err != nil {
+		return err
+	}
+	if err = errs.join(); err != nil {
+		return err
+	}
+	s.log.Info().Str("org", orgSnetID).Str("snet-id", serviceSnetID).Msg("Service synced on demand")
+	return nil
+}
+
+// stringToBytes32 is the registry id of a snet id, ok is false for ids too long to be one
+func stringToBytes32(id string) (b [32]byte, ok bool) {
+	if len(id) > len(b) {
+		return b, false
+	}
+	copy(b[:], id)
+	return b, true
+}
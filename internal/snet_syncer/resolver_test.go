@@ -0,0 +1,44 @@
+package snet_syncer
+
+import (
+	"github.com/bufbuild/protocompile"
+	"testing"
+)
+
+func TestSyncImportsFromImportResolver(t *testing.T) {
+	n := newTestNet(t)
+	// shared/types.proto is published separately and only the resolver has it
+	n.addService("svc1", modelOf("svc1"), map[string]string{"echo.proto": `syntax = "proto3";
+package svc1;
+import "shared/types.proto";
+service Echo { rpc Say(shared.Text) returns (shared.Text); }
+`})
+	n.registerOrg("org1", map[string]string{"svc1": "ipfs://" + cidOf("svc1")})
+	s := n.syncer()
+	s.ImportResolver = &protocompile.SourceResolver{Accessor: protocompile.SourceAccessorFromMap(map[string]string{
+		"shared/types.proto": `syntax = "proto3";
+package shared;
+message Text { string text = 1; }
+`,
+		// files of the bundle come first
+		"echo.proto": `syntax = "proto3"; package shadowed;`,
+	})}
+
+	syncOnce(t, s)
+	descriptors := s.ServiceDescriptors("svc1")
+	if len(descriptors) != 1 || descriptors[0].Package() != "svc1" {
+		t.Fatalf("svc1 has descriptors %v, want echo.proto of the bundle", descriptors)
+	}
+	if input := descriptors[0].Services().Get(0).Methods().Get(0).Input(); input.FullName() != "shared.Text" {
+		t.Fatalf("input of Echo.Say is %s, want shared.Text", input.FullName())
+	}
+
+	// without the resolver the import is missing
+	withoutResolver := n.syncer()
+	if _, compileErrs := withoutResolver.compileBundle("svc1", map[string]string{"echo.proto": `syntax = "proto3";
+package svc1;
+import "shared/types.proto";
+`}); len(compileErrs) == 0 {
+		t.Fatal("import missing from the bundle compiled without a resolver")
+	}
+}
@@ -0,0 +1,84 @@
+package snet_syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	ipfs "matrix-ai-framework/pkg/ipfs"
+	"time"
+)
+
+// RetryPolicy controls how failed fetches are retried: up to MaxAttempts tries, waiting a random
+// delay of up to BaseDelay*2^n (capped at MaxDelay) before retry n.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultIPFSRetry is used for IPFS fetches unless the syncer is configured otherwise
+var DefaultIPFSRetry = RetryPolicy{MaxAttempts: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second}
+
+// backoff returns the full-jitter delay before the given retry (1 for the first retry)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			delay = p.MaxDelay
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return rand.N(delay) + 1
+}
+
+// retry calls fn until it succeeds, the attempts are exhausted or the context is done
+func (s *SnetSyncer) retry(ctx context.Context, policy RetryPolicy, what string, fn func() error) (err error) {
+	attempts := max(policy.MaxAttempts, 1)
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+		delay := policy.backoff(attempt)
+		s.log.Warn().Err(err).Str("fetch", what).Int("attempt", attempt).Dur("retry-in", delay).Msg("Fetch failed, retrying")
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+	return err
+}
+
+// fetchIPFS fetches a file through the org gateway, retrying transient failures with the IPFS retry policy.
+// A fetch still failing after the retries wraps ErrIPFSUnavailable.
+func (s *SnetSyncer) fetchIPFS(ctx context.Context, orgSnetID, hash string) (content []byte, err error) {
+	// an unsupported scheme or a path won't fetch on a retry either
+	if hash, err = ipfs.ParseContentURI(hash); err != nil {
+		return nil, err
+	}
+	var cID string
+	err = s.retry(ctx, s.IPFSRetry, hash, func() (err error) {
+		content, cID, err = s.IPFSClient.GetIpfsFileForOrg(ctx, orgSnetID, hash)
+		return
+	})
+	if err != nil {
+		s.metrics.ipfsFetchFailed()
+		if errors.Is(err, ipfs.ErrLimitExceeded) || ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", ErrIPFSUnavailable, err)
+	}
+	s.log.Debug().Str("org", orgSnetID).Str("cid", cID).Int("bytes", len(content)).Msg("Fetched IPFS file")
+	return content, nil
+}
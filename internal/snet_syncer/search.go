@@ -0,0 +1,112 @@
+package snet_syncer
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+)
+
+// Message usages of a Match
+const (
+	UsageInput  = "input"
+	UsageOutput = "output"
+)
+
+// Match is a method of a synced service found by FindServicesByMethod or FindServicesByMessage
+type Match struct {
+	SnetID  string `json:"snet_id"`
+	File    string `json:"file"`
+	Service string `json:"service"` // fully-qualified name of the gRPC service
+	Method  string `json:"method"`
+	// Message and Usage are only set by FindServicesByMessage: the fully-qualified name of the message
+	// found and whether the method takes or returns it, as the whole input or output or in one of its fields
+	Message string `json:"message,omitempty"`
+	Usage   string `json:"usage,omitempty"`
+}
+
+// FindServicesByMethod returns the methods of the synced services whose fully-qualified name contains
+// name, ignoring case, by snet id and in declaration order. An empty name matches nothing.
+func (s *SnetSyncer) FindServicesByMethod(name string) []Match {
+	query := strings.ToLower(name)
+	if query == "" {
+		return nil
+	}
+	var matches []Match
+	s.eachMethod(func(snetID string, method protoreflect.MethodDescriptor) {
+		if strings.Contains(strings.ToLower(string(method.FullName())), query) {
+			matches = append(matches, methodMatch(snetID, method))
+		}
+	})
+	return matches
+}
+
+// FindServicesByMessage returns the methods of the synced services taking or returning a message whose
+// fully-qualified name contains name, ignoring case, directly or in a field at any depth. A method is
+// returned once per message found, by snet id and in declaration order. An empty name matches nothing.
+func (s *SnetSyncer) FindServicesByMessage(name string) []Match {
+	query := strings.ToLower(name)
+	if query == "" {
+		return nil
+	}
+	var matches []Match
+	s.eachMethod(func(snetID string, method protoreflect.MethodDescriptor) {
+		found := make(map[protoreflect.FullName]bool)
+		for _, side := range []struct {
+			usage   string
+			message protoreflect.MessageDescriptor
+		}{{UsageInput, method.Input()}, {UsageOutput, method.Output()}} {
+			findMessages(side.message, query, make(map[protoreflect.FullName]bool), func(message protoreflect.MessageDescriptor) {
+				if found[message.FullName()] {
+					return
+				}
+				found[message.FullName()] = true
+				match := methodMatch(snetID, method)
+				match.Message, match.Usage = string(message.FullName()), side.usage
+				matches = append(matches, match)
+			})
+		}
+	})
+	return matches
+}
+
+// eachMethod calls fn with every method of the compiled descriptors, by snet id and in declaration order
+func (s *SnetSyncer) eachMethod(fn func(snetID string, method protoreflect.MethodDescriptor)) {
+	descriptors := s.Descriptors()
+	for _, snetID := range sortedKeys(descriptors) {
+		for _, descriptor := range descriptors[snetID] {
+			services := descriptor.Services()
+			for i := 0; i < services.Len(); i++ {
+				methods := services.Get(i).Methods()
+				for j := 0; j < methods.Len(); j++ {
+					fn(snetID, methods.Get(j))
+				}
+			}
+		}
+	}
+}
+
+// findMessages calls found with message and the messages of its fields at any depth whose fully-qualified
+// name contains query. Map entries aren't matched themselves, their values are.
+func findMessages(message protoreflect.MessageDescriptor, query string, visiting map[protoreflect.FullName]bool, found func(protoreflect.MessageDescriptor)) {
+	if visiting[message.FullName()] {
+		return
+	}
+	visiting[message.FullName()] = true
+	if !message.IsMapEntry() && strings.Contains(strings.ToLower(string(message.FullName())), query) {
+		found(message)
+	}
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if field := fields.Get(i).Message(); field != nil {
+			findMessages(field, query, visiting, found)
+		}
+	}
+}
+
+func methodMatch(snetID string, method protoreflect.MethodDescriptor) Match {
+	return Match{
+		SnetID:  snetID,
+		File:    method.ParentFile().Path(),
+		Service: string(method.Parent().FullName()),
+		Method:  string(method.Name()),
+	}
+}
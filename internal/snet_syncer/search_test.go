@@ -0,0 +1,93 @@
+package snet_syncer
+
+import (
+	"reflect"
+	"testing"
+)
+
+// searchNet syncs an echo service and a vision service nesting an image message in a map
+func searchNet(t *testing.T) *SnetSyncer {
+	t.Helper()
+	n := newTestNet(t)
+	n.addService("echo", modelOf("echo"), map[string]string{"echo.proto": `syntax = "proto3";
+package echo;
+message Request { string text = 1; }
+message Response { string text = 1; }
+service Echo {
+  rpc Say(Request) returns (Response);
+  rpc Recognize(Request) returns (Response);
+}
+`})
+	n.addService("vision", modelOf("vision"), map[string]string{"vision.proto": `syntax = "proto3";
+package vision;
+message ImageInput { bytes data = 1; }
+message Batch { map<string, ImageInput> images = 1; }
+message Labels { repeated string labels = 1; ImageInput annotated = 2; }
+service Vision {
+  rpc RecognizeImage(ImageInput) returns (Labels);
+  rpc RecognizeBatch(Batch) returns (Labels);
+}
+`})
+	n.registerOrg("org1", map[string]string{"echo": "ipfs://" + cidOf("echo"), "vision": "ipfs://" + cidOf("vision")})
+	s := n.syncer()
+	syncOnce(t, s)
+	return s
+}
+
+func TestFindServicesByMethod(t *testing.T) {
+	s := searchNet(t)
+	echo := Match{SnetID: "echo", File: "echo.proto", Service: "echo.Echo", Method: "Recognize"}
+	image := Match{SnetID: "vision", File: "vision.proto", Service: "vision.Vision", Method: "RecognizeImage"}
+	batch := Match{SnetID: "vision", File: "vision.proto", Service: "vision.Vision", Method: "RecognizeBatch"}
+	for _, test := range []struct {
+		name string
+		want []Match
+	}{
+		{name: "recognize", want: []Match{echo, image, batch}},
+		{name: "RECOGNIZEIMAGE", want: []Match{image}},
+		// the fully-qualified name is matched, the package included
+		{name: "vision.vision.recognizeb", want: []Match{batch}},
+		{name: "Translate"},
+		{name: ""},
+	} {
+		if got := s.FindServicesByMethod(test.name); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("FindServicesByMethod(%q) = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFindServicesByMessage(t *testing.T) {
+	s := searchNet(t)
+	match := func(snetID, method, message, usage string) Match {
+		file, service := "vision.proto", "vision.Vision"
+		if snetID == "echo" {
+			file, service = "echo.proto", "echo.Echo"
+		}
+		return Match{SnetID: snetID, File: file, Service: service, Method: method, Message: message, Usage: usage}
+	}
+	for _, test := range []struct {
+		name string
+		want []Match
+	}{
+		// found as the input, in a field of the output, and in the values of a map; once per method
+		{name: "imageinput", want: []Match{
+			match("vision", "RecognizeImage", "vision.ImageInput", UsageInput),
+			match("vision", "RecognizeBatch", "vision.ImageInput", UsageInput),
+		}},
+		{name: "Response", want: []Match{
+			match("echo", "Say", "echo.Response", UsageOutput),
+			match("echo", "Recognize", "echo.Response", UsageOutput),
+		}},
+		{name: "labels", want: []Match{
+			match("vision", "RecognizeImage", "vision.Labels", UsageOutput),
+			match("vision", "RecognizeBatch", "vision.Labels", UsageOutput),
+		}},
+		// map entries aren't matched themselves
+		{name: "ImagesEntry"},
+		{name: ""},
+	} {
+		if got := s.FindServicesByMessage(test.name); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("FindServicesByMessage(%q) =\n%+v\nwant\n%+v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package snet_syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"math/rand/v2"
+	"matrix-ai-framework/internal/grpc_manager"
+	"matrix-ai-framework/pkg/db"
+	ipfs "matrix-ai-framework/pkg/ipfs"
+	"sort"
+)
+
+// Self-test step statuses
+const (
+	StepPassed  = "pass"
+	StepFailed  = "fail"
+	StepSkipped = "skip"
+)
+
+// Self-test step names, in execution order
+const (
+	StepMetadata = "metadata"
+	StepCID      = "cid"
+	StepCompile  = "compile"
+	StepEndpoint = "endpoint"
+	StepGRPC     = "grpc"
+)
+
+// SelfTestStep is the outcome of one pipeline stage for a service
+type SelfTestStep struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// SelfTestResult holds the steps run for one service
+type SelfTestResult struct {
+	SnetID string
+	Steps  []SelfTestStep
+}
+
+// Passed reports whether no step of the service failed
+func (r SelfTestResult) Passed() bool {
+	for _, step := range r.Steps {
+		if step.Status == StepFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// SelfTest runs the sync pipeline read-only for a random sample of synced services:
+// fetch the model bundle, verify its CID, compile the protos and check that the endpoint accepts
+// TCP connections. With live set, it also waits for a gRPC connection to the daemon to become ready.
+// Nothing is written to the DB or to the synced descriptors.
+func (s *SnetSyncer) SelfTest(ctx context.Context, sampleSize int, live bool) ([]SelfTestResult, error) {
+	services, err := s.DB.GetSnetServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get services: %w", err)
+	}
+	rand.Shuffle(len(services), func(i, j int) { services[i], services[j] = services[j], services[i] })
+	if sampleSize > 0 && len(services) > sampleSize {
+		services = services[:sampleSize]
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].SnetID < services[j].SnetID })
+
+	results := make([]SelfTestResult, 0, len(services))
+	for _, service := range services {
+		results = append(results, s.selfTestService(ctx, service, live))
+	}
+	return results, nil
+}
+
+func (s *SnetSyncer) selfTestService(ctx context.Context, service db.SnetService, live bool) SelfTestResult {
+	result := SelfTestResult{SnetID: service.SnetID}
+	add := func(name, status, detail string) {
+		result.Steps = append(result.Steps, SelfTestStep{Name: name, Status: status, Detail: detail})
+	}
+	fail := func(name string, err error) {
+		add(name, StepFailed, err.Error())
+	}
+
+	if service.ModelIpfsHash == "" {
+		add(StepMetadata, StepSkipped, "no model")
+		add(StepCID, StepSkipped, "")
+		add(StepCompile, StepSkipped, "")
+	} else if content, _, err := s.IPFSClient.GetIpfsFileForOrg(ctx, service.SnetOrgID, service.ModelIpfsHash); err != nil {
+		fail(StepMetadata, err)
+		add(StepCID, StepSkipped, "")
+		add(StepCompile, StepSkipped, "")
+	} else {
+		add(StepMetadata, StepPassed, fmt.Sprintf("%d bytes", len(content)))
+
+		switch err = ipfs.VerifyCID(service.ModelIpfsHash, content); {
+		case err == nil:
+			add(StepCID, StepPassed, "")
+		case errors.Is(err, ipfs.ErrCIDNotVerifiable):
+			add(StepCID, StepSkipped, err.Error())
+		default:
+			fail(StepCID, err)
+		}
+
+		protoFiles, err := ipfs.ReadFilesCompressed(string(content), s.ArchiveLimits)
+		if err != nil {
+			fail(StepCompile, err)
+		} else {
+			compiled := 0
+			var compileErr error
+			bundle := protoBundle(protoFiles)
+			for _, fileName := range sortedKeys(bundle) {
+				if _, err := s.compileProto(bundle, fileName); err != nil {
+					compileErr = errors.Join(compileErr, err)
+					continue
+				}
+				compiled++
+			}
+			if compileErr != nil {
+				fail(StepCompile, compileErr)
+			} else {
+				add(StepCompile, StepPassed, fmt.Sprintf("%d files", compiled))
+			}
+		}
+	}
+
+	address, secure, err := dialEndpoint(ctx, service.URL)
+	if err != nil {
+		fail(StepEndpoint, err)
+		add(StepGRPC, StepSkipped, "")
+		return result
+	}
+	add(StepEndpoint, StepPassed, address)
+
+	if !live {
+		add(StepGRPC, StepSkipped, "live checks disabled")
+		return result
+	}
+	if err := s.checkGRPCReady(ctx, address, secure); err != nil {
+		fail(StepGRPC, err)
+	} else {
+		add(StepGRPC, StepPassed, "")
+	}
+	return result
+}
+
+// endpointAddress converts a service endpoint to host:port, using the default port of the scheme if missing
+func endpointAddress(endpoint string) (address string, secure bool, err error) {
+	parsed, err := grpc_manager.ParseEndpoint(endpoint)
+	if err != nil {
+		return "", false, err
+	}
+	return parsed.Address, parsed.Secure(), nil
+}
+
+func (s *SnetSyncer) checkGRPCReady(ctx context.Context, address string, secure bool) error {
+	creds := insecure.NewCredentials()
+	if secure {
+		creds = credentials.NewClientTLSFromCert(nil, "")
+	}
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			s.log.Error().Err(err).Msg("Failed to close self-test connection")
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, endpointDialTimeout)
+	defer cancel()
+	conn.Connect()
+	for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("connection not ready: %s", state)
+		}
+	}
+	return nil
+}
@@ -1,224 +1,1346 @@
 package snet_syncer
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/bufbuild/protocompile"
+	"github.com/bufbuild/protocompile/reporter"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"io"
+	"matrix-ai-framework/internal/sanitizer"
 	"matrix-ai-framework/pkg/blockchain"
 	"matrix-ai-framework/pkg/db"
 	ipfs "matrix-ai-framework/pkg/ipfs"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	defaultSyncInterval = time.Hour
+	defaultConcurrency  = 4
+	// model archives hold a few proto files, these bounds only stop abusive ones
+	defaultArchiveMaxBytes = 32 << 20
+	defaultArchiveMaxFiles = 1000
+	defaultMaxMetadataSize = 16 << 20
+	// DefaultCallTimeout bounds calls to service methods unless CallTimeout is set
+	DefaultCallTimeout = 30 * time.Second
+)
+
 type SnetSyncer struct {
-	Ethereum        blockchain.Ethereum
-	IPFSClient      ipfs.IPFSClient
+	Ethereum        Registry
+	IPFSClient      ContentFetcher
+	HTTPFetcher     *ipfs.HTTPFetcher // fetches metadata published on http(s) URIs
 	DB              db.Service
-	FileDescriptors map[string][]protoreflect.FileDescriptor
+	FileDescriptors map[string][]protoreflect.FileDescriptor // key: org and service snet id, see descriptorKey
+	// LenientCompile enables a second compile attempt with known-problematic
+	// constructs (unknown syntax versions, editions) rewritten to proto3.
+	LenientCompile bool
+	// MergeDuplicates shows services published by several orgs with the same model bundle once,
+	// listing the other providers as "also available from"
+	MergeDuplicates bool
+	// Sanitizer cleans service descriptions shown in the services info
+	Sanitizer sanitizer.Sanitizer
+	// Concurrency is the number of orgs, and of services per org, synced at once
+	Concurrency int
+	// IPFSRetry is the retry policy of IPFS fetches
+	IPFSRetry RetryPolicy
+	// ForceFullSync re-syncs every service, including the ones whose metadata didn't change
+	ForceFullSync bool
+	// IncludeOrgs, when not empty, are the only orgs synced. ExcludeOrgs are never synced, even when included.
+	// Orgs are matched by snet id and filtered out before any RPC or IPFS call.
+	IncludeOrgs []string
+	ExcludeOrgs []string
+	// OrgPageSize is the number of orgs listed and synced at a time, 0 syncs all of them at once
+	OrgPageSize int
+	// ArchiveLimits bound the files extracted from model archives
+	ArchiveLimits ipfs.ArchiveLimits
+	// MaxMetadataSize caps the size of gzipped metadata once decompressed, 0 means no limit
+	MaxMetadataSize int64
+	// SyncInterval is how often the registry is synced again, defaultSyncInterval when not positive
+	SyncInterval time.Duration
+	// NewTicker starts the tickers of the periodic syncs and health checks, NewRealTicker when nil
+	NewTicker NewTickerFunc
+	// HealthCheckInterval is how often service endpoints are dialed, 0 disables the checks
+	HealthCheckInterval time.Duration
+	// HealthCheckConcurrency is the number of endpoints dialed at once by the health checks,
+	// defaultHealthCheckConcurrency when not positive
+	HealthCheckConcurrency int
+	// CallTimeout bounds each call to a method of a synced service, DefaultCallTimeout when not positive
+	CallTimeout time.Duration
+	// InvokableOnly hides services with an unreachable endpoint from the services info
+	InvokableOnly bool
+	// DryRun syncs without writing to the DB: the writes are counted in the SyncResult instead, and
+	// services removed from the registry keep their descriptors
+	DryRun bool
+	// PruneHardDelete deletes the rows of orgs and services removed from the registry instead of
+	// setting their deleted_at
+	PruneHardDelete bool
+	// LazyCompile keeps the proto sources of synced services and compiles them on first access
+	// through GetServiceDescriptors instead of during the sync
+	LazyCompile bool
+	// OnServiceSynced, when set, is called after a service is stored and at least one of its files compiled,
+	// or with LazyCompile, once its proto sources are stored.
+	// OnOrgSynced, when set, is called after an org and all its services are synced. The hooks are called
+	// from the sync workers without holding locks, so they must be safe for concurrent use.
+	OnServiceSynced func(snetID string, meta blockchain.ServiceMetadata)
+	OnOrgSynced     func(snetID string, meta blockchain.OrganizationMetaData)
+	// MetadataTransform, when set, rewrites the org and service metadata before it is parsed, e.g. to
+	// unwrap or rename the fields of a registry with quirks. It gets the decompressed JSON, and its
+	// output is what the unchanged check hashes. A failure skips the org or service like a failed fetch.
+	MetadataTransform func(raw []byte) ([]byte, error)
+	// ImportResolver, when set, resolves the imports a bundle doesn't ship, e.g. a proto library shared by
+	// the services of an org and published separately. Bundle files take precedence over it.
+	ImportResolver protocompile.Resolver
+	compileErrors  map[string][]CompileDiagnostic // key: service snet id
+	compileSlots   *compileSlots                  // bounds concurrent proto compilations
+	health         *healthStore
+	compileStats   *compileStatsStore
+	rpcLimiter     *AIMDLimiter    // adapts in-flight Ethereum RPC calls to the provider limits
+	rpcBreaker     *CircuitBreaker // pauses Ethereum RPC calls while the node keeps failing, nil when disabled
+	lastSync       *syncStatus
+	events         *eventHub              // subscribers of the sync events
+	metrics        *syncMetrics           // nil when metrics are disabled
+	syncMu         *sync.Mutex            // serializes sync passes
+	pendingProtos  map[string]*lazyBundle // key: service snet id, sources not compiled yet with LazyCompile
+	serviceless    map[string]bool        // key: service snet id, protos compiled cleanly without a gRPC service
+	descriptorOrgs map[string]string      // key: service snet id, org its entry of FileDescriptors was compiled for
+	// descriptorsMu guards FileDescriptors, descriptorOrgs, compileErrors, pendingProtos and serviceless, shared by all
+	// copies of the syncer
+	descriptorsMu *sync.RWMutex
+	// log is the logger given to New with the component field set
+	log zerolog.Logger
 }
 
-func New(eth blockchain.Ethereum, ipfs ipfs.IPFSClient, db db.Service) SnetSyncer {
-	return SnetSyncer{
+// ErrMissingDependency is returned by New when the Ethereum, IPFS or DB client is missing
+var ErrMissingDependency = errors.New("missing dependency")
+
+// New returns a syncer of the registry read through eth into db, fetching metadata and models with ipfsClient.
+// Any implementation of the interfaces will do, e.g. the fakes of the fakes package in tests.
+// The syncer logs to logger, or the global logger when nil, with "component" set to "snet_syncer".
+func New(eth Registry, ipfsClient ContentFetcher, db db.Service, logger *zerolog.Logger) (*SnetSyncer, error) {
+	switch {
+	case missingClient(eth):
+		return nil, fmt.Errorf("%w: ethereum client", ErrMissingDependency)
+	case missingClient(ipfsClient):
+		return nil, fmt.Errorf("%w: ipfs client", ErrMissingDependency)
+	case db == nil:
+		return nil, fmt.Errorf("%w: db", ErrMissingDependency)
+	}
+	if logger == nil {
+		logger = &log.Logger
+	}
+	s := &SnetSyncer{
 		Ethereum:        eth,
-		IPFSClient:      ipfs,
+		IPFSClient:      ipfsClient,
+		HTTPFetcher:     ipfs.NewHTTPFetcher(),
 		DB:              db,
 		FileDescriptors: make(map[string][]protoreflect.FileDescriptor),
+		Sanitizer:       sanitizer.New(),
+		SyncInterval:    defaultSyncInterval,
+		CallTimeout:     DefaultCallTimeout,
+		NewTicker:       NewRealTicker,
+		IPFSRetry:       DefaultIPFSRetry,
+		ArchiveLimits:   ipfs.ArchiveLimits{MaxBytes: defaultArchiveMaxBytes, MaxFiles: defaultArchiveMaxFiles},
+		MaxMetadataSize: defaultMaxMetadataSize,
+		compileErrors:   make(map[string][]CompileDiagnostic),
+		pendingProtos:   make(map[string]*lazyBundle),
+		serviceless:     make(map[string]bool),
+		descriptorOrgs:  make(map[string]string),
+		compileSlots:    &compileSlots{slots: make(chan struct{}, runtime.GOMAXPROCS(0))},
+		health:          &healthStore{statuses: make(map[string]EndpointHealth)},
+		compileStats:    &compileStatsStore{stats: make(map[string]CompileStat)},
+		rpcLimiter:      NewAIMDLimiter(defaultRPCMinConcurrency, defaultRPCMaxConcurrency),
+		rpcBreaker:      NewCircuitBreaker(defaultRPCBreakerThreshold, defaultRPCBreakerCooldown),
+		lastSync:        &syncStatus{initialDone: make(chan struct{})},
+		events:          &eventHub{},
+		syncMu:          &sync.Mutex{},
+		descriptorsMu:   &sync.RWMutex{},
+		Concurrency:     defaultConcurrency,
+		log:             logger.With().Str("component", "snet_syncer").Logger(),
 	}
+	s.rpcLimiter.log = s.log
+	s.rpcBreaker.log = s.log
+	return s, nil
+}
+
+// SetCompileConcurrency limits how many proto compilations run at once.
+// Compilation is CPU-bound, so this limit is independent of how many fetches are in flight;
+// a non-positive value means GOMAXPROCS. It is safe to call while syncing, compilations already running
+// count against the previous limit until they finish.
+func (s *SnetSyncer) SetCompileConcurrency(n int) {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	if s.compileSlots == nil {
+		s.compileSlots = &compileSlots{}
+	}
+	s.compileSlots.mu.Lock()
+	defer s.compileSlots.mu.Unlock()
+	s.compileSlots.slots = make(chan struct{}, n)
+}
+
+// compileSlots holds the semaphore of the proto compilations, shared by all copies of the syncer
+type compileSlots struct {
+	mu    sync.Mutex
+	slots chan struct{}
+}
+
+// acquire waits for a free slot and returns the function releasing it. The slot is released to the channel
+// it was taken from, even if SetCompileConcurrency swapped it meanwhile.
+func (c *compileSlots) acquire() (release func()) {
+	c.mu.Lock()
+	slots := c.slots
+	c.mu.Unlock()
+	slots <- struct{}{}
+	return func() { <-slots }
 }
 
-func (s *SnetSyncer) syncOnce() {
-	log.Info().Msg("SnetSyncer now working...")
+// syncOnce syncs all orgs and services of the registry, up to Concurrency orgs and Concurrency services
+// of each org at a time. With OrgPageSize set, orgs are listed and synced a page at a time.
+// Failures of single orgs or services don't stop the sync, they are joined into the returned error.
+// Orgs and services no longer in the registry are pruned after the pass, complete reports that the pass
+// got that far, i.e. it wasn't stopped by a canceled context or a failure to list the orgs.
+// The orgs synced so far are stored as a checkpoint, a pass stopped halfway is resumed after them by the
+// next one unless ForceFullSync is set. A resumed pass doesn't prune, as it didn't see the whole registry.
+// The orgs and services seen by the pass are returned as a snapshot, partial unless the pass was complete.
+func (s *SnetSyncer) syncOnce(ctx context.Context) (snapshot SyncSnapshot, complete bool, err error) {
+	s.log.Info().Msg("SnetSyncer now working...")
+	defer s.metrics.observeSync(time.Now())
 
-	orgs, _ := s.Ethereum.GetOrgs()
-	for _, orgIDBytes := range orgs {
-		borg, err := s.Ethereum.GetOrg(orgIDBytes)
+	errs := &syncErrors{onAdd: func(err error) {
+		s.publish(SyncEvent{Type: EventError, Error: err.Error()})
+	}}
+	seen := &seenIDs{}
+	known := s.knownMetadataHashes(ctx)
+	owners := s.storedOwners(ctx)
+	progress := s.startProgress(ctx)
+	defer func() { snapshot = seen.snapshot(!complete || progress.resumed) }()
+	total := -1
+	offset := 0
+	if s.OrgPageSize > 0 {
+		offset = progress.start()
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			errs.add(err)
+			return snapshot, false, errs.join()
+		}
+		orgs, pageTotal, err := s.listOrgs(ctx, offset)
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to get org")
+			s.log.Error().Err(err).Int("offset", offset).Msg("Failed to get orgs")
+			errs.add(fmt.Errorf("get orgs: %w", err))
+			return snapshot, false, errs.join()
+		}
+		if total < 0 && !progress.listed(pageTotal) && offset > 0 {
+			offset = 0
 			continue
 		}
-		var org blockchain.OrganizationMetaData
+		if total >= 0 && pageTotal != total {
+			// ids shifted between pages, some orgs may have been skipped in this pass
+			seen.markChanged()
+		}
+		total = pageTotal
 
-		metadataJson, err := s.IPFSClient.GetIpfsFile(string(borg.OrgMetadataURI))
-		if err != nil {
-			log.Error().Err(err).Msg("Failed to get ipfs file")
-			continue
+		first := 0
+		if s.OrgPageSize <= 0 {
+			// all orgs are listed at once, the ones before the checkpoint were synced by the last pass
+			first = min(progress.start(), len(orgs))
 		}
+		// the orgs of the page are all read before any is synced, so the services whose id several of
+		// them publish are claimed the same way whatever order the orgs are synced in
+		page := make([]*blockchain.Org, len(orgs)-first)
+		group, groupCtx := errgroup.WithContext(ctx)
+		group.SetLimit(s.concurrency())
+		for i, orgIDBytes := range orgs[first:] {
+			index := offset + first + i
+			if !s.syncsOrg(bytes32ToString(orgIDBytes)) {
+				// filtered orgs are handled like orgs removed from the registry and pruned
+				s.log.Debug().Str("org", bytes32ToString(orgIDBytes)).Msg("Skipping filtered org")
+				progress.orgDone(ctx, index)
+				continue
+			}
+			seen.addOrg(orgIDBytes)
+			group.Go(func() error {
+				borg, err := s.readOrg(groupCtx, orgIDBytes, errs, seen)
+				if err != nil {
+					return err
+				}
+				if borg == nil {
+					progress.orgDone(ctx, index)
+				}
+				page[i] = borg
+				return nil
+			})
+		}
+		if err := group.Wait(); err != nil {
+			errs.add(err)
+			return snapshot, false, errs.join()
+		}
+		seen.claimServices(page, owners)
 
-		err = json.Unmarshal(metadataJson, &org)
-		if err != nil {
-			log.Error().Err(err).Any("content", string(metadataJson)).Msg("Can't unmarshal org metadata from ipfs")
+		group, groupCtx = errgroup.WithContext(ctx)
+		group.SetLimit(s.concurrency())
+		for i, borg := range page {
+			if borg == nil {
+				continue
+			}
+			index := offset + first + i
+			group.Go(func() error {
+				if err := s.syncOrg(groupCtx, *borg, errs, seen, known); err != nil {
+					return err
+				}
+				// an org cut short by the cancellation isn't done, the resumed pass syncs it again
+				if err := groupCtx.Err(); err != nil {
+					return err
+				}
+				progress.orgDone(ctx, index)
+				return nil
+			})
+		}
+		if err := group.Wait(); err != nil {
+			errs.add(err)
+			return snapshot, false, errs.join()
+		}
+
+		offset += len(orgs)
+		if s.OrgPageSize <= 0 || len(orgs) == 0 || offset >= total {
+			break
+		}
+	}
+	progress.finish(ctx)
+	if progress.resumed {
+		s.log.Info().Msg("Not pruning, the sync resumed from a checkpoint")
+	} else if err := s.prune(ctx, seen); err != nil {
+		s.log.Error().Err(err).Msg("Failed to prune removed orgs and services")
+		errs.add(err)
+	}
+	return snapshot, true, errs.join()
+}
+
+// readOrg reads an org from the registry, a failure is added to errs and nil is returned. Only a canceled
+// context is returned, aborting the whole sync.
+func (s *SnetSyncer) readOrg(ctx context.Context, orgIDBytes [32]byte, errs *syncErrors, seen *seenIDs) (*blockchain.Org, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var borg blockchain.Org
+	err := s.callRPC(ctx, func() (err error) {
+		borg, err = s.Ethereum.GetOrg(ctx, orgIDBytes)
+		return
+	})
+	if err != nil {
+		s.log.Error().Err(err).Str("org", bytes32ToString(orgIDBytes)).Msg("Failed to get org")
+		errs.add(fmt.Errorf("get org %s: %w", bytes32ToString(orgIDBytes), err))
+		seen.markIncomplete()
+		return nil, nil
+	}
+	seen.addServices(borg.ServiceIds)
+	return &borg, nil
+}
+
+// syncOrg syncs an org read from the registry and the services it claimed, see seenIDs.claimServices.
+// Failures are added to errs and only a canceled context is returned, aborting the whole sync.
+func (s *SnetSyncer) syncOrg(ctx context.Context, borg blockchain.Org, errs *syncErrors, seen *seenIDs, known map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	orgSnetID := bytes32ToString(borg.Id)
+	s.publish(SyncEvent{Type: EventOrgStarted, OrgSnetID: orgSnetID})
+	org, err := s.resolveOrg(ctx, borg, seen)
+	if err != nil {
+		errs.add(err)
+		return nil
+	}
+
+	var pendingMu sync.Mutex
+	var pending []*pendingService
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(s.concurrency())
+	for _, serviceIDBytes := range borg.ServiceIds {
+		// syncing it would overwrite the service of the other org
+		if owner := seen.owner(bytes32ToString(serviceIDBytes)); owner != orgSnetID {
+			s.log.Warn().Str("snet-id", bytes32ToString(serviceIDBytes)).Str("org", orgSnetID).Str("other-org", owner).Msg("Service id already synced for another org, skipping")
 			continue
 		}
+		group.Go(func() error {
+			service, err := s.resolveService(groupCtx, borg.Id, org, serviceIDBytes, errs, seen, known)
+			if service != nil {
+				pendingMu.Lock()
+				pending = append(pending, service)
+				pendingMu.Unlock()
+			}
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+
+	if err = s.storeOrg(ctx, &org, pending); err != nil {
+		// the transaction left nothing of the org behind, its services are skipped rather than compiled
+		// and hashed for an org that wasn't stored, the next pass syncs them again
+		s.log.Error().Err(err).Str("org", orgSnetID).Msg("Failed to store org")
+		errs.add(fmt.Errorf("org %s: %w", orgSnetID, err))
+		return nil
+	}
 
-		org.Owner = borg.Owner.Hex()
-		org.SnetID = strings.ReplaceAll(string(borg.Id[:]), "\u0000", "")
+	group, groupCtx = errgroup.WithContext(ctx)
+	group.SetLimit(s.concurrency())
+	models := &modelCache{}
+	for _, service := range pending {
+		group.Go(func() error {
+			return s.compileService(groupCtx, org, service, errs, models)
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	s.metrics.orgSynced()
+	s.lastSync.run.orgs.Add(1)
+	if s.OnOrgSynced != nil {
+		s.OnOrgSynced(orgSnetID, org)
+	}
+	return nil
+}
+
+// resolveOrg fetches and validates the metadata of an org read from the registry, failures are logged
+// and returned prefixed with the org. The metadata hash is recorded in seen, which may be nil.
+func (s *SnetSyncer) resolveOrg(ctx context.Context, borg blockchain.Org, seen *seenIDs) (org blockchain.OrganizationMetaData, err error) {
+	orgSnetID := bytes32ToString(borg.Id)
+	uri := metadataURI(borg.OrgMetadataURI)
+	metadataJson, err := s.fetchMetadata(ctx, orgSnetID, uri)
+	if err != nil {
+		s.log.Error().Err(err).Str("org", orgSnetID).Msg("Failed to get org metadata")
+		return org, fmt.Errorf("org %s: fetch metadata: %w", orgSnetID, err)
+	}
+	seen.orgMetadata(orgSnetID, hashMetadata(metadataJson))
+
+	if err = checkJSON(uri, metadataJson); err != nil {
+		s.log.Error().Err(err).Str("org", orgSnetID).Msg("Org metadata is not JSON")
+		return org, fmt.Errorf("org %s: %w", orgSnetID, err)
+	}
+	err = json.Unmarshal(metadataJson, &org)
+	if err != nil {
+		s.log.Error().Err(err).Str("org", orgSnetID).Str("content", string(metadataJson)).Msg("Can't unmarshal org metadata from ipfs")
+		return org, fmt.Errorf("org %s: unmarshal metadata: %w", orgSnetID, err)
+	}
+	if err = org.Validate(); err != nil {
+		s.log.Error().Err(err).Str("org", orgSnetID).Msg("Rejected org metadata")
+		return org, fmt.Errorf("org %s: %w", orgSnetID, err)
+	}
+
+	org.Owner = borg.Owner.Hex()
+	org.SnetID = orgSnetID
+	return org, nil
+}
+
+// storeOrg stores an org, its groups and the given services together, a failure leaves none of them
+// half-written. The ids of the stored rows are set on org and the services.
+func (s *SnetSyncer) storeOrg(ctx context.Context, org *blockchain.OrganizationMetaData, pending []*pendingService) error {
+	return s.DB.WithTx(ctx, func(tx db.Tx) error {
 		dbOrg, dbGroups := org.DB()
-		orgID, err := s.DB.CreateSnetOrg(dbOrg)
+		orgID, err := tx.CreateSnetOrg(ctx, dbOrg)
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to create org")
+			return fmt.Errorf("create org: %w", err)
 		}
 		org.ID = orgID
-		err = s.DB.CreateSnetOrgGroups(orgID, dbGroups)
-		if err != nil {
-			log.Error().Err(err).Msg("Failed to create org group")
+		if err = tx.CreateSnetOrgGroups(ctx, orgID, dbGroups); err != nil {
+			return fmt.Errorf("create groups: %w", err)
 		}
-
-		for _, serviceIDBytes := range borg.ServiceIds {
-			service, err := s.Ethereum.GetService(borg.Id, serviceIDBytes)
-			if err != nil {
-				log.Error().Err(err)
-				continue
+		for _, service := range pending {
+			service.meta.OrgID = orgID
+			if service.meta.ID, err = tx.CreateSnetService(ctx, service.meta.DB()); err != nil {
+				return fmt.Errorf("create service %s: %w", service.meta.SnetID, err)
 			}
-
-			metadataJson, err = s.IPFSClient.GetIpfsFile(string(service.MetadataURI))
-			if err != nil {
-				log.Error().Err(err).Msg("Failed to get file from ipfs")
-				return
+			if err = tx.CreateSnetServiceEndpoints(ctx, service.meta.SnetID, service.meta.Endpoints()); err != nil {
+				return fmt.Errorf("create endpoints of %s: %w", service.meta.SnetID, err)
 			}
-
-			var srvMeta blockchain.ServiceMetadata
-			err = json.Unmarshal(metadataJson, &srvMeta)
-			if err != nil {
-				log.Error().Err(err).Any("content", string(metadataJson)).Msg("Failed to unmarshal metadata from ipfs")
-				return
+			if err = tx.CreateSnetMethodPrices(ctx, service.meta.SnetID, service.meta.MethodPrices()); err != nil {
+				return fmt.Errorf("create method prices of %s: %w", service.meta.SnetID, err)
 			}
+		}
+		return nil
+	})
+}
 
-			log.Debug().Msgf("Metadata of service: %+v", srvMeta)
+// pendingService is a service whose metadata was fetched and validated, it is stored and compiled next
+type pendingService struct {
+	meta blockchain.ServiceMetadata
+	hash string // of the metadata, see hashMetadata
+}
 
-			srvMeta.OrgID = orgID
-			srvMeta.SnetID = strings.ReplaceAll(string(serviceIDBytes[:]), "\u0000", "")
-			srvMeta.SnetOrgID = org.SnetID
-			srvMeta.ID, err = s.DB.CreateSnetService(srvMeta.DB())
-			if err != nil {
-				log.Error().Err(err).Int("id", srvMeta.ID).Str("snet-id", srvMeta.SnetID).Msg("Failed to add snet_service")
-			}
+// resolveService fetches and validates the metadata of a service, a broken service is skipped with its
+// failure added to errs. A service whose metadata hashes to its known hash, the one of the last complete
+// sync, is skipped too unless ForceFullSync is set. The metadata hash is recorded in seen, which may be nil.
+// Only a canceled context is returned.
+func (s *SnetSyncer) resolveService(ctx context.Context, orgIDBytes [32]byte, org blockchain.OrganizationMetaData, serviceIDBytes [32]byte, errs *syncErrors, seen *seenIDs, known map[string]string) (*pendingService, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	serviceSnetID := bytes32ToString(serviceIDBytes)
+	var service blockchain.Service
+	err := s.callRPC(ctx, func() (err error) {
+		service, err = s.Ethereum.GetService(ctx, orgIDBytes, serviceIDBytes)
+		return
+	})
+	if err != nil {
+		s.log.Error().Err(err).Str("org", org.SnetID).Str("snet-id", serviceSnetID).Msg("Failed to get service")
+		errs.add(fmt.Errorf("service %s/%s: get service: %w", org.SnetID, serviceSnetID, err))
+		return nil, nil
+	}
 
-			content, err := s.IPFSClient.GetIpfsFile(srvMeta.ModelIpfsHash)
-			if err != nil {
-				log.Error().Err(err)
-			}
-			protoFiles, err := ipfs.ReadFilesCompressed(string(content))
-			if err != nil {
-				log.Error().Err(err)
-			}
+	uri := metadataURI(service.MetadataURI)
+	metadataJson, err := s.fetchMetadata(ctx, org.SnetID, uri)
+	if err != nil {
+		s.log.Error().Err(err).Str("org", org.SnetID).Str("snet-id", serviceSnetID).Msg("Failed to get service metadata")
+		errs.add(fmt.Errorf("service %s/%s: fetch metadata: %w", org.SnetID, serviceSnetID, err))
+		return nil, nil
+	}
+	metadataHash := hashMetadata(metadataJson)
+	seen.serviceMetadata(serviceSnetID, metadataHash)
+	if !s.ForceFullSync && known[serviceSnetID] == metadataHash && s.syncedProtos(serviceSnetID) {
+		s.log.Debug().Str("org", org.SnetID).Str("snet-id", serviceSnetID).Msg("Service metadata unchanged, skipping")
+		s.lastSync.run.unchanged.Add(1)
+		return nil, nil
+	}
 
-			for fileName, fileContent := range protoFiles {
-				fd := getFileDescriptor(string(fileContent), fileName)
-				s.FileDescriptors[srvMeta.SnetID] = append(s.FileDescriptors[srvMeta.SnetID], fd)
-			}
+	if err = checkJSON(uri, metadataJson); err != nil {
+		s.log.Error().Err(err).Str("org", org.SnetID).Str("snet-id", serviceSnetID).Msg("Service metadata is not JSON")
+		errs.add(fmt.Errorf("service %s/%s: %w", org.SnetID, serviceSnetID, err))
+		return nil, nil
+	}
+	var srvMeta blockchain.ServiceMetadata
+	err = json.Unmarshal(metadataJson, &srvMeta)
+	if err != nil {
+		s.log.Error().Err(err).Str("org", org.SnetID).Str("snet-id", serviceSnetID).Str("content", string(metadataJson)).Msg("Failed to unmarshal metadata from ipfs")
+		errs.add(fmt.Errorf("service %s/%s: unmarshal metadata: %w", org.SnetID, serviceSnetID, err))
+		return nil, nil
+	}
+	if err = srvMeta.Validate(); err != nil {
+		s.log.Error().Err(err).Str("org", org.SnetID).Str("snet-id", serviceSnetID).Msg("Rejected service metadata")
+		errs.add(fmt.Errorf("service %s/%s: %w", org.SnetID, serviceSnetID, err))
+		return nil, nil
+	}
+
+	s.log.Debug().Str("org", org.SnetID).Str("snet-id", serviceSnetID).Str("display-name", srvMeta.DisplayName).Str("model", srvMeta.ModelIpfsHash).Int("groups", len(srvMeta.Groups)).Msg("Service metadata")
+
+	srvMeta.SnetID = serviceSnetID
+	srvMeta.SnetOrgID = org.SnetID
+	return &pendingService{meta: srvMeta, hash: metadataHash}, nil
+}
+
+// compileService fetches and compiles the protos of a stored service, with LazyCompile it only keeps
+// the sources for GetServiceDescriptors. Failures are added to errs and only a canceled context is
+// returned. The metadata hash is stored once everything else is, so a failed sync is retried on the
+// next pass. Services of the org sharing a model get it from models, which may be nil.
+func (s *SnetSyncer) compileService(ctx context.Context, org blockchain.OrganizationMetaData, service *pendingService, errs *syncErrors, models *modelCache) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	srvMeta, serviceSnetID := service.meta, service.meta.SnetID
+	// a service without a model is kept with its metadata, it just has nothing to compile
+	var bundle map[string]string
+	model := models.get(srvMeta.ModelIpfsHash)
+	if srvMeta.ModelIpfsHash == "" {
+		s.log.Info().Str("org", org.SnetID).Str("snet-id", serviceSnetID).Msg("Service has no model, skipping proto compilation")
+	} else {
+		var err error
+		if bundle, err = model.load(ctx, s, org.SnetID, srvMeta.ModelIpfsHash); err != nil {
+			s.log.Error().Err(err).Str("org", org.SnetID).Str("snet-id", serviceSnetID).Str("model", srvMeta.ModelIpfsHash).Msg("Failed to get model")
+			errs.add(fmt.Errorf("service %s/%s: %w", org.SnetID, serviceSnetID, err))
+			return nil
+		}
+	}
+
+	var descriptors []protoreflect.FileDescriptor
+	if s.LazyCompile {
+		// descriptors of previous syncs are dropped, stored ones too so a restart doesn't bring them back
+		s.setPendingProtos(org.SnetID, serviceSnetID, bundle)
+	} else {
+		var compileErrs []CompileDiagnostic
+		descriptors, compileErrs = model.compile(s, serviceSnetID)
+		for _, compileErr := range compileErrs {
+			errs.add(fmt.Errorf("service %s/%s: compile %w", org.SnetID, serviceSnetID, compileErr))
 		}
+		s.descriptorsMu.Lock()
+		s.setCompiled(org.SnetID, serviceSnetID, bundle, descriptors, compileErrs)
+		s.descriptorsMu.Unlock()
 	}
+	if err := s.saveDescriptors(ctx, srvMeta.SnetID, descriptors); err != nil {
+		s.log.Error().Err(err).Str("snet-id", srvMeta.SnetID).Msg("Failed to store descriptors")
+		errs.add(fmt.Errorf("service %s/%s: store descriptors: %w", org.SnetID, serviceSnetID, err))
+	} else if err := s.DB.SetSnetServiceMetadataHash(ctx, srvMeta.SnetID, service.hash); err != nil {
+		s.log.Error().Err(err).Str("snet-id", srvMeta.SnetID).Msg("Failed to store metadata hash")
+	}
+	s.metrics.serviceSynced()
+	s.lastSync.run.services.Add(1)
+	s.publish(SyncEvent{Type: EventServiceSynced, OrgSnetID: org.SnetID, SnetID: serviceSnetID})
+	if s.OnServiceSynced != nil && (len(descriptors) > 0 || (s.LazyCompile && len(bundle) > 0)) {
+		s.OnServiceSynced(srvMeta.SnetID, srvMeta)
+	}
+	return nil
 }
 
-func (s *SnetSyncer) Start() {
-	log.Info().Msg("SnetSyncer started")
-	s.syncOnce()
-	ticker := time.NewTicker(100 * time.Hour)
+// bytes32ToString converts a registry id to its string form. Ids are right-padded with zero bytes,
+// only the padding is trimmed so an id containing a zero byte isn't mangled.
+func bytes32ToString(id [32]byte) string {
+	return string(bytes.TrimRight(id[:], "\x00"))
+}
+
+// metadataURI converts a metadata URI read from the registry to a string. Like ids, URIs may come
+// right-padded with zero bytes, which would end up in the CID fetched.
+func metadataURI(raw []byte) string {
+	return string(bytes.TrimRight(raw, "\x00"))
+}
+
+// checkJSON returns a clear error for metadata that isn't JSON, e.g. an error page served by a gateway
+func checkJSON(uri string, content []byte) error {
+	if json.Valid(content) {
+		return nil
+	}
+	if ipfs.LooksLikeHTML(content) {
+		return fmt.Errorf("gateway returned non-JSON (HTML) for %s: %q", uri, ipfs.Snippet(content))
+	}
+	return fmt.Errorf("metadata %s is not JSON: %q", uri, ipfs.Snippet(content))
+}
+
+// hashMetadata returns the hash compared between syncs to find unchanged services
+func hashMetadata(metadata []byte) string {
+	sum := sha256.Sum256(metadata)
+	return hex.EncodeToString(sum[:])
+}
+
+// knownMetadataHashes returns the metadata hashes of the services stored by previous syncs, key: service snet id
+func (s *SnetSyncer) knownMetadataHashes(ctx context.Context) map[string]string {
+	if s.ForceFullSync {
+		return nil
+	}
+	hashes, err := s.DB.GetSnetServiceMetadataHashes(ctx)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to get metadata hashes, syncing all services")
+		return nil
+	}
+	return hashes
+}
+
+// storedOwners returns the snet id of the org each stored service was synced for, key: service snet id
+func (s *SnetSyncer) storedOwners(ctx context.Context) map[string]string {
+	services, err := s.DB.GetSnetServices(ctx)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to get stored services, service ids published by several orgs go to the lowest org id")
+		return nil
+	}
+	owners := make(map[string]string, len(services))
+	for _, service := range services {
+		owners[service.SnetID] = service.SnetOrgID
+	}
+	return owners
+}
+
+// listOrgs returns the page of org ids at offset and the number of orgs in the registry,
+// all of them when OrgPageSize is not positive
+func (s *SnetSyncer) listOrgs(ctx context.Context, offset int) (orgs [][32]byte, total int, err error) {
+	err = s.callRPC(ctx, func() (err error) {
+		if s.OrgPageSize <= 0 {
+			orgs, err = s.Ethereum.GetOrgs(ctx)
+			total = len(orgs)
+			return
+		}
+		orgs, total, err = s.Ethereum.GetOrgsPaged(ctx, offset, s.OrgPageSize)
+		return
+	})
+	return
+}
+
+// concurrency returns the number of orgs, and of services per org, synced at once
+func (s *SnetSyncer) concurrency() int {
+	return max(s.Concurrency, 1)
+}
+
+// syncErrors collects the failures of a sync from concurrent workers
+type syncErrors struct {
+	mu   sync.Mutex
+	errs []error
+	// onAdd, when set, is called with each failure as it is added
+	onAdd func(err error)
+}
+
+func (e *syncErrors) add(err error) {
+	e.mu.Lock()
+	e.errs = append(e.errs, err)
+	e.mu.Unlock()
+	if e.onAdd != nil {
+		e.onAdd(err)
+	}
+}
+
+// join returns the failures sorted by message, so the result doesn't depend on the concurrency
+func (e *syncErrors) join() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	sort.Slice(e.errs, func(i, j int) bool { return e.errs[i].Error() < e.errs[j].Error() })
+	return errors.Join(e.errs...)
+}
+
+// fetchMetadata downloads org or service metadata from IPFS or, for http(s) URIs, over HTTP, and
+// decompresses it when it is gzipped. Metadata embedded in the URI as JSON is used as is.
+// The result is passed through MetadataTransform when it is set.
+func (s *SnetSyncer) fetchMetadata(ctx context.Context, orgSnetID, uri string) ([]byte, error) {
+	metadata, ok := ipfs.InlineJSON(uri)
+	if !ok {
+		var err error
+		if ipfs.IsHTTPURI(uri) {
+			metadata, err = s.HTTPFetcher.Get(ctx, uri)
+		} else {
+			metadata, err = s.fetchIPFS(ctx, orgSnetID, uri)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// some metadata is published gzipped
+		if metadata, err = ipfs.Gunzip(metadata, s.MaxMetadataSize); err != nil {
+			return nil, err
+		}
+	}
+	if s.MetadataTransform == nil {
+		return metadata, nil
+	}
+	transformed, err := s.MetadataTransform(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("transform metadata: %w", err)
+	}
+	return transformed, nil
+}
+
+// Start syncs the registry now and then every SyncInterval until the context is canceled,
+// an in-flight sync is aborted on cancellation
+func (s *SnetSyncer) Start(ctx context.Context) {
+	s.log.Info().Msg("SnetSyncer started")
+	if err := s.LoadDescriptors(ctx); err != nil {
+		s.log.Error().Err(err).Msg("Failed to load stored descriptors")
+	}
+	s.SyncNow(ctx)
+	interval := s.SyncInterval
+	if interval <= 0 {
+		interval = defaultSyncInterval
+	}
+	ticker := s.newTicker(interval)
 	defer ticker.Stop()
 	for {
 		select {
-		case <-ticker.C:
-			s.syncOnce()
+		case <-ctx.Done():
+			s.log.Info().Msg("SnetSyncer stopped")
+			return
+		case <-ticker.C():
+			s.SyncNow(ctx)
 		}
 	}
 }
 
-func getFileDescriptor(protoContent, name string) (ds protoreflect.FileDescriptor) {
-	accessor := protocompile.SourceAccessorFromMap(map[string]string{
-		name: protoContent,
-	})
+// SyncNow runs exactly one sync pass and returns its aggregated error, which is also logged and
+// recorded as the last sync result. Passes started while another one runs wait for it to finish.
+func (s *SnetSyncer) SyncNow(ctx context.Context) error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	return s.syncLocked(ctx)
+}
+
+// syncLocked is SyncNow for callers holding syncMu
+func (s *SnetSyncer) syncLocked(ctx context.Context) error {
+	started := time.Now()
+	s.lastSync.start(started)
+	s.publish(SyncEvent{Type: EventSyncStarted})
+	run, dryRun := s.runner()
+	snapshot, complete, err := run.syncOnce(ctx)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Sync finished with errors")
+	} else {
+		s.log.Info().Msg("Sync finished")
+	}
+	if prev, ok := s.LastSyncResult(); ok {
+		s.logSyncDiff(DiffSync(prev.Snapshot, snapshot))
+	}
+	result := SyncResult{StartedAt: started, FinishedAt: time.Now(), Err: err, Snapshot: snapshot}
+	if dryRun != nil {
+		counts := dryRun.snapshot()
+		result.DryRun = &counts
+		s.log.Info().
+			Int("orgs", counts.Orgs).
+			Int("groups", counts.Groups).
+			Int("services", counts.Services).
+			Int("endpoints", counts.Endpoints).
+			Int("method-prices", counts.MethodPrices).
+			Int("descriptors", counts.Descriptors).
+			Int("metadata-hashes", counts.MetadataHashes).
+			Int64("pruned-orgs", counts.PrunedOrgs).
+			Int64("pruned-services", counts.PrunedServices).
+			Msg("Dry run finished, nothing was written to the DB")
+	}
+	s.lastSync.finish(result, complete)
+	finished := SyncEvent{Type: EventSyncFinished}
+	if err != nil {
+		finished.Error = err.Error()
+	}
+	s.publish(finished)
+	return err
+}
+
+// SyncResult is the outcome of a sync run
+type SyncResult struct {
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Err        error         // joined failures of single orgs and services, nil for a clean run
+	DryRun     *DryRunCounts // writes skipped by a dry run, nil otherwise
+	// Snapshot is the registry as seen by the run, DiffSync compares it with the one of another run
+	Snapshot SyncSnapshot
+}
+
+// LastSyncResult returns the result of the last finished sync, ok is false before the first sync finished
+func (s *SnetSyncer) LastSyncResult() (result SyncResult, ok bool) {
+	s.lastSync.mu.RLock()
+	defer s.lastSync.mu.RUnlock()
+	return s.lastSync.result, s.lastSync.synced
+}
+
+// ErrProtoSyntax marks compile failures caused by the proto syntax itself
+// (unknown syntax version, editions, malformed declarations) rather than by
+// missing imports or type errors.
+var ErrProtoSyntax = errors.New("proto syntax error")
+
+// protoBundle converts the files of a model bundle to the sources compileProto resolves imports from.
+// Archive paths are normalized ("./a.proto" and "/a.proto" become "a.proto") and a directory
+// wrapping all the files is dropped, so the keys match the paths used by import statements.
+// Copies of the well-known types shipped in the bundle are dropped too, see isWellKnownProto.
+func protoBundle(protoFiles map[string][]byte) map[string]string {
+	bundle := make(map[string]string, len(protoFiles))
+	// archive names are read in sorted order, of the names normalizing to the same path the first one wins
+	for _, archiveName := range sortedKeys(protoFiles) {
+		fileName := normalizeProtoPath(archiveName)
+		if _, dup := bundle[fileName]; dup || isWellKnownProto(fileName) {
+			continue
+		}
+		bundle[fileName] = string(protoFiles[archiveName])
+	}
+	var root string
+	for fileName := range bundle {
+		dir, _, ok := strings.Cut(fileName, "/")
+		if !ok || (root != "" && dir != root) {
+			return bundle
+		}
+		root = dir
+	}
+	stripped := make(map[string]string, len(bundle))
+	for fileName, content := range bundle {
+		stripped[strings.TrimPrefix(fileName, root+"/")] = content
+	}
+	return stripped
+}
+
+// wellKnownProtos are the files protocompile's standard imports provide, the same descriptors as the
+// ones linked in the binary
+var wellKnownProtos = []string{
+	"google/protobuf/any.proto",
+	"google/protobuf/api.proto",
+	"google/protobuf/compiler/plugin.proto",
+	"google/protobuf/descriptor.proto",
+	"google/protobuf/duration.proto",
+	"google/protobuf/empty.proto",
+	"google/protobuf/field_mask.proto",
+	"google/protobuf/source_context.proto",
+	"google/protobuf/struct.proto",
+	"google/protobuf/timestamp.proto",
+	"google/protobuf/type.proto",
+	"google/protobuf/wrappers.proto",
+}
+
+// isWellKnownProto reports whether a bundle file is a copy of a well-known type, at its import path or
+// vendored under another directory. Copies are compiled from the standard imports instead: compiling
+// them with the bundle would define their symbols twice, and an outdated copy would shadow the real one.
+func isWellKnownProto(name string) bool {
+	for _, wellKnown := range wellKnownProtos {
+		if name == wellKnown || strings.HasSuffix(name, "/"+wellKnown) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeProtoPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// bundleAccessor opens the files of a bundle by the path used in an import. An import not matching
+// a bundle path exactly resolves to the only bundle file ending with it, for bundles whose directory
+// layout doesn't match their imports.
+func bundleAccessor(bundle map[string]string) func(string) (io.ReadCloser, error) {
+	return func(name string) (io.ReadCloser, error) {
+		name = normalizeProtoPath(name)
+		if content, ok := bundle[name]; ok {
+			return io.NopCloser(strings.NewReader(content)), nil
+		}
+		var match string
+		for _, fileName := range sortedKeys(bundle) {
+			if strings.HasSuffix(fileName, "/"+name) {
+				if match != "" {
+					return nil, fmt.Errorf("import %s is ambiguous: %s and %s", name, match, fileName)
+				}
+				match = fileName
+			}
+		}
+		if match == "" {
+			return nil, os.ErrNotExist
+		}
+		return io.NopCloser(strings.NewReader(bundle[match])), nil
+	}
+}
+
+// compileProto compiles a file of a bundle, its imports are resolved against the other files of the
+// bundle, ImportResolver and the well-known types. When LenientCompile is set and the failure is a syntax error, it
+// retries once with the sources rewritten by lenientProto.
+func (s *SnetSyncer) compileProto(bundle map[string]string, name string) (protoreflect.FileDescriptor, error) {
+	if s.compileSlots != nil {
+		defer s.compileSlots.acquire()()
+	}
+
+	fd, err := getFileDescriptor(bundle, name, s.ImportResolver)
+	if err == nil || !s.LenientCompile || !errors.Is(err, ErrProtoSyntax) {
+		return fd, err
+	}
+	s.log.Warn().Err(err).Str("file", name).Msg("Retrying proto compilation in lenient mode")
+	lenient := make(map[string]string, len(bundle))
+	for fileName, content := range bundle {
+		lenient[fileName] = lenientProto(content)
+	}
+	fd, lenientErr := getFileDescriptor(lenient, name, s.ImportResolver)
+	if lenientErr != nil {
+		return nil, fmt.Errorf("%w (lenient retry: %v)", err, lenientErr)
+	}
+	return fd, nil
+}
+
+func getFileDescriptor(bundle map[string]string, name string, imports protocompile.Resolver) (protoreflect.FileDescriptor, error) {
+	var resolver protocompile.Resolver = &protocompile.SourceResolver{Accessor: bundleAccessor(bundle)}
+	if imports != nil {
+		resolver = protocompile.CompositeResolver{resolver, imports}
+	}
+	// every problem of the file is collected, not just the first one
+	var problems []error
 	compiler := protocompile.Compiler{
-		Resolver:       &protocompile.SourceResolver{Accessor: accessor},
+		Resolver:       protocompile.WithStandardImports(resolver),
 		SourceInfoMode: protocompile.SourceInfoStandard,
+		Reporter: reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+			problems = append(problems, err)
+			return nil
+		}, nil),
 	}
 	fds, err := compiler.Compile(context.Background(), name)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to create file descriptor")
-		return
+		if len(problems) > 0 {
+			err = errors.Join(problems...)
+		}
+		if isSyntaxError(err) {
+			return nil, fmt.Errorf("%w: %w", ErrProtoSyntax, err)
+		}
+		return nil, err
 	}
-	ds = fds.FindFileByPath(name)
-	return
+	ds := fds.FindFileByPath(name)
+	if ds == nil {
+		return nil, fmt.Errorf("file %s not found in compiled result", name)
+	}
+	return ds, nil
+}
+
+// isSyntaxError reports whether a protocompile error points at the syntax
+// declaration or the parser rather than at semantic problems.
+func isSyntaxError(err error) bool {
+	var errWithPos reporter.ErrorWithPos
+	if !errors.As(err, &errWithPos) {
+		return false
+	}
+	msg := errWithPos.Unwrap().Error()
+	return strings.HasPrefix(msg, "syntax ") || strings.Contains(msg, "editions are not yet supported")
+}
+
+var (
+	syntaxDeclRegexp  = regexp.MustCompile(`(?m)^\s*syntax\s*=\s*[^;]*;`)
+	editionDeclRegexp = regexp.MustCompile(`(?m)^\s*edition\s*=\s*[^;]*;`)
+)
+
+// lenientProto rewrites constructs protocompile rejects: an unknown or malformed
+// syntax declaration and edition declarations are replaced with proto3.
+// A valid proto2 declaration is kept as is.
+func lenientProto(protoContent string) string {
+	syntax := "proto3"
+	if decl := syntaxDeclRegexp.FindString(protoContent); strings.Contains(decl, `"proto2"`) {
+		syntax = "proto2"
+	}
+	protoContent = strings.TrimPrefix(protoContent, "\ufeff")
+	protoContent = editionDeclRegexp.ReplaceAllString(protoContent, "")
+	protoContent = syntaxDeclRegexp.ReplaceAllString(protoContent, "")
+	return "syntax = \"" + syntax + "\";\n" + protoContent
 }
 
+// CompileErrors returns the proto compilation problems recorded during the last sync, keyed by service snet id,
+// with the file and position of each problem.
+func (s *SnetSyncer) CompileErrors() map[string][]CompileDiagnostic {
+	s.descriptorsMu.RLock()
+	defer s.descriptorsMu.RUnlock()
+	compileErrors := make(map[string][]CompileDiagnostic, len(s.compileErrors))
+	for snetID, errs := range s.compileErrors {
+		compileErrors[snetID] = slices.Clone(errs)
+	}
+	return compileErrors
+}
+
+// Descriptors returns a snapshot of the compiled descriptors keyed by service snet id,
+// safe to iterate while a sync is running. Services waiting for lazy compilation are compiled first.
+func (s *SnetSyncer) Descriptors() map[string][]protoreflect.FileDescriptor {
+	s.compilePending()
+	s.descriptorsMu.RLock()
+	defer s.descriptorsMu.RUnlock()
+	descriptors := make(map[string][]protoreflect.FileDescriptor, len(s.descriptorOrgs))
+	for snetID := range s.descriptorOrgs {
+		descriptors[snetID] = slices.Clone(s.descriptorsOf(snetID))
+	}
+	return descriptors
+}
+
+// ServiceDescriptors returns a snapshot of the compiled descriptors of a service, see GetServiceDescriptors
+func (s *SnetSyncer) ServiceDescriptors(snetID string) []protoreflect.FileDescriptor {
+	descriptors, _ := s.compiledDescriptors(snetID)
+	return descriptors
+}
+
+// catalogServices returns the synced services from the DB, key: service snet id
+func (s *SnetSyncer) catalogServices() map[string]db.SnetService {
+	catalog := make(map[string]db.SnetService)
+	services, err := s.DB.GetSnetServices(context.Background())
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to get services for services info")
+		return catalog
+	}
+	for _, service := range services {
+		catalog[service.SnetID] = service
+	}
+	return catalog
+}
+
+// serviceDescription returns the sanitized short (or full, if there is no short) description of a service
+func (s *SnetSyncer) serviceDescription(service db.SnetService) string {
+	if service.ShortDescription != "" {
+		return s.Sanitizer.HTML(service.ShortDescription)
+	}
+	return s.Sanitizer.HTML(service.Description)
+}
+
+// GetSnetServicesInfo renders the synced services and the ones whose protos failed to compile as an HTML list,
+// or a notice when there are none
 func (s *SnetSyncer) GetSnetServicesInfo() string {
+	return s.Render(HTMLFormatter{})
+}
+
+// Render renders the services info of GetSnetServicesInfo with formatter
+func (s *SnetSyncer) Render(formatter DescriptorFormatter) string {
+	var builder strings.Builder
+	// writing to a strings.Builder doesn't fail
+	_ = s.writeServicesInfo(&builder, formatter)
+	return builder.String()
+}
+
+// WriteSnetServicesInfo writes the HTML of GetSnetServicesInfo to w one service at a time, so the
+// whole list is never held in memory, e.g. for HTTP responses. It returns the first write error.
+func (s *SnetSyncer) WriteSnetServicesInfo(w io.Writer) error {
+	return s.writeServicesInfo(w, HTMLFormatter{})
+}
+
+func (s *SnetSyncer) writeServicesInfo(w io.Writer, formatter DescriptorFormatter) error {
+	empty := true
+	err := s.eachServiceInfo(formatter, func(item string) error {
+		if empty {
+			empty = false
+			if _, err := io.WriteString(w, formatter.ListOpen()); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, item)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if empty {
+		_, err = io.WriteString(w, formatter.Empty())
+		return err
+	}
+	_, err = io.WriteString(w, formatter.ListClose())
+	return err
+}
+
+// GetSnetServicesPlain renders the services info as plain text with PlainTextFormatter, for the body
+// of Matrix messages whose formatted_body is GetSnetServicesInfo
+func (s *SnetSyncer) GetSnetServicesPlain() string {
+	return s.Render(PlainTextFormatter{})
+}
+
+// GetSnetServicesInfoPages renders the services info in pages of at most maxBytes bytes each, so every
+// page fits in a Matrix message. Pages are split between services only and are well-formed on their own,
+// a service rendering larger than maxBytes gets a page of its own. maxBytes <= 0 renders a single page.
+// There are no pages when no service synced.
+func (s *SnetSyncer) GetSnetServicesInfoPages(maxBytes int) []string {
+	formatter := HTMLFormatter{}
+	items := s.servicesInfoItems(formatter)
+	if len(items) == 0 {
+		return nil
+	}
+	open, closing := formatter.ListOpen(), formatter.ListClose()
+	if maxBytes <= 0 {
+		return []string{open + strings.Join(items, "") + closing}
+	}
+	var pages []string
+	var page strings.Builder
+	for _, item := range items {
+		if page.Len() > 0 && page.Len()+len(item)+len(closing) > maxBytes {
+			pages = append(pages, page.String()+closing)
+			page.Reset()
+		}
+		if page.Len() == 0 {
+			page.WriteString(open)
+		}
+		page.WriteString(item)
+	}
+	if page.Len() > 0 {
+		pages = append(pages, page.String()+closing)
+	}
+	return pages
+}
+
+// GetServiceInfo renders the services info of a single service, unlike the full list it includes
+// services hidden by MergeDuplicates or InvokableOnly
+func (s *SnetSyncer) GetServiceInfo(snetID string) (string, error) {
+	formatter := HTMLFormatter{}
+	descriptors := s.ServiceDescriptors(snetID)
+	compileErrs := s.CompileErrors()[snetID]
+	if len(descriptors) == 0 && len(compileErrs) == 0 {
+		return "", s.notSyncedError(snetID)
+	}
+	catalog := s.catalogServices()
+	var duplicates map[string][]db.SnetService
+	if s.MergeDuplicates {
+		duplicates = duplicateServices(catalog)
+	}
 	var builder strings.Builder
-	if s.FileDescriptors != nil {
-		builder.WriteString("<div style=\"line-height: 0.8;\"><ol>")
-		for snetID, descriptors := range s.FileDescriptors {
-			if descriptors != nil {
-				for _, descriptor := range descriptors {
-					if descriptor != nil {
-						builder.WriteString("<li><strong>Path: " + descriptor.Path() + " Snet ID: " + snetID + " Descriptor: " + string(descriptor.FullName().Name()) + "</strong></li>")
-						services := descriptor.Services()
-						if services != nil {
-							for i := 0; i < services.Len(); i++ {
-								if services.Get(i) != nil {
-									builder.WriteString("<p><em>Service: " + string(services.Get(i).FullName().Name()) + "</em></p>")
-									methods := services.Get(i).Methods()
-									if methods != nil {
-										builder.WriteString("<p>🔁Methods: </p><ul>")
-										for j := 0; j < methods.Len(); j++ {
-											if methods.Get(j) != nil {
-												builder.WriteString("<li>" + string(methods.Get(j).FullName().Name()) + "<br>")
-												inputFields := methods.Get(j).Input().Fields()
-												outputFields := methods.Get(j).Output().Fields()
-
-												if inputFields != nil {
-													builder.WriteString("<p>➡️Input:</p>")
-													builder.WriteString("<pre><code>{")
-													for n := 0; n < inputFields.Len(); n++ {
-														if inputFields.Get(n).Message() != nil {
-															messageFields := inputFields.Get(n).Message().Fields()
-															if messageFields != nil {
-																builder.WriteString("\n    \"" + inputFields.Get(n).JSONName() + "\": {")
-																for m := 0; m < messageFields.Len(); m++ {
-																	builder.WriteString("\n        \"" + messageFields.Get(m).JSONName() + "\": " + messageFields.Get(m).Kind().String())
-																}
-																builder.WriteString("\n    }")
-															}
-														} else {
-															builder.WriteString("\n    \"" + inputFields.Get(n).JSONName() + "\": " + inputFields.Get(n).Kind().String())
-														}
-													}
-													builder.WriteString("\n}</code></pre>")
-												}
-												if outputFields != nil {
-													builder.WriteString("<p>➡️Output:</p>")
-													builder.WriteString("<pre><code>{")
-													for n := 0; n < outputFields.Len(); n++ {
-														if outputFields.Get(n).Message() != nil {
-															messageFields := outputFields.Get(n).Message().Fields()
-															if messageFields != nil {
-																builder.WriteString("\n    \"" + outputFields.Get(n).JSONName() + "\": {")
-																for m := 0; m < messageFields.Len(); m++ {
-																	builder.WriteString("\n        \"" + messageFields.Get(m).JSONName() + "\": " + messageFields.Get(m).Kind().String())
-																}
-																builder.WriteString("\n    }")
-															}
-														} else {
-															builder.WriteString("\n    \"" + outputFields.Get(n).JSONName() + "\": " + outputFields.Get(n).Kind().String())
-														}
-													}
-													builder.WriteString("\n}</code></pre>")
-												}
-												builder.WriteString("</li>")
-											}
-										}
-										builder.WriteString("</ul>")
-									}
-								}
-							}
-						}
-					}
+	builder.WriteString(formatter.ListOpen())
+	if len(descriptors) > 0 {
+		prices, err := s.DB.GetServiceMethodPrices(context.Background(), snetID)
+		if err != nil {
+			s.log.Error().Err(err).Str("snet-id", snetID).Msg("Failed to get method prices")
+		}
+		builder.WriteString(s.renderServiceInfo(formatter, snetID, descriptors, catalog, duplicates, prices))
+	}
+	if len(compileErrs) > 0 {
+		builder.WriteString(formatter.CompileErrors(snetID, compileErrs))
+	}
+	builder.WriteString(formatter.ListClose())
+	return builder.String(), nil
+}
+
+// eachServiceInfo renders the list items of the services info and passes them to yield one service at a
+// time, it stops at the first error of yield and returns it
+func (s *SnetSyncer) eachServiceInfo(formatter DescriptorFormatter, yield func(item string) error) error {
+	// render from snapshots so the sync isn't blocked while the list is built
+	fileDescriptors := s.Descriptors()
+	compileErrors := s.CompileErrors()
+	catalog := s.catalogServices()
+	var duplicates map[string][]db.SnetService
+	merged := make(map[string]bool)
+	if s.MergeDuplicates {
+		duplicates = duplicateServices(catalog)
+		for _, others := range duplicates {
+			for _, other := range others {
+				merged[other.SnetID] = true
+			}
+		}
+	}
+	prices, err := s.DB.GetMethodPrices(context.Background())
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to get method prices")
+	}
+	// services are listed by snet id, their files, gRPC services and methods keep their stable order
+	for _, snetID := range sortedKeys(fileDescriptors) {
+		// services synced without descriptors render nothing, they'd only leave the list blank
+		if len(fileDescriptors[snetID]) == 0 || merged[snetID] || (s.InvokableOnly && !s.Invokable(snetID)) {
+			continue
+		}
+		if err := yield(s.renderServiceInfo(formatter, snetID, fileDescriptors[snetID], catalog, duplicates, prices[snetID])); err != nil {
+			return err
+		}
+	}
+	for _, snetID := range sortedKeys(compileErrors) {
+		if err := yield(formatter.CompileErrors(snetID, compileErrors[snetID])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// servicesInfoItems renders the list items of the services info, one string per service
+func (s *SnetSyncer) servicesInfoItems(formatter DescriptorFormatter) []string {
+	var items []string
+	_ = s.eachServiceInfo(formatter, func(item string) error {
+		items = append(items, item)
+		return nil
+	})
+	return items
+}
+
+// renderServiceInfo renders the files, gRPC services and methods of a service with their prices
+func (s *SnetSyncer) renderServiceInfo(formatter DescriptorFormatter, snetID string, descriptors []protoreflect.FileDescriptor, catalog map[string]db.SnetService, duplicates map[string][]db.SnetService, prices []db.SnetMethodPrice) string {
+	var builder strings.Builder
+	service, priced := catalog[snetID]
+	for i, descriptor := range descriptors {
+		builder.WriteString(formatter.File(snetID, descriptor))
+		if i == 0 && priced {
+			builder.WriteString(formatter.Service(ServiceView{
+				SnetID:      snetID,
+				Price:       service.Price,
+				Description: s.serviceDescription(service),
+				Duplicates:  duplicates[snetID],
+				Health:      s.EndpointHealth(snetID),
+			}))
+		}
+		services := descriptor.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			rendered := make([]string, 0, methods.Len())
+			for j := 0; j < methods.Len(); j++ {
+				method := MethodView{
+					Descriptor: methods.Get(j),
+					Streaming:  StreamingKind(methods.Get(j)),
+					Options:    methodOptions(methods.Get(j)),
 				}
+				if priced {
+					method.Price = methodPrice(service, prices, string(services.Get(i).FullName())+"/"+string(methods.Get(j).Name()))
+					method.CustomPrice = method.Price != service.Price
+				}
+				rendered = append(rendered, formatter.Method(method))
 			}
+			builder.WriteString(formatter.GRPCService(services.Get(i), rendered))
 		}
-		builder.WriteString("</ol></div>")
+	}
+	return builder.String()
+}
+
+// renderEnum renders an enum with its value names, the names are what the JSON mapping uses
+func renderEnum(enum protoreflect.EnumDescriptor, escape func(string) string) string {
+	values := enum.Values()
+	names := make([]string, 0, values.Len())
+	for i := 0; i < values.Len(); i++ {
+		names = append(names, string(values.Get(i).Name()))
+	}
+	return escape("enum " + string(enum.FullName()) + " {" + strings.Join(names, ", ") + "}")
+}
+
+// renderScalar renders a scalar kind, noting the 64-bit integers the JSON mapping encodes as strings
+func renderScalar(kind protoreflect.Kind) string {
+	switch kind {
+	case protoreflect.Int64Kind, protoreflect.Uint64Kind, protoreflect.Sint64Kind,
+		protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind:
+		return kind.String() + " (JSON string)"
+	}
+	return kind.String()
+}
 
+// sortedKeys returns the keys of m in ascending order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
+	return keys
+}
+
+// renderFields renders the fields of a message as a JSON-like object, descending into message fields
+// at any depth with four spaces of indentation per level. visiting holds the messages on the current
+// path, a message referencing itself is rendered as <recursive Name> instead of being expanded again.
+// The fields of a oneof are grouped under a comment at the place of its first field, fields with
+// explicit presence are marked optional and proto2 required fields required. escape is applied to the
+// names and types taken from the protos.
+func renderFields(message protoreflect.MessageDescriptor, depth int, visiting map[protoreflect.FullName]bool, escape func(string) string) string {
+	visiting[message.FullName()] = true
+	defer delete(visiting, message.FullName())
 
+	var builder strings.Builder
+	indent := strings.Repeat("    ", depth+1)
+	builder.WriteString("{")
+	fields := message.Fields()
+	for n := 0; n < fields.Len(); n++ {
+		field := fields.Get(n)
+		oneof := field.ContainingOneof()
+		if oneof == nil || oneof.IsSynthetic() {
+			builder.WriteString(renderField(field, indent, depth, visiting, escape))
+			continue
+		}
+		if oneof.Fields().Get(0) != field {
+			// rendered with the first field of the oneof
+			continue
+		}
+		builder.WriteString("\n" + indent + escape("// oneof "+string(oneof.Name())+": set at most one of"))
+		for i := 0; i < oneof.Fields().Len(); i++ {
+			builder.WriteString(renderField(oneof.Fields().Get(i), indent, depth, visiting, escape))
+		}
+	}
+	builder.WriteString("\n" + strings.Repeat("    ", depth) + "}")
 	return builder.String()
 }
+
+// renderField renders the line of a field in renderFields
+func renderField(field protoreflect.FieldDescriptor, indent string, depth int, visiting map[protoreflect.FullName]bool, escape func(string) string) string {
+	var builder strings.Builder
+	builder.WriteString("\n" + indent + "\"" + escape(field.JSONName()) + "\": ")
+	switch {
+	case field.IsMap():
+		builder.WriteString(escape("map<"+field.MapKey().Kind().String()+", ") +
+			renderFieldType(field.MapValue(), depth, visiting, escape) + escape(">"))
+	case field.IsList():
+		builder.WriteString("[]" + renderFieldType(field, depth, visiting, escape))
+	default:
+		builder.WriteString(renderFieldType(field, depth, visiting, escape))
+	}
+	switch {
+	case field.HasOptionalKeyword() && field.Syntax() == protoreflect.Proto3:
+		builder.WriteString(" (optional, may be null)")
+	case field.Cardinality() == protoreflect.Required:
+		builder.WriteString(" (required)")
+	}
+	return builder.String()
+}
+
+// renderFieldType renders the type of a single value of the field: its kind or the expanded message
+func renderFieldType(field protoreflect.FieldDescriptor, depth int, visiting map[protoreflect.FullName]bool, escape func(string) string) string {
+	switch {
+	case field.Enum() != nil:
+		return renderEnum(field.Enum(), escape)
+	case field.Message() == nil:
+		return renderScalar(field.Kind())
+	case visiting[field.Message().FullName()]:
+		return escape("<recursive " + string(field.Message().Name()) + ">")
+	default:
+		return renderFields(field.Message(), depth+1, visiting, escape)
+	}
+}
@@ -0,0 +1,857 @@
+package snet_syncer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	xhtml "golang.org/x/net/html"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"html"
+	"matrix-ai-framework/internal/snet_syncer/fakes"
+	"matrix-ai-framework/pkg/blockchain"
+	"matrix-ai-framework/pkg/db"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSyncWithFakes(t *testing.T) {
+	ctx := context.Background()
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1", "svc2")
+	s := n.syncer()
+
+	snapshot := syncOnce(t, s)
+	if len(snapshot.Orgs) != 1 || len(snapshot.Services) != 2 {
+		t.Fatalf("snapshot has %d orgs and %d services, want 1 and 2", len(snapshot.Orgs), len(snapshot.Services))
+	}
+	if got := n.storedServices(); !slices.Equal(got, []string{"svc1", "svc2"}) {
+		t.Fatalf("stored services %v, want [svc1 svc2]", got)
+	}
+	groups, err := n.db.GetOrgGroups(ctx, "org1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].GroupID != "Zw==" {
+		t.Fatalf("stored groups %+v, want the default group", groups)
+	}
+	for _, snetID := range []string{"svc1", "svc2"} {
+		service, err := n.db.GetSnetService(ctx, snetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if service.Price != 7 {
+			t.Errorf("%s costs %d cogs, want 7", snetID, service.Price)
+		}
+		descriptors := s.ServiceDescriptors(snetID)
+		if len(descriptors) != 1 || descriptors[0].Services().Get(0).Methods().Get(0).Name() != "Say" {
+			t.Errorf("%s has descriptors %v, want echo.proto with Echo.Say", snetID, descriptors)
+		}
+	}
+	stored, err := n.db.GetServiceDescriptors(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("%d services have stored descriptors, want 2", len(stored))
+	}
+}
+
+func TestSyncSkipsServiceWithUnreachableMetadata(t *testing.T) {
+	n := newTestNet(t)
+	n.addService("svc1", modelOf("svc1"), map[string]string{"echo.proto": fmt.Sprintf(echoProto, "svc1")})
+	n.addService("svc3", modelOf("svc3"), map[string]string{"echo.proto": fmt.Sprintf(echoProto, "svc3")})
+	// the metadata of svc2 is never added, fetching it fails like an unreachable gateway
+	n.registerOrg("org1", map[string]string{
+		"svc1": "ipfs://" + cidOf("svc1"),
+		"svc2": "ipfs://" + cidOf("svc2"),
+		"svc3": "ipfs://" + cidOf("svc3"),
+	})
+	s := n.syncer()
+
+	_, _, err := s.syncOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "svc2") {
+		t.Fatalf("sync error %v, want the failure of svc2", err)
+	}
+	if got := n.storedServices(); !slices.Equal(got, []string{"svc1", "svc3"}) {
+		t.Fatalf("stored services %v, want [svc1 svc3]", got)
+	}
+	if n.ipfs.Fetches(cidOf("svc3")) == 0 {
+		t.Fatal("svc3 wasn't fetched after svc2 failed")
+	}
+}
+
+const collectionsProto = `syntax = "proto3";
+package collections;
+
+message Foo { int32 count = 1; }
+message Bag {
+  repeated string tags = 1;
+  map<string, Foo> foos = 2;
+  map<int32, string> names = 3;
+}
+`
+
+func TestRenderFieldsRepeatedAndMap(t *testing.T) {
+	fd := compileFile(t, map[string]string{"bag.proto": collectionsProto}, "bag.proto")
+	got := RenderMessage(fd.Messages().ByName("Bag"), nil)
+	want := `{
+    "tags": []string
+    "foos": map<string, {
+        "count": int32
+    }>
+    "names": map<int32, string>
+}`
+	if got != want {
+		t.Fatalf("rendered\n%s\nwant\n%s", got, want)
+	}
+	if escaped := renderFields(fd.Messages().ByName("Bag"), 0, map[protoreflect.FullName]bool{}, html.EscapeString); !strings.Contains(escaped, `"names": map&lt;int32, string&gt;`) {
+		t.Fatalf("map type isn't escaped for HTML:\n%s", escaped)
+	}
+}
+
+func TestResyncKeepsDescriptorCount(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1", "svc2")
+	s := n.syncer()
+	// unchanged services would be skipped, descriptors are only replaced when everything is synced again
+	s.ForceFullSync = true
+
+	syncOnce(t, s)
+	first := len(s.ServiceDescriptors("svc1"))
+	syncOnce(t, s)
+	if got := len(s.ServiceDescriptors("svc1")); got != first || got != 1 {
+		t.Fatalf("svc1 has %d descriptors after the second sync, %d after the first, want 1", got, first)
+	}
+	if info := s.GetSnetServicesInfo(); strings.Count(info, "Snet ID: svc1") != 1 {
+		t.Fatalf("svc1 is listed %d times in the services info, want once", strings.Count(info, "Snet ID: svc1"))
+	}
+}
+
+func TestBytes32ToString(t *testing.T) {
+	var padded, interior, full [32]byte
+	copy(padded[:], "org1")
+	copy(interior[:], "a\x00b")
+	for i := range full {
+		full[i] = 'x'
+	}
+	for _, test := range []struct {
+		id   [32]byte
+		want string
+	}{
+		{id: padded, want: "org1"},
+		{id: interior, want: "a\x00b"},
+		{id: full, want: strings.Repeat("x", 32)},
+		{want: ""},
+	} {
+		if got := bytes32ToString(test.id); got != test.want {
+			t.Errorf("bytes32ToString(%q) = %q, want %q", test.id, got, test.want)
+		}
+	}
+}
+
+func TestCompileBundleImportFromSubdirectory(t *testing.T) {
+	// archived under a wrapping directory, imports are relative to it
+	bundle := protoBundle(map[string][]byte{
+		"./model/a.proto": []byte(`syntax = "proto3";
+package a;
+import "sub/b.proto";
+service A { rpc Get(b.B) returns (b.B); }
+`),
+		"./model/sub/b.proto": []byte(`syntax = "proto3";
+package b;
+message B { string text = 1; }
+`),
+	})
+	if _, ok := bundle["sub/b.proto"]; !ok {
+		t.Fatalf("bundle paths %v, want a.proto and sub/b.proto", sortedKeys(bundle))
+	}
+	descriptors, compileErrs := newTestNet(t).syncer().compileBundle("svc1", bundle)
+	if len(compileErrs) > 0 {
+		t.Fatalf("compile errors: %v", compileErrs)
+	}
+	var paths []string
+	for _, descriptor := range descriptors {
+		paths = append(paths, descriptor.Path())
+	}
+	if !slices.Equal(paths, []string{"a.proto", "sub/b.proto"}) {
+		t.Fatalf("compiled %v, want [a.proto sub/b.proto]", paths)
+	}
+	if input := descriptors[0].Services().Get(0).Methods().Get(0).Input(); input.ParentFile().Path() != "sub/b.proto" {
+		t.Fatalf("input of A.Get is declared in %s, want sub/b.proto", input.ParentFile().Path())
+	}
+}
+
+func TestUnchangedServiceSkipsModelFetch(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1")
+	s := n.syncer()
+
+	syncOnce(t, s)
+	if got := n.ipfs.Fetches(modelOf("svc1")); got != 1 {
+		t.Fatalf("model fetched %d times by the first sync, want 1", got)
+	}
+	syncOnce(t, s)
+	if got := n.ipfs.Fetches(modelOf("svc1")); got != 1 {
+		t.Fatalf("model fetched %d times after a sync of unchanged metadata, want 1", got)
+	}
+	if len(s.ServiceDescriptors("svc1")) != 1 {
+		t.Fatal("the skipped service lost its descriptors")
+	}
+
+	s.ForceFullSync = true
+	syncOnce(t, s)
+	if got := n.ipfs.Fetches(modelOf("svc1")); got != 2 {
+		t.Fatalf("model fetched %d times after a forced sync, want 2", got)
+	}
+}
+
+func TestServicesInfoIsDeterministic(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc3", "svc1", "svc5")
+	n.addOrg("org2", "svc4", "svc2")
+	s := n.syncer()
+	syncOnce(t, s)
+
+	first := s.GetSnetServicesInfo()
+	for i := 0; i < 10; i++ {
+		if again := s.GetSnetServicesInfo(); again != first {
+			t.Fatalf("services info changed between calls:\n%s\n%s", first, again)
+		}
+	}
+	last := -1
+	for _, snetID := range []string{"svc1", "svc2", "svc3", "svc4", "svc5"} {
+		at := strings.Index(first, "Snet ID: "+snetID)
+		if at < last {
+			t.Fatalf("%s is listed out of snet id order", snetID)
+		}
+		last = at
+	}
+}
+
+// wellFormed reports the first tag of fragment that isn't closed in order, void elements aside
+func wellFormed(fragment string) error {
+	var open []string
+	tokenizer := xhtml.NewTokenizer(strings.NewReader(fragment))
+	for {
+		switch tokenizer.Next() {
+		case xhtml.ErrorToken:
+			if len(open) > 0 {
+				return fmt.Errorf("unclosed <%s>", open[len(open)-1])
+			}
+			return nil
+		case xhtml.StartTagToken:
+			if name, _ := tokenizer.TagName(); string(name) != "br" {
+				open = append(open, string(name))
+			}
+		case xhtml.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if len(open) == 0 || open[len(open)-1] != string(name) {
+				return fmt.Errorf("unexpected </%s>, open: %v", name, open)
+			}
+			open = open[:len(open)-1]
+		}
+	}
+}
+
+func TestServicesInfoPagesAreWellFormed(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1", "svc2", "svc3", "svc4")
+	s := n.syncer()
+	syncOnce(t, s)
+
+	full := s.GetSnetServicesInfo()
+	pages := s.GetSnetServicesInfoPages(len(full) / 3)
+	if len(pages) < 3 {
+		t.Fatalf("got %d pages of at most %d bytes, want at least 3", len(pages), len(full)/3)
+	}
+	var listed int
+	for i, page := range pages {
+		if len(page) > len(full)/3 {
+			t.Errorf("page %d has %d bytes, more than the %d allowed", i, len(page), len(full)/3)
+		}
+		if err := wellFormed(page); err != nil {
+			t.Errorf("page %d isn't well-formed: %v\n%s", i, err, page)
+		}
+		listed += strings.Count(page, "Snet ID: ")
+	}
+	if listed != 4 {
+		t.Fatalf("pages list %d services, want 4", listed)
+	}
+	if err := wellFormed(full); err != nil {
+		t.Fatalf("services info isn't well-formed: %v", err)
+	}
+
+	single, err := s.GetServiceInfo("svc2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wellFormed(single); err != nil || strings.Count(single, "Snet ID: ") != 1 {
+		t.Fatalf("info of svc2 isn't a well-formed single service (%v):\n%s", err, single)
+	}
+	if _, err := s.GetServiceInfo("nope"); !errors.Is(err, ErrServiceNotFound) {
+		t.Fatalf("info of an unknown service fails with %v, want ErrServiceNotFound", err)
+	}
+}
+
+func TestRenderFieldsEnumAndInt64(t *testing.T) {
+	fd := compileFile(t, map[string]string{"order.proto": `syntax = "proto3";
+package shop;
+
+enum Size { SIZE_UNSET = 0; SMALL = 1; LARGE = 2; }
+message Order {
+  Size size = 1;
+  int64 id = 2;
+  uint64 total = 3;
+  int32 count = 4;
+  repeated Size extras = 5;
+}
+`}, "order.proto")
+	got := RenderMessage(fd.Messages().ByName("Order"), nil)
+	want := `{
+    "size": enum shop.Size {SIZE_UNSET, SMALL, LARGE}
+    "id": int64 (JSON string)
+    "total": uint64 (JSON string)
+    "count": int32
+    "extras": []enum shop.Size {SIZE_UNSET, SMALL, LARGE}
+}`
+	if got != want {
+		t.Fatalf("rendered\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSyncServiceWithoutModel(t *testing.T) {
+	n := newTestNet(t)
+	n.addService("svc1", "", nil)
+	n.registerOrg("org1", map[string]string{"svc1": "ipfs://" + cidOf("svc1")})
+	s := n.syncer()
+
+	syncOnce(t, s)
+	if got := n.storedServices(); !slices.Equal(got, []string{"svc1"}) {
+		t.Fatalf("stored services %v, want the service without a model", got)
+	}
+	if got := n.ipfs.Fetches(""); got != 0 {
+		t.Fatalf("empty model hash fetched %d times", got)
+	}
+	if descriptors := s.ServiceDescriptors("svc1"); len(descriptors) != 0 {
+		t.Fatalf("service without a model has descriptors %v", descriptors)
+	}
+}
+
+func TestSyncServicelessBundle(t *testing.T) {
+	for _, lazy := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lazy=%v", lazy), func(t *testing.T) {
+			n := newTestNet(t)
+			n.addService("svc1", modelOf("svc1"), map[string]string{
+				"types.proto": `syntax = "proto3"; package types; message Point { int32 x = 1; int32 y = 2; }`,
+			})
+			n.registerOrg("org1", map[string]string{"svc1": "ipfs://" + cidOf("svc1")})
+			s := n.syncer()
+			s.LazyCompile = lazy
+			var logs bytes.Buffer
+			s.log = zerolog.New(&logs)
+
+			syncOnce(t, s)
+			if _, err := s.GetServiceDescriptors("svc1"); !errors.Is(err, ErrDescriptorNotCompiled) && !errors.Is(err, ErrServiceNotFound) {
+				t.Fatalf("descriptors of the service-less bundle: got %v, want none", err)
+			}
+			if !strings.Contains(logs.String(), "Protos declare no gRPC service") || !strings.Contains(logs.String(), `"snet-id":"svc1"`) {
+				t.Fatalf("no warning tagged with the snet id:\n%s", logs.String())
+			}
+			// the service is stored for reference, but isn't callable nor listed
+			if got := n.storedServices(); !slices.Equal(got, []string{"svc1"}) {
+				t.Fatalf("stored services %v, want svc1", got)
+			}
+			if s.Invokable("svc1") || len(s.CompileErrors()) != 0 {
+				t.Fatalf("service-less bundle is invokable or has compile errors %v", s.CompileErrors())
+			}
+			if got := s.GetSnetServicesInfo(); got != (HTMLFormatter{}).Empty() {
+				t.Fatalf("services info lists the service-less bundle:\n%s", got)
+			}
+
+			// unchanged metadata skips the service rather than compiling the bundle again
+			if err := s.SyncNow(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got := n.ipfs.Fetches(modelOf("svc1")); got != 1 {
+				t.Fatalf("model fetched %d times over two passes, want once", got)
+			}
+			if got := s.SyncStatus().Unchanged; got != 1 {
+				t.Fatalf("%d services unchanged on the second pass, want 1", got)
+			}
+
+			// a new model declaring a service is compiled
+			n.addService("svc1", "QmModelCallable", map[string]string{"echo.proto": fmt.Sprintf(echoProto, "svc1")})
+			syncOnce(t, s)
+			if descriptors, err := s.GetServiceDescriptors("svc1"); err != nil || len(descriptors) != 1 {
+				t.Fatalf("descriptors of the new model: got %v, %v, want its file", descriptors, err)
+			}
+		})
+	}
+}
+
+func TestSyncInlineMetadata(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1")
+	// org2 and its service embed their metadata in the registry instead of a CID
+	org, err := json.Marshal(blockchain.OrganizationMetaData{OrgName: "Org org2", OrgID: "org2", Groups: []blockchain.Group{{
+		GroupName:      "default",
+		GroupID:        "Zw==",
+		PaymentDetails: blockchain.Payment{PaymentAddress: "0x0000000000000000000000000000000000000001"},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err := json.Marshal(serviceMeta("svc2", modelOf("svc2")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.addModel(modelOf("svc2"), map[string]string{"echo.proto": fmt.Sprintf(echoProto, "svc2")})
+	n.registry.AddOrg("org2", " "+string(org)+"\x00\x00", map[string]string{"svc2": string(service)})
+	s := n.syncer()
+
+	snapshot := syncOnce(t, s)
+	if len(snapshot.Orgs) != 2 {
+		t.Fatalf("synced %d orgs, want the one on IPFS and the inline one", len(snapshot.Orgs))
+	}
+	if got := n.storedServices(); !slices.Equal(got, []string{"svc1", "svc2"}) {
+		t.Fatalf("stored services %v, want [svc1 svc2]", got)
+	}
+	if len(s.ServiceDescriptors("svc2")) != 1 {
+		t.Fatal("service with inline metadata wasn't compiled")
+	}
+	if n.ipfs.Fetches(cidOf("org1")) != 1 || n.ipfs.Fetches(cidOf("svc1")) != 1 {
+		t.Fatal("org1 metadata wasn't fetched from IPFS")
+	}
+}
+
+func TestSyncSkipsServiceIDOfAnotherOrg(t *testing.T) {
+	n := newTestNet(t)
+	n.addService("shared", modelOf("shared"), map[string]string{"echo.proto": fmt.Sprintf(echoProto, "first")})
+	n.addService("other", modelOf("other"), map[string]string{"echo.proto": fmt.Sprintf(echoProto, "second")})
+	n.registerOrg("org1", map[string]string{"shared": "ipfs://" + cidOf("shared")})
+	// org2 publishes a different service under the same id
+	n.registerOrg("org2", map[string]string{"shared": "ipfs://" + cidOf("other")})
+	s := n.syncer()
+	// no org stores the id yet, org1 has the lowest org id
+	var logs bytes.Buffer
+	s.log = zerolog.New(&logs)
+
+	syncOnce(t, s)
+	if got := n.storedServices(); !slices.Equal(got, []string{"shared"}) {
+		t.Fatalf("stored services %v, want [shared]", got)
+	}
+	service, err := n.db.GetSnetService(context.Background(), "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.SnetOrgID != "org1" {
+		t.Fatalf("shared is stored for %s, want org1", service.SnetOrgID)
+	}
+	if descriptors := s.ServiceDescriptors("shared"); len(descriptors) != 1 || descriptors[0].Package() != "first" {
+		t.Fatalf("shared has descriptors %v, want those of org1", descriptors)
+	}
+	if n.ipfs.Fetches(cidOf("other")) != 0 {
+		t.Fatal("the service of org2 was fetched")
+	}
+	warning := logs.String()
+	if !strings.Contains(warning, "already synced for another org") || !strings.Contains(warning, `"org":"org2"`) ||
+		!strings.Contains(warning, `"other-org":"org1"`) {
+		t.Fatalf("no warning naming both orgs in the logs:\n%s", warning)
+	}
+}
+
+// sharedIDNet registers org1 and org2, in the given order, both publishing a service with the id shared
+func sharedIDNet(t *testing.T, order ...string) *testNet {
+	t.Helper()
+	n := newTestNet(t)
+	n.addService("shared", modelOf("shared"), map[string]string{"echo.proto": fmt.Sprintf(echoProto, "first")})
+	n.addService("other", modelOf("other"), map[string]string{"echo.proto": fmt.Sprintf(echoProto, "second")})
+	uris := map[string]string{"org1": "ipfs://" + cidOf("shared"), "org2": "ipfs://" + cidOf("other")}
+	for _, orgSnetID := range order {
+		n.registerOrg(orgSnetID, map[string]string{"shared": uris[orgSnetID]})
+	}
+	return n
+}
+
+// ownerOf returns the org shared is stored for and the package of its descriptors
+func ownerOf(t *testing.T, n *testNet, s *SnetSyncer) (string, string) {
+	t.Helper()
+	service, err := n.db.GetSnetService(context.Background(), "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptors := s.ServiceDescriptors("shared")
+	if len(descriptors) != 1 {
+		t.Fatalf("shared has descriptors %v, want one file", descriptors)
+	}
+	return service.SnetOrgID, string(descriptors[0].Package())
+}
+
+func TestSyncClaimsServiceIDWhateverTheOrder(t *testing.T) {
+	for _, order := range [][]string{{"org1", "org2"}, {"org2", "org1"}} {
+		for _, concurrency := range []int{1, 4} {
+			n := sharedIDNet(t, order...)
+			s := n.syncer()
+			s.Concurrency = concurrency
+			syncOnce(t, s)
+			if org, pkg := ownerOf(t, n, s); org != "org1" || pkg != "first" {
+				t.Fatalf("orgs %v synced %d at a time store shared for %s with package %s, want org1 and first", order, concurrency, org, pkg)
+			}
+		}
+	}
+}
+
+func TestSyncKeepsStoredOwnerOfServiceID(t *testing.T) {
+	n := sharedIDNet(t, "org2")
+	s := n.syncer()
+	syncOnce(t, s)
+
+	// org1 publishes the id too, its lower id doesn't take it from org2
+	n.registerOrg("org1", map[string]string{"shared": "ipfs://" + cidOf("shared")})
+	syncOnce(t, s)
+	if org, pkg := ownerOf(t, n, s); org != "org2" || pkg != "second" {
+		t.Fatalf("shared is stored for %s with package %s, want org2 that stored it first", org, pkg)
+	}
+	// a restarted syncer keeps it as well
+	restarted := n.syncer()
+	syncOnce(t, restarted)
+	if org, pkg := ownerOf(t, n, restarted); org != "org2" || pkg != "second" {
+		t.Fatalf("after a restart shared is stored for %s with package %s, want org2", org, pkg)
+	}
+
+	// org2 no longer publishes it, org1 gets it
+	n.registry.RemoveOrg("org2")
+	n.registerOrg("org2", map[string]string{})
+	syncOnce(t, s)
+	if org, pkg := ownerOf(t, n, s); org != "org1" || pkg != "first" {
+		t.Fatalf("shared is stored for %s with package %s, want org1 once org2 dropped it", org, pkg)
+	}
+	if got := s.Descriptors(); len(got) != 1 || len(got["shared"]) != 1 {
+		t.Fatalf("descriptors %v, want only those of shared for org1", got)
+	}
+}
+
+// gzipped compresses content, failing the test on an error
+func gzipped(t *testing.T, content []byte) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return compressed.Bytes()
+}
+
+func TestSyncGzippedMetadata(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1")
+	// republish everything gzipped under the same CIDs
+	for _, cid := range []string{cidOf("org1"), cidOf("svc1")} {
+		content, _, err := n.ipfs.GetIpfsFileForOrg(context.Background(), "org1", cid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.ipfs.Add(cid, gzipped(t, content))
+	}
+	archive, err := fakes.Archive(map[string]string{"echo.proto": fmt.Sprintf(echoProto, "svc1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.ipfs.Add(modelOf("svc1"), gzipped(t, archive))
+	s := n.syncer()
+
+	syncOnce(t, s)
+	service, err := n.db.GetSnetService(context.Background(), "svc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.DisplayName != "Service svc1" || service.Price != 7 {
+		t.Fatalf("stored service %+v, want the gzipped metadata", service)
+	}
+	if len(s.ServiceDescriptors("svc1")) != 1 {
+		t.Fatal("gzipped model wasn't compiled")
+	}
+}
+
+func TestGroupPaymentAddressesRoundTrip(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1")
+	publish := func(addresses ...string) {
+		org := blockchain.OrganizationMetaData{OrgName: "Org org1", OrgID: "org1"}
+		for i, address := range addresses {
+			org.Groups = append(org.Groups, blockchain.Group{
+				GroupName:      fmt.Sprintf("group%d", i),
+				GroupID:        fmt.Sprintf("Zw%d==", i),
+				PaymentDetails: blockchain.Payment{PaymentAddress: address},
+			})
+		}
+		if err := n.ipfs.AddJSON(cidOf("org1"), org); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stored := func() map[string]string {
+		groups, err := n.db.GetOrgGroups(context.Background(), "org1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addresses := make(map[string]string, len(groups))
+		for _, group := range groups {
+			addresses[group.GroupID] = group.PaymentAddress
+		}
+		return addresses
+	}
+	s := n.syncer()
+
+	publish("0x00000000000000000000000000000000000000a1", "0x00000000000000000000000000000000000000b2")
+	syncOnce(t, s)
+	if got := stored(); len(got) != 2 || got["Zw0=="] != "0x00000000000000000000000000000000000000a1" ||
+		got["Zw1=="] != "0x00000000000000000000000000000000000000b2" {
+		t.Fatalf("stored payment addresses %v, want those of both groups", got)
+	}
+
+	// a changed payment address is picked up by the next sync
+	publish("0x00000000000000000000000000000000000000c3", "0x00000000000000000000000000000000000000b2")
+	syncOnce(t, s)
+	if got := stored(); got["Zw0=="] != "0x00000000000000000000000000000000000000c3" {
+		t.Fatalf("stored payment addresses %v after the address of group0 changed", got)
+	}
+}
+
+func TestServicesInfoWithoutServices(t *testing.T) {
+	n := newTestNet(t)
+	s := n.syncer()
+	check := func(state string) {
+		t.Helper()
+		if got := s.GetSnetServicesInfo(); got != (HTMLFormatter{}).Empty() || wellFormed(got) != nil {
+			t.Fatalf("services info %s is %q, want the no services message", state, got)
+		}
+		if got := s.GetSnetServicesPlain(); got != (PlainTextFormatter{}).Empty() {
+			t.Fatalf("plain services info %s is %q, want the no services message", state, got)
+		}
+		if pages := s.GetSnetServicesInfoPages(100); pages != nil {
+			t.Fatalf("services info %s has pages %q, want none", state, pages)
+		}
+	}
+	check("before any sync")
+
+	// services synced without descriptors
+	s.FileDescriptors[descriptorKey("org1", "svc1")] = nil
+	s.FileDescriptors[descriptorKey("org1", "svc2")] = []protoreflect.FileDescriptor{}
+	s.descriptorOrgs["svc1"], s.descriptorOrgs["svc2"] = "org1", "org1"
+	check("of services without descriptors")
+}
+
+func TestServicesInfoPlainMatchesHTML(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1", "svc2")
+	s := n.syncer()
+	syncOnce(t, s)
+
+	formatted, plain := s.GetSnetServicesInfo(), s.GetSnetServicesPlain()
+	if err := wellFormed(formatted); err != nil {
+		t.Fatalf("HTML services info isn't well-formed: %v", err)
+	}
+	if strings.ContainsAny(plain, "<>") {
+		t.Fatalf("plain services info has tags:\n%s", plain)
+	}
+	// both list the same services and methods, in the same order
+	for _, text := range []string{"Snet ID: svc1", "Snet ID: svc2", "Service: Echo", "Say", "Price: 7 cogs per call", "Echoes svc1"} {
+		if strings.Count(formatted, text) != strings.Count(plain, text) || !strings.Contains(plain, text) {
+			t.Errorf("%q is listed %d times in the HTML and %d times in the plain text", text, strings.Count(formatted, text), strings.Count(plain, text))
+		}
+	}
+	if strings.Index(plain, "svc1") > strings.Index(plain, "svc2") {
+		t.Fatal("plain services info isn't in snet id order")
+	}
+}
+
+func TestResyncUpdatesOrgInPlace(t *testing.T) {
+	ctx := context.Background()
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1")
+	s := n.syncer()
+	syncOnce(t, s)
+
+	org := blockchain.OrganizationMetaData{OrgName: "Renamed", OrgID: "org1", Groups: []blockchain.Group{{GroupName: "default", GroupID: "Zw=="}}}
+	if err := n.ipfs.AddJSON(cidOf("org1"), org); err != nil {
+		t.Fatal(err)
+	}
+	syncOnce(t, s)
+	orgs, err := n.db.GetSnetOrgs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orgs) != 1 || orgs[0].Name != "Renamed" {
+		t.Fatalf("stored orgs %+v, want a single renamed org", orgs)
+	}
+	if got := n.storedServices(); !slices.Equal(got, []string{"svc1"}) {
+		t.Fatalf("stored services %v after the resync, want [svc1]", got)
+	}
+}
+
+func TestSyncSkipsOrgFailingToStore(t *testing.T) {
+	ctx := context.Background()
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1")
+	n.addOrg("org2", "svc2")
+	n.db.CreateOrgErr = func(org db.SnetOrganization) error {
+		if org.SnetID == "org1" {
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+	s := n.syncer()
+
+	_, _, err := s.syncOnce(ctx)
+	if err == nil || !strings.Contains(err.Error(), "org org1") {
+		t.Fatalf("sync error %v, want the failure of org1", err)
+	}
+	if _, err := n.db.GetOrgGroups(ctx, "org1"); !errors.As(err, new(*db.NotFoundError)) {
+		t.Fatalf("groups of org1: got %v, want the org not found", err)
+	}
+	if got := n.storedServices(); !slices.Equal(got, []string{"svc2"}) {
+		t.Fatalf("stored services %v, want only svc2", got)
+	}
+	if got := s.ServiceDescriptors("svc1"); len(got) != 0 {
+		t.Fatalf("svc1 of the unstored org has descriptors %v, want none", got)
+	}
+	groups, err := n.db.GetOrgGroups(ctx, "org2")
+	if err != nil || len(groups) != 1 {
+		t.Fatalf("groups of org2: got %+v, %v, want its group", groups, err)
+	}
+
+	// the next pass stores the org once its creation succeeds
+	n.db.CreateOrgErr = nil
+	syncOnce(t, s)
+	if got := n.storedServices(); !slices.Equal(got, []string{"svc1", "svc2"}) {
+		t.Fatalf("stored services %v after the failure cleared, want both", got)
+	}
+}
+
+const presenceProto = `syntax = "proto3";
+package presence;
+
+message Query {
+  string text = 1;
+  oneof source {
+    string url = 2;
+    bytes image = 3;
+  }
+  optional int32 limit = 4;
+  optional string lang = 5;
+}
+`
+
+func TestRenderFieldsOneofAndOptional(t *testing.T) {
+	fd := compileFile(t, map[string]string{"query.proto": presenceProto}, "query.proto")
+	got := RenderMessage(fd.Messages().ByName("Query"), nil)
+	want := `{
+    "text": string
+    // oneof source: set at most one of
+    "url": string
+    "image": bytes
+    "limit": int32 (optional, may be null)
+    "lang": string (optional, may be null)
+}`
+	if got != want {
+		t.Fatalf("rendered\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCompileBundleShippingWellKnownTypes(t *testing.T) {
+	// an outdated copy of timestamp.proto, compiling it would shadow the real Timestamp
+	copied := `syntax = "proto3";
+package google.protobuf;
+message Timestamp { int64 seconds = 1; }
+`
+	bundle := protoBundle(map[string][]byte{
+		"clock.proto": []byte(`syntax = "proto3";
+package clock;
+import "google/protobuf/timestamp.proto";
+import "google/protobuf/empty.proto";
+service Clock { rpc Now(google.protobuf.Empty) returns (google.protobuf.Timestamp); }
+`),
+		"google/protobuf/timestamp.proto":             []byte(copied),
+		"third_party/google/protobuf/empty.proto":     []byte(`syntax = "proto3"; package google.protobuf; message Empty {}`),
+		"third_party/google/protobuf/timestamp.proto": []byte(copied),
+	})
+	if got := sortedKeys(bundle); !slices.Equal(got, []string{"clock.proto"}) {
+		t.Fatalf("bundle paths %v, want the copies of the well-known types dropped", got)
+	}
+	descriptors, compileErrs := newTestNet(t).syncer().compileBundle("svc1", bundle)
+	if len(compileErrs) > 0 {
+		t.Fatalf("compile errors: %v", compileErrs)
+	}
+	output := descriptors[0].Services().Get(0).Methods().Get(0).Output()
+	if output.FullName() != "google.protobuf.Timestamp" || output.Fields().ByName("nanos") == nil {
+		t.Fatalf("Clock.Now returns %s with fields %v, want the standard Timestamp", output.FullName(), output.Fields())
+	}
+}
+
+func TestMetadataURI(t *testing.T) {
+	for _, test := range []struct {
+		raw  []byte
+		want string
+	}{
+		{raw: []byte("ipfs://Qmorg1"), want: "ipfs://Qmorg1"},
+		{raw: []byte("ipfs://Qmorg1\x00\x00\x00"), want: "ipfs://Qmorg1"},
+		{raw: append([]byte("ipfs://Qmorg1"), make([]byte, 32)...), want: "ipfs://Qmorg1"},
+		{raw: []byte("ipfs://Qm\x00org1\x00"), want: "ipfs://Qm\x00org1"},
+		{raw: []byte("\x00\x00"), want: ""},
+		{raw: nil, want: ""},
+	} {
+		if got := metadataURI(test.raw); got != test.want {
+			t.Errorf("metadataURI(%q) = %q, want %q", test.raw, got, test.want)
+		}
+	}
+}
+
+// recordingFetcher records the hashes fetched through it
+type recordingFetcher struct {
+	ContentFetcher
+	mu     *sync.Mutex
+	hashes *[]string
+}
+
+func (f recordingFetcher) GetIpfsFileForOrg(ctx context.Context, orgSnetID, hash string) ([]byte, string, error) {
+	f.mu.Lock()
+	*f.hashes = append(*f.hashes, hash)
+	f.mu.Unlock()
+	return f.ContentFetcher.GetIpfsFileForOrg(ctx, orgSnetID, hash)
+}
+
+func TestSyncNullPaddedMetadataURI(t *testing.T) {
+	n := newTestNet(t)
+	n.addService("svc1", modelOf("svc1"), map[string]string{"echo.proto": fmt.Sprintf(echoProto, "svc1")})
+	n.registerOrg("org1", map[string]string{"svc1": "ipfs://" + cidOf("svc1") + "\x00\x00\x00"})
+	// registered again with a zero-padded org URI, like a fixed-size field of the contract
+	org := blockchain.OrganizationMetaData{OrgName: "Org org2", OrgID: "org2", Groups: []blockchain.Group{{GroupName: "default", GroupID: "Zw=="}}}
+	if err := n.ipfs.AddJSON(cidOf("org2"), org); err != nil {
+		t.Fatal(err)
+	}
+	n.registry.AddOrg("org2", "ipfs://"+cidOf("org2")+strings.Repeat("\x00", 20), nil)
+	s := n.syncer()
+	var hashes []string
+	s.IPFSClient = recordingFetcher{ContentFetcher: n.ipfs, mu: &sync.Mutex{}, hashes: &hashes}
+
+	snapshot := syncOnce(t, s)
+	if len(snapshot.Orgs) != 2 || snapshot.Orgs["org2"] == "" {
+		t.Fatalf("snapshot orgs %v, want org2 fetched", snapshot.Orgs)
+	}
+	if got := n.storedServices(); !slices.Equal(got, []string{"svc1"}) {
+		t.Fatalf("stored services %v, want [svc1]", got)
+	}
+	slices.Sort(hashes)
+	if want := []string{modelOf("svc1"), cidOf("org1"), cidOf("org2"), cidOf("svc1")}; !slices.Equal(hashes, want) {
+		t.Fatalf("fetched %q, want the cleaned CIDs %q", hashes, want)
+	}
+}
@@ -0,0 +1,128 @@
+package snet_syncer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SyncStatus summarizes the sync runs for health checks, the counts are those of the last finished run
+type SyncStatus struct {
+	Running        bool
+	LastStartedAt  time.Time // of the running sync while Running
+	LastFinishedAt time.Time
+	// LastSuccessAt is when the last run that went through the whole registry finished. Such a run
+	// may still have failed for single orgs or services, those are counted in Failures.
+	LastSuccessAt time.Time
+	LastError     error
+	Orgs          int // orgs synced
+	Services      int // services synced, unchanged ones aside
+	Unchanged     int // services skipped because their metadata didn't change
+	Failures      int // failed orgs and services
+	RPCBreaker    BreakerState
+}
+
+// syncStatus is shared by all copies of the syncer, so it is held by pointer
+type syncStatus struct {
+	mu          sync.RWMutex
+	result      SyncResult
+	synced      bool
+	running     bool
+	started     time.Time
+	lastSuccess time.Time
+	counts      SyncStatus    // counts of the last finished run
+	run         runCounts     // counts of the running sync
+	initialDone chan struct{} // closed when the first run finished
+}
+
+// runCounts are updated concurrently by the syncs of single orgs and services
+type runCounts struct {
+	orgs      atomic.Int64
+	services  atomic.Int64
+	unchanged atomic.Int64
+}
+
+func (st *syncStatus) start(started time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.running = true
+	st.started = started
+	st.run.orgs.Store(0)
+	st.run.services.Store(0)
+	st.run.unchanged.Store(0)
+}
+
+func (st *syncStatus) finish(result SyncResult, complete bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.result = result
+	if !st.synced {
+		close(st.initialDone)
+	}
+	st.synced = true
+	st.running = false
+	if complete {
+		st.lastSuccess = result.FinishedAt
+	}
+	st.counts = SyncStatus{
+		Orgs:      int(st.run.orgs.Load()),
+		Services:  int(st.run.services.Load()),
+		Unchanged: int(st.run.unchanged.Load()),
+		Failures:  countErrors(result.Err),
+	}
+}
+
+// countErrors counts the failures joined into err
+func countErrors(err error) int {
+	if err == nil {
+		return 0
+	}
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		return len(joined.Unwrap())
+	}
+	return 1
+}
+
+// SyncStatus returns the status of the sync runs
+func (s *SnetSyncer) SyncStatus() SyncStatus {
+	s.lastSync.mu.RLock()
+	defer s.lastSync.mu.RUnlock()
+	status := s.lastSync.counts
+	status.Running = s.lastSync.running
+	status.LastStartedAt = s.lastSync.started
+	status.LastFinishedAt = s.lastSync.result.FinishedAt
+	status.LastSuccessAt = s.lastSync.lastSuccess
+	status.LastError = s.lastSync.result.Err
+	status.RPCBreaker = s.rpcBreaker.State()
+	return status
+}
+
+// InitialSyncDone returns a channel closed once the first sync run finished, successful or not
+func (s *SnetSyncer) InitialSyncDone() <-chan struct{} {
+	return s.lastSync.initialDone
+}
+
+// WaitForInitialSync blocks until the first sync run finished, e.g. to start serving what depends on the
+// synced data, and returns nil then. It returns ctx.Err() when the context ends first. The outcome of
+// the run is its LastSyncResult.
+func (s *SnetSyncer) WaitForInitialSync(ctx context.Context) error {
+	select {
+	case <-s.lastSync.initialDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Healthy reports whether a run went through the whole registry within the last two sync intervals
+func (s *SnetSyncer) Healthy() bool {
+	interval := s.SyncInterval
+	if interval <= 0 {
+		interval = defaultSyncInterval
+	}
+	lastSuccess := s.SyncStatus().LastSuccessAt
+	return !lastSuccess.IsZero() && time.Since(lastSuccess) <= 2*interval
+}
@@ -0,0 +1,61 @@
+package snet_syncer
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWaitForInitialSync(t *testing.T) {
+	n := newTestNet(t)
+	n.addOrg("org1", "svc1")
+	s := n.syncer()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.WaitForInitialSync(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waiting before any sync: got %v, want context.DeadlineExceeded", err)
+	}
+
+	go s.SyncNow(context.Background())
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.WaitForInitialSync(ctx); err != nil {
+		t.Fatalf("waiting for the first sync: %v", err)
+	}
+	// the synced data is there once the signal fired
+	if got := n.storedServices(); !slices.Equal(got, []string{"svc1"}) {
+		t.Fatalf("stored services %v when the first sync finished, want svc1", got)
+	}
+	if got := s.ServiceDescriptors("svc1"); len(got) != 1 {
+		t.Fatalf("svc1 has descriptors %v when the first sync finished, want its model", got)
+	}
+
+	// later passes leave the signal as it is
+	s.SyncNow(context.Background())
+	select {
+	case <-s.InitialSyncDone():
+	default:
+		t.Fatal("initial sync signal unset after the second pass")
+	}
+}
+
+func TestWaitForInitialSyncFailed(t *testing.T) {
+	n := newTestNet(t)
+	n.registry.Err = errors.New("registry down")
+	s := n.syncer()
+
+	if err := s.SyncNow(context.Background()); err == nil {
+		t.Fatal("sync of a failing registry succeeded")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.WaitForInitialSync(ctx); err != nil {
+		t.Fatalf("waiting for a failed first sync: %v", err)
+	}
+	if result, ok := s.LastSyncResult(); !ok || result.Err == nil {
+		t.Fatalf("last sync result %+v, want the failure", result)
+	}
+}
@@ -0,0 +1,38 @@
+package snet_syncer
+
+import "time"
+
+// Ticker delivers the ticks of a periodic loop, tests can drive it by sending on the channel
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// NewTickerFunc returns a Ticker firing every interval
+type NewTickerFunc func(interval time.Duration) Ticker
+
+// realTicker is the Ticker of a time.Ticker
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+// NewRealTicker is the default NewTickerFunc, backed by time.NewTicker
+func NewRealTicker(interval time.Duration) Ticker {
+	return realTicker{ticker: time.NewTicker(interval)}
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// newTicker starts a ticker with NewTicker, or a real one when it isn't set
+func (s *SnetSyncer) newTicker(interval time.Duration) Ticker {
+	if s.NewTicker == nil {
+		return NewRealTicker(interval)
+	}
+	return s.NewTicker(interval)
+}
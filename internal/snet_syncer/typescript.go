@@ -0,0 +1,180 @@
+package snet_syncer
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strconv"
+	"strings"
+)
+
+// wellKnownTypes maps well-known types to their TypeScript equivalent in the protobuf JSON mapping
+var wellKnownTypes = map[protoreflect.FullName]string{
+	"google.protobuf.Timestamp":   "string", // RFC 3339
+	"google.protobuf.Duration":    "string", // e.g. "1.5s"
+	"google.protobuf.FieldMask":   "string", // comma-separated paths
+	"google.protobuf.Empty":       "Record<string, never>",
+	"google.protobuf.Struct":      "{ [key: string]: unknown }",
+	"google.protobuf.Value":       "unknown",
+	"google.protobuf.ListValue":   "unknown[]",
+	"google.protobuf.NullValue":   "null",
+	"google.protobuf.Any":         "{ \"@type\": string; [key: string]: unknown }",
+	"google.protobuf.DoubleValue": "number | null",
+	"google.protobuf.FloatValue":  "number | null",
+	"google.protobuf.Int32Value":  "number | null",
+	"google.protobuf.UInt32Value": "number | null",
+	"google.protobuf.Int64Value":  "string | null",
+	"google.protobuf.UInt64Value": "string | null",
+	"google.protobuf.BoolValue":   "boolean | null",
+	"google.protobuf.StringValue": "string | null",
+	"google.protobuf.BytesValue":  "string | null",
+}
+
+// ExportTypeScript generates TypeScript interfaces for the inputs and outputs of the methods of a service,
+// following the protobuf JSON mapping (JSON field names, 64-bit integers and bytes as strings, enums as
+// unions of their names). The service is looked up by its name or fully-qualified name.
+func (s *SnetSyncer) ExportTypeScript(snetID, service string) (string, error) {
+	serviceDescriptor := s.findService(snetID, service)
+	if serviceDescriptor == nil {
+		return "", fmt.Errorf("service %s not found in the descriptors of %s", service, snetID)
+	}
+
+	e := tsExporter{declared: make(map[protoreflect.FullName]bool)}
+	var methods strings.Builder
+	methods.WriteString(fmt.Sprintf("export interface %sMethods {\n", tsName(serviceDescriptor)))
+	serviceMethods := serviceDescriptor.Methods()
+	for i := 0; i < serviceMethods.Len(); i++ {
+		method := serviceMethods.Get(i)
+		e.enqueue(method.Input())
+		e.enqueue(method.Output())
+		methods.WriteString(fmt.Sprintf("  %s: { input: %s; output: %s };\n",
+			method.Name(), e.messageType(method.Input()), e.messageType(method.Output())))
+	}
+	methods.WriteString("}\n")
+
+	for len(e.queue) > 0 {
+		descriptor := e.queue[0]
+		e.queue = e.queue[1:]
+		switch d := descriptor.(type) {
+		case protoreflect.MessageDescriptor:
+			e.writeMessage(d)
+		case protoreflect.EnumDescriptor:
+			e.writeEnum(d)
+		}
+	}
+	e.out.WriteString(methods.String())
+	return e.out.String(), nil
+}
+
+// findService looks up a gRPC service among the descriptors synced for the snet service
+func (s *SnetSyncer) findService(snetID, service string) protoreflect.ServiceDescriptor {
+	for _, descriptor := range s.ServiceDescriptors(snetID) {
+		services := descriptor.Services()
+		for i := 0; i < services.Len(); i++ {
+			if string(services.Get(i).Name()) == service || string(services.Get(i).FullName()) == service {
+				return services.Get(i)
+			}
+		}
+	}
+	return nil
+}
+
+type tsExporter struct {
+	out      strings.Builder
+	declared map[protoreflect.FullName]bool
+	queue    []protoreflect.Descriptor // messages and enums still to write
+}
+
+// enqueue schedules a message or enum declaration, well-known types and map entries are inlined instead
+func (e *tsExporter) enqueue(descriptor protoreflect.Descriptor) {
+	if _, ok := wellKnownTypes[descriptor.FullName()]; ok || e.declared[descriptor.FullName()] {
+		return
+	}
+	if message, ok := descriptor.(protoreflect.MessageDescriptor); ok && message.IsMapEntry() {
+		return
+	}
+	e.declared[descriptor.FullName()] = true
+	e.queue = append(e.queue, descriptor)
+}
+
+func (e *tsExporter) messageType(message protoreflect.MessageDescriptor) string {
+	if wkt, ok := wellKnownTypes[message.FullName()]; ok {
+		return wkt
+	}
+	e.enqueue(message)
+	return tsName(message)
+}
+
+func (e *tsExporter) writeMessage(message protoreflect.MessageDescriptor) {
+	e.out.WriteString(fmt.Sprintf("export interface %s {\n", tsName(message)))
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		e.out.WriteString(fmt.Sprintf("  %s?: %s;\n", tsPropertyName(field.JSONName()), e.fieldType(field)))
+	}
+	e.out.WriteString("}\n\n")
+}
+
+func (e *tsExporter) writeEnum(enum protoreflect.EnumDescriptor) {
+	values := enum.Values()
+	literals := make([]string, 0, values.Len())
+	for i := 0; i < values.Len(); i++ {
+		literals = append(literals, strconv.Quote(string(values.Get(i).Name())))
+	}
+	if len(literals) == 0 {
+		literals = append(literals, "never")
+	}
+	e.out.WriteString(fmt.Sprintf("export type %s = %s;\n\n", tsName(enum), strings.Join(literals, " | ")))
+}
+
+// fieldType returns the TypeScript type of a field, taking cardinality into account
+func (e *tsExporter) fieldType(field protoreflect.FieldDescriptor) string {
+	if field.IsMap() {
+		return fmt.Sprintf("{ [key: string]: %s }", e.singularType(field.MapValue()))
+	}
+	if field.IsList() {
+		elem := e.singularType(field)
+		if strings.ContainsAny(elem, " |") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	}
+	return e.singularType(field)
+}
+
+func (e *tsExporter) singularType(field protoreflect.FieldDescriptor) string {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return "boolean"
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return "string" // bytes are base64-encoded
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return "string" // 64-bit integers don't fit in a JS number
+	case protoreflect.EnumKind:
+		if wkt, ok := wellKnownTypes[field.Enum().FullName()]; ok {
+			return wkt
+		}
+		e.enqueue(field.Enum())
+		return tsName(field.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return e.messageType(field.Message())
+	default:
+		return "number"
+	}
+}
+
+// tsName is the name of a declaration without its package, nested types are joined with "_"
+func tsName(descriptor protoreflect.Descriptor) string {
+	name := strings.TrimPrefix(string(descriptor.FullName()), string(descriptor.ParentFile().Package())+".")
+	return strings.ReplaceAll(name, ".", "_")
+}
+
+// tsPropertyName quotes JSON names that are not valid identifiers
+func tsPropertyName(name string) string {
+	for i, r := range name {
+		if !(r == '_' || r == '$' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return strconv.Quote(name)
+		}
+	}
+	return name
+}
@@ -1,8 +1,10 @@
 package blockchain
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/rs/zerolog/log"
@@ -22,6 +24,8 @@ const (
 	FreeCallPrefixSignature = "__prefix_free_trial"
 	//Agreed constant value
 	AllowedUserPrefixSignature = "__authorized_user"
+	// ChannelStatePrefixSignature prefixes the requests to the payment channel state service of the daemon
+	ChannelStatePrefixSignature = "__get_channel_state"
 )
 
 const (
@@ -145,14 +149,30 @@ func (eth *Ethereum) InitMPE() (err error) {
 	return
 }
 
-func (eth Ethereum) GetOrgs() (orgsIDs [][32]byte, err error) {
-	orgsIDs, err = eth.Registry.ListOrganizations(nil)
+func (eth Ethereum) GetOrgs(ctx context.Context) (orgsIDs [][32]byte, err error) {
+	orgsIDs, err = eth.Registry.ListOrganizations(&bind.CallOpts{Context: ctx})
 	if err != nil {
 		log.Debug().Err(err).Msg("Failed to GetOrgs")
+		err = fmt.Errorf("list organizations: %w", err)
 	}
 	return
 }
 
+// GetOrgsPaged returns up to limit org ids starting at offset, and the number of orgs in the registry.
+// The registry contract has no paged getter, so the ids are still read in one call, paging bounds how
+// many orgs a sync works on at a time.
+func (eth Ethereum) GetOrgsPaged(ctx context.Context, offset, limit int) (orgIDs [][32]byte, total int, err error) {
+	all, err := eth.GetOrgs(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	total = len(all)
+	if offset >= total || limit <= 0 {
+		return nil, total, nil
+	}
+	return all[offset:min(offset+limit, total)], total, nil
+}
+
 type Org struct {
 	Found          bool
 	Id             [32]byte
@@ -162,10 +182,11 @@ type Org struct {
 	ServiceIds     [][32]byte
 }
 
-func (eth Ethereum) GetOrg(orgID [32]byte) (org Org, err error) {
-	org, err = eth.Registry.GetOrganizationById(nil, orgID)
+func (eth Ethereum) GetOrg(ctx context.Context, orgID [32]byte) (org Org, err error) {
+	org, err = eth.Registry.GetOrganizationById(&bind.CallOpts{Context: ctx}, orgID)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to GetOrg")
+		log.Error().Err(err).Hex("org-id", orgID[:]).Msg("Failed to GetOrg")
+		err = fmt.Errorf("get organization %x: %w", orgID, err)
 		return
 	}
 	return
@@ -177,10 +198,11 @@ type Service struct {
 	MetadataURI []byte
 }
 
-func (eth Ethereum) GetService(orgID, serviceID [32]byte) (service Service, err error) {
-	service, err = eth.Registry.GetServiceRegistrationById(nil, orgID, serviceID)
+func (eth Ethereum) GetService(ctx context.Context, orgID, serviceID [32]byte) (service Service, err error) {
+	service, err = eth.Registry.GetServiceRegistrationById(&bind.CallOpts{Context: ctx}, orgID, serviceID)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get service from blockchain")
+		log.Error().Err(err).Hex("org-id", orgID[:]).Hex("service-id", serviceID[:]).Msg("Failed to get service from blockchain")
+		err = fmt.Errorf("get service registration %x/%x: %w", orgID, serviceID, err)
 	}
 	return
 }
@@ -0,0 +1,95 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+)
+
+// ChannelState is the state of a payment channel of the MultiPartyEscrow contract
+type ChannelState struct {
+	// Found is unset when the sender has no channel to the group
+	Found     bool
+	ChannelID *big.Int
+	Nonce     *big.Int
+	// Value is the balance of the channel in cogs
+	Value *big.Int
+	// Expiration is the block number after which the recipient can't claim from the channel anymore
+	Expiration *big.Int
+	// Expired is set when the channel expired at the current block, the daemon refuses payments from it
+	Expired bool
+	// Block is the number of the block the state was read at
+	Block *big.Int
+	// Authorized is the amount in cogs already signed to the daemon on the current nonce, it isn't read from
+	// the contract and is only set by the payers of the calls
+	Authorized *big.Int
+}
+
+// Covers reports whether the channel is open and what it holds beyond the amount already authorized
+// covers price cogs
+func (c ChannelState) Covers(price *big.Int) bool {
+	if !c.Found || c.Expired || c.Value == nil {
+		return false
+	}
+	available := new(big.Int).Set(c.Value)
+	if c.Authorized != nil {
+		available.Sub(available, c.Authorized)
+	}
+	return available.Cmp(price) >= 0
+}
+
+// FindChannel returns the state of the channel signed by sender to the payment group, read from the
+// ChannelOpen events of the escrow contract. When the sender opened several, the newest one that hasn't
+// expired is returned, or the newest one when they all expired.
+func (eth Ethereum) FindChannel(ctx context.Context, sender, recipient common.Address, groupID [32]byte) (ChannelState, error) {
+	events, err := eth.MPE.FilterChannelOpen(&bind.FilterOpts{Context: ctx}, []common.Address{sender}, []common.Address{recipient}, [][32]byte{groupID})
+	if err != nil {
+		return ChannelState{}, fmt.Errorf("list payment channels: %w", err)
+	}
+	defer events.Close()
+	var channelIDs []*big.Int
+	for events.Next() {
+		channelIDs = append(channelIDs, events.Event.ChannelId)
+	}
+	if err := events.Error(); err != nil {
+		return ChannelState{}, fmt.Errorf("list payment channels: %w", err)
+	}
+	if len(channelIDs) == 0 {
+		return ChannelState{}, nil
+	}
+
+	header, err := eth.Client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return ChannelState{}, fmt.Errorf("get block number: %w", err)
+	}
+	var newest ChannelState
+	// events are in block order, the newest channels come last
+	for i := len(channelIDs) - 1; i >= 0; i-- {
+		channel, err := eth.MPE.Channels(&bind.CallOpts{Context: ctx}, channelIDs[i])
+		if err != nil {
+			return ChannelState{}, fmt.Errorf("get payment channel %s: %w", channelIDs[i], err)
+		}
+		// payments are signed with the sender key, a channel whose signer was changed can't be used
+		if channel.Signer != sender {
+			continue
+		}
+		state := ChannelState{
+			Found:      true,
+			ChannelID:  channelIDs[i],
+			Nonce:      channel.Nonce,
+			Value:      channel.Value,
+			Expiration: channel.Expiration,
+			Expired:    channel.Expiration == nil || channel.Expiration.Cmp(header.Number) <= 0,
+			Block:      header.Number,
+		}
+		if !state.Expired {
+			return state, nil
+		}
+		if !newest.Found {
+			newest = state
+		}
+	}
+	return newest, nil
+}
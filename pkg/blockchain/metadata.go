@@ -3,8 +3,13 @@
 package blockchain
 
 import (
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
 	"math/big"
+	"matrix-ai-framework/internal/grpc_manager"
 	"matrix-ai-framework/pkg/db"
+	"strings"
 )
 
 type OrganizationMetaData struct {
@@ -30,6 +35,48 @@ type OrganizationMetaData struct {
 	Owner string
 }
 
+// ErrInvalidMetadata is returned by Validate for metadata missing required fields
+var ErrInvalidMetadata = errors.New("invalid metadata")
+
+// Validate checks the fields required to store and list the org
+func (o OrganizationMetaData) Validate() error {
+	var problems []string
+	if strings.TrimSpace(o.OrgName) == "" {
+		problems = append(problems, "missing org_name")
+	}
+	if len(o.Groups) == 0 {
+		problems = append(problems, "no groups")
+	}
+	return invalid(problems)
+}
+
+// Validate checks the fields required to store and call the service. The first group is the one
+// calls are paid and sent through, so it needs an endpoint and a price.
+func (s ServiceMetadata) Validate() error {
+	var problems []string
+	if strings.TrimSpace(s.DisplayName) == "" {
+		problems = append(problems, "missing display_name")
+	}
+	if len(s.Groups) == 0 {
+		problems = append(problems, "no groups")
+	} else {
+		if _, ok := s.Groups[0].endpoint(); !ok {
+			problems = append(problems, "no valid endpoint in the first group")
+		}
+		if len(s.Groups[0].Pricing) == 0 {
+			problems = append(problems, "no pricing in the first group")
+		}
+	}
+	return invalid(problems)
+}
+
+func invalid(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidMetadata, strings.Join(problems, ", "))
+}
+
 func (o OrganizationMetaData) DB() (db.SnetOrganization, []db.SnetOrgGroup) {
 	org := db.SnetOrganization{
 		SnetID:           o.SnetID,
@@ -66,8 +113,8 @@ func (s ServiceMetadata) DB() db.SnetService {
 		ServiceType:           s.ServiceType,
 		ModelIpfsHash:         s.ModelIpfsHash,
 		MPEAddress:            s.MpeAddress,
-		URL:                   s.Groups[0].Endpoints[0],
-		Price:                 s.Groups[0].Pricing[0].PriceInCogs,
+		URL:                   s.url(),
+		Price:                 s.Groups[0].DefaultPrice(),
 		GroupID:               s.Groups[0].GroupID,
 		FreeCalls:             s.Groups[0].FreeCalls,
 		FreeCallSignerAddress: s.Groups[0].FreeCallSignerAddress,
@@ -76,6 +123,130 @@ func (s ServiceMetadata) DB() db.SnetService {
 	}
 }
 
+// ServiceGroup is a group the service is offered in, with its endpoints and prices
+type ServiceGroup struct {
+	FreeCalls             int       `json:"free_calls"`
+	FreeCallSignerAddress string    `json:"free_call_signer_address"`
+	DaemonAddresses       []string  `json:"daemon_addresses"`
+	Pricing               []Pricing `json:"pricing"`
+	Endpoints             []string  `json:"endpoints"`
+	GroupID               string    `json:"group_id"`
+	GroupName             string    `json:"group_name"`
+}
+
+// Price models of the service metadata
+const (
+	PriceModelFixed          = "fixed_price"
+	PriceModelFixedPerMethod = "fixed_price_per_method"
+)
+
+// Pricing is a pricing entry of a service group. A fixed_price entry sets the price of every call,
+// a fixed_price_per_method entry lists the prices of single methods in Details.
+type Pricing struct {
+	Default     bool            `json:"default"`
+	PriceModel  string          `json:"price_model"`
+	PriceInCogs int             `json:"price_in_cogs"`
+	PackageName string          `json:"package_name"`
+	Details     []PricingDetail `json:"details"`
+}
+
+// PricingDetail holds the method prices of a gRPC service
+type PricingDetail struct {
+	ServiceName   string `json:"service_name"`
+	MethodPricing []struct {
+		MethodName  string `json:"method_name"`
+		PriceInCogs int    `json:"price_in_cogs"`
+	} `json:"method_pricing"`
+}
+
+// DefaultPrice returns the price of calls to methods without a price of their own: the default
+// fixed_price entry, else the first fixed_price one, else the first entry's price
+func (g ServiceGroup) DefaultPrice() int {
+	for _, pricing := range g.Pricing {
+		if pricing.Default && pricing.PriceModel != PriceModelFixedPerMethod {
+			return pricing.PriceInCogs
+		}
+	}
+	for _, pricing := range g.Pricing {
+		if pricing.PriceModel == PriceModelFixed {
+			return pricing.PriceInCogs
+		}
+	}
+	if len(g.Pricing) > 0 {
+		return g.Pricing[0].PriceInCogs
+	}
+	return 0
+}
+
+// MethodPrices returns the method-level prices of every group of the service
+func (s ServiceMetadata) MethodPrices() []db.SnetMethodPrice {
+	var prices []db.SnetMethodPrice
+	for _, group := range s.Groups {
+		for _, pricing := range group.Pricing {
+			if pricing.PriceModel != PriceModelFixedPerMethod {
+				continue
+			}
+			for _, detail := range pricing.Details {
+				for _, method := range detail.MethodPricing {
+					prices = append(prices, db.SnetMethodPrice{
+						ServiceSnetID: s.SnetID,
+						GroupID:       group.GroupID,
+						ServiceName:   detail.ServiceName,
+						MethodName:    method.MethodName,
+						PriceInCogs:   method.PriceInCogs,
+					})
+				}
+			}
+		}
+	}
+	return prices
+}
+
+// Endpoints returns the endpoints of every group of the service in their canonical form, see
+// grpc_manager.ParseEndpoint. Invalid endpoints are skipped with a warning, and duplicates once normalized.
+func (s ServiceMetadata) Endpoints() []db.SnetServiceEndpoint {
+	var endpoints []db.SnetServiceEndpoint
+	seen := make(map[db.SnetServiceEndpoint]bool)
+	for _, group := range s.Groups {
+		for _, url := range group.Endpoints {
+			if strings.TrimSpace(url) == "" {
+				continue
+			}
+			parsed, err := grpc_manager.ParseEndpoint(url)
+			if err != nil {
+				log.Warn().Err(err).Str("snet-id", s.SnetID).Str("group", group.GroupID).Msg("Skipping invalid service endpoint")
+				continue
+			}
+			endpoint := db.SnetServiceEndpoint{ServiceSnetID: s.SnetID, GroupID: group.GroupID, URL: parsed.String()}
+			if seen[endpoint] {
+				continue
+			}
+			seen[endpoint] = true
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+// url returns the endpoint calls are sent to, the first valid one of the first group
+func (s ServiceMetadata) url() string {
+	if len(s.Groups) == 0 {
+		return ""
+	}
+	endpoint, _ := s.Groups[0].endpoint()
+	return endpoint
+}
+
+// endpoint returns the canonical form of the first valid endpoint of the group
+func (g ServiceGroup) endpoint() (string, bool) {
+	for _, url := range g.Endpoints {
+		if parsed, err := grpc_manager.ParseEndpoint(url); err == nil {
+			return parsed.String(), true
+		}
+	}
+	return "", false
+}
+
 type Group struct {
 	GroupName        string   `json:"group_name"`
 	GroupID          string   `json:"group_id"`
@@ -97,29 +268,17 @@ type PaymentChannelStorageClient struct {
 }
 
 type ServiceMetadata struct {
-	ID            int
-	SnetID        string
-	SnetOrgID     string
-	OrgID         int
-	Version       int    `json:"version"`
-	DisplayName   string `json:"display_name"`
-	Encoding      string `json:"encoding"`
-	ServiceType   string `json:"service_type"`
-	ModelIpfsHash string `json:"model_ipfs_hash"`
-	MpeAddress    string `json:"mpe_address"`
-	Groups        []struct {
-		FreeCalls             int      `json:"free_calls"`
-		FreeCallSignerAddress string   `json:"free_call_signer_address"`
-		DaemonAddresses       []string `json:"daemon_addresses"`
-		Pricing               []struct {
-			Default     bool   `json:"default"`
-			PriceModel  string `json:"price_model"`
-			PriceInCogs int    `json:"price_in_cogs"`
-		} `json:"pricing"`
-		Endpoints []string `json:"endpoints"`
-		GroupID   string   `json:"group_id"`
-		GroupName string   `json:"group_name"`
-	} `json:"groups"`
+	ID                 int
+	SnetID             string
+	SnetOrgID          string
+	OrgID              int
+	Version            int            `json:"version"`
+	DisplayName        string         `json:"display_name"`
+	Encoding           string         `json:"encoding"`
+	ServiceType        string         `json:"service_type"`
+	ModelIpfsHash      string         `json:"model_ipfs_hash"`
+	MpeAddress         string         `json:"mpe_address"`
+	Groups             []ServiceGroup `json:"groups"`
 	ServiceDescription struct {
 		URL              string `json:"url"`
 		ShortDescription string `json:"short_description"`
@@ -0,0 +1,34 @@
+package blockchain
+
+import (
+	"matrix-ai-framework/pkg/db"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestServiceEndpointsAreNormalized(t *testing.T) {
+	service := ServiceMetadata{SnetID: "svc1", Groups: []ServiceGroup{
+		{GroupID: "a", Endpoints: []string{"ftp://daemon.example.com", "https://Daemon.Example.com/", " ", "daemon.example.com:7000"}},
+		{GroupID: "b", Endpoints: []string{"https://daemon.example.com:443", "https://daemon.example.com/api"}},
+	}}
+	want := []db.SnetServiceEndpoint{
+		{ServiceSnetID: "svc1", GroupID: "a", URL: "https://daemon.example.com:443"},
+		{ServiceSnetID: "svc1", GroupID: "a", URL: "daemon.example.com:7000"},
+		{ServiceSnetID: "svc1", GroupID: "b", URL: "https://daemon.example.com:443"},
+	}
+	if got := service.Endpoints(); !slices.Equal(got, want) {
+		t.Fatalf("endpoints %+v, want %+v", got, want)
+	}
+	// calls go to the first valid endpoint of the first group
+	if got := service.DB().URL; got != "https://daemon.example.com:443" {
+		t.Fatalf("service URL %q, want the first valid endpoint", got)
+	}
+}
+
+func TestValidateRejectsInvalidEndpoints(t *testing.T) {
+	service := ServiceMetadata{Groups: []ServiceGroup{{Endpoints: []string{"daemon.example.com", "grpc://daemon.example.com:7000"}}}}
+	if err := service.Validate(); err == nil || !strings.Contains(err.Error(), "no valid endpoint in the first group") {
+		t.Fatalf("validation of metadata without a valid endpoint fails with %v", err)
+	}
+}
@@ -1,19 +1,54 @@
 package db
 
 import (
+	"context"
 	"math/big"
 	"time"
 )
 
 type Service interface {
-	GetSnetOrgs() ([]SnetOrganization, error)
-	GetSnetServices() ([]SnetService, error)
-	GetSnetService(snetID string) (s SnetService, err error)
-	CreateSnetService(service SnetService) (id int, err error)
-	CreateSnetOrg(organization SnetOrganization) (id int, err error)
-	CreateSnetOrgGroups(orgID int, groups []SnetOrgGroup) (err error)
-	GetSnetOrgGroup(groupID string) (SnetOrgGroup, error)
-	Health() map[string]string
+	Tx
+	// WithTx runs fn in a transaction, committed when fn returns nil and rolled back otherwise
+	WithTx(ctx context.Context, fn func(tx Tx) error) error
+	GetSnetOrgs(ctx context.Context) ([]SnetOrganization, error)
+	GetSnetServices(ctx context.Context) ([]SnetService, error)
+	GetSnetService(ctx context.Context, snetID string) (s SnetService, err error)
+	// ListSnetOrgs returns the synced orgs ordered by snet id
+	ListSnetOrgs(ctx context.Context) ([]SnetOrganization, error)
+	// ListSnetServices returns the synced services of an org ordered by snet id, all services when
+	// orgSnetID is empty
+	ListSnetServices(ctx context.Context, orgSnetID string) ([]SnetService, error)
+	// GetSnetServiceAggregate retrieves a service with its org, the groups of the org and its endpoints
+	// in one round trip, the error is a *NotFoundError when the service is unknown or deleted
+	GetSnetServiceAggregate(ctx context.Context, snetID string) (*ServiceAggregate, error)
+	GetSnetOrgGroup(ctx context.Context, groupID string) (SnetOrgGroup, error)
+	// GetOrgGroups returns the groups of an org, a NotFoundError when the org doesn't exist
+	GetOrgGroups(ctx context.Context, orgSnetID string) ([]SnetOrgGroup, error)
+	GetServiceEndpoints(ctx context.Context, snetID string) ([]string, error)
+	GetServiceMethodPrices(ctx context.Context, snetID string) ([]SnetMethodPrice, error)
+	GetMethodPrices(ctx context.Context) (map[string][]SnetMethodPrice, error)
+	SetSnetServiceMetadataHash(ctx context.Context, snetID, hash string) (err error)
+	GetSnetServiceMetadataHashes(ctx context.Context) (map[string]string, error)
+	SaveServiceDescriptors(ctx context.Context, snetID string, raw []byte) error
+	GetServiceDescriptors(ctx context.Context) (map[string][]byte, error)
+	DeleteSnetServicesNotIn(ctx context.Context, seen []string, hard bool) (deleted int64, err error)
+	DeleteSnetOrgsNotIn(ctx context.Context, seen []string, hard bool) (deleted int64, err error)
+	// GetSyncCheckpoint returns the progress of an interrupted sync, ok is false when the last one finished
+	GetSyncCheckpoint(ctx context.Context) (checkpoint SyncCheckpoint, ok bool, err error)
+	SaveSyncCheckpoint(ctx context.Context, checkpoint SyncCheckpoint) (err error)
+	ClearSyncCheckpoint(ctx context.Context) (err error)
+	CreateAuditEntry(ctx context.Context, entry AuditEntry) (id int, err error)
+	GetAuditEntries(ctx context.Context, limit int) ([]AuditEntry, error)
+	Health(ctx context.Context) map[string]string
+}
+
+// Tx holds the writes of a sync, they can run on their own or together in a transaction with Service.WithTx
+type Tx interface {
+	CreateSnetService(ctx context.Context, service SnetService) (id int, err error)
+	CreateSnetOrg(ctx context.Context, organization SnetOrganization) (id int, err error)
+	CreateSnetOrgGroups(ctx context.Context, orgID int, groups []SnetOrgGroup) (err error)
+	CreateSnetServiceEndpoints(ctx context.Context, snetID string, endpoints []SnetServiceEndpoint) (err error)
+	CreateSnetMethodPrices(ctx context.Context, snetID string, prices []SnetMethodPrice) (err error)
 }
 
 type SnetOrganization struct {
@@ -49,9 +84,10 @@ type SnetService struct {
 	FreeCallSignerAddress string     `db:"free_call_signer_address"`
 	ShortDescription      string     `db:"short_description"`
 	Description           string     `db:"description"`
-	CreatedAt             time.Time  `db:"created_at"` // not null
-	UpdatedAt             time.Time  `db:"updated_at"` // not null
-	DeletedAt             *time.Time `db:"deleted_at"` // can be null
+	CreatedAt             time.Time  `db:"created_at"`    // not null
+	UpdatedAt             time.Time  `db:"updated_at"`    // not null
+	DeletedAt             *time.Time `db:"deleted_at"`    // can be null
+	MetadataHash          string     `db:"metadata_hash"` // hash of the metadata of the last complete sync
 }
 
 type SnetOrgGroup struct {
@@ -65,3 +101,57 @@ type SnetOrgGroup struct {
 	UpdatedAt                  time.Time  `db:"updated_at"` // not null
 	DeletedAt                  *time.Time `db:"deleted_at"` // can be null
 }
+
+// SnetServiceEndpoint is a daemon endpoint of a service in one of its groups
+type SnetServiceEndpoint struct {
+	ID            int    `db:"id"`
+	ServiceSnetID string `db:"service_snet_id"`
+	GroupID       string `db:"group_id"`
+	URL           string `db:"url"`
+}
+
+// SnetMethodPrice is the price of a method of a service group priced per method, ServiceName is
+// the gRPC service name as given in the metadata
+type SnetMethodPrice struct {
+	ID            int    `db:"id"`
+	ServiceSnetID string `db:"service_snet_id"`
+	GroupID       string `db:"group_id"`
+	ServiceName   string `db:"service_name"`
+	MethodName    string `db:"method_name"`
+	PriceInCogs   int    `db:"price_in_cogs"`
+}
+
+// ServiceAggregate is a snet service together with its org, the groups of the org and the service endpoints
+type ServiceAggregate struct {
+	Service   SnetService
+	Org       SnetOrganization
+	Groups    []SnetOrgGroup
+	Endpoints []SnetServiceEndpoint
+}
+
+// Group returns the org group the service is paid through
+func (a *ServiceAggregate) Group() (SnetOrgGroup, bool) {
+	for _, group := range a.Groups {
+		if group.GroupID == a.Service.GroupID {
+			return group, true
+		}
+	}
+	return SnetOrgGroup{}, false
+}
+
+// SyncCheckpoint is the progress of a sync: the first OrgOffset of the OrgTotal orgs of the registry were synced
+type SyncCheckpoint struct {
+	OrgOffset int
+	OrgTotal  int
+	UpdatedAt time.Time
+}
+
+// AuditEntry records an admin action, params must be redacted before they are stored
+type AuditEntry struct {
+	ID        int               `db:"id"`
+	Actor     string            `db:"actor"` // matrix user id
+	Action    string            `db:"action"`
+	Params    map[string]string `db:"params"`
+	Result    string            `db:"result"`
+	CreatedAt time.Time         `db:"created_at"` // not null
+}
@@ -0,0 +1,23 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is wrapped by the errors returned for rows that don't exist or are deleted
+var ErrNotFound = errors.New("not found")
+
+// NotFoundError is returned when no row of the given kind has the given snet id
+type NotFoundError struct {
+	Kind   string // e.g. "service"
+	SnetID string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %s not found", e.Kind, e.SnetID)
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return ErrNotFound
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
 	"matrix-ai-framework/internal/config"
@@ -12,6 +13,21 @@ import (
 
 type postgres struct {
 	*pgxpool.Pool
+	writes
+}
+
+// querier runs queries on the pool or in a transaction
+type querier interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// writes implements the writes of a sync, see Tx. Writes that need several statements begin
+// their own transaction, a savepoint when q is already a transaction.
+type writes struct {
+	q querier
 }
 
 // New initializes a new postgres connection.
@@ -80,17 +96,64 @@ func New() Service {
 			updated_at          		TIMESTAMP NOT NULL DEFAULT current_timestamp,
 			deleted_at          		TIMESTAMP DEFAULT null
 		);
+
+	ALTER TABLE snet_services ADD COLUMN IF NOT EXISTS metadata_hash TEXT NOT NULL DEFAULT '';
+
+	CREATE TABLE IF NOT EXISTS snet_service_endpoints
+		(
+			id                  SERIAL PRIMARY KEY,
+			service_snet_id     TEXT NOT NULL,
+			group_id            TEXT NOT NULL DEFAULT '',
+			url                 TEXT NOT NULL,
+			UNIQUE (service_snet_id, group_id, url)
+		);
+
+	CREATE TABLE IF NOT EXISTS snet_service_method_prices
+		(
+			id                  SERIAL PRIMARY KEY,
+			service_snet_id     TEXT NOT NULL,
+			group_id            TEXT NOT NULL DEFAULT '',
+			service_name        TEXT NOT NULL DEFAULT '',
+			method_name         TEXT NOT NULL,
+			price_in_cogs       INTEGER NOT NULL DEFAULT 0,
+			UNIQUE (service_snet_id, group_id, service_name, method_name)
+		);
+
+	CREATE TABLE IF NOT EXISTS snet_service_descriptors
+		(
+			service_snet_id     TEXT PRIMARY KEY,
+			descriptor_set      BYTEA NOT NULL,
+			updated_at          TIMESTAMP NOT NULL DEFAULT current_timestamp
+		);
+
+	CREATE TABLE IF NOT EXISTS audit_log
+		(
+			id                  SERIAL PRIMARY KEY,
+			actor               TEXT NOT NULL,
+			action              TEXT NOT NULL,
+			params              JSONB NOT NULL DEFAULT '{}',
+			result              TEXT NOT NULL DEFAULT '',
+			created_at          TIMESTAMP NOT NULL DEFAULT current_timestamp
+		);
+
+	CREATE TABLE IF NOT EXISTS sync_checkpoints
+		(
+			name                TEXT PRIMARY KEY,
+			org_offset          INTEGER NOT NULL,
+			org_total           INTEGER NOT NULL,
+			updated_at          TIMESTAMP NOT NULL DEFAULT current_timestamp
+		);
 `)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create tables")
 		return nil
 	}
-	db := &postgres{pool}
+	db := &postgres{Pool: pool, writes: writes{q: pool}}
 	return db
 }
 
-func (p *postgres) Health() map[string]string {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (p *postgres) Health(ctx context.Context) map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	err := p.Ping(ctx)
@@ -103,16 +166,16 @@ func (p *postgres) Health() map[string]string {
 	}
 }
 
-// CreateSnetService creates snet service
-func (p *postgres) CreateSnetService(s SnetService) (id int, err error) {
-	row := p.Pool.QueryRow(context.Background(),
+// CreateSnetService creates snet service, or updates the existing row with the same snet id in place,
+// so re-syncs keep a single row per service and its id stays the same
+func (w writes) CreateSnetService(ctx context.Context, s SnetService) (id int, err error) {
+	row := w.q.QueryRow(ctx,
 		`
 			INSERT INTO snet_services
    			(snet_id, snet_org_id, org_id, version, displayname, encoding , service_type, model_ipfs_hash, mpe_address, url, price, group_id, free_calls, free_call_signer_address, short_description, description) 
 			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 			ON CONFLICT (snet_id)
 			DO UPDATE SET
-			    snet_id=EXCLUDED.snet_id,
 				snet_org_id=EXCLUDED.snet_org_id,
 				org_id=EXCLUDED.org_id,
 				version=EXCLUDED.version,
@@ -127,7 +190,9 @@ func (p *postgres) CreateSnetService(s SnetService) (id int, err error) {
 				free_calls=EXCLUDED.free_calls,
 				free_call_signer_address=EXCLUDED.free_call_signer_address,
 				short_description=EXCLUDED.short_description,
-				description=EXCLUDED.description
+				description=EXCLUDED.description,
+				updated_at=current_timestamp,
+				deleted_at=NULL
 			RETURNING id`,
 		s.SnetID, s.SnetOrgID, s.OrgID, s.Version, s.DisplayName, s.Encoding, s.ServiceType, s.ModelIpfsHash, s.MPEAddress, s.URL, s.Price, s.GroupID, s.FreeCalls, s.FreeCallSignerAddress, s.ShortDescription, s.Description)
 	err = row.Scan(&id)
@@ -137,23 +202,25 @@ func (p *postgres) CreateSnetService(s SnetService) (id int, err error) {
 	return
 }
 
-// CreateSnetOrg creates snet organization
-func (p *postgres) CreateSnetOrg(org SnetOrganization) (id int, err error) {
-	row := p.Pool.QueryRow(context.Background(),
+// CreateSnetOrg creates snet organization, or updates the existing row with the same snet id in place
+// and returns its id
+func (w writes) CreateSnetOrg(ctx context.Context, org SnetOrganization) (id int, err error) {
+	row := w.q.QueryRow(ctx,
 		`
 			INSERT INTO snet_organizations
     		(snet_id, name, type, short_description, description, url, owner, image)
 			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 			ON CONFLICT (snet_id)
 			DO UPDATE SET
-			    snet_id=EXCLUDED.snet_id,
 			    name=EXCLUDED.name,
 			    type=EXCLUDED.type,
 			    short_description=EXCLUDED.short_description,
 			    description=EXCLUDED.description,
 			    url=EXCLUDED.url,
 			    owner=EXCLUDED.owner,
-			    image=EXCLUDED.image
+			    image=EXCLUDED.image,
+			    updated_at=current_timestamp,
+			    deleted_at=NULL
 			RETURNING id`,
 		org.SnetID, org.Name, org.Type, org.ShortDescription, org.Description, org.URL, org.Owner, org.Image)
 	err = row.Scan(&id)
@@ -163,10 +230,10 @@ func (p *postgres) CreateSnetOrg(org SnetOrganization) (id int, err error) {
 	return
 }
 
-// CreateSnetOrgGroups creates snet organization group
-func (p *postgres) CreateSnetOrgGroups(orgID int, groups []SnetOrgGroup) (err error) {
-	ctx := context.Background()
-	tx, err := p.Pool.Begin(ctx)
+// CreateSnetOrgGroups creates snet organization groups, or updates the name and payment details of
+// existing ones so a changed payment address is picked up by the next sync
+func (w writes) CreateSnetOrgGroups(ctx context.Context, orgID int, groups []SnetOrgGroup) (err error) {
+	tx, err := w.q.Begin(ctx)
 	if err != nil {
 		log.Error().Err(err)
 		return
@@ -176,7 +243,14 @@ func (p *postgres) CreateSnetOrgGroups(orgID int, groups []SnetOrgGroup) (err er
 	stmt := `
 		INSERT INTO snet_org_groups (org_id, group_id, group_name, payment_address, payment_expiration_threshold)
 		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT (group_id) DO NOTHING
+		ON CONFLICT (group_id)
+		DO UPDATE SET
+			org_id=EXCLUDED.org_id,
+			group_name=EXCLUDED.group_name,
+			payment_address=EXCLUDED.payment_address,
+			payment_expiration_threshold=EXCLUDED.payment_expiration_threshold,
+			updated_at=current_timestamp,
+			deleted_at=NULL
 	`
 
 	for _, group := range groups {
@@ -195,10 +269,17 @@ func (p *postgres) CreateSnetOrgGroups(orgID int, groups []SnetOrgGroup) (err er
 	return
 }
 
+// WithTx runs fn in a transaction, it is committed when fn returns nil and rolled back otherwise
+func (p *postgres) WithTx(ctx context.Context, fn func(tx Tx) error) error {
+	return pgx.BeginFunc(ctx, p.Pool, func(tx pgx.Tx) error {
+		return fn(writes{q: tx})
+	})
+}
+
 // GetSnetOrgGroup retrieves a snet organization group
-func (p *postgres) GetSnetOrgGroup(groupID string) (g SnetOrgGroup, err error) {
+func (p *postgres) GetSnetOrgGroup(ctx context.Context, groupID string) (g SnetOrgGroup, err error) {
 
-	row := p.Pool.QueryRow(context.Background(), "SELECT * FROM snet_org_groups WHERE group_id=$1 AND deleted_at is NULL", groupID)
+	row := p.Pool.QueryRow(ctx, "SELECT * FROM snet_org_groups WHERE group_id=$1 AND deleted_at is NULL", groupID)
 	err = row.Scan(&g.ID, &g.OrgID, &g.GroupID, &g.GroupName, &g.PaymentAddress, &g.PaymentExpirationThreshold, &g.CreatedAt, &g.UpdatedAt, &g.DeletedAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -212,9 +293,283 @@ func (p *postgres) GetSnetOrgGroup(groupID string) (g SnetOrgGroup, err error) {
 	return
 }
 
+// CreateSnetServiceEndpoints stores the endpoints of a snet service, replacing the ones stored before
+func (w writes) CreateSnetServiceEndpoints(ctx context.Context, snetID string, endpoints []SnetServiceEndpoint) (err error) {
+	tx, err := w.q.Begin(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Can't begin transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM snet_service_endpoints WHERE service_snet_id=$1", snetID)
+	if err != nil {
+		log.Error().Err(err).Str("snet-id", snetID).Msg("Can't remove snet-service endpoints")
+		return
+	}
+
+	stmt := `
+		INSERT INTO snet_service_endpoints (service_snet_id, group_id, url)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (service_snet_id, group_id, url) DO NOTHING
+	`
+
+	for _, endpoint := range endpoints {
+		_, err = tx.Exec(ctx, stmt, snetID, endpoint.GroupID, endpoint.URL)
+		if err != nil {
+			log.Error().Err(err).Str("snet-id", snetID).Msg("Can't add snet-service endpoint")
+			return
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// CreateSnetMethodPrices stores the method prices of a snet service, replacing the ones stored before
+func (w writes) CreateSnetMethodPrices(ctx context.Context, snetID string, prices []SnetMethodPrice) (err error) {
+	tx, err := w.q.Begin(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Can't begin transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM snet_service_method_prices WHERE service_snet_id=$1", snetID)
+	if err != nil {
+		log.Error().Err(err).Str("snet-id", snetID).Msg("Can't remove snet-service method prices")
+		return
+	}
+
+	stmt := `
+		INSERT INTO snet_service_method_prices (service_snet_id, group_id, service_name, method_name, price_in_cogs)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (service_snet_id, group_id, service_name, method_name) DO UPDATE SET price_in_cogs=EXCLUDED.price_in_cogs
+	`
+
+	for _, price := range prices {
+		_, err = tx.Exec(ctx, stmt, snetID, price.GroupID, price.ServiceName, price.MethodName, price.PriceInCogs)
+		if err != nil {
+			log.Error().Err(err).Str("snet-id", snetID).Msg("Can't add snet-service method price")
+			return
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetServiceMethodPrices retrieves the method prices of a snet service
+func (p *postgres) GetServiceMethodPrices(ctx context.Context, snetID string) ([]SnetMethodPrice, error) {
+	rows, err := p.Pool.Query(ctx, "SELECT * FROM snet_service_method_prices WHERE service_snet_id=$1 ORDER BY id", snetID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to retrieve snet service method prices")
+		return nil, err
+	}
+	prices, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[SnetMethodPrice])
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to scan snet service method prices")
+	}
+	return prices, err
+}
+
+// GetMethodPrices retrieves the method prices of every snet service, key: service snet id
+func (p *postgres) GetMethodPrices(ctx context.Context) (map[string][]SnetMethodPrice, error) {
+	rows, err := p.Pool.Query(ctx, "SELECT * FROM snet_service_method_prices ORDER BY id")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to retrieve snet service method prices")
+		return nil, err
+	}
+	all, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[SnetMethodPrice])
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to scan snet service method prices")
+		return nil, err
+	}
+	prices := make(map[string][]SnetMethodPrice)
+	for _, price := range all {
+		prices[price.ServiceSnetID] = append(prices[price.ServiceSnetID], price)
+	}
+	return prices, nil
+}
+
+// GetServiceEndpoints retrieves the endpoint urls of a snet service, in the order of the metadata
+func (p *postgres) GetServiceEndpoints(ctx context.Context, snetID string) ([]string, error) {
+	rows, err := p.Pool.Query(ctx, "SELECT url FROM snet_service_endpoints WHERE service_snet_id=$1 ORDER BY id", snetID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to retrieve snet service endpoints")
+		return nil, err
+	}
+	urls, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to scan snet service endpoints")
+	}
+	return urls, err
+}
+
+// SetSnetServiceMetadataHash records the metadata hash of a completely synced snet service
+func (p *postgres) SetSnetServiceMetadataHash(ctx context.Context, snetID, hash string) (err error) {
+	_, err = p.Pool.Exec(ctx, "UPDATE snet_services SET metadata_hash=$2 WHERE snet_id=$1", snetID, hash)
+	if err != nil {
+		log.Error().Err(err).Str("snet-id", snetID).Msg("Can't set snet-service metadata hash")
+	}
+	return
+}
+
+// GetSnetServiceMetadataHashes retrieves the metadata hashes of the services not deleted, key: service snet id
+func (p *postgres) GetSnetServiceMetadataHashes(ctx context.Context) (map[string]string, error) {
+	rows, err := p.Pool.Query(ctx,
+		"SELECT snet_id, metadata_hash FROM snet_services WHERE deleted_at is NULL AND metadata_hash <> ''")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to retrieve snet service metadata hashes")
+		return nil, err
+	}
+	defer rows.Close()
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var snetID, hash string
+		if err = rows.Scan(&snetID, &hash); err != nil {
+			log.Error().Err(err).Msg("Failed to scan snet service metadata hashes")
+			return nil, err
+		}
+		hashes[snetID] = hash
+	}
+	return hashes, rows.Err()
+}
+
+// SaveServiceDescriptors stores the serialized FileDescriptorSet of a snet service, empty raw removes it
+func (p *postgres) SaveServiceDescriptors(ctx context.Context, snetID string, raw []byte) (err error) {
+	if len(raw) == 0 {
+		_, err = p.Pool.Exec(ctx, "DELETE FROM snet_service_descriptors WHERE service_snet_id=$1", snetID)
+	} else {
+		_, err = p.Pool.Exec(ctx,
+			`INSERT INTO snet_service_descriptors (service_snet_id, descriptor_set) VALUES ($1, $2)
+			ON CONFLICT (service_snet_id)
+			DO UPDATE SET descriptor_set=EXCLUDED.descriptor_set, updated_at=current_timestamp`,
+			snetID, raw)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("snet-id", snetID).Msg("Can't save snet-service descriptors")
+	}
+	return
+}
+
+// GetServiceDescriptors retrieves the stored FileDescriptorSets of the services not deleted, key: service snet id
+func (p *postgres) GetServiceDescriptors(ctx context.Context) (map[string][]byte, error) {
+	rows, err := p.Pool.Query(ctx,
+		`SELECT d.service_snet_id, d.descriptor_set FROM snet_service_descriptors d
+		JOIN snet_services s ON s.snet_id = d.service_snet_id WHERE s.deleted_at is NULL`)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to retrieve snet service descriptors")
+		return nil, err
+	}
+	defer rows.Close()
+	descriptors := make(map[string][]byte)
+	for rows.Next() {
+		var snetID string
+		var raw []byte
+		if err = rows.Scan(&snetID, &raw); err != nil {
+			log.Error().Err(err).Msg("Failed to scan snet service descriptors")
+			return nil, err
+		}
+		descriptors[snetID] = raw
+	}
+	return descriptors, rows.Err()
+}
+
+// DeleteSnetServicesNotIn removes the services whose snet id is not in seen. Services are soft-deleted
+// by setting deleted_at unless hard is set, a service seen again is restored by CreateSnetService.
+func (p *postgres) DeleteSnetServicesNotIn(ctx context.Context, seen []string, hard bool) (deleted int64, err error) {
+	if seen == nil {
+		seen = []string{}
+	}
+	if !hard {
+		tag, err := p.Pool.Exec(ctx,
+			"UPDATE snet_services SET deleted_at=current_timestamp WHERE deleted_at is NULL AND NOT (snet_id = ANY($1))", seen)
+		if err != nil {
+			log.Error().Err(err).Msg("Can't soft-delete snet-services")
+			return 0, err
+		}
+		return tag.RowsAffected(), nil
+	}
+
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Can't begin transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM snet_service_endpoints WHERE NOT (service_snet_id = ANY($1))", seen)
+	if err != nil {
+		log.Error().Err(err).Msg("Can't delete snet-service endpoints")
+		return
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM snet_service_method_prices WHERE NOT (service_snet_id = ANY($1))", seen)
+	if err != nil {
+		log.Error().Err(err).Msg("Can't delete snet-service method prices")
+		return
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM snet_service_descriptors WHERE NOT (service_snet_id = ANY($1))", seen)
+	if err != nil {
+		log.Error().Err(err).Msg("Can't delete snet-service descriptors")
+		return
+	}
+	tag, err := tx.Exec(ctx, "DELETE FROM snet_services WHERE NOT (snet_id = ANY($1))", seen)
+	if err != nil {
+		log.Error().Err(err).Msg("Can't delete snet-services")
+		return
+	}
+	return tag.RowsAffected(), tx.Commit(ctx)
+}
+
+// DeleteSnetOrgsNotIn removes the organizations whose snet id is not in seen. Organizations are
+// soft-deleted by setting deleted_at unless hard is set, then their groups and services go as well.
+func (p *postgres) DeleteSnetOrgsNotIn(ctx context.Context, seen []string, hard bool) (deleted int64, err error) {
+	if seen == nil {
+		seen = []string{}
+	}
+	if !hard {
+		tag, err := p.Pool.Exec(ctx,
+			"UPDATE snet_organizations SET deleted_at=current_timestamp WHERE deleted_at is NULL AND NOT (snet_id = ANY($1))", seen)
+		if err != nil {
+			log.Error().Err(err).Msg("Can't soft-delete snet-orgs")
+			return 0, err
+		}
+		return tag.RowsAffected(), nil
+	}
+
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Can't begin transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	stmts := []string{
+		`DELETE FROM snet_service_endpoints WHERE service_snet_id IN
+			(SELECT s.snet_id FROM snet_services s JOIN snet_organizations o ON s.org_id = o.id WHERE NOT (o.snet_id = ANY($1)))`,
+		`DELETE FROM snet_service_descriptors WHERE service_snet_id IN
+			(SELECT s.snet_id FROM snet_services s JOIN snet_organizations o ON s.org_id = o.id WHERE NOT (o.snet_id = ANY($1)))`,
+		`DELETE FROM snet_service_method_prices WHERE service_snet_id IN
+			(SELECT s.snet_id FROM snet_services s JOIN snet_organizations o ON s.org_id = o.id WHERE NOT (o.snet_id = ANY($1)))`,
+		"DELETE FROM snet_services WHERE org_id IN (SELECT id FROM snet_organizations WHERE NOT (snet_id = ANY($1)))",
+		"DELETE FROM snet_org_groups WHERE org_id IN (SELECT id FROM snet_organizations WHERE NOT (snet_id = ANY($1)))",
+	}
+	for _, stmt := range stmts {
+		if _, err = tx.Exec(ctx, stmt, seen); err != nil {
+			log.Error().Err(err).Msg("Can't delete rows of snet-orgs")
+			return
+		}
+	}
+	tag, err := tx.Exec(ctx, "DELETE FROM snet_organizations WHERE NOT (snet_id = ANY($1))", seen)
+	if err != nil {
+		log.Error().Err(err).Msg("Can't delete snet-orgs")
+		return
+	}
+	return tag.RowsAffected(), tx.Commit(ctx)
+}
+
 // GetSnetServices retrieves a list of services
-func (p *postgres) GetSnetServices() (services []SnetService, err error) {
-	rows, err := p.Pool.Query(context.Background(), "SELECT * FROM snet_services")
+func (p *postgres) GetSnetServices(ctx context.Context) (services []SnetService, err error) {
+	rows, err := p.Pool.Query(ctx, "SELECT * FROM snet_services WHERE deleted_at is NULL")
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to retrieve snet services")
 		return services, err
@@ -227,8 +582,8 @@ func (p *postgres) GetSnetServices() (services []SnetService, err error) {
 }
 
 // GetSnetOrgs retrieves a list of organizations
-func (p *postgres) GetSnetOrgs() ([]SnetOrganization, error) {
-	rows, err := p.Pool.Query(context.Background(), "SELECT * FROM snet_organizations WHERE deleted_at is NULL")
+func (p *postgres) GetSnetOrgs(ctx context.Context) ([]SnetOrganization, error) {
+	rows, err := p.Pool.Query(ctx, "SELECT * FROM snet_organizations WHERE deleted_at is NULL")
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to retrieve snet orgs")
 		return nil, nil
@@ -240,10 +595,40 @@ func (p *postgres) GetSnetOrgs() ([]SnetOrganization, error) {
 	return orgs, err
 }
 
+// ListSnetOrgs retrieves the organizations ordered by snet id
+func (p *postgres) ListSnetOrgs(ctx context.Context) ([]SnetOrganization, error) {
+	rows, err := p.Pool.Query(ctx, "SELECT * FROM snet_organizations WHERE deleted_at is NULL ORDER BY snet_id")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list snet orgs")
+		return nil, err
+	}
+	orgs, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[SnetOrganization])
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to scan snet orgs")
+	}
+	return orgs, err
+}
+
+// ListSnetServices retrieves the services of an organization, or of all of them when orgSnetID is
+// empty, ordered by snet id
+func (p *postgres) ListSnetServices(ctx context.Context, orgSnetID string) ([]SnetService, error) {
+	rows, err := p.Pool.Query(ctx,
+		"SELECT * FROM snet_services WHERE deleted_at is NULL AND ($1='' OR snet_org_id=$1) ORDER BY snet_id", orgSnetID)
+	if err != nil {
+		log.Error().Err(err).Str("org", orgSnetID).Msg("Failed to list snet services")
+		return nil, err
+	}
+	services, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[SnetService])
+	if err != nil {
+		log.Error().Err(err).Str("org", orgSnetID).Msg("Failed to scan snet services")
+	}
+	return services, err
+}
+
 // GetSnetService retrieves a snet service
-func (p *postgres) GetSnetService(snetID string) (s SnetService, err error) {
-	row := p.Pool.QueryRow(context.Background(), "SELECT * FROM snet_services WHERE snet_id=$1 AND deleted_at is NULL", snetID)
-	err = row.Scan(&s.ID, &s.SnetID, &s.SnetOrgID, &s.OrgID, &s.Version, &s.DisplayName, &s.Encoding, &s.ServiceType, &s.ModelIpfsHash, &s.MPEAddress, &s.URL, &s.Price, &s.GroupID, &s.FreeCalls, &s.FreeCallSignerAddress, &s.ShortDescription, &s.Description, &s.CreatedAt, &s.UpdatedAt, &s.DeletedAt)
+func (p *postgres) GetSnetService(ctx context.Context, snetID string) (s SnetService, err error) {
+	row := p.Pool.QueryRow(ctx, "SELECT * FROM snet_services WHERE snet_id=$1 AND deleted_at is NULL", snetID)
+	err = row.Scan(&s.ID, &s.SnetID, &s.SnetOrgID, &s.OrgID, &s.Version, &s.DisplayName, &s.Encoding, &s.ServiceType, &s.ModelIpfsHash, &s.MPEAddress, &s.URL, &s.Price, &s.GroupID, &s.FreeCalls, &s.FreeCallSignerAddress, &s.ShortDescription, &s.Description, &s.CreatedAt, &s.UpdatedAt, &s.DeletedAt, &s.MetadataHash)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Error().Err(err).Msg("No snet service found with given ID")
@@ -255,3 +640,144 @@ func (p *postgres) GetSnetService(snetID string) (s SnetService, err error) {
 	log.Debug().Msgf("Retrieved snet service: %v", s)
 	return
 }
+
+// GetOrgGroups retrieves the groups of a snet organization with their payment addresses
+func (p *postgres) GetOrgGroups(ctx context.Context, orgSnetID string) ([]SnetOrgGroup, error) {
+	batch := &pgx.Batch{}
+	batch.Queue("SELECT id FROM snet_organizations WHERE snet_id=$1 AND deleted_at is NULL", orgSnetID)
+	batch.Queue("SELECT g.* FROM snet_org_groups g JOIN snet_organizations o ON o.id=g.org_id WHERE o.snet_id=$1 AND g.deleted_at is NULL ORDER BY g.id", orgSnetID)
+	results := p.Pool.SendBatch(ctx, batch)
+	defer results.Close()
+
+	rows, _ := results.Query()
+	_, err := pgx.CollectExactlyOneRow(rows, pgx.RowTo[int])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &NotFoundError{Kind: "org", SnetID: orgSnetID}
+	}
+	if err != nil {
+		log.Error().Err(err).Str("org", orgSnetID).Msg("Failed to retrieve snet org")
+		return nil, err
+	}
+	rows, _ = results.Query()
+	groups, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[SnetOrgGroup])
+	if err != nil {
+		log.Error().Err(err).Str("org", orgSnetID).Msg("Failed to retrieve snet org groups")
+		return nil, err
+	}
+	return groups, nil
+}
+
+// GetSnetServiceAggregate retrieves a snet service with its org, org groups and endpoints, the queries
+// are sent as one batch
+func (p *postgres) GetSnetServiceAggregate(ctx context.Context, snetID string) (*ServiceAggregate, error) {
+	batch := &pgx.Batch{}
+	batch.Queue("SELECT * FROM snet_services WHERE snet_id=$1 AND deleted_at is NULL", snetID)
+	batch.Queue("SELECT o.* FROM snet_organizations o JOIN snet_services s ON s.org_id=o.id WHERE s.snet_id=$1", snetID)
+	batch.Queue("SELECT g.* FROM snet_org_groups g JOIN snet_services s ON s.org_id=g.org_id WHERE s.snet_id=$1 AND g.deleted_at is NULL ORDER BY g.id", snetID)
+	batch.Queue("SELECT * FROM snet_service_endpoints WHERE service_snet_id=$1 ORDER BY id", snetID)
+	results := p.Pool.SendBatch(ctx, batch)
+	defer results.Close()
+
+	var aggregate ServiceAggregate
+	var err error
+	rows, _ := results.Query()
+	aggregate.Service, err = pgx.CollectExactlyOneRow(rows, pgx.RowToStructByNameLax[SnetService])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &NotFoundError{Kind: "service", SnetID: snetID}
+	}
+	if err != nil {
+		log.Error().Err(err).Str("snet-id", snetID).Msg("Failed to retrieve snet service")
+		return nil, err
+	}
+	rows, _ = results.Query()
+	aggregate.Org, err = pgx.CollectExactlyOneRow(rows, pgx.RowToStructByNameLax[SnetOrganization])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &NotFoundError{Kind: "org", SnetID: aggregate.Service.SnetOrgID}
+	}
+	if err != nil {
+		log.Error().Err(err).Str("snet-id", snetID).Msg("Failed to retrieve snet service org")
+		return nil, err
+	}
+	rows, _ = results.Query()
+	aggregate.Groups, err = pgx.CollectRows(rows, pgx.RowToStructByNameLax[SnetOrgGroup])
+	if err != nil {
+		log.Error().Err(err).Str("snet-id", snetID).Msg("Failed to retrieve snet service org groups")
+		return nil, err
+	}
+	rows, _ = results.Query()
+	aggregate.Endpoints, err = pgx.CollectRows(rows, pgx.RowToStructByNameLax[SnetServiceEndpoint])
+	if err != nil {
+		log.Error().Err(err).Str("snet-id", snetID).Msg("Failed to retrieve snet service endpoints")
+		return nil, err
+	}
+	return &aggregate, nil
+}
+
+// syncCheckpointName is the row of the registry sync in sync_checkpoints
+const syncCheckpointName = "registry"
+
+// GetSyncCheckpoint retrieves the checkpoint of an interrupted sync, ok is false when there is none
+func (p *postgres) GetSyncCheckpoint(ctx context.Context) (checkpoint SyncCheckpoint, ok bool, err error) {
+	row := p.Pool.QueryRow(ctx, "SELECT org_offset, org_total, updated_at FROM sync_checkpoints WHERE name=$1", syncCheckpointName)
+	err = row.Scan(&checkpoint.OrgOffset, &checkpoint.OrgTotal, &checkpoint.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return checkpoint, false, nil
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to retrieve sync checkpoint")
+		return checkpoint, false, err
+	}
+	return checkpoint, true, nil
+}
+
+// SaveSyncCheckpoint stores the progress of the current sync, replacing the previous checkpoint
+func (p *postgres) SaveSyncCheckpoint(ctx context.Context, checkpoint SyncCheckpoint) (err error) {
+	_, err = p.Pool.Exec(ctx,
+		`INSERT INTO sync_checkpoints (name, org_offset, org_total) VALUES ($1, $2, $3)
+		ON CONFLICT (name)
+		DO UPDATE SET org_offset=EXCLUDED.org_offset, org_total=EXCLUDED.org_total, updated_at=current_timestamp`,
+		syncCheckpointName, checkpoint.OrgOffset, checkpoint.OrgTotal)
+	if err != nil {
+		log.Error().Err(err).Int("offset", checkpoint.OrgOffset).Msg("Can't save sync checkpoint")
+	}
+	return
+}
+
+// ClearSyncCheckpoint removes the checkpoint once a sync went through the whole registry
+func (p *postgres) ClearSyncCheckpoint(ctx context.Context) (err error) {
+	_, err = p.Pool.Exec(ctx, "DELETE FROM sync_checkpoints WHERE name=$1", syncCheckpointName)
+	if err != nil {
+		log.Error().Err(err).Msg("Can't clear sync checkpoint")
+	}
+	return
+}
+
+// CreateAuditEntry appends an entry to the audit log
+func (p *postgres) CreateAuditEntry(ctx context.Context, entry AuditEntry) (id int, err error) {
+	params := entry.Params
+	if params == nil {
+		params = map[string]string{}
+	}
+	row := p.Pool.QueryRow(ctx,
+		`INSERT INTO audit_log (actor, action, params, result) VALUES ($1, $2, $3, $4) RETURNING id`,
+		entry.Actor, entry.Action, params, entry.Result)
+	err = row.Scan(&id)
+	if err != nil {
+		log.Error().Err(err).Msg("Can't add audit entry")
+	}
+	return
+}
+
+// GetAuditEntries retrieves the latest audit log entries, newest first
+func (p *postgres) GetAuditEntries(ctx context.Context, limit int) ([]AuditEntry, error) {
+	rows, err := p.Pool.Query(ctx, "SELECT * FROM audit_log ORDER BY created_at DESC, id DESC LIMIT $1", limit)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to retrieve audit entries")
+		return nil, err
+	}
+	entries, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[AuditEntry])
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to scan audit entries")
+	}
+	return entries, err
+}
@@ -0,0 +1,118 @@
+//go:build integration
+
+package db
+
+import (
+	"context"
+	"matrix-ai-framework/internal/config"
+	"os"
+	"testing"
+)
+
+// testPostgres connects to the database of DB_URL, run with: go test -tags integration ./pkg/db
+func testPostgres(t *testing.T) Service {
+	t.Helper()
+	url := os.Getenv("DB_URL")
+	if url == "" {
+		t.Skip("DB_URL isn't set")
+	}
+	config.Postgres.URL = url
+	return New()
+}
+
+// cleanupOrg removes the rows of a test org when the test ends, the database may hold synced orgs
+func cleanupOrg(t *testing.T, p Service, orgSnetID string) {
+	t.Helper()
+	t.Cleanup(func() {
+		ctx := context.Background()
+		pool := p.(*postgres).Pool
+		_, _ = pool.Exec(ctx, "DELETE FROM snet_services WHERE snet_org_id=$1", orgSnetID)
+		_, _ = pool.Exec(ctx, "DELETE FROM snet_org_groups WHERE org_id IN (SELECT id FROM snet_organizations WHERE snet_id=$1)", orgSnetID)
+		_, _ = pool.Exec(ctx, "DELETE FROM snet_organizations WHERE snet_id=$1", orgSnetID)
+	})
+}
+
+func TestOrgGroupsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	p := testPostgres(t)
+	orgSnetID := "test-org-groups-round-trip"
+	cleanupOrg(t, p, orgSnetID)
+
+	orgID, err := p.CreateSnetOrg(ctx, SnetOrganization{SnetID: orgSnetID, Name: "Test org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := []SnetOrgGroup{
+		{GroupID: orgSnetID + "-a", GroupName: "a", PaymentAddress: "0x00000000000000000000000000000000000000a1"},
+		{GroupID: orgSnetID + "-b", GroupName: "b", PaymentAddress: "0x00000000000000000000000000000000000000b2"},
+	}
+	if err = p.CreateSnetOrgGroups(ctx, orgID, groups); err != nil {
+		t.Fatal(err)
+	}
+	groups[0].PaymentAddress = "0x00000000000000000000000000000000000000c3"
+	if err = p.CreateSnetOrgGroups(ctx, orgID, groups); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := p.GetOrgGroups(ctx, orgSnetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("stored %d groups, want 2", len(stored))
+	}
+	for i, group := range stored {
+		if group.GroupID != groups[i].GroupID || group.PaymentAddress != groups[i].PaymentAddress {
+			t.Errorf("stored group %s paying %s, want %s paying %s", group.GroupID, group.PaymentAddress, groups[i].GroupID, groups[i].PaymentAddress)
+		}
+	}
+}
+
+func TestUpsertOrgAndService(t *testing.T) {
+	ctx := context.Background()
+	p := testPostgres(t)
+	orgSnetID := "test-upsert-org"
+	cleanupOrg(t, p, orgSnetID)
+
+	orgID, err := p.CreateSnetOrg(ctx, SnetOrganization{SnetID: orgSnetID, Name: "Before"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := p.CreateSnetOrg(ctx, SnetOrganization{SnetID: orgSnetID, Name: "After"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != orgID {
+		t.Fatalf("upserted org got id %d, want the id %d of the existing row", again, orgID)
+	}
+	orgs, err := p.GetSnetOrgs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []SnetOrganization
+	for _, org := range orgs {
+		if org.SnetID == orgSnetID {
+			rows = append(rows, org)
+		}
+	}
+	if len(rows) != 1 || rows[0].Name != "After" || !rows[0].UpdatedAt.After(rows[0].CreatedAt) {
+		t.Fatalf("org rows %+v, want a single updated one", rows)
+	}
+
+	service := SnetService{SnetID: orgSnetID + "-service", SnetOrgID: orgSnetID, OrgID: orgID, DisplayName: "Before", Price: 1}
+	serviceID, err := p.CreateSnetService(ctx, service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.DisplayName, service.Price = "After", 2
+	if again, err = p.CreateSnetService(ctx, service); err != nil || again != serviceID {
+		t.Fatalf("upserted service got id %d (%v), want the id %d of the existing row", again, err, serviceID)
+	}
+	stored, err := p.GetSnetService(ctx, service.SnetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.DisplayName != "After" || stored.Price != 2 {
+		t.Fatalf("stored service %+v, want the upserted fields", stored)
+	}
+}
@@ -0,0 +1,114 @@
+package ipfsutils
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// BareProtoName is the file name given to a model published as a single proto file instead of an archive
+const BareProtoName = "model.proto"
+
+// sniffLen is how much of a model is read to detect its format, a tar header is 512 bytes
+const sniffLen = 512
+
+// zipHeadersSize is the room left for the headers and central directory of a zip archive over its
+// extracted size
+const zipHeadersSize = 1 << 20
+
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	emptyZipMagic = []byte("PK\x05\x06")
+)
+
+func isZip(head []byte) bool {
+	return bytes.HasPrefix(head, zipMagic) || bytes.HasPrefix(head, emptyZipMagic)
+}
+
+// isTar reports whether head starts with a POSIX or GNU tar header, both have "ustar" at offset 257
+func isTar(head []byte) bool {
+	return len(head) >= 262 && string(head[257:262]) == "ustar"
+}
+
+// looksLikeText reports whether head is the start of a text file: valid UTF-8 without NUL bytes,
+// which every archive header has
+func looksLikeText(head []byte) bool {
+	if len(head) == 0 || bytes.IndexByte(head, 0) >= 0 {
+		return false
+	}
+	// the sniffed bytes may end in the middle of a rune
+	for i := 0; i < utf8.UTFMax && len(head) > 0 && !utf8.Valid(head); i++ {
+		head = head[:len(head)-1]
+	}
+	return utf8.Valid(head)
+}
+
+// readZip extracts the files of a zip archive, directories are skipped
+func readZip(f io.Reader, limits ArchiveLimits) (map[string][]byte, error) {
+	// zip needs random access, so gzipped archives are read whole first, bounded by what they may extract
+	// to plus room for the headers
+	maxSize := limits.MaxBytes
+	if maxSize > 0 {
+		maxSize += zipHeadersSize
+	}
+	content, err := readAll(f, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("read zip archive: %w", err)
+	}
+	protofiles := make(map[string][]byte, len(zipReader.File))
+	var total int64
+	for _, file := range zipReader.File {
+		if strings.HasSuffix(file.Name, "/") {
+			continue
+		}
+		if limits.MaxFiles > 0 && len(protofiles) >= limits.MaxFiles {
+			return nil, fmt.Errorf("%w: archive has more than %d files", ErrLimitExceeded, limits.MaxFiles)
+		}
+		// the declared size is checked first, and the reader below stops at it in case it lies
+		total += int64(file.UncompressedSize64)
+		if limits.MaxBytes > 0 && (total > limits.MaxBytes || total < 0) {
+			return nil, fmt.Errorf("%w: archive extracts to more than %d bytes", ErrLimitExceeded, limits.MaxBytes)
+		}
+		data, err := readZipFile(file)
+		if err != nil {
+			return nil, err
+		}
+		protofiles[file.Name] = data
+	}
+	return protofiles, nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open %s in zip archive: %w", file.Name, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, int64(file.UncompressedSize64)))
+	if err != nil {
+		return nil, fmt.Errorf("read %s in zip archive: %w", file.Name, err)
+	}
+	return data, nil
+}
+
+// readAll reads f up to maxSize bytes, more fails with ErrLimitExceeded; 0 means no limit
+func readAll(f io.Reader, maxSize int64) ([]byte, error) {
+	if maxSize > 0 {
+		f = io.LimitReader(f, maxSize+1)
+	}
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("read model: %w", err)
+	}
+	if maxSize > 0 && int64(len(content)) > maxSize {
+		return nil, fmt.Errorf("%w: model is larger than %d bytes", ErrLimitExceeded, maxSize)
+	}
+	return content, nil
+}
@@ -0,0 +1,79 @@
+package ipfsutils
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"maps"
+	"testing"
+)
+
+// zipArchive archives files as a zip, failing the test on an error
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	for _, name := range []string{"a.proto", "sub/", "sub/b.proto"} {
+		if _, ok := files[name]; !ok {
+			continue
+		}
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archive.Bytes()
+}
+
+func TestReadFilesCompressedFormats(t *testing.T) {
+	files := map[string]string{"a.proto": `syntax = "proto3"; import "sub/b.proto";`, "sub/b.proto": `syntax = "proto3";`}
+	bare := "syntax = \"proto3\";\nservice Echo {}\n"
+	withDir := map[string]string{"a.proto": files["a.proto"], "sub/": "", "sub/b.proto": files["sub/b.proto"]}
+	for _, test := range []struct {
+		name  string
+		model []byte
+		want  map[string]string
+	}{
+		{name: "tar", model: tarArchive(t, files), want: files},
+		{name: "tar.gz", model: gzipped(t, tarArchive(t, files)), want: files},
+		{name: "zip", model: zipArchive(t, withDir), want: files},
+		{name: "zip.gz", model: gzipped(t, zipArchive(t, withDir)), want: files},
+		{name: "bare proto", model: []byte(bare), want: map[string]string{BareProtoName: bare}},
+		{name: "gzipped bare proto", model: gzipped(t, []byte(bare)), want: map[string]string{BareProtoName: bare}},
+	} {
+		got, err := ReadFilesCompressed(string(test.model), ArchiveLimits{})
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		gotFiles := make(map[string]string, len(got))
+		for name, content := range got {
+			gotFiles[name] = string(content)
+		}
+		if !maps.Equal(gotFiles, test.want) {
+			t.Errorf("%s: extracted %v, want %v", test.name, gotFiles, test.want)
+		}
+	}
+}
+
+func TestReadFilesCompressedZipLimits(t *testing.T) {
+	archive := string(zipArchive(t, map[string]string{"a.proto": "syntax = \"proto3\";", "sub/b.proto": "syntax = \"proto3\";"}))
+	if _, err := ReadFilesCompressed(archive, ArchiveLimits{MaxFiles: 1}); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("zip with too many files fails with %v, want ErrLimitExceeded", err)
+	}
+	if _, err := ReadFilesCompressed(archive, ArchiveLimits{MaxBytes: 20}); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("zip extracting to too many bytes fails with %v, want ErrLimitExceeded", err)
+	}
+}
+
+func TestReadFilesCompressedRejectsBinary(t *testing.T) {
+	if _, err := ReadFilesCompressed("\x00\x01\x02 not an archive", ArchiveLimits{}); err == nil {
+		t.Fatal("binary content that isn't an archive was accepted")
+	}
+}
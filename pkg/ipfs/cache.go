@@ -0,0 +1,112 @@
+package ipfsutils
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache is an LRU cache of IPFS content keyed by CID, bounded by the total size of the cached content.
+// IPFS content is immutable, so entries only expire when a TTL is set.
+type Cache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	ttl      time.Duration // 0: entries never expire
+	size     int64
+	order    *list.List // front: most recently used
+	entries  map[string]*list.Element
+	hits     atomic.Uint64
+	misses   atomic.Uint64
+}
+
+type cacheEntry struct {
+	key      string
+	content  []byte
+	cachedAt time.Time
+}
+
+// CacheStats are the counters of a Cache
+type CacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// NewCache creates a cache holding up to maxBytes of content, a non-positive maxBytes returns nil, which disables caching
+func NewCache(maxBytes int64, ttl time.Duration) *Cache {
+	if maxBytes <= 0 {
+		return nil
+	}
+	return &Cache{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// cacheKey normalizes a hash the way getIpfsFile does before parsing it
+func cacheKey(hash string) string {
+	if parsed, err := ParseContentURI(hash); err == nil {
+		return parsed
+	}
+	return hash
+}
+
+// Get returns the cached content of the CID, a nil cache always misses
+func (c *Cache) Get(hash string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[cacheKey(hash)]
+	if ok && c.ttl > 0 && time.Since(element.Value.(*cacheEntry).cachedAt) > c.ttl {
+		c.remove(element)
+		ok = false
+	}
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	c.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).content, true
+}
+
+// Add caches the content of the CID, evicting the least recently used entries to stay within the size.
+// Content larger than the whole cache is not cached.
+func (c *Cache) Add(hash string, content []byte) {
+	if c == nil || int64(len(content)) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := cacheKey(hash)
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, content: content, cachedAt: time.Now()})
+	c.size += int64(len(content))
+	for c.size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *Cache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.content))
+}
+
+// Stats returns the hit and miss counters and the current size of the cache
+func (c *Cache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: len(c.entries), Bytes: c.size}
+}
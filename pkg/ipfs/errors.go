@@ -0,0 +1,53 @@
+package ipfsutils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+)
+
+// GatewayError is returned when an IPFS gateway answers with an error or with an error page
+// instead of the requested content
+type GatewayError struct {
+	Hash    string
+	Message string // error reported by the gateway or the start of the page it returned
+}
+
+func (e *GatewayError) Error() string {
+	return fmt.Sprintf("ipfs gateway failed for CID %s: %s", e.Hash, e.Message)
+}
+
+// TimeoutError is returned when a fetch takes longer than the RequestTimeout of the client.
+// It matches context.DeadlineExceeded with errors.Is.
+type TimeoutError struct {
+	Hash    string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("ipfs fetch of %s timed out after %s", e.Hash, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// maxSnippet is how much of an unexpected response is kept in errors
+const maxSnippet = 200
+
+// Snippet returns the start of content for error messages
+func Snippet(content []byte) string {
+	if len(content) > maxSnippet {
+		return string(content[:maxSnippet]) + "..."
+	}
+	return string(content)
+}
+
+// LooksLikeHTML reports whether content is an HTML document, as returned by gateways for
+// rate limits and proxy errors
+func LooksLikeHTML(content []byte) bool {
+	start := bytes.ToLower(bytes.TrimSpace(content[:min(len(content), 512)]))
+	return bytes.HasPrefix(start, []byte("<!doctype html")) || bytes.HasPrefix(start, []byte("<html")) ||
+		bytes.HasPrefix(start, []byte("<head")) || bytes.HasPrefix(start, []byte("<body"))
+}
@@ -0,0 +1,43 @@
+package ipfsutils
+
+import (
+	"github.com/ipfs/kubo/client/rpc"
+	"sort"
+	"sync"
+)
+
+// gateways are the default IPFS gateways. Fetches try them in order, a gateway that keeps failing is
+// moved behind the others until it succeeds again.
+type gateways struct {
+	mu      sync.Mutex
+	entries []*gateway
+}
+
+type gateway struct {
+	url      string
+	api      *rpc.HttpApi
+	failures int // consecutive failed fetches
+}
+
+// ordered returns the gateways to try, fewest consecutive failures first and in the configured order otherwise
+func (g *gateways) ordered() []*gateway {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ordered := make([]*gateway, len(g.entries))
+	copy(ordered, g.entries)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].failures < ordered[j].failures
+	})
+	return ordered
+}
+
+// report records the outcome of a fetch through the gateway
+func (g *gateways) report(gw *gateway, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err != nil {
+		gw.failures++
+		return
+	}
+	gw.failures = 0
+}
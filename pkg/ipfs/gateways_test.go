@@ -0,0 +1,55 @@
+package ipfsutils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGatewayFailover(t *testing.T) {
+	var failing, working atomic.Int32
+	down := testGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		failing.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"Message": "gateway down", "Code": 0, "Type": "error"}`)
+	})
+	up := testGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		working.Add(1)
+		fmt.Fprint(w, "content")
+	})
+	client := IPFSClient{HttpApi: down, gateways: &gateways{entries: []*gateway{
+		{url: "down", api: down},
+		{url: "up", api: up},
+	}}}
+
+	content, _, err := client.GetIpfsFile(context.Background(), testCID)
+	if err != nil || string(content) != "content" {
+		t.Fatalf("fetched %q, %v, want the content of the working gateway", content, err)
+	}
+	if failing.Load() != 1 || working.Load() != 1 {
+		t.Fatalf("gateways got %d and %d requests, want 1 each", failing.Load(), working.Load())
+	}
+
+	// the failing gateway is now tried last, so the next fetch doesn't wait for it
+	if _, _, err = client.GetIpfsFile(context.Background(), testCID); err != nil {
+		t.Fatal(err)
+	}
+	if failing.Load() != 1 || working.Load() != 2 {
+		t.Fatalf("gateways got %d and %d requests, want the failing one deprioritized", failing.Load(), working.Load())
+	}
+}
+
+func TestGatewayFailoverAllFailing(t *testing.T) {
+	down := testGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"Message": "gateway down", "Code": 0, "Type": "error"}`)
+	})
+	client := IPFSClient{HttpApi: down, gateways: &gateways{entries: []*gateway{{url: "a", api: down}, {url: "b", api: down}}}}
+	if _, _, err := client.GetIpfsFile(context.Background(), testCID); err == nil {
+		t.Fatal("fetch through failing gateways succeeded")
+	}
+}
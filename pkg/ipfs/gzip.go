@@ -0,0 +1,41 @@
+package ipfsutils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// gzipMagic starts every gzip stream
+const gzipMagic = "\x1f\x8b"
+
+// IsGzip reports whether content starts with the gzip magic bytes
+func IsGzip(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(gzipMagic))
+}
+
+// Gunzip decompresses gzip content and returns any other content as is. The decompressed size is
+// capped at maxSize, larger content fails with ErrLimitExceeded; 0 means no limit.
+func Gunzip(content []byte, maxSize int64) ([]byte, error) {
+	if !IsGzip(content) {
+		return content, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("gunzip: %w", err)
+	}
+	defer reader.Close()
+	var limited io.Reader = reader
+	if maxSize > 0 {
+		limited = io.LimitReader(reader, maxSize+1)
+	}
+	decompressed, err := io.ReadAll(limited)
+	if err != nil {
+		return nil, fmt.Errorf("gunzip: %w", err)
+	}
+	if maxSize > 0 && int64(len(decompressed)) > maxSize {
+		return nil, fmt.Errorf("%w: decompresses to more than %d bytes", ErrLimitExceeded, maxSize)
+	}
+	return decompressed, nil
+}
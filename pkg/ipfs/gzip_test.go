@@ -0,0 +1,22 @@
+package ipfsutils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGunzip(t *testing.T) {
+	metadata := []byte(`{"display_name": "Service"}`)
+	if got, err := Gunzip(metadata, 0); err != nil || string(got) != string(metadata) {
+		t.Fatalf("Gunzip of plain content = %q, %v, want it as is", got, err)
+	}
+	if got, err := Gunzip(gzipped(t, metadata), 0); err != nil || string(got) != string(metadata) {
+		t.Fatalf("Gunzip = %q, %v, want %q", got, err, metadata)
+	}
+	if _, err := Gunzip(gzipped(t, metadata), int64(len(metadata)-1)); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Gunzip over the limit fails with %v, want ErrLimitExceeded", err)
+	}
+	if _, err := Gunzip([]byte(gzipMagic+"junk"), 0); err == nil {
+		t.Fatal("Gunzip of a corrupt stream succeeded")
+	}
+}
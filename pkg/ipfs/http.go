@@ -0,0 +1,159 @@
+package ipfsutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"matrix-ai-framework/internal/config"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// ErrForbiddenAddress is returned when a metadata URL points to a blocked host or IP range
+var ErrForbiddenAddress = errors.New("address is not allowed")
+
+// HTTPFetcher fetches metadata published on HTTP(S) URLs.
+// Metadata URIs come from untrusted on-chain data, so every request is bounded in time and size,
+// and connections to blocked IP ranges (private networks by default) are refused at dial time.
+type HTTPFetcher struct {
+	client         *http.Client
+	MaxSize        int64
+	AllowedSchemes []string
+	AllowedHosts   []string // empty means any host
+	AllowedNets    []*net.IPNet
+	BlockedNets    []*net.IPNet
+}
+
+// NewHTTPFetcher creates an HTTPFetcher from the metadata HTTP config
+func NewHTTPFetcher() *HTTPFetcher {
+	f := &HTTPFetcher{
+		MaxSize:        config.MetadataHTTP.MaxSize,
+		AllowedSchemes: config.MetadataHTTP.AllowedSchemes,
+		AllowedHosts:   config.MetadataHTTP.AllowedHosts,
+		AllowedNets:    parseCIDRs(config.MetadataHTTP.AllowedCIDRs),
+		BlockedNets:    parseCIDRs(config.MetadataHTTP.BlockedCIDRs),
+	}
+	dialer := &net.Dialer{
+		Timeout: config.MetadataHTTP.Timeout,
+		Control: f.checkDialAddress,
+	}
+	f.client = &http.Client{
+		Timeout: config.MetadataHTTP.Timeout,
+		Transport: &http.Transport{
+			Proxy:               nil, // a proxy would hide the real destination from the dial check
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: config.MetadataHTTP.Timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return f.checkURL(req.URL)
+		},
+	}
+	return f
+}
+
+// Get downloads the content of the URL
+func (f *HTTPFetcher) Get(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse metadata url: %w", err)
+	}
+	if err = f.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", u.Redacted(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: unexpected status %s", u.Redacted(), resp.Status)
+	}
+	if f.MaxSize > 0 && resp.ContentLength > f.MaxSize {
+		return nil, fmt.Errorf("fetch %s: response of %d bytes exceeds limit of %d bytes", u.Redacted(), resp.ContentLength, f.MaxSize)
+	}
+
+	body := io.Reader(resp.Body)
+	if f.MaxSize > 0 {
+		body = io.LimitReader(resp.Body, f.MaxSize+1)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", u.Redacted(), err)
+	}
+	if f.MaxSize > 0 && int64(len(content)) > f.MaxSize {
+		return nil, fmt.Errorf("fetch %s: response exceeds limit of %d bytes", u.Redacted(), f.MaxSize)
+	}
+	return content, nil
+}
+
+func (f *HTTPFetcher) checkURL(u *url.URL) error {
+	if !slices.Contains(f.AllowedSchemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("%w: scheme %q", ErrForbiddenAddress, u.Scheme)
+	}
+	if len(f.AllowedHosts) > 0 && !slices.Contains(f.AllowedHosts, strings.ToLower(u.Hostname())) {
+		return fmt.Errorf("%w: host %q", ErrForbiddenAddress, u.Hostname())
+	}
+	return nil
+}
+
+// checkDialAddress runs after DNS resolution, so names resolving to blocked IPs are refused as well
+func (f *HTTPFetcher) checkDialAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: unresolved address %q", ErrForbiddenAddress, host)
+	}
+	if containsIP(f.AllowedNets, ip) {
+		return nil
+	}
+	if containsIP(f.BlockedNets, ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+	}
+	return nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCIDRs(cidrs []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			log.Error().Err(err).Str("cidr", cidr).Msg("Invalid CIDR in metadata HTTP config")
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// IsHTTPURI reports whether a metadata URI must be fetched over HTTP(S) instead of IPFS
+func IsHTTPURI(uri string) bool {
+	lower := strings.ToLower(uri)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
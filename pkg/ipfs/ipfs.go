@@ -2,7 +2,10 @@ package ipfsutils
 
 import (
 	"archive/tar"
+	"bufio"
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/kubo/client/rpc"
@@ -17,27 +20,132 @@ import (
 
 type IPFSClient struct {
 	*rpc.HttpApi
+	gateways    *gateways               // the default gateway and its fallbacks, nil: only HttpApi is used
+	orgGateways map[string]*rpc.HttpApi // preferred gateways, key: org snet id
+	cache       *Cache                  // nil when caching is disabled
+	// MaxFileSize caps the size of fetched files, 0 means no limit
+	MaxFileSize int64
+	// RequestTimeout bounds each fetch from a gateway, a fetch taking longer fails with a TimeoutError.
+	// 0 means no timeout.
+	RequestTimeout time.Duration
+	fetchSlots     chan struct{} // bounds concurrent requests to the gateways, nil: no limit
 }
 
+// ArchiveLimits bound what ReadFilesCompressed extracts from a model archive, zero values mean no limit
+type ArchiveLimits struct {
+	MaxBytes int64 // total size of the extracted files
+	MaxFiles int
+}
+
+// ErrLimitExceeded is returned for files and archives larger than the configured limits
+var ErrLimitExceeded = errors.New("size limit exceeded")
+
 func Init() IPFSClient {
-	httpClient := http.Client{
-		//Timeout: time.Duration(config.GetInt(config.IpfsTimeout)) * time.Second,
-		Timeout: 5 * time.Second,
-	}
+	// fetches are bounded by RequestTimeout through their context
+	httpClient := http.Client{}
 	ifpsClient, err := rpc.NewURLApiWithClient(config.IPFS.IPFSProviderURL, &httpClient)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Connection failed to IPFS")
 	}
-	return IPFSClient{ifpsClient}
+	defaults := &gateways{entries: []*gateway{{url: config.IPFS.IPFSProviderURL, api: ifpsClient}}}
+	for _, fallbackURL := range config.IPFS.FallbackURLs {
+		fallback, err := rpc.NewURLApiWithClient(fallbackURL, &httpClient)
+		if err != nil {
+			log.Error().Err(err).Str("gateway", fallbackURL).Msg("Failed to init fallback IPFS gateway, skipping it")
+			continue
+		}
+		defaults.entries = append(defaults.entries, &gateway{url: fallbackURL, api: fallback})
+	}
+
+	orgGateways := make(map[string]*rpc.HttpApi, len(config.IPFS.OrgGateways))
+	for orgSnetID, gatewayURL := range config.IPFS.OrgGateways {
+		gateway, err := rpc.NewURLApiWithClient(gatewayURL, &httpClient)
+		if err != nil {
+			log.Error().Err(err).Str("org", orgSnetID).Str("gateway", gatewayURL).Msg("Failed to init org IPFS gateway, default will be used")
+			continue
+		}
+		orgGateways[orgSnetID] = gateway
+	}
+	return IPFSClient{
+		HttpApi:        ifpsClient,
+		gateways:       defaults,
+		orgGateways:    orgGateways,
+		cache:          NewCache(config.IPFS.CacheMaxBytes, config.IPFS.CacheTTL),
+		MaxFileSize:    config.IPFS.MaxFileSize,
+		RequestTimeout: config.IPFS.RequestTimeout,
+		fetchSlots:     newFetchSlots(config.IPFS.MaxConcurrentFetches),
+	}
+}
+
+// WithMaxConcurrentFetches returns a copy of the client making at most n requests to the gateways at
+// once, shared by all copies made from it. Cached files are served without waiting. n <= 0 means no limit.
+func (ipfsClient IPFSClient) WithMaxConcurrentFetches(n int) IPFSClient {
+	ipfsClient.fetchSlots = newFetchSlots(n)
+	return ipfsClient
+}
+
+func newFetchSlots(n int) chan struct{} {
+	if n <= 0 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+// WithCache returns a copy of the client serving fetched files from the cache, nil disables caching
+func (ipfsClient IPFSClient) WithCache(cache *Cache) IPFSClient {
+	ipfsClient.cache = cache
+	return ipfsClient
+}
+
+// CacheStats returns the counters of the content cache, all zero when caching is disabled
+func (ipfsClient IPFSClient) CacheStats() CacheStats {
+	return ipfsClient.cache.Stats()
 }
 
 // ReadFilesCompressed - read all files which have been compressed, there can be more than one file
 // We need to start reading the proto files associated with the service.
 // proto files are compressed and stored as modelipfsHash
-func ReadFilesCompressed(compressedFile string) (protofiles map[string][]byte, err error) {
-	f := strings.NewReader(compressedFile)
+// Gzipped content is decompressed while it is read, then the format is sniffed: tar and zip archives
+// are extracted, and a bare proto file is returned as the single file BareProtoName.
+// Extraction stops with ErrLimitExceeded when the archive holds more than the limits allow.
+// The files are keyed by name, callers needing a stable order sort the names.
+func ReadFilesCompressed(compressedFile string, limits ArchiveLimits) (protofiles map[string][]byte, err error) {
+	var f io.Reader = strings.NewReader(compressedFile)
+	if strings.HasPrefix(compressedFile, gzipMagic) {
+		gzipReader, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("gunzip archive: %w", err)
+		}
+		defer gzipReader.Close()
+		f = gzipReader
+	}
+	buffered := bufio.NewReaderSize(f, sniffLen)
+	head, err := buffered.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read archive: %w", err)
+	}
+	switch {
+	case isZip(head):
+		return readZip(buffered, limits)
+	case isTar(head):
+		return readTar(buffered, limits)
+	case looksLikeText(head):
+		proto, err := readAll(buffered, limits.MaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{BareProtoName: proto}, nil
+	default:
+		// tar archives of the old format have no magic
+		return readTar(buffered, limits)
+	}
+}
+
+// readTar extracts the regular files of a tar archive
+func readTar(f io.Reader, limits ArchiveLimits) (protofiles map[string][]byte, err error) {
 	tarReader := tar.NewReader(f)
 	protofiles = map[string][]byte{}
+	var total int64
 	for true {
 		header, err := tarReader.Next()
 		if err == io.EOF {
@@ -53,9 +161,17 @@ func ReadFilesCompressed(compressedFile string) (protofiles map[string][]byte, e
 			log.Debug().Any("dir_name", name).Msg("Directory Name")
 		case tar.TypeReg:
 			//log.Debug().Any("file Name", name).Msg("file Name")
+			if limits.MaxFiles > 0 && len(protofiles) >= limits.MaxFiles {
+				return nil, fmt.Errorf("%w: archive has more than %d files", ErrLimitExceeded, limits.MaxFiles)
+			}
+			// check the declared size before allocating for it
+			total += header.Size
+			if limits.MaxBytes > 0 && total > limits.MaxBytes {
+				return nil, fmt.Errorf("%w: archive extracts to more than %d bytes", ErrLimitExceeded, limits.MaxBytes)
+			}
 			data := make([]byte, header.Size)
-			_, err := tarReader.Read(data)
-			if err != nil && err != io.EOF {
+			_, err := io.ReadFull(tarReader, data)
+			if err != nil {
 				log.Error().Err(err)
 				return nil, err
 			}
@@ -82,9 +198,120 @@ func RemoveSpecialCharacters(hash string) string {
 	return reg.ReplaceAllString(hash, "")
 }
 
-func (ipfsClient IPFSClient) GetIpfsFile(hash string) (content []byte, err error) {
-	hash = strings.TrimPrefix(hash, "ipfs://")
-	hash = RemoveSpecialCharacters(hash)
+// GetIpfsFileForOrg fetches a file through the gateway configured for the org
+// in IPFS_ORG_GATEWAYS and falls back to the default gateways on failure.
+func (ipfsClient IPFSClient) GetIpfsFileForOrg(ctx context.Context, orgSnetID, hash string) (content []byte, cID string, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	if cID, err = normalizeCID(hash); err != nil {
+		return nil, "", err
+	}
+	if content, ok := ipfsClient.cache.Get(cID); ok {
+		return content, cID, nil
+	}
+	gateway, ok := ipfsClient.orgGateways[orgSnetID]
+	if ok {
+		content, err = ipfsClient.fetch(ctx, gateway, cID)
+		if err == nil {
+			ipfsClient.cache.Add(cID, content)
+			return content, cID, nil
+		}
+		log.Warn().Err(err).Str("org", orgSnetID).Str("hash", cID).Msg("Org IPFS gateway failed, falling back to default")
+	}
+	content, err = ipfsClient.fetchDefault(ctx, cID)
+	if err == nil {
+		ipfsClient.cache.Add(cID, content)
+	}
+	return content, cID, err
+}
+
+// GetIpfsFile fetches a file through the default gateways. Both getters return ctx.Err() right away
+// when the context is done, cached files included, and return the normalized CID that was fetched:
+// the scheme and special characters are stripped, so "ipfs://Qm..." and "/ipfs/Qm..." share a cache
+// entry. URIs with a path after the CID fail with ErrContentPath, see ParseContentURI.
+func (ipfsClient IPFSClient) GetIpfsFile(ctx context.Context, hash string) (content []byte, cID string, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	if cID, err = normalizeCID(hash); err != nil {
+		return nil, "", err
+	}
+	if content, ok := ipfsClient.cache.Get(cID); ok {
+		return content, cID, nil
+	}
+	content, err = ipfsClient.fetchDefault(ctx, cID)
+	if err == nil {
+		ipfsClient.cache.Add(cID, content)
+	}
+	return content, cID, err
+}
+
+// normalizeCID returns the canonical string form of the CID of a content URI
+func normalizeCID(hash string) (string, error) {
+	hash, err := ParseContentURI(hash)
+	if err != nil {
+		return "", err
+	}
+	cID, err := cid.Parse(hash)
+	if err != nil {
+		return "", fmt.Errorf("parse cid %q: %w", hash, err)
+	}
+	return cID.String(), nil
+}
+
+// fetchDefault fetches a file through the default gateways, trying the next one until a gateway succeeds
+func (ipfsClient IPFSClient) fetchDefault(ctx context.Context, hash string) ([]byte, error) {
+	if ipfsClient.gateways == nil {
+		return ipfsClient.fetch(ctx, ipfsClient.HttpApi, hash)
+	}
+	var errs []error
+	for _, gw := range ipfsClient.gateways.ordered() {
+		content, err := ipfsClient.fetch(ctx, gw.api, hash)
+		if err == nil {
+			ipfsClient.gateways.report(gw, nil)
+			return content, nil
+		}
+		// oversized content or a canceled sync fail the same way on every gateway
+		if errors.Is(err, ErrLimitExceeded) || ctx.Err() != nil {
+			return nil, err
+		}
+		ipfsClient.gateways.report(gw, err)
+		log.Warn().Err(err).Str("gateway", gw.url).Str("hash", hash).Msg("IPFS gateway failed, trying the next one")
+		errs = append(errs, fmt.Errorf("gateway %s: %w", gw.url, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// fetch gets a file through api, giving up after RequestTimeout. It waits for a free fetch slot first,
+// and gives up with ctx.Err() when the context ends while waiting.
+func (ipfsClient IPFSClient) fetch(ctx context.Context, api *rpc.HttpApi, hash string) ([]byte, error) {
+	if ipfsClient.fetchSlots != nil {
+		select {
+		case ipfsClient.fetchSlots <- struct{}{}:
+			defer func() { <-ipfsClient.fetchSlots }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if ipfsClient.RequestTimeout <= 0 {
+		return getIpfsFile(ctx, api, hash, ipfsClient.MaxFileSize)
+	}
+	requestCtx, cancel := context.WithTimeout(ctx, ipfsClient.RequestTimeout)
+	defer cancel()
+	content, err := getIpfsFile(requestCtx, api, hash, ipfsClient.MaxFileSize)
+	// only the request deadline is reported as a timeout, not the caller's context ending
+	if err != nil && ctx.Err() == nil && errors.Is(requestCtx.Err(), context.DeadlineExceeded) {
+		return nil, &TimeoutError{Hash: hash, Timeout: ipfsClient.RequestTimeout}
+	}
+	return content, err
+}
+
+func getIpfsFile(ctx context.Context, api *rpc.HttpApi, hash string, maxSize int64) (content []byte, err error) {
+	hash, err = ParseContentURI(hash)
+	if err != nil {
+		return
+	}
 
 	cID, err := cid.Parse(hash)
 	if err != nil {
@@ -92,31 +319,41 @@ func (ipfsClient IPFSClient) GetIpfsFile(hash string) (content []byte, err error
 		return
 	}
 
-	req := ipfsClient.Request("cat", cID.String())
-	resp, err := req.Send(context.Background())
-	defer func(resp *rpc.Response) {
-		err := resp.Close()
-		if err != nil {
-			log.Error().Err(err)
-		}
-	}(resp)
+	req := api.Request("cat", cID.String())
+	resp, err := req.Send(ctx)
 	if err != nil {
 		log.Error().Err(err)
 		return
 	}
 	if resp == nil {
 		log.Error().Msg("resp is nil!")
-		return
+		return nil, fmt.Errorf("empty response for %s", cID)
 	}
+	defer func(resp *rpc.Response) {
+		err := resp.Close()
+		if err != nil {
+			log.Error().Err(err)
+		}
+	}(resp)
 	if resp.Error != nil {
 		log.Err(resp.Error)
-		return
+		return nil, &GatewayError{Hash: cID.String(), Message: resp.Error.Error()}
 	}
-	fileContent, err := io.ReadAll(resp.Output)
+	output := io.Reader(resp.Output)
+	if maxSize > 0 {
+		output = io.LimitReader(resp.Output, maxSize+1)
+	}
+	fileContent, err := io.ReadAll(output)
 	if err != nil {
 		log.Error().Err(err)
 		return
 	}
+	if maxSize > 0 && int64(len(fileContent)) > maxSize {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrLimitExceeded, cID, maxSize)
+	}
+	if LooksLikeHTML(fileContent) {
+		return nil, &GatewayError{Hash: cID.String(), Message: "returned an HTML page: " + Snippet(fileContent)}
+	}
 
 	// Create a cid manually to check cid
 	_, c, err := cid.CidFromBytes(append(cID.Bytes(), fileContent...))
@@ -132,3 +369,30 @@ func (ipfsClient IPFSClient) GetIpfsFile(hash string) (content []byte, err error
 
 	return fileContent, err
 }
+
+// ErrCIDNotVerifiable is returned by VerifyCID for CIDs whose hash covers a DAG node rather than the raw content
+var ErrCIDNotVerifiable = errors.New("cid can't be verified against raw content")
+
+// VerifyCID checks that the content hashes to the given CID. Only raw-codec CIDs can be checked
+// directly, for others (e.g. unixfs dag-pb "Qm..." hashes) ErrCIDNotVerifiable is returned.
+func VerifyCID(hash string, content []byte) error {
+	hash, err := ParseContentURI(hash)
+	if err != nil {
+		return err
+	}
+	cID, err := cid.Parse(hash)
+	if err != nil {
+		return err
+	}
+	if cID.Type() != cid.Raw {
+		return ErrCIDNotVerifiable
+	}
+	sum, err := cID.Prefix().Sum(content)
+	if err != nil {
+		return err
+	}
+	if !sum.Equals(cID) {
+		return fmt.Errorf("content hashes to %s, expected %s", sum, cID)
+	}
+	return nil
+}
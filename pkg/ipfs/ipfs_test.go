@@ -0,0 +1,179 @@
+package ipfsutils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ipfs/kubo/client/rpc"
+	"golang.org/x/sync/errgroup"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tarArchive packs files into a tar archive, key: file name
+func tarArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	for name, content := range files {
+		if err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archive.Bytes()
+}
+
+func gzipped(t *testing.T, content []byte) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return compressed.Bytes()
+}
+
+func TestReadFilesCompressedLimits(t *testing.T) {
+	files := map[string]string{"a.proto": "syntax = \"proto3\";", "b.proto": "syntax = \"proto3\";", "c.proto": "syntax = \"proto3\";"}
+	archive := tarArchive(t, files)
+	// a bomb: a few KB compressed, 64 MB once extracted
+	bomb := gzipped(t, tarArchive(t, map[string]string{"bomb.proto": strings.Repeat("\x00", 64<<20)}))
+
+	for _, test := range []struct {
+		name    string
+		content []byte
+		limits  ArchiveLimits
+		wantErr bool
+	}{
+		{name: "within limits", content: archive, limits: ArchiveLimits{MaxBytes: 1024, MaxFiles: 3}},
+		{name: "no limits", content: archive},
+		{name: "too many files", content: archive, limits: ArchiveLimits{MaxFiles: 2}, wantErr: true},
+		{name: "too large", content: archive, limits: ArchiveLimits{MaxBytes: 40}, wantErr: true},
+		{name: "decompression bomb", content: bomb, limits: ArchiveLimits{MaxBytes: 1 << 20}, wantErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			extracted, err := ReadFilesCompressed(string(test.content), test.limits)
+			if test.wantErr {
+				if !errors.Is(err, ErrLimitExceeded) {
+					t.Fatalf("error %v, want ErrLimitExceeded", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(extracted) != len(files) {
+				t.Fatalf("extracted %d files, want %d", len(extracted), len(files))
+			}
+		})
+	}
+}
+
+// testGateway serves the IPFS RPC cat endpoint with handler
+func testGateway(t *testing.T, handler http.HandlerFunc) *rpc.HttpApi {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	api, err := rpc.NewURLApiWithClient(server.URL, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api
+}
+
+func TestFetchMaxFileSize(t *testing.T) {
+	api := testGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("x", 2048))
+	})
+	client := IPFSClient{HttpApi: api, MaxFileSize: 1024}
+	if _, err := client.fetch(context.Background(), api, testCID); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("fetch error %v, want ErrLimitExceeded", err)
+	}
+	client.MaxFileSize = 4096
+	content, err := client.fetch(context.Background(), api, testCID)
+	if err != nil || len(content) != 2048 {
+		t.Fatalf("fetched %d bytes, %v, want 2048", len(content), err)
+	}
+}
+
+func TestGetIpfsFileRejectsPath(t *testing.T) {
+	var requests atomic.Int32
+	api := testGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, "directory")
+	})
+	client := IPFSClient{HttpApi: api}.WithCache(NewCache(1<<20, 0))
+	for _, uri := range []string{"ipfs://" + testCID + "/service.json", "/ipfs/" + testCID + "/model.tar"} {
+		if _, _, err := client.GetIpfsFile(context.Background(), uri); !errors.Is(err, ErrContentPath) {
+			t.Fatalf("GetIpfsFile(%q) error %v, want ErrContentPath", uri, err)
+		}
+	}
+	if got := requests.Load(); got != 0 {
+		t.Fatalf("%d requests to the gateway, want none for URIs with a path", got)
+	}
+}
+
+func TestFetchConcurrencyCap(t *testing.T) {
+	const limit, fetches = 3, 10
+	var inFlight, peak atomic.Int32
+	release := make(chan struct{})
+	api := testGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			if seen := peak.Load(); current <= seen || peak.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		<-release
+		w.Write([]byte("content"))
+	})
+	client := IPFSClient{HttpApi: api}.WithMaxConcurrentFetches(limit)
+
+	var group errgroup.Group
+	for i := 0; i < fetches; i++ {
+		group.Go(func() error {
+			_, err := client.fetch(context.Background(), api, testCID)
+			return err
+		})
+	}
+	// let the blocked fetches pile up, none may get past the cap meanwhile
+	for inFlight.Load() < limit {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := inFlight.Load(); got != limit {
+		t.Fatalf("%d fetches in flight, want %d", got, limit)
+	}
+
+	// a fetch waiting for a slot gives up when its context ends
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.fetch(ctx, api, testCID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("fetch waiting for a slot fails with %v, want the context error", err)
+	}
+
+	close(release)
+	if err := group.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if got := peak.Load(); got != limit {
+		t.Fatalf("at most %d fetches were in flight, want %d", got, limit)
+	}
+}
@@ -0,0 +1,57 @@
+package ipfsutils
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMirrorLookups(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, testCID), []byte("metadata"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mirror := NewMirror(root, 0)
+
+	for _, hash := range []string{testCID, "ipfs://" + testCID, "/ipfs/" + testCID, "ipfs://" + testCID + "/"} {
+		content, cID, err := mirror.GetIpfsFileForOrg(context.Background(), "org1", hash)
+		if err != nil {
+			t.Fatalf("%s: %v", hash, err)
+		}
+		if string(content) != "metadata" || cID != testCID {
+			t.Fatalf("%s: got %q as %s, want the mirrored file as %s", hash, content, cID, testCID)
+		}
+	}
+
+	missing := "QmbWqxBEKC3P8tqsKc98xmWNzrzDtRLMiMPL8wBuTGsMnR"
+	if _, cID, err := mirror.GetIpfsFile(context.Background(), missing); !errors.Is(err, fs.ErrNotExist) || cID != missing {
+		t.Fatalf("missing file: got %s, %v, want its CID and fs.ErrNotExist", cID, err)
+	}
+	if _, _, err := mirror.GetIpfsFile(context.Background(), "not a cid"); err == nil {
+		t.Fatal("invalid CID read, want an error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := mirror.GetIpfsFile(ctx, testCID); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled context: got %v, want context.Canceled", err)
+	}
+}
+
+func TestMirrorMaxFileSize(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, testCID), []byte("12345678"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := NewMirror(root, 7).GetIpfsFile(context.Background(), testCID); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("file over the limit: got %v, want ErrLimitExceeded", err)
+	}
+	content, _, err := NewMirror(root, 8).GetIpfsFile(context.Background(), testCID)
+	if err != nil || string(content) != "12345678" {
+		t.Fatalf("file at the limit: got %q, %v, want the whole file", content, err)
+	}
+}
@@ -0,0 +1,48 @@
+package ipfsutils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupportedScheme is returned for content URIs that can't be fetched from an IPFS gateway
+var ErrUnsupportedScheme = errors.New("unsupported uri scheme")
+
+// ErrContentPath is returned for content URIs with a path after the CID, which names a file of a directory
+// rather than the content of the CID
+var ErrContentPath = errors.New("paths in content uris are not supported")
+
+// ParseContentURI returns the CID of a metadata or model URI: a bare CID, ipfs://<cid> or /ipfs/<cid>.
+// A path after the CID, e.g. ipfs://<dir-cid>/service.json, is rejected with ErrContentPath: files of a
+// directory aren't resolved, and fetching the directory CID instead would return the wrong content.
+// filecoin:// and other schemes are rejected with ErrUnsupportedScheme, as Filecoin retrieval is not implemented.
+func ParseContentURI(uri string) (string, error) {
+	uri = strings.TrimSpace(uri)
+	if scheme, rest, ok := strings.Cut(uri, "://"); ok {
+		switch strings.ToLower(scheme) {
+		case "ipfs":
+			uri = rest
+		case "filecoin":
+			return "", fmt.Errorf("%w: filecoin retrieval is not supported (%s)", ErrUnsupportedScheme, uri)
+		default:
+			return "", fmt.Errorf("%w: %s", ErrUnsupportedScheme, uri)
+		}
+	}
+	uri = strings.TrimPrefix(uri, "/ipfs/")
+	uri = strings.TrimSuffix(uri, "/")
+	if cID, path, ok := strings.Cut(uri, "/"); ok {
+		return "", fmt.Errorf("%w: %s has path /%s after the cid %s, publish the cid of the file itself", ErrContentPath, uri, path, cID)
+	}
+	return RemoveSpecialCharacters(uri), nil
+}
+
+// InlineJSON returns the metadata embedded in a URI by registrations that store the JSON itself
+// instead of a CID, ok is false when the URI isn't a JSON object
+func InlineJSON(uri string) (metadata []byte, ok bool) {
+	uri = strings.Trim(uri, " \t\r\n\x00")
+	if !strings.HasPrefix(uri, "{") {
+		return nil, false
+	}
+	return []byte(uri), true
+}
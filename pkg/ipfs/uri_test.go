@@ -0,0 +1,39 @@
+package ipfsutils
+
+import (
+	"errors"
+	"testing"
+)
+
+const testCID = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+
+func TestParseContentURI(t *testing.T) {
+	for _, test := range []struct {
+		uri     string
+		want    string
+		wantErr error
+	}{
+		{uri: testCID, want: testCID},
+		{uri: " " + testCID + "\n", want: testCID},
+		{uri: "ipfs://" + testCID, want: testCID},
+		{uri: "IPFS://" + testCID, want: testCID},
+		{uri: "/ipfs/" + testCID, want: testCID},
+		{uri: testCID + "/", want: testCID},
+		{uri: "ipfs://" + testCID + "/", want: testCID},
+		{uri: "ipfs://" + testCID + "/service.json", wantErr: ErrContentPath},
+		{uri: "/ipfs/" + testCID + "/models/service.tar", wantErr: ErrContentPath},
+		{uri: "filecoin://" + testCID, wantErr: ErrUnsupportedScheme},
+		{uri: "https://example.com/" + testCID, wantErr: ErrUnsupportedScheme},
+	} {
+		got, err := ParseContentURI(test.uri)
+		if test.wantErr != nil {
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("ParseContentURI(%q) error %v, want %v", test.uri, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("ParseContentURI(%q) = %q, %v, want %q", test.uri, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"context"
+	"github.com/rs/zerolog/log"
+	"matrix-ai-framework/pkg/db"
+	"maunium.net/go/mautrix/id"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretParamNames are substrings of parameter names whose values are never stored or logged
+var secretParamNames = []string{"key", "secret", "token", "password", "passwd", "mnemonic", "seed", "signature", "private"}
+
+// secretValuePattern matches values shaped like private keys or signatures (32+ raw bytes in hex)
+var secretValuePattern = regexp.MustCompile(`^(0x)?[0-9a-fA-F]{64,}$`)
+
+// redactParams returns a copy of the params with secret values replaced
+func redactParams(params map[string]string) map[string]string {
+	redactedParams := make(map[string]string, len(params))
+	for name, value := range params {
+		redactedParams[name] = value
+		if isSecretParam(name) || secretValuePattern.MatchString(strings.TrimSpace(value)) {
+			redactedParams[name] = redacted
+		}
+	}
+	return redactedParams
+}
+
+func isSecretParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range secretParamNames {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// audit persists an admin action with its redacted params, failures to persist are only logged
+// so that they never block the action itself
+func (bot *SNETBot) audit(actor id.UserID, action string, params map[string]string, result string) {
+	entry := db.AuditEntry{
+		Actor:  actor.String(),
+		Action: action,
+		Params: redactParams(params),
+		Result: result,
+	}
+	log.Info().Str("actor", entry.Actor).Str("action", entry.Action).Interface("params", entry.Params).Str("result", entry.Result).Msg("Admin action")
+	if bot.DB == nil {
+		return
+	}
+	if _, err := bot.DB.CreateAuditEntry(context.Background(), entry); err != nil {
+		log.Error().Err(err).Str("action", action).Msg("Failed to persist audit entry")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/rs/zerolog/log"
+	"matrix-ai-framework/internal/sanitizer"
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
@@ -198,7 +199,7 @@ func (b *DefaultMatrixBot) SendMessage(roomID id.RoomID, text string) error {
 
 	_, err := b.MauClient.SendMessageEvent(context.Background(), roomID, event.EventMessage, event.MessageEventContent{
 		MsgType:       event.MsgText,
-		Body:          text,
+		Body:          sanitizer.PlainText(text),
 		Format:        event.FormatHTML,
 		FormattedBody: fmt.Sprintf("<p>%s</p>", text),
 	})
@@ -0,0 +1,241 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"io"
+	"matrix-ai-framework/internal/grpc_manager"
+	"matrix-ai-framework/internal/snet_syncer"
+	"matrix-ai-framework/pkg/blockchain"
+	"matrix-ai-framework/pkg/db"
+	"time"
+)
+
+var (
+	// ErrServiceNotSynced is wrapped by ErrServiceNotFound and ErrDescriptorNotCompiled, see snet_syncer
+	ErrServiceNotSynced      = snet_syncer.ErrServiceNotSynced
+	ErrServiceNotFound       = snet_syncer.ErrServiceNotFound
+	ErrDescriptorNotCompiled = snet_syncer.ErrDescriptorNotCompiled
+	ErrMethodNotFound        = snet_syncer.ErrMethodNotFound
+	// ErrStreamingUnsupported is returned for streaming methods by CallMethod, which only calls unary
+	// methods, and for methods other than server streaming ones by CallServerStream
+	ErrStreamingUnsupported = errors.New("streaming methods are not supported")
+	// ErrCallTimeout is returned when the daemon didn't answer a call within its timeout
+	ErrCallTimeout = errors.New("call timed out")
+)
+
+// SnetCaller invokes methods of synced snet services with JSON inputs and outputs, paying for every call
+type SnetCaller struct {
+	Syncer      *snet_syncer.SnetSyncer
+	eth         blockchain.Ethereum
+	db          db.Service
+	grpcManager *grpc_manager.GRPCClientManager
+}
+
+// NewSnetCaller creates a SnetCaller resolving methods from the descriptors of the syncer
+func NewSnetCaller(syncer *snet_syncer.SnetSyncer, eth blockchain.Ethereum, database db.Service, grpcManager *grpc_manager.GRPCClientManager) *SnetCaller {
+	return &SnetCaller{
+		Syncer:      syncer,
+		eth:         eth,
+		db:          database,
+		grpcManager: grpcManager,
+	}
+}
+
+// CallMethod calls a unary method of the snet service. The service is the gRPC service name or
+// fully-qualified name, jsonInput is the request in the protobuf JSON mapping and the response is
+// returned in the same format. Inputs that don't match the method are refused with an InputError
+// before anything is paid. The call is bounded by the CallTimeout of the syncer.
+func (c *SnetCaller) CallMethod(ctx context.Context, snetID, serviceName, methodName string, jsonInput []byte) ([]byte, error) {
+	return c.CallMethodTimeout(ctx, snetID, serviceName, methodName, jsonInput, 0)
+}
+
+// CallMethodTimeout is CallMethod with the call to the daemon bounded by timeout instead, a call that
+// doesn't return in time fails with ErrCallTimeout. A non-positive timeout means the CallTimeout of the syncer.
+func (c *SnetCaller) CallMethodTimeout(ctx context.Context, snetID, serviceName, methodName string, jsonInput []byte, timeout time.Duration) ([]byte, error) {
+	method, err := c.findMethod(snetID, serviceName, methodName)
+	if err != nil {
+		return nil, err
+	}
+	if kind := snet_syncer.StreamingKind(method); kind != "" {
+		return nil, fmt.Errorf("%w: %s is a %s streaming method", ErrStreamingUnsupported, method.FullName(), kind)
+	}
+
+	input, callCtx, conn, settle, err := c.prepareCall(ctx, snetID, method, jsonInput)
+	if err != nil {
+		return nil, err
+	}
+	fullMethod := fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name())
+	log.Info().Str("snet-id", snetID).Str("method", fullMethod).Msg("Calling method")
+	output := dynamicpb.NewMessage(method.Output())
+	if timeout <= 0 {
+		timeout = c.Syncer.CallTimeout
+	}
+	err = invoke(callCtx, conn, fullMethod, input, output, timeout)
+	settle(err)
+	if err != nil {
+		return nil, err
+	}
+	return protojson.Marshal(output)
+}
+
+// CallServerStream calls a server-streaming method of the snet service by its fully-qualified name, e.g.
+// "example.Service.Method" or "example.Service/Method". The responses are sent on the first channel in
+// the protobuf JSON mapping as they arrive, it is closed at the end of the stream. A failure, including
+// ctx being canceled, is sent on the second channel before both are closed. The call is paid once up
+// front like a unary call and the stream isn't bounded by CallTimeout, only by ctx.
+func (c *SnetCaller) CallServerStream(ctx context.Context, snetID, method string, jsonInput []byte) (<-chan []byte, <-chan error) {
+	responses, errs := make(chan []byte), make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(responses)
+		if err := c.serverStream(ctx, snetID, method, jsonInput, responses); err != nil {
+			errs <- err
+		}
+	}()
+	return responses, errs
+}
+
+func (c *SnetCaller) serverStream(ctx context.Context, snetID, name string, jsonInput []byte, responses chan<- []byte) (err error) {
+	method, err := c.Syncer.FindMethod(snetID, name)
+	if err != nil {
+		return err
+	}
+	if method.IsStreamingClient() || !method.IsStreamingServer() {
+		kind := snet_syncer.StreamingKind(method)
+		if kind == "" {
+			kind = "unary"
+		}
+		return fmt.Errorf("%w: %s is a %s method, not a server streaming one", ErrStreamingUnsupported, method.FullName(), kind)
+	}
+	input, callCtx, conn, settle, err := c.prepareCall(ctx, snetID, method, jsonInput)
+	if err != nil {
+		return err
+	}
+	defer func() { settle(err) }()
+	// canceling ends the stream when the caller stops reading
+	callCtx, cancel := context.WithCancel(callCtx)
+	defer cancel()
+
+	fullMethod := fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name())
+	log.Info().Str("snet-id", snetID).Str("method", fullMethod).Msg("Calling streaming method")
+	stream, err := conn.NewStream(callCtx, &grpc.StreamDesc{ServerStreams: true}, fullMethod)
+	if err != nil {
+		return fmt.Errorf("call %s: %w", fullMethod, err)
+	}
+	if err = stream.SendMsg(input); err != nil {
+		return fmt.Errorf("call %s: %w", fullMethod, err)
+	}
+	if err = stream.CloseSend(); err != nil {
+		return fmt.Errorf("call %s: %w", fullMethod, err)
+	}
+	for {
+		output := dynamicpb.NewMessage(method.Output())
+		if err := stream.RecvMsg(output); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return fmt.Errorf("call %s: %w", fullMethod, err)
+		}
+		response, err := protojson.Marshal(output)
+		if err != nil {
+			return fmt.Errorf("response of %s: %w", fullMethod, err)
+		}
+		select {
+		case responses <- response:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// prepareCall parses the input of a call and pays for it, it returns the context carrying the payment
+// to the daemon and the connection to the endpoint of the service. settle must be called with the result
+// of the call, see escrowPayment. Inputs that don't match the method are refused with an InputError
+// before anything is paid.
+func (c *SnetCaller) prepareCall(ctx context.Context, snetID string, method protoreflect.MethodDescriptor, jsonInput []byte) (*dynamicpb.Message, context.Context, *grpc.ClientConn, func(error), error) {
+	input, err := ParseInput(method, jsonInput)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	snetService, err := c.db.GetSnetService(ctx, snetID)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("get snet service %s: %w", snetID, err)
+	}
+	price, err := snet_syncer.ServicePrice(ctx, c.db, snetService, string(method.Parent().FullName())+"/"+string(method.Name()))
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("price of %s: %w", method.FullName(), err)
+	}
+	endpoint := c.Syncer.ServiceEndpoint(ctx, snetService)
+	client, err := c.grpcManager.GetClient(endpoint)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("connect to %s of %s: %w", endpoint, snetID, err)
+	}
+	md, settle, err := escrowPayment(ctx, c.eth, c.db, snetService, client.Conn, price)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("payment for %s: %w", snetID, err)
+	}
+	return input, metadata.NewOutgoingContext(ctx, md), client.Conn, settle, nil
+}
+
+// invoke calls a unary method within timeout, DefaultCallTimeout when not positive. A call that ran out
+// of time, or whose ctx expired, fails with ErrCallTimeout.
+func invoke(ctx context.Context, conn grpc.ClientConnInterface, fullMethod string, input, output any, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = snet_syncer.DefaultCallTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := conn.Invoke(ctx, fullMethod, input, output)
+	if err == nil {
+		return nil
+	}
+	if status.Code(err) == codes.DeadlineExceeded || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %s didn't answer within %s", ErrCallTimeout, fullMethod, timeout)
+	}
+	return fmt.Errorf("call %s: %w", fullMethod, err)
+}
+
+// CheckChannel returns the state of the payment channel calls to the snet service are paid from, Found is
+// unset when there is none. CallMethod refuses to call a service without a funded channel.
+func (c *SnetCaller) CheckChannel(ctx context.Context, snetID string) (blockchain.ChannelState, error) {
+	snetService, err := c.db.GetSnetService(ctx, snetID)
+	if err != nil {
+		return blockchain.ChannelState{}, fmt.Errorf("get snet service %s: %w", snetID, err)
+	}
+	return checkChannel(ctx, c.eth, c.db, snetService)
+}
+
+// findMethod looks up the method among the descriptors synced for the snet service
+func (c *SnetCaller) findMethod(snetID, serviceName, methodName string) (protoreflect.MethodDescriptor, error) {
+	descriptors, err := c.Syncer.GetServiceDescriptors(snetID)
+	if err != nil {
+		return nil, err
+	}
+	for _, descriptor := range descriptors {
+		services := descriptor.Services()
+		for i := 0; i < services.Len(); i++ {
+			service := services.Get(i)
+			if string(service.Name()) != serviceName && string(service.FullName()) != serviceName {
+				continue
+			}
+			if method := service.Methods().ByName(protoreflect.Name(methodName)); method != nil {
+				return method, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s/%s in %s", ErrMethodNotFound, serviceName, methodName, snetID)
+}
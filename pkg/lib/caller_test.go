@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"net"
+	"testing"
+	"time"
+)
+
+// testDaemon serves every method with handler, returning a connection to it
+func testDaemon(t *testing.T, handler func(ctx context.Context) error) *grpc.ClientConn {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+			return err
+		}
+		if err := handler(stream.Context()); err != nil {
+			return err
+		}
+		return stream.SendMsg(&emptypb.Empty{})
+	}))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestInvokeTimeout(t *testing.T) {
+	// the daemon stalls past the deadline of the call
+	stalled := testDaemon(t, func(ctx context.Context) error {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ctx.Done():
+		}
+		return nil
+	})
+	started := time.Now()
+	err := invoke(context.Background(), stalled, "/echo.Echo/Say", &emptypb.Empty{}, &emptypb.Empty{}, 50*time.Millisecond)
+	if !errors.Is(err, ErrCallTimeout) {
+		t.Fatalf("stalled call fails with %v, want ErrCallTimeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("stalled call returned after %s, want right after its timeout", elapsed)
+	}
+
+	// an expired ctx is reported as a timeout too
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := invoke(ctx, stalled, "/echo.Echo/Say", &emptypb.Empty{}, &emptypb.Empty{}, time.Minute); !errors.Is(err, ErrCallTimeout) {
+		t.Fatalf("call past the deadline of its ctx fails with %v, want ErrCallTimeout", err)
+	}
+}
+
+func TestInvokeOtherFailures(t *testing.T) {
+	fast := testDaemon(t, func(context.Context) error { return nil })
+	if err := invoke(context.Background(), fast, "/echo.Echo/Say", &emptypb.Empty{}, &emptypb.Empty{}, time.Second); err != nil {
+		t.Fatalf("call answered in time fails with %v", err)
+	}
+
+	failing := testDaemon(t, func(context.Context) error { return status.Error(codes.Unavailable, "daemon down") })
+	err := invoke(context.Background(), failing, "/echo.Echo/Say", &emptypb.Empty{}, &emptypb.Empty{}, time.Second)
+	if err == nil || errors.Is(err, ErrCallTimeout) || status.Code(errors.Unwrap(err)) != codes.Unavailable {
+		t.Fatalf("failing call fails with %v, want the daemon error and no timeout", err)
+	}
+}
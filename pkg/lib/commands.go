@@ -0,0 +1,436 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"html"
+	"matrix-ai-framework/internal/config"
+	"matrix-ai-framework/internal/snet_syncer"
+	"matrix-ai-framework/pkg/db"
+	"maunium.net/go/mautrix/event"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultAuditEntries = 20
+	maxAuditEntries     = 100
+	// snetPaymentTimeout bounds the payment of a method call made with "!snet call", the call itself
+	// gets the CallTimeout of the syncer on top
+	snetPaymentTimeout = time.Minute
+)
+
+const snetUsage = "Usage: <code>!snet list</code>, <code>!snet info &lt;snet id&gt;</code>, <code>!snet example &lt;snet id&gt; &lt;method&gt;</code> " +
+	"or <code>!snet call &lt;snet id&gt; &lt;method&gt; {json input}</code>. " +
+	"The method is a method name, or <code>&lt;service&gt;/&lt;method&gt;</code> when several services have it."
+
+var (
+	errAmbiguousMethod = snet_syncer.ErrAmbiguousMethod
+	errInvalidInput    = errors.New("input is not a JSON object")
+)
+
+// botCommand is a bot command prefixed with "!", run returns the result recorded in the audit log
+type botCommand struct {
+	run       func(bot *SNETBot, evt *event.Event, params map[string]string) (string, error)
+	adminOnly bool
+	audited   bool
+}
+
+var botCommands = map[string]botCommand{
+	"!selftest": {run: (*SNETBot).runSelfTest, adminOnly: true, audited: true},
+	"!audit":    {run: (*SNETBot).showAudit, adminOnly: true},
+	"!describe": {run: (*SNETBot).describeService},
+	"!snet":     {run: (*SNETBot).snetCommand},
+}
+
+// handleCommand runs the bot commands, it returns false if the message is not
+// such a command and should be handled as a service call
+func (bot *SNETBot) handleCommand(evt *event.Event) bool {
+	fields := strings.Fields(evt.Content.AsMessage().Body)
+	if len(fields) == 0 {
+		return false
+	}
+	command, ok := botCommands[fields[0]]
+	if !ok {
+		return false
+	}
+	action := strings.TrimPrefix(fields[0], "!")
+	params := parseCommandParams(fields[1:])
+
+	if command.adminOnly && !bot.Admins[evt.Sender] {
+		bot.audit(evt.Sender, action, params, "denied")
+		bot.reply(evt, "Only bot admins can run this command.")
+		return true
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error().Any("panic", r).Str("command", fields[0]).Msg("Bot command panicked")
+				bot.reply(evt, "The command failed.")
+			}
+		}()
+		result, err := command.run(bot, evt, params)
+		if err != nil {
+			result = "error: " + err.Error()
+		}
+		if command.audited {
+			bot.audit(evt.Sender, action, params, result)
+		}
+	}()
+	return true
+}
+
+// parseCommandParams reads "name=value" arguments, other arguments are named by position (arg0, arg1...)
+func parseCommandParams(args []string) map[string]string {
+	params := make(map[string]string, len(args))
+	for i, arg := range args {
+		if name, value, ok := strings.Cut(arg, "="); ok && name != "" {
+			params[name] = value
+			continue
+		}
+		params[fmt.Sprintf("arg%d", i)] = arg
+	}
+	return params
+}
+
+func (bot *SNETBot) reply(evt *event.Event, text string) {
+	if _, err := bot.Client.SendMessage(evt.RoomID, text); err != nil {
+		log.Error().Err(err).Msg("Failed to send message: " + err.Error())
+	}
+}
+
+// runSelfTest checks a sample of the catalog and replies with a pass/fail matrix
+func (bot *SNETBot) runSelfTest(evt *event.Event, _ map[string]string) (string, error) {
+	if bot.Syncer == nil {
+		bot.reply(evt, "Self-test is not available: no syncer is attached to the bot.")
+		return "", errors.New("no syncer")
+	}
+
+	results, err := bot.Syncer.SelfTest(context.Background(), config.Syncer.SelfTestSampleSize, config.Syncer.SelfTestLive)
+	if err != nil {
+		log.Error().Err(err).Msg("Self-test failed")
+		bot.reply(evt, fmt.Sprintf("Self-test failed: %s", html.EscapeString(err.Error())))
+		return "", err
+	}
+	bot.reply(evt, formatSelfTest(results))
+
+	passed := 0
+	for _, result := range results {
+		if result.Passed() {
+			passed++
+		}
+	}
+	return fmt.Sprintf("%d/%d services passed", passed, len(results)), nil
+}
+
+// showAudit replies with the latest audit log entries, "!audit 50" shows more of them
+func (bot *SNETBot) showAudit(evt *event.Event, params map[string]string) (string, error) {
+	limit := defaultAuditEntries
+	if arg, ok := params["arg0"]; ok {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			bot.reply(evt, "Usage: !audit [number of entries]")
+			return "", fmt.Errorf("invalid number of entries %q", arg)
+		}
+		limit = min(n, maxAuditEntries)
+	}
+	if bot.DB == nil {
+		bot.reply(evt, "Audit log is not available: no database is attached to the bot.")
+		return "", errors.New("no database")
+	}
+
+	entries, err := bot.DB.GetAuditEntries(context.Background(), limit)
+	if err != nil {
+		bot.reply(evt, "Failed to read the audit log.")
+		return "", err
+	}
+	bot.reply(evt, formatAudit(entries))
+	return fmt.Sprintf("%d entries", len(entries)), nil
+}
+
+// describeService replies with the details and endpoint health of a service, "!describe <snet id>"
+// also accepts the bot service names "<snet id>/<service>"
+func (bot *SNETBot) describeService(evt *event.Event, params map[string]string) (string, error) {
+	name, ok := params["arg0"]
+	if !ok {
+		bot.reply(evt, "Usage: !describe <service>")
+		return "", errors.New("no service given")
+	}
+	if bot.DB == nil || bot.Syncer == nil {
+		bot.reply(evt, "Service details are not available.")
+		return "", errors.New("no database or syncer")
+	}
+	snetID, _, _ := strings.Cut(name, "/")
+	service, err := bot.DB.GetSnetService(context.Background(), snetID)
+	if err != nil {
+		bot.reply(evt, fmt.Sprintf("Service %s not found.", html.EscapeString(snetID)))
+		return "", err
+	}
+	bot.reply(evt, formatServiceDescription(service, bot.Syncer.EndpointHealth(snetID), bot.Syncer.Sanitizer.HTML(service.Description)))
+	return "", nil
+}
+
+// snetCommand lists the synced services with "!snet list", shows one with "!snet info <snet id>", replies
+// with an example input with "!snet example <snet id> <method>" and calls a method with
+// "!snet call <snet id> <method> {json input}", the JSON input may contain spaces
+func (bot *SNETBot) snetCommand(evt *event.Event, _ map[string]string) (string, error) {
+	_, args := cutField(evt.Content.AsMessage().Body)
+	subcommand, args := cutField(args)
+	if bot.Syncer == nil {
+		bot.reply(evt, "Services are not available: no syncer is attached to the bot.")
+		return "", errors.New("no syncer")
+	}
+	switch subcommand {
+	case "list":
+		pages := bot.Syncer.GetSnetServicesInfoPages(config.Output.MessageMaxBytes)
+		if len(pages) == 0 {
+			bot.reply(evt, "No services are synced yet.")
+		}
+		for _, page := range pages {
+			bot.reply(evt, page)
+		}
+		return "", nil
+	case "info":
+		snetID, _ := cutField(args)
+		if snetID == "" {
+			bot.reply(evt, snetUsage)
+			return "", errors.New("no service given")
+		}
+		info, err := bot.Syncer.GetServiceInfo(snetID)
+		if err != nil {
+			bot.reply(evt, errorText(snetID, err))
+			return "", err
+		}
+		bot.reply(evt, info)
+		return "", nil
+	case "example":
+		snetID, args := cutField(args)
+		methodName, _ := cutField(args)
+		if snetID == "" || methodName == "" {
+			bot.reply(evt, snetUsage)
+			return "", errors.New("no service or method given")
+		}
+		example, err := bot.Syncer.GenerateExampleRequest(snetID, methodName)
+		if err != nil {
+			bot.reply(evt, errorText(snetID, err))
+			return "", err
+		}
+		bot.reply(evt, formatJSON(example))
+		return "", nil
+	case "call":
+		snetID, args := cutField(args)
+		methodName, input := cutField(args)
+		if snetID == "" || methodName == "" {
+			bot.reply(evt, snetUsage)
+			return "", errors.New("no service or method given")
+		}
+		return bot.snetCall(evt, snetID, methodName, input)
+	}
+	bot.reply(evt, snetUsage)
+	return "", fmt.Errorf("unknown subcommand %q", subcommand)
+}
+
+// snetCall calls a method of a synced service and replies with its JSON output
+func (bot *SNETBot) snetCall(evt *event.Event, snetID, methodName, input string) (string, error) {
+	if bot.Caller == nil {
+		bot.reply(evt, "Calls are not available: no caller is attached to the bot.")
+		return "", errors.New("no caller")
+	}
+	if input == "" {
+		input = "{}"
+	}
+	if !strings.HasPrefix(input, "{") || !json.Valid([]byte(input)) {
+		bot.reply(evt, "The input must be a JSON object. "+snetUsage)
+		return "", errInvalidInput
+	}
+	serviceName, methodName, err := bot.resolveMethod(snetID, methodName)
+	if err != nil {
+		bot.reply(evt, errorText(snetID, err))
+		return "", err
+	}
+	if health := bot.Syncer.EndpointHealth(snetID); health.Status == snet_syncer.EndpointUnreachable {
+		bot.reply(evt, fmt.Sprintf("Service %s can't be called: %s.", html.EscapeString(snetID), health.Status))
+		return "", errors.New(health.Status)
+	}
+	if allowed, retryAfter := bot.allowCall(evt.RoomID, evt.Sender); !allowed {
+		bot.reply(evt, fmt.Sprintf("Slow down! You can call services again in %s.", retryAfter))
+		return "", errors.New("rate limited")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), snetPaymentTimeout+bot.Syncer.CallTimeout)
+	defer cancel()
+	output, err := bot.Caller.CallMethod(ctx, snetID, serviceName, methodName, []byte(input))
+	if err != nil {
+		log.Error().Err(err).Str("snet-id", snetID).Str("method", methodName).Msg("Failed to call method")
+		bot.reply(evt, errorText(snetID, err))
+		return "", err
+	}
+	bot.reply(evt, formatJSON(output))
+	return "", nil
+}
+
+// resolveMethod splits "<service>/<method>" and "<service>.<method>", a bare method name is looked up
+// among the services of snetID and must belong to exactly one of them
+func (bot *SNETBot) resolveMethod(snetID, name string) (serviceName, methodName string, err error) {
+	if i := strings.LastIndexAny(name, "/."); i >= 0 {
+		return name[:i], name[i+1:], nil
+	}
+	methods, err := bot.Syncer.GetServiceMethods(snetID)
+	if err != nil {
+		return "", "", err
+	}
+	for _, method := range methods {
+		if method.Name != name {
+			continue
+		}
+		if serviceName != "" {
+			return "", "", fmt.Errorf("%w: %s is in %s and %s", errAmbiguousMethod, name, serviceName, method.Service)
+		}
+		serviceName = method.Service
+	}
+	if serviceName == "" {
+		return "", "", fmt.Errorf("%w: %s in %s", ErrMethodNotFound, name, snetID)
+	}
+	return serviceName, name, nil
+}
+
+// errorText is the reply to a failed lookup or call of a service
+func errorText(snetID string, err error) string {
+	service := html.EscapeString(snetID)
+	switch {
+	case errors.Is(err, ErrServiceNotFound):
+		return fmt.Sprintf("Service %s not found.", service)
+	case errors.Is(err, ErrDescriptorNotCompiled):
+		return fmt.Sprintf("Service %s is synced but its protos didn't compile, it can't be called.", service)
+	case errors.Is(err, ErrMethodNotFound), errors.Is(err, errAmbiguousMethod):
+		return html.EscapeString(err.Error()) + ". " + snetUsage
+	case errors.Is(err, ErrCallTimeout):
+		return fmt.Sprintf("Service %s didn't answer in time, try again later.", service)
+	case errors.Is(err, ErrNoFundedChannel), errors.Is(err, ErrInsufficientChannelBalance):
+		return fmt.Sprintf("Service %s can't be paid: %s.", service, html.EscapeString(err.Error()))
+	}
+	return fmt.Sprintf("Call failed: %s", html.EscapeString(err.Error()))
+}
+
+// cutField splits the first whitespace-separated field off s
+func cutField(s string) (field, rest string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexFunc(s, unicode.IsSpace); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
+
+// formatJSON renders a JSON response indented in a code block
+func formatJSON(output []byte) string {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, output, "", "  "); err != nil {
+		indented.Reset()
+		indented.Write(output)
+	}
+	return "<pre><code>" + html.EscapeString(indented.String()) + "</code></pre>"
+}
+
+// formatServiceDescription renders the service details, description must already be sanitized
+func formatServiceDescription(service db.SnetService, health snet_syncer.EndpointHealth, description string) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("<p><strong>%s</strong> (%s/%s)</p>",
+		html.EscapeString(service.DisplayName), html.EscapeString(service.SnetOrgID), html.EscapeString(service.SnetID)))
+	if description != "" {
+		text.WriteString("<p>📝" + description + "</p>")
+	}
+	text.WriteString(fmt.Sprintf("<p>Price: %d cogs, free calls: %d</p>", service.Price, service.FreeCalls))
+	text.WriteString("<p>Endpoint: " + html.EscapeString(service.URL) + "</p>")
+	status := "Status: " + health.Status
+	if !health.CheckedAt.IsZero() {
+		status += ", last checked at " + health.CheckedAt.UTC().Format(time.RFC3339)
+	}
+	text.WriteString("<p>" + html.EscapeString(status) + "</p>")
+	return text.String()
+}
+
+// formatAudit renders audit entries as an HTML list, newest first
+func formatAudit(entries []db.AuditEntry) string {
+	if len(entries) == 0 {
+		return "Audit log is empty."
+	}
+	var text strings.Builder
+	text.WriteString("<ul>")
+	for _, entry := range entries {
+		names := make([]string, 0, len(entry.Params))
+		for name := range entry.Params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		params := make([]string, 0, len(names))
+		for _, name := range names {
+			params = append(params, name+"="+entry.Params[name])
+		}
+		text.WriteString(fmt.Sprintf("<li>%s <b>%s</b> %s <code>%s</code>: %s</li>",
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			html.EscapeString(entry.Actor),
+			html.EscapeString(entry.Action),
+			html.EscapeString(strings.Join(params, " ")),
+			html.EscapeString(entry.Result)))
+	}
+	text.WriteString("</ul>")
+	return text.String()
+}
+
+// formatSelfTest renders the self-test results as an HTML table, failure details are listed below it
+func formatSelfTest(results []snet_syncer.SelfTestResult) string {
+	if len(results) == 0 {
+		return "Self-test: no services to check."
+	}
+	steps := []string{snet_syncer.StepMetadata, snet_syncer.StepCID, snet_syncer.StepCompile, snet_syncer.StepEndpoint, snet_syncer.StepGRPC}
+	marks := map[string]string{
+		snet_syncer.StepPassed:  "✅",
+		snet_syncer.StepFailed:  "❌",
+		snet_syncer.StepSkipped: "➖",
+	}
+
+	passed := 0
+	var table, failures strings.Builder
+	table.WriteString("<table><tr><th>service</th>")
+	for _, step := range steps {
+		table.WriteString("<th>" + step + "</th>")
+	}
+	table.WriteString("</tr>")
+	for _, result := range results {
+		if result.Passed() {
+			passed++
+		}
+		statuses := make(map[string]string, len(result.Steps))
+		for _, step := range result.Steps {
+			statuses[step.Name] = step.Status
+			if step.Status == snet_syncer.StepFailed {
+				failures.WriteString(fmt.Sprintf("<li><b>%s</b> %s: %s</li>",
+					html.EscapeString(result.SnetID), step.Name, html.EscapeString(step.Detail)))
+			}
+		}
+		table.WriteString("<tr><td>" + html.EscapeString(result.SnetID) + "</td>")
+		for _, step := range steps {
+			mark, ok := marks[statuses[step]]
+			if !ok {
+				mark = marks[snet_syncer.StepSkipped]
+			}
+			table.WriteString("<td>" + mark + "</td>")
+		}
+		table.WriteString("</tr>")
+	}
+	table.WriteString("</table>")
+
+	text := fmt.Sprintf("<p>Self-test: %d/%d services passed</p>%s", passed, len(results), table.String())
+	if failures.Len() > 0 {
+		text += "<ul>" + failures.String() + "</ul>"
+	}
+	return text
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/rs/zerolog/log"
 	"log/slog"
 	"matrix-ai-framework/internal/app"
+	"matrix-ai-framework/internal/config"
+	"net"
 	"time"
 )
 
@@ -79,15 +81,21 @@ func DefaultSNETEngine() *Engine {
 		}
 	}()
 
-	go a.Syncer.Start()
+	go a.Syncer.Start(context.Background())
+	go a.Syncer.StartHealthChecks(context.Background())
 
-	time.Sleep(40 * time.Second)
+	// the services are connected to the bot from the descriptors of the first sync
+	a.Syncer.WaitForInitialSync(context.Background())
 
+	defaultGRPCManager = a.GRPCManager
 	bot := NewSNETBot(a.MatrixClient)
+	bot.Syncer = a.Syncer
+	bot.DB = a.DB
+	bot.Caller = NewSnetCaller(a.Syncer, a.Ethereum, a.DB, a.GRPCManager)
 
 	// connect services to the bot from file descriptors
 	if a.Syncer.FileDescriptors != nil {
-		for snetIDOfService, descriptors := range a.Syncer.FileDescriptors {
+		for snetIDOfService, descriptors := range a.Syncer.Descriptors() {
 			log.Info().Msgf("service snet id: %s", snetIDOfService)
 			if descriptors != nil {
 				for _, descriptor := range descriptors {
@@ -113,5 +121,20 @@ func DefaultSNETEngine() *Engine {
 
 	engine.RegisterBot(bot)
 
+	if config.App.GRPCProxyAddr != "" {
+		proxy, err := NewGRPCProxy(a.Syncer, a.Ethereum, a.DB, a.GRPCManager)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to create gRPC proxy")
+		} else if lis, err := net.Listen("tcp", config.App.GRPCProxyAddr); err != nil {
+			log.Error().Err(err).Msg("Failed to listen for gRPC proxy")
+		} else {
+			go func() {
+				if err := proxy.Serve(lis); err != nil {
+					log.Error().Err(err).Msg("gRPC proxy stopped")
+				}
+			}()
+		}
+	}
+
 	return engine
 }
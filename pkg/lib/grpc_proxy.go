@@ -0,0 +1,444 @@
+package lib
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"io"
+	"matrix-ai-framework/internal/config"
+	"matrix-ai-framework/internal/grpc_manager"
+	"matrix-ai-framework/internal/snet_syncer"
+	"matrix-ai-framework/pkg/blockchain"
+	"matrix-ai-framework/pkg/db"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// SnetIDHeader selects the snet service a proxied call is routed to,
+// it is only required when several synced services expose the same gRPC service name
+const SnetIDHeader = "snet-proxy-service-id"
+
+// proxyRoom is the key of the proxy in the room limiter, all the calls through it count as one room
+const proxyRoom = "grpc-proxy"
+
+// GRPCProxy is a gRPC server exposing the synced snet services through the reflection API,
+// so standard tooling (grpcurl, evans) can browse them, and forwarding every call to the
+// service daemon with the escrow payment attached
+type GRPCProxy struct {
+	Syncer      *snet_syncer.SnetSyncer
+	eth         blockchain.Ethereum
+	db          db.Service
+	grpcManager *grpc_manager.GRPCClientManager
+	server      *grpc.Server
+	// Token, when set, is required from clients as the "authorization: Bearer <token>" metadata
+	Token string
+	// AllowedPeers, when set, are the only networks calls are accepted from
+	AllowedPeers []*net.IPNet
+	PeerLimiter  *RateLimiter // limits calls per peer IP, a peer is limited like a matrix user
+	RoomLimiter  *RateLimiter // limits all the calls through the proxy, the proxy is limited like a room
+}
+
+// NewGRPCProxy creates a GRPCProxy backed by the descriptors of the syncer, accepting calls with the
+// GRPC_PROXY_TOKEN or from the GRPC_PROXY_ALLOWED_PEERS. It fails when neither is configured.
+func NewGRPCProxy(syncer *snet_syncer.SnetSyncer, eth blockchain.Ethereum, database db.Service, grpcManager *grpc_manager.GRPCClientManager) (*GRPCProxy, error) {
+	allowedPeers, err := parsePeers(config.App.GRPCProxyAllowedPeers)
+	if err != nil {
+		return nil, err
+	}
+	if config.App.GRPCProxyToken == "" && len(allowedPeers) == 0 {
+		return nil, errors.New("the gRPC proxy requires GRPC_PROXY_TOKEN or GRPC_PROXY_ALLOWED_PEERS")
+	}
+	p := &GRPCProxy{
+		Syncer:       syncer,
+		eth:          eth,
+		db:           database,
+		grpcManager:  grpcManager,
+		Token:        config.App.GRPCProxyToken,
+		AllowedPeers: allowedPeers,
+		PeerLimiter:  NewRateLimiter(config.RateLimit.UserPerMinute, config.RateLimit.UserBurst),
+		RoomLimiter:  NewRateLimiter(config.RateLimit.RoomPerMinute, config.RateLimit.RoomBurst),
+	}
+	p.server = grpc.NewServer(
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(p.forward),
+		// the reflection API is authorized like the proxied calls
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := p.authorize(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := p.authorize(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+
+	opts := reflection.ServerOptions{
+		Services:           p,
+		DescriptorResolver: descriptorResolver{syncer: syncer},
+	}
+	reflectionv1.RegisterServerReflectionServer(p.server, reflection.NewServerV1(opts))
+	reflectionv1alpha.RegisterServerReflectionServer(p.server, reflection.NewServer(opts))
+	return p, nil
+}
+
+// parsePeers parses IPs and CIDR networks, an IP is a network of its own
+func parsePeers(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if ip := net.ParseIP(value); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("allowed proxy peer %q isn't an IP or a CIDR network", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// peerIP returns the IP of the client of the call, nil when it isn't known
+func peerIP(ctx context.Context) net.IP {
+	client, ok := peer.FromContext(ctx)
+	if !ok || client.Addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(client.Addr.String())
+	if err != nil {
+		host = client.Addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+// authorize refuses calls from peers outside of the AllowedPeers and, when there is a Token, calls without it
+func (p *GRPCProxy) authorize(ctx context.Context) error {
+	if len(p.AllowedPeers) > 0 {
+		ip := peerIP(ctx)
+		if ip == nil || !slices.ContainsFunc(p.AllowedPeers, func(network *net.IPNet) bool { return network.Contains(ip) }) {
+			return status.Errorf(codes.PermissionDenied, "peer %v isn't allowed to call the proxy", ip)
+		}
+	}
+	if p.Token != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) == 0 || subtle.ConstantTimeCompare([]byte(values[0]), []byte("Bearer "+p.Token)) != 1 {
+			return status.Error(codes.Unauthenticated, "missing or invalid proxy token")
+		}
+	}
+	return nil
+}
+
+// Serve accepts connections on the listener until Stop is called
+func (p *GRPCProxy) Serve(lis net.Listener) error {
+	log.Info().Msgf("gRPC proxy listening on %s", lis.Addr())
+	return p.server.Serve(lis)
+}
+
+// Stop gracefully stops the proxy
+func (p *GRPCProxy) Stop() {
+	p.server.GracefulStop()
+}
+
+// GetServiceInfo lists the reflection service and every synced gRPC service, used by the reflection API
+func (p *GRPCProxy) GetServiceInfo() map[string]grpc.ServiceInfo {
+	info := p.server.GetServiceInfo()
+	for name := range p.serviceSnetIDs() {
+		info[name] = grpc.ServiceInfo{}
+	}
+	return info
+}
+
+// serviceSnetIDs maps fully-qualified gRPC service names to the snet ids of services exposing them
+func (p *GRPCProxy) serviceSnetIDs() map[string][]string {
+	snetIDs := make(map[string][]string)
+	for snetID, descriptors := range p.Syncer.Descriptors() {
+		for _, descriptor := range descriptors {
+			services := descriptor.Services()
+			for i := 0; i < services.Len(); i++ {
+				name := string(services.Get(i).FullName())
+				snetIDs[name] = append(snetIDs[name], snetID)
+			}
+		}
+	}
+	return snetIDs
+}
+
+// resolveSnetID picks the snet service for a call from the SnetIDHeader or, if the header
+// is missing, the only synced service exposing the gRPC service
+func (p *GRPCProxy) resolveSnetID(ctx context.Context, serviceName string) (string, error) {
+	candidates := p.serviceSnetIDs()[serviceName]
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(SnetIDHeader); len(values) > 0 {
+			for _, candidate := range candidates {
+				if candidate == values[0] {
+					return candidate, nil
+				}
+			}
+			return "", status.Errorf(codes.NotFound, "snet service %s does not expose %s", values[0], serviceName)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return "", status.Errorf(codes.Unimplemented, "unknown service %s", serviceName)
+	case 1:
+		return candidates[0], nil
+	default:
+		sort.Strings(candidates)
+		return "", status.Errorf(codes.InvalidArgument, "service %s is provided by several snet services (%s), set the %s header",
+			serviceName, strings.Join(candidates, ", "), SnetIDHeader)
+	}
+}
+
+// forward proxies any call to the daemon of the snet service, paying for it. Like the calls from the bot,
+// calls to a service with an unreachable endpoint are refused first, then the ones over the rate limits.
+func (p *GRPCProxy) forward(_ any, serverStream grpc.ServerStream) (err error) {
+	fullMethod, ok := grpc.MethodFromServerStream(serverStream)
+	if !ok {
+		return status.Error(codes.Internal, "method not found in stream")
+	}
+	serviceName, _, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+
+	ctx, cancel := context.WithCancel(serverStream.Context())
+	defer cancel()
+
+	snetID, err := p.resolveSnetID(ctx, serviceName)
+	if err != nil {
+		return err
+	}
+	if health := p.Syncer.EndpointHealth(snetID); health.Status == snet_syncer.EndpointUnreachable {
+		return status.Errorf(codes.Unavailable, "service %s can't be called: %s", snetID, health.Status)
+	}
+	peerKey := "unknown"
+	if ip := peerIP(ctx); ip != nil {
+		peerKey = ip.String()
+	}
+	if allowed, retryAfter := allowAll(limit{limiter: p.PeerLimiter, key: peerKey}, limit{limiter: p.RoomLimiter, key: proxyRoom}); !allowed {
+		return status.Errorf(codes.ResourceExhausted, "rate limited, retry in %s", retryAfter)
+	}
+	snetService, err := p.db.GetSnetService(ctx, snetID)
+	if err != nil {
+		return status.Errorf(codes.NotFound, "snet service %s: %v", snetID, err)
+	}
+	price, err := snet_syncer.ServicePrice(ctx, p.db, snetService, fullMethod)
+	if err != nil {
+		return status.Errorf(codes.Internal, "price of %s: %v", fullMethod, err)
+	}
+	endpoint := p.Syncer.ServiceEndpoint(ctx, snetService)
+	client, err := p.grpcManager.GetClient(endpoint)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "connect to %s of %s: %v", endpoint, snetID, err)
+	}
+	md, settle, err := escrowPayment(ctx, p.eth, p.db, snetService, client.Conn, price)
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "payment for %s: %v", snetID, err)
+	}
+	defer func() { settle(err) }()
+
+	log.Info().Str("snet-id", snetID).Str("method", fullMethod).Msg("Proxying call")
+	clientStream, err := client.Conn.NewStream(metadata.NewOutgoingContext(ctx, md),
+		&grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, fullMethod, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			frame := &rawFrame{}
+			if err := serverStream.RecvMsg(frame); err != nil {
+				if errors.Is(err, io.EOF) {
+					_ = clientStream.CloseSend()
+				} else {
+					cancel()
+				}
+				return
+			}
+			if err := clientStream.SendMsg(frame); err != nil {
+				return
+			}
+		}
+	}()
+
+	headerSent := false
+	for {
+		frame := &rawFrame{}
+		err := clientStream.RecvMsg(frame)
+		if !headerSent {
+			if header, headerErr := clientStream.Header(); headerErr == nil {
+				_ = serverStream.SendHeader(header)
+			}
+			headerSent = true
+		}
+		if errors.Is(err, io.EOF) {
+			serverStream.SetTrailer(clientStream.Trailer())
+			return nil
+		}
+		if err != nil {
+			serverStream.SetTrailer(clientStream.Trailer())
+			return err
+		}
+		if err := serverStream.SendMsg(frame); err != nil {
+			return err
+		}
+	}
+}
+
+// rawFrame carries an undecoded gRPC message
+type rawFrame struct {
+	payload []byte
+}
+
+// rawCodec passes proxied messages through untouched and encodes regular
+// proto messages, such as the reflection ones, as usual
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	switch m := v.(type) {
+	case *rawFrame:
+		return m.payload, nil
+	case proto.Message:
+		return proto.Marshal(m)
+	}
+	return nil, fmt.Errorf("unsupported message type %T", v)
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	switch m := v.(type) {
+	case *rawFrame:
+		m.payload = append([]byte(nil), data...)
+		return nil
+	case proto.Message:
+		return proto.Unmarshal(data, m)
+	}
+	return fmt.Errorf("unsupported message type %T", v)
+}
+
+// Name is "proto" so that the content type stays application/grpc+proto
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// descriptorResolver looks up files and symbols among the descriptors currently held by the syncer
+type descriptorResolver struct {
+	syncer *snet_syncer.SnetSyncer
+}
+
+// files walks all synced files and their imports
+func (r descriptorResolver) files(visit func(fd protoreflect.FileDescriptor) bool) {
+	seen := make(map[string]bool)
+	var walk func(fd protoreflect.FileDescriptor) bool
+	walk = func(fd protoreflect.FileDescriptor) bool {
+		if seen[fd.Path()] {
+			return true
+		}
+		seen[fd.Path()] = true
+		if !visit(fd) {
+			return false
+		}
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			if !walk(imports.Get(i).FileDescriptor) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, descriptors := range r.syncer.Descriptors() {
+		for _, descriptor := range descriptors {
+			if !walk(descriptor) {
+				return
+			}
+		}
+	}
+}
+
+func (r descriptorResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	var found protoreflect.FileDescriptor
+	r.files(func(fd protoreflect.FileDescriptor) bool {
+		if fd.Path() == path {
+			found = fd
+		}
+		return found == nil
+	})
+	if found == nil {
+		return protoregistry.GlobalFiles.FindFileByPath(path)
+	}
+	return found, nil
+}
+
+func (r descriptorResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	var found protoreflect.Descriptor
+	r.files(func(fd protoreflect.FileDescriptor) bool {
+		found = findInFile(fd, name)
+		return found == nil
+	})
+	if found == nil {
+		return protoregistry.GlobalFiles.FindDescriptorByName(name)
+	}
+	return found, nil
+}
+
+// findInFile searches the services, methods, messages, enums and extensions declared in the file
+func findInFile(fd protoreflect.FileDescriptor, name protoreflect.FullName) protoreflect.Descriptor {
+	services := fd.Services()
+	for i := 0; i < services.Len(); i++ {
+		service := services.Get(i)
+		if service.FullName() == name {
+			return service
+		}
+		if method := service.Methods().ByName(name.Name()); method != nil && method.FullName() == name {
+			return method
+		}
+	}
+	return findInContainer(fd.Messages(), fd.Enums(), fd.Extensions(), name)
+}
+
+func findInContainer(messages protoreflect.MessageDescriptors, enums protoreflect.EnumDescriptors, extensions protoreflect.ExtensionDescriptors, name protoreflect.FullName) protoreflect.Descriptor {
+	for i := 0; i < enums.Len(); i++ {
+		if enums.Get(i).FullName() == name {
+			return enums.Get(i)
+		}
+	}
+	for i := 0; i < extensions.Len(); i++ {
+		if extensions.Get(i).FullName() == name {
+			return extensions.Get(i)
+		}
+	}
+	for i := 0; i < messages.Len(); i++ {
+		message := messages.Get(i)
+		if message.FullName() == name {
+			return message
+		}
+		if found := findInContainer(message.Messages(), message.Enums(), message.Extensions(), name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package lib
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"testing"
+)
+
+func peerContext(addr string, md ...string) context.Context {
+	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: tcpAddr})
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(md...))
+}
+
+func TestParsePeers(t *testing.T) {
+	networks, err := parsePeers([]string{"127.0.0.1", " 10.0.0.0/8", "::1", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, network := range networks {
+		got = append(got, network.String())
+	}
+	if want := []string{"127.0.0.1/32", "10.0.0.0/8", "::1/128"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("parsed peers %v, want %v", got, want)
+	}
+	if _, err := parsePeers([]string{"example.org"}); err == nil {
+		t.Fatal("host name accepted as a peer")
+	}
+}
+
+func TestProxyAuthorize(t *testing.T) {
+	networks, err := parsePeers([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPeer := &GRPCProxy{AllowedPeers: networks}
+	if err := byPeer.authorize(peerContext("10.1.2.3:4000")); err != nil {
+		t.Fatalf("allowed peer refused: %v", err)
+	}
+	if err := byPeer.authorize(peerContext("192.168.1.1:4000")); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("other peer fails with %v, want PermissionDenied", err)
+	}
+	if err := byPeer.authorize(context.Background()); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("unknown peer fails with %v, want PermissionDenied", err)
+	}
+
+	byToken := &GRPCProxy{Token: "secret"}
+	if err := byToken.authorize(peerContext("192.168.1.1:4000", "authorization", "Bearer secret")); err != nil {
+		t.Fatalf("call with the token refused: %v", err)
+	}
+	for _, md := range [][]string{nil, {"authorization", "Bearer other"}, {"authorization", "secret"}} {
+		if err := byToken.authorize(peerContext("192.168.1.1:4000", md...)); status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("call with %v fails with %v, want Unauthenticated", md, err)
+		}
+	}
+
+	// both are required when both are set
+	both := &GRPCProxy{Token: "secret", AllowedPeers: networks}
+	if err := both.authorize(peerContext("192.168.1.1:4000", "authorization", "Bearer secret")); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("call with the token from another peer fails with %v, want PermissionDenied", err)
+	}
+}
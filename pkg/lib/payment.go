@@ -0,0 +1,266 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math/big"
+	"matrix-ai-framework/internal/config"
+	"matrix-ai-framework/pkg/blockchain"
+	"matrix-ai-framework/pkg/blockchain/util"
+	"matrix-ai-framework/pkg/db"
+	"sync"
+)
+
+var (
+	// ErrInsufficientChannelBalance is returned when the payment channel can't cover the price of a call
+	ErrInsufficientChannelBalance = errors.New("insufficient channel balance, fund the payment channel to the service group first")
+	// ErrNoFundedChannel is returned when there is no open payment channel to the service group to pay from
+	ErrNoFundedChannel = errors.New("no funded payment channel to the service group, open one first")
+)
+
+// signerKey returns the key payments are signed with and its address, the sender of the payment channels
+func signerKey() (*ecdsa.PrivateKey, common.Address, error) {
+	privateKeyECDSA, err := crypto.HexToECDSA(config.Blockchain.PrivateKey)
+	if err != nil {
+		return nil, common.Address{}, fmt.Errorf("get private key: %w", err)
+	}
+	publicKeyECDSA, ok := privateKeyECDSA.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil, common.Address{}, errors.New("failed to get public key")
+	}
+	return privateKeyECDSA, crypto.PubkeyToAddress(*publicKeyECDSA), nil
+}
+
+// paymentGroup returns the id and the payment address of the group of the service
+func paymentGroup(ctx context.Context, database db.Service, snetService db.SnetService) (groupID [32]byte, recipient common.Address, err error) {
+	group, err := database.GetSnetOrgGroup(ctx, snetService.GroupID)
+	if err != nil {
+		return groupID, recipient, fmt.Errorf("get payment group %s: %w", snetService.GroupID, err)
+	}
+	log.Debug().Msgf("group: %+v", group)
+	log.Debug().Msgf("groupID from group: %s", group.GroupID)
+	log.Debug().Msgf("groupID from snet service: %s", snetService.GroupID)
+
+	decodedGroupID, err := base64.StdEncoding.DecodeString(group.GroupID)
+	if err != nil {
+		return groupID, recipient, fmt.Errorf("decode group id %s: %w", group.GroupID, err)
+	}
+	copy(groupID[:], decodedGroupID)
+	log.Debug().Msgf("groupID in bytes: %v", groupID)
+
+	recipient = common.HexToAddress(group.PaymentAddress)
+	log.Debug().Msgf("recipient: %v", recipient)
+	return groupID, recipient, nil
+}
+
+// checkChannel returns the payment channel calls to the service are paid from, see blockchain.Ethereum.FindChannel
+func checkChannel(ctx context.Context, eth blockchain.Ethereum, database db.Service, snetService db.SnetService) (blockchain.ChannelState, error) {
+	_, sender, err := signerKey()
+	if err != nil {
+		return blockchain.ChannelState{}, err
+	}
+	groupID, recipient, err := paymentGroup(ctx, database, snetService)
+	if err != nil {
+		return blockchain.ChannelState{}, err
+	}
+	channel, err := eth.FindChannel(ctx, sender, recipient, groupID)
+	if err != nil {
+		return blockchain.ChannelState{}, fmt.Errorf("check payment channel: %w", err)
+	}
+	return channel, nil
+}
+
+// channelStateMethod is the method of the payment channel state service of the daemon returning the nonce and
+// the amount last signed on a channel
+const channelStateMethod = "/escrow.PaymentChannelStateService/GetChannelState"
+
+// payments keeps the running totals of the payment channels of the bot key for every call
+var payments = newChannelPayments()
+
+// channelPayment is the running total signed on a payment channel
+type channelPayment struct {
+	// busy holds a token while a call paid from the channel is in flight, the daemon takes one payment per
+	// channel at a time and only keeps it when the call succeeds
+	busy chan struct{}
+	// nonce and authorized are unset until read from the daemon
+	nonce      *big.Int
+	authorized *big.Int
+}
+
+// channelPayments keeps the amount signed to the daemons on every payment channel. The daemon takes the
+// payment of a call as the difference between the signed amount and the one it got last, so each call signs
+// the running total of its nonce.
+type channelPayments struct {
+	mu       *sync.Mutex
+	channels map[string]*channelPayment
+}
+
+func newChannelPayments() *channelPayments {
+	return &channelPayments{mu: &sync.Mutex{}, channels: map[string]*channelPayment{}}
+}
+
+// reserve waits for the call in flight on the channel and returns the nonce and the amount to sign for a call
+// costing price. The nonce and the amount the daemon got last are read with readState the first time the
+// channel is used, once the nonce changed on chain and after a failed call. settle must be called with the
+// result of the call, the amount only counts when the call succeeded. Without price left in the channel
+// beyond the amount already signed it fails with ErrInsufficientChannelBalance.
+func (p *channelPayments) reserve(ctx context.Context, channel blockchain.ChannelState, price *big.Int,
+	readState func(context.Context) (nonce, authorized *big.Int, err error)) (nonce, amount *big.Int, settle func(error), err error) {
+	p.mu.Lock()
+	payment, ok := p.channels[channel.ChannelID.String()]
+	if !ok {
+		payment = &channelPayment{busy: make(chan struct{}, 1)}
+		p.channels[channel.ChannelID.String()] = payment
+	}
+	p.mu.Unlock()
+
+	select {
+	case payment.busy <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, nil, ctx.Err()
+	}
+	if payment.nonce == nil || payment.nonce.Cmp(channel.Nonce) < 0 {
+		if payment.nonce, payment.authorized, err = readState(ctx); err != nil {
+			payment.nonce, payment.authorized = nil, nil
+			<-payment.busy
+			return nil, nil, nil, err
+		}
+	}
+	channel.Authorized = payment.authorized
+	if !channel.Covers(price) {
+		<-payment.busy
+		return nil, nil, nil, fmt.Errorf("%w: channel %s holds %v cogs and %v are already signed, the call costs %v cogs",
+			ErrInsufficientChannelBalance, channel.ChannelID, channel.Value, payment.authorized, price)
+	}
+
+	nonce, amount = payment.nonce, new(big.Int).Add(payment.authorized, price)
+	var once sync.Once
+	settle = func(callErr error) {
+		once.Do(func() {
+			if callErr == nil {
+				payment.authorized = amount
+			} else {
+				// the daemon may have taken the payment anyway, its state is read again
+				payment.nonce, payment.authorized = nil, nil
+			}
+			<-payment.busy
+		})
+	}
+	return nonce, amount, settle, nil
+}
+
+// daemonChannelState reads the nonce and the amount last signed on the channel from the payment channel
+// state service of the daemon
+func daemonChannelState(ctx context.Context, conn grpc.ClientConnInterface, eth blockchain.Ethereum, privateKeyECDSA *ecdsa.PrivateKey,
+	channel blockchain.ChannelState) (nonce, authorized *big.Int, err error) {
+	signature := util.GetSignature(bytes.Join([][]byte{
+		[]byte(blockchain.ChannelStatePrefixSignature),
+		eth.MPEAddress.Bytes(),
+		util.BigIntToBytes(channel.ChannelID),
+		util.BigIntToBytes(channel.Block),
+	}, nil), privateKeyECDSA)
+
+	request := protowire.AppendTag(nil, 1, protowire.BytesType)
+	request = protowire.AppendBytes(request, util.BigIntToBytes(channel.ChannelID))
+	request = protowire.AppendTag(request, 2, protowire.BytesType)
+	request = protowire.AppendBytes(request, signature)
+	request = protowire.AppendTag(request, 3, protowire.VarintType)
+	request = protowire.AppendVarint(request, channel.Block.Uint64())
+	reply := &rawFrame{}
+	if err := conn.Invoke(ctx, channelStateMethod, &rawFrame{payload: request}, reply, grpc.ForceCodec(rawCodec{})); err != nil {
+		return nil, nil, fmt.Errorf("get state of channel %s from the daemon: %w", channel.ChannelID, err)
+	}
+
+	nonce, authorized = new(big.Int), new(big.Int)
+	for payload := reply.payload; len(payload) > 0; {
+		number, kind, n := protowire.ConsumeTag(payload)
+		if n < 0 {
+			return nil, nil, fmt.Errorf("state of channel %s: %w", channel.ChannelID, protowire.ParseError(n))
+		}
+		payload = payload[n:]
+		if kind != protowire.BytesType || (number != 1 && number != 2) {
+			n = protowire.ConsumeFieldValue(number, kind, payload)
+			if n < 0 {
+				return nil, nil, fmt.Errorf("state of channel %s: %w", channel.ChannelID, protowire.ParseError(n))
+			}
+			payload = payload[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(payload)
+		if n < 0 {
+			return nil, nil, fmt.Errorf("state of channel %s: %w", channel.ChannelID, protowire.ParseError(n))
+		}
+		payload = payload[n:]
+		// current_nonce is field 1 of the reply and current_signed_amount field 2
+		if number == 1 {
+			nonce.SetBytes(value)
+		} else {
+			authorized.SetBytes(value)
+		}
+	}
+	return nonce, authorized, nil
+}
+
+// escrowPayment signs the payment of price cogs for one call from the newest payment channel of the bot key
+// to the group of the service and returns it as snet daemon metadata, conn is the connection to the daemon
+// the call is sent to. The amount signed is the running total of the channel, see channelPayments, and
+// settle must be called with the result of the call. Nothing is sent to the chain: without an unexpired
+// channel it fails with ErrNoFundedChannel, without enough funds left in it with
+// ErrInsufficientChannelBalance, before the daemon is called. Opening and funding channels is left to the
+// operator.
+func escrowPayment(ctx context.Context, eth blockchain.Ethereum, database db.Service, snetService db.SnetService,
+	conn grpc.ClientConnInterface, price int) (md metadata.MD, settle func(error), err error) {
+	groupID, recipient, err := paymentGroup(ctx, database, snetService)
+	if err != nil {
+		return nil, nil, err
+	}
+	privateKeyECDSA, fromAddress, err := signerKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Debug().Msgf("fromAddress: %v", fromAddress)
+
+	channel, err := eth.FindChannel(ctx, fromAddress, recipient, groupID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("check payment channel: %w", err)
+	}
+	if !channel.Found || channel.Expired {
+		return nil, nil, ErrNoFundedChannel
+	}
+	channelID := channel.ChannelID
+	// the balance is checked before signing so the daemon doesn't have to reject the call
+	nonce, amount, settle, err := payments.reserve(ctx, channel, big.NewInt(int64(price)), func(ctx context.Context) (*big.Int, *big.Int, error) {
+		return daemonChannelState(ctx, conn, eth, privateKeyECDSA, channel)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message := bytes.Join([][]byte{
+		[]byte(blockchain.PrefixInSignature), // prefix
+		eth.MPEAddress.Bytes(),               // mpe address
+		util.BigIntToBytes(channelID),        // channel id
+		util.BigIntToBytes(nonce),            // nonce
+		util.BigIntToBytes(amount),           // amount
+	}, nil)
+
+	signature := util.GetSignature(message, privateKeyECDSA)
+
+	return metadata.New(map[string]string{
+		blockchain.PaymentTypeHeader:             "escrow",
+		blockchain.PaymentChannelIDHeader:        channelID.String(),
+		blockchain.PaymentChannelNonceHeader:     nonce.String(),
+		blockchain.PaymentChannelAmountHeader:    amount.String(),
+		blockchain.PaymentChannelSignatureHeader: string(signature),
+	}), settle, nil
+}
@@ -0,0 +1,194 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/crypto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math/big"
+	"matrix-ai-framework/pkg/blockchain"
+	"matrix-ai-framework/pkg/blockchain/util"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeState returns the daemon state nonce/authorized and counts the reads
+type fakeState struct {
+	nonce, authorized int64
+	reads             int
+}
+
+func (f *fakeState) read(context.Context) (*big.Int, *big.Int, error) {
+	f.reads++
+	return big.NewInt(f.nonce), big.NewInt(f.authorized), nil
+}
+
+func testChannel(nonce, value int64) blockchain.ChannelState {
+	return blockchain.ChannelState{Found: true, ChannelID: big.NewInt(7), Nonce: big.NewInt(nonce), Value: big.NewInt(value), Block: big.NewInt(100)}
+}
+
+func reserveAmount(t *testing.T, p *channelPayments, channel blockchain.ChannelState, price int64, state *fakeState) (*big.Int, *big.Int, func(error)) {
+	t.Helper()
+	nonce, amount, settle, err := p.reserve(context.Background(), channel, big.NewInt(price), state.read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nonce, amount, settle
+}
+
+func TestReserveSignsRunningTotal(t *testing.T) {
+	p := newChannelPayments()
+	// the daemon got 30 cogs on the channel before
+	state := &fakeState{nonce: 2, authorized: 30}
+	channel := testChannel(2, 100)
+
+	for _, want := range []int64{40, 50, 60} {
+		nonce, amount, settle := reserveAmount(t, p, channel, 10, state)
+		if nonce.Int64() != 2 || amount.Int64() != want {
+			t.Fatalf("call signs %v on nonce %v, want %d on nonce 2", amount, nonce, want)
+		}
+		settle(nil)
+	}
+	if state.reads != 1 {
+		t.Fatalf("daemon state read %d times, want once and then tracked", state.reads)
+	}
+
+	// the failed call isn't counted and the state is read again, the daemon may have taken it anyway
+	_, _, settle := reserveAmount(t, p, channel, 10, state)
+	settle(errors.New("call failed"))
+	state.authorized = 70
+	if _, amount, settle := reserveAmount(t, p, channel, 10, state); amount.Int64() != 80 || state.reads != 2 {
+		t.Fatalf("call after a failure signs %v after %d reads, want 80 read from the daemon", amount, state.reads)
+	} else {
+		settle(nil)
+	}
+
+	// claiming moves the channel to a new nonce, the total starts over from the daemon state
+	state.nonce, state.authorized = 3, 0
+	nonce, amount, settle := reserveAmount(t, p, testChannel(3, 20), 10, state)
+	if nonce.Int64() != 3 || amount.Int64() != 10 {
+		t.Fatalf("call after a claim signs %v on nonce %v, want 10 on nonce 3", amount, nonce)
+	}
+	settle(nil)
+}
+
+func TestReserveChecksWhatIsLeft(t *testing.T) {
+	p := newChannelPayments()
+	state := &fakeState{nonce: 0, authorized: 95}
+	// 100 cogs cover the price but only 5 are left after what was signed
+	if _, _, _, err := p.reserve(context.Background(), testChannel(0, 100), big.NewInt(10), state.read); !errors.Is(err, ErrInsufficientChannelBalance) {
+		t.Fatalf("reserve fails with %v, want ErrInsufficientChannelBalance", err)
+	}
+	// the refused call doesn't hold the channel
+	_, amount, settle := reserveAmount(t, p, testChannel(0, 100), 5, state)
+	if amount.Int64() != 100 {
+		t.Fatalf("call signs %v, want the 100 cogs left", amount)
+	}
+	settle(nil)
+}
+
+func TestReserveWaitsForCallInFlight(t *testing.T) {
+	p := newChannelPayments()
+	state := &fakeState{}
+	_, _, settle := reserveAmount(t, p, testChannel(0, 100), 10, state)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, _, err := p.reserve(ctx, testChannel(0, 100), big.NewInt(10), state.read); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("reserve with a call in flight fails with %v, want to wait until ctx expires", err)
+	}
+
+	reserved := make(chan *big.Int)
+	go func() {
+		_, amount, settle, err := p.reserve(context.Background(), testChannel(0, 100), big.NewInt(10), state.read)
+		if err != nil {
+			close(reserved)
+			return
+		}
+		settle(nil)
+		reserved <- amount
+	}()
+	settle(nil)
+	// settling twice is harmless
+	settle(nil)
+	if amount := <-reserved; amount == nil || amount.Int64() != 20 {
+		t.Fatalf("waiting call signs %v, want 20 once the first one settled", amount)
+	}
+}
+
+func TestDaemonChannelState(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := make(chan []byte, 1)
+	server := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}), grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		if method, _ := grpc.MethodFromServerStream(stream); method != channelStateMethod {
+			t.Errorf("daemon called with %s, want %s", method, channelStateMethod)
+		}
+		request := &rawFrame{}
+		if err := stream.RecvMsg(request); err != nil {
+			return err
+		}
+		requests <- request.payload
+		reply := protowire.AppendTag(nil, 1, protowire.BytesType)
+		reply = protowire.AppendBytes(reply, util.BigIntToBytes(big.NewInt(4)))
+		reply = protowire.AppendTag(reply, 2, protowire.BytesType)
+		reply = protowire.AppendBytes(reply, util.BigIntToBytes(big.NewInt(1234)))
+		reply = protowire.AppendTag(reply, 6, protowire.VarintType)
+		reply = protowire.AppendVarint(reply, 99)
+		return stream.SendMsg(&rawFrame{payload: reply})
+	}))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	channel := testChannel(4, 5000)
+	nonce, authorized, err := daemonChannelState(context.Background(), conn, blockchain.Ethereum{}, key, channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce.Int64() != 4 || authorized.Int64() != 1234 {
+		t.Fatalf("daemon state is nonce %v and %v signed, want nonce 4 and 1234", nonce, authorized)
+	}
+
+	request := <-requests
+	fields := map[protowire.Number][]byte{}
+	var block uint64
+	for len(request) > 0 {
+		number, kind, n := protowire.ConsumeTag(request)
+		request = request[n:]
+		if kind == protowire.VarintType {
+			block, n = protowire.ConsumeVarint(request)
+		} else {
+			fields[number], n = protowire.ConsumeBytes(request)
+		}
+		if n < 0 {
+			t.Fatalf("malformed request: %v", protowire.ParseError(n))
+		}
+		request = request[n:]
+	}
+	if new(big.Int).SetBytes(fields[1]).Int64() != 7 || block != 100 {
+		t.Fatalf("request for channel %x at block %d, want channel 7 at block 100", fields[1], block)
+	}
+	hash := crypto.Keccak256(blockchain.HashPrefix32Bytes, crypto.Keccak256(
+		[]byte(blockchain.ChannelStatePrefixSignature), make([]byte, 20), util.BigIntToBytes(big.NewInt(7)), util.BigIntToBytes(big.NewInt(100))))
+	signer, err := crypto.SigToPub(hash, fields[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crypto.PubkeyToAddress(*signer) != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Fatal("request isn't signed by the bot key")
+	}
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter is an in-memory token bucket limiter keyed by an arbitrary string (user or room id)
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64 // bucket capacity
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter refilling perMinute tokens per minute with the given burst.
+// A non-positive perMinute disables limiting.
+func NewRateLimiter(perMinute float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    perMinute / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token for the key. If the bucket is empty it returns false and the time until the next token.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	return allowAll(limit{limiter: l, key: key})
+}
+
+// limit is the bucket of key in limiter
+type limit struct {
+	limiter *RateLimiter
+	key     string
+}
+
+// allowAll takes a token from every bucket only when each of them has one. Otherwise it takes none and
+// returns false and the time until they all have one. The limiters must be distinct, they are locked in
+// the order given.
+func allowAll(limits ...limit) (bool, time.Duration) {
+	buckets := make([]*tokenBucket, 0, len(limits))
+	var retryAfter time.Duration
+	for _, lim := range limits {
+		l := lim.limiter
+		if l == nil || l.rate <= 0 {
+			continue
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		now := l.now()
+		bucket, ok := l.buckets[lim.key]
+		if !ok {
+			bucket = &tokenBucket{tokens: l.burst, last: now}
+			l.buckets[lim.key] = bucket
+		}
+		bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+		bucket.last = now
+
+		if bucket.tokens < 1 {
+			retryAfter = max(retryAfter, time.Duration(math.Ceil((1-bucket.tokens)/l.rate))*time.Second)
+		}
+		buckets = append(buckets, bucket)
+	}
+	if retryAfter > 0 {
+		return false, retryAfter
+	}
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return true, 0
+}
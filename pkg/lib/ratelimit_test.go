@@ -0,0 +1,32 @@
+package lib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllowAllTakesNoTokenWhenRefused(t *testing.T) {
+	now := time.Unix(1000, 0)
+	users, rooms := NewRateLimiter(60, 2), NewRateLimiter(60, 1)
+	users.now, rooms.now = func() time.Time { return now }, func() time.Time { return now }
+
+	if allowed, _ := allowAll(limit{limiter: users, key: "@alice"}, limit{limiter: rooms, key: "!room"}); !allowed {
+		t.Fatal("first call refused")
+	}
+	// the room is out of tokens, the user keeps the one left
+	allowed, retryAfter := allowAll(limit{limiter: users, key: "@alice"}, limit{limiter: rooms, key: "!room"})
+	if allowed || retryAfter != time.Second {
+		t.Fatalf("call in the empty room allowed %v, retry after %s, want refused for 1s", allowed, retryAfter)
+	}
+	if allowed, _ := users.Allow("@alice"); !allowed {
+		t.Fatal("refused call took the token of the user")
+	}
+	if allowed, _ := users.Allow("@alice"); allowed {
+		t.Fatal("user allowed past the burst")
+	}
+
+	// a disabled limiter doesn't refuse and the other one still counts
+	if allowed, _ := allowAll(limit{limiter: NewRateLimiter(0, 1), key: "@bob"}, limit{limiter: rooms, key: "!room"}); allowed {
+		t.Fatal("call in the empty room allowed by the disabled limiter")
+	}
+}
@@ -3,7 +3,10 @@ package lib
 import (
 	"fmt"
 	"github.com/rs/zerolog/log"
+	"matrix-ai-framework/internal/config"
 	"matrix-ai-framework/internal/matrix"
+	"matrix-ai-framework/internal/snet_syncer"
+	"matrix-ai-framework/pkg/db"
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
 	"strings"
@@ -35,16 +38,29 @@ func NewUserState(serviceName string, method *AIMethod, eventID id.EventID) *Use
 // SNETBot represents a Matrix bot for SNET Services
 // Implements IMauBot
 type SNETBot struct {
-	Client     matrix.Service
-	AIServices []BotService
-	States     map[string]*UserState // key: "{roomId} {userId}"
+	Client      matrix.Service
+	AIServices  []BotService
+	States      map[string]*UserState // key: "{roomId} {userId}"
+	UserLimiter *RateLimiter          // limits calls per matrix user
+	RoomLimiter *RateLimiter          // limits calls per room
+	Admins      map[id.UserID]bool    // admins are not rate limited and can run admin commands
+	Syncer      *snet_syncer.SnetSyncer
+	DB          db.Service  // stores the audit log of admin commands
+	Caller      *SnetCaller // calls methods for "!snet call"
 }
 
 func NewSNETBot(client matrix.Service) *SNETBot {
+	admins := make(map[id.UserID]bool, len(config.Matrix.Admins))
+	for _, admin := range config.Matrix.Admins {
+		admins[id.UserID(admin)] = true
+	}
 	return &SNETBot{
-		Client:     client,
-		States:     make(map[string]*UserState),
-		AIServices: make([]BotService, 0),
+		Client:      client,
+		States:      make(map[string]*UserState),
+		AIServices:  make([]BotService, 0),
+		UserLimiter: NewRateLimiter(config.RateLimit.UserPerMinute, config.RateLimit.UserBurst),
+		RoomLimiter: NewRateLimiter(config.RateLimit.RoomPerMinute, config.RateLimit.RoomBurst),
+		Admins:      admins,
 	}
 }
 
@@ -94,6 +110,9 @@ func (bot *SNETBot) handlerEvent(event *event.Event) {
 
 	state, found := bot.States[key]
 	if !found {
+		if bot.handleCommand(event) {
+			return
+		}
 
 		names, err := bot.parseCommand(event.Content.AsMessage().Body, event.RoomID)
 		if err != nil {
@@ -113,6 +132,22 @@ func (bot *SNETBot) handlerEvent(event *event.Event) {
 			return
 		}
 
+		if reason := bot.callPrecheck(service); reason != "" {
+			_, err := bot.Client.SendMessage(event.RoomID, reason)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to send message: " + err.Error())
+			}
+			return
+		}
+
+		if allowed, retryAfter := bot.allowCall(event.RoomID, event.Sender); !allowed {
+			_, err := bot.Client.SendMessage(event.RoomID, fmt.Sprintf("Slow down! You can call services again in %s.", retryAfter))
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to send message: " + err.Error())
+			}
+			return
+		}
+
 		inputs := method.Inputs
 		if len(inputs) == 0 {
 			log.Error().Msg("No inputs")
@@ -200,6 +235,29 @@ func (bot *SNETBot) handlerEvent(event *event.Event) {
 	state.LastEventID = resp.EventID
 }
 
+// allowCall checks the per-user and per-room rate limits, a call refused by either takes no token from
+// the other. Admins are exempt.
+func (bot *SNETBot) allowCall(roomID id.RoomID, userID id.UserID) (bool, time.Duration) {
+	if bot.Admins[userID] {
+		return true, 0
+	}
+	return allowAll(limit{limiter: bot.UserLimiter, key: userID.String()}, limit{limiter: bot.RoomLimiter, key: roomID.String()})
+}
+
+// callPrecheck returns why the service can't be called, or an empty string if it can
+func (bot *SNETBot) callPrecheck(service *AIService) string {
+	if bot.Syncer == nil || service.Type != "snet" {
+		return ""
+	}
+	snetID, _, _ := strings.Cut(service.Name, "/")
+	health := bot.Syncer.EndpointHealth(snetID)
+	if health.Status != snet_syncer.EndpointUnreachable {
+		return ""
+	}
+	return fmt.Sprintf("Service %s can't be called: %s (last checked at %s).",
+		snetID, health.Status, health.CheckedAt.UTC().Format(time.RFC3339))
+}
+
 // ParsedNames contains parsed information from a command
 type ParsedNames struct {
 	BotName     string // bot name. If private chat, it will be empty
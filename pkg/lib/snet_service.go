@@ -1,28 +1,18 @@
 package lib
 
 import (
-	"bytes"
 	"context"
-	"crypto/ecdsa"
-	"encoding/base64"
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
+	"errors"
 	"github.com/golang/protobuf/proto"
 	"github.com/rs/zerolog/log"
-	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/dynamicpb"
-	"math/big"
-	"matrix-ai-framework/internal/config"
 	"matrix-ai-framework/internal/grpc_manager"
+	"matrix-ai-framework/internal/snet_syncer"
 	"matrix-ai-framework/pkg/blockchain"
-	"matrix-ai-framework/pkg/blockchain/util"
 	"matrix-ai-framework/pkg/db"
-	"net/url"
 	"strconv"
-	"strings"
 )
 
 type SnetHandler struct {
@@ -37,6 +27,10 @@ type SnetHandler struct {
 	OutputMsg   *dynamicpb.Message
 }
 
+// defaultGRPCManager is shared by the handlers, so calls to the same daemon reuse one connection.
+// The engine replaces it with the configured manager of the app.
+var defaultGRPCManager = grpc_manager.NewGRPCClientManager()
+
 func NewSnetHandler(snetID, serviceName, methodName string, inputMsg, outputMsg *dynamicpb.Message) *SnetHandler {
 
 	return &SnetHandler{
@@ -45,7 +39,7 @@ func NewSnetHandler(snetID, serviceName, methodName string, inputMsg, outputMsg
 		MethodName:  methodName,
 		eth:         blockchain.Init(),
 		db:          db.New(),
-		grpcManager: grpc_manager.NewGRPCClientManager(),
+		grpcManager: defaultGRPCManager,
 		InputMsg:    inputMsg,
 		OutputMsg:   outputMsg,
 	}
@@ -56,75 +50,33 @@ func (h *SnetHandler) Call(c *MContext) {
 	log.Debug().Msgf("serviceName: %v", h.ServiceName)
 	log.Debug().Msgf("methodName: %v", h.MethodName)
 
-	snetService, err := h.db.GetSnetService(h.SnetID)
+	ctx := context.Background()
+	snetService, err := h.db.GetSnetService(ctx, h.SnetID)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get snet service")
 		return
 	}
 	log.Debug().Msgf("snetService: %+v", snetService)
 
-	group, _ := h.db.GetSnetOrgGroup(snetService.GroupID)
-	log.Debug().Msgf("group: %+v", group)
-	log.Debug().Msgf("groupID from group: %s", group.GroupID)
-	log.Debug().Msgf("groupID from snet service: %s", snetService.GroupID)
-
-	decodedGroupID, err := base64.StdEncoding.DecodeString(group.GroupID)
-	var groupID [32]byte
-	copy(groupID[:], decodedGroupID)
-	log.Debug().Msgf("groupID in bytes: %v", groupID)
-
-	recipient := common.HexToAddress(group.PaymentAddress)
-	log.Debug().Msgf("recipient: %v", recipient)
-
-	// getting ecds pub priv keys
-	privateKeyECDSA, err := crypto.HexToECDSA(config.Blockchain.PrivateKey)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to get private key")
-	}
-	log.Debug().Msgf("privateKeyECDSA: %+v", privateKeyECDSA)
-
-	publicKey := privateKeyECDSA.Public()
-	log.Debug().Msgf("publicKey: %+v", publicKey)
-
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		log.Fatal().Msg("Failed to get public key")
-	}
-	log.Debug().Msgf("publicKeyECDSA: %+v", publicKeyECDSA)
-
-	// signer address
-	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-	log.Debug().Msgf("fromAddress: %v", fromAddress)
-
-	chainID, _ := strconv.Atoi(config.Blockchain.ChainID)
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKeyECDSA, big.NewInt(int64(chainID)))
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to create transactor")
-	}
-
-	nextChannelID, err := h.eth.MPE.NextChannelId(&bind.CallOpts{})
+	price, err := snet_syncer.ServicePrice(ctx, h.db, snetService, h.ServiceName+"/"+h.MethodName)
 	if err != nil {
+		log.Error().Err(err).Msg("Failed to get method price")
 		return
 	}
-	log.Debug().Msgf("Next channel id: %v", nextChannelID)
-	header, err := h.eth.Client.HeaderByNumber(context.Background(), nil)
+	log.Info().Msgf("Target: %v", snetService.URL)
+	client, err := h.grpcManager.GetClient(snetService.URL)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get block number")
-	}
-	blockNumber := header.Number
-	log.Debug().Msgf("Last block number: %v", blockNumber)
-	expiration := new(big.Int).Add(blockNumber, big.NewInt(10000000))
-	channel, err := h.eth.MPE.DepositAndOpenChannel(util.EstimateGas(auth), fromAddress, recipient, groupID, big.NewInt(10000000), expiration)
-	if err != nil {
-		log.Error().Err(err).Msgf("Failed to deposit and open payment channel")
+		log.Error().Err(err).Str("endpoint", snetService.URL).Msg("Failed to connect to service")
+		return
 	}
-	log.Debug().Msgf("Opened channel: %v", channel.Hash().Hex())
 
-	target, err := removeProtocol(snetService.URL)
-	log.Info().Msgf("Target: %v", target)
-	client, err := h.grpcManager.GetClient(target)
+	md, settle, err := escrowPayment(ctx, h.eth, h.db, snetService, client.Conn, price)
 	if err != nil {
-		log.Error().Err(err)
+		log.Error().Err(err).Msg("Failed to prepare payment")
+		if errors.Is(err, ErrInsufficientChannelBalance) || errors.Is(err, ErrNoFundedChannel) {
+			c.Result <- err.Error()
+		}
+		return
 	}
 
 	inputMsg := h.InputMsg
@@ -153,28 +105,9 @@ func (h *SnetHandler) Call(c *MContext) {
 
 	inputProto := proto.MessageV2(inputMsg)
 
-	price := snetService.Price
-
-	message := bytes.Join([][]byte{
-		[]byte(blockchain.PrefixInSignature),                      // prefix
-		h.eth.MPEAddress.Bytes(),                                  // mpe address
-		util.BigIntToBytes(big.NewInt(nextChannelID.Int64() - 1)), // channel id
-		util.BigIntToBytes(big.NewInt(0)),                         // nonce
-		util.BigIntToBytes(big.NewInt(int64(price))),              // amount
-	}, nil)
-
-	signature := util.GetSignature(message, privateKeyECDSA)
-
-	md := metadata.New(map[string]string{
-		"snet-payment-type":                  "escrow",
-		"snet-payment-channel-id":            strconv.FormatInt(nextChannelID.Int64()-1, 10),
-		"snet-payment-channel-nonce":         "0",
-		"snet-payment-channel-amount":        strconv.Itoa(price),
-		"snet-payment-channel-signature-bin": string(signature),
-	})
-
 	endpoint := "/" + h.ServiceName + "/" + h.MethodName
 	err = client.CallMethod(endpoint, inputProto, outputMsg, md)
+	settle(err)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to call method")
 		return
@@ -208,6 +141,10 @@ func NewSNETService(serviceDescriptor protoreflect.ServiceDescriptor, snetID, se
 			var inputList []MInput
 			var outputList []MOutput
 			if methods.Get(j) != nil {
+				if kind := snet_syncer.StreamingKind(methods.Get(j)); kind != "" {
+					log.Warn().Msgf("Skipping %s streaming method %s of %s, only unary methods can be called", kind, methods.Get(j).Name(), name)
+					continue
+				}
 				inputFields := methods.Get(j).Input().Fields()
 				outputFields := methods.Get(j).Output().Fields()
 				methodName := string(methods.Get(j).Name())
@@ -260,12 +197,3 @@ func SnetServiceHandler(snetID, serviceName, methodName string, inputMsg, output
 		outputMsg,
 	)
 }
-
-func removeProtocol(rawURL string) (string, error) {
-	parsedURL, err := url.Parse(rawURL)
-	if err != nil {
-		return "", err
-	}
-
-	return strings.TrimPrefix(rawURL, parsedURL.Scheme+"://"), nil
-}
@@ -0,0 +1,234 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidInput is returned for inputs that don't match the input message of a method
+var ErrInvalidInput = errors.New("invalid input")
+
+// InputError names the field of an input that doesn't match the input message of a method
+type InputError struct {
+	Method string
+	Field  string // path of the field, e.g. "images[0].url", empty for the input itself
+	Reason string
+}
+
+func (e *InputError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("invalid input of %s: %s", e.Method, e.Reason)
+	}
+	return fmt.Sprintf("invalid input of %s: field %q: %s", e.Method, e.Field, e.Reason)
+}
+
+func (e *InputError) Unwrap() error {
+	return ErrInvalidInput
+}
+
+// ParseInput checks a JSON input against the input message of a method and parses it. Unknown fields,
+// values of the wrong JSON type and missing required fields of proto2 messages are rejected with an
+// InputError naming the field. An empty input is the empty message.
+func ParseInput(method protoreflect.MethodDescriptor, jsonInput []byte) (*dynamicpb.Message, error) {
+	input := dynamicpb.NewMessage(method.Input())
+	if len(bytes.TrimSpace(jsonInput)) == 0 {
+		return input, nil
+	}
+	if field, reason := validateMessage(method.Input(), jsonInput, ""); reason != "" {
+		return nil, &InputError{Method: string(method.FullName()), Field: field, Reason: reason}
+	}
+	// the checks above cover the common mistakes, protojson still rejects the values they let through
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: false}).Unmarshal(jsonInput, input); err != nil {
+		return nil, &InputError{Method: string(method.FullName()), Reason: err.Error()}
+	}
+	return input, nil
+}
+
+// validateMessage checks the fields of a JSON object against a message, returning the path of the first
+// invalid field and why it is invalid
+func validateMessage(message protoreflect.MessageDescriptor, raw json.RawMessage, path string) (field, reason string) {
+	if isNull(raw) || strings.HasPrefix(string(message.FullName()), "google.protobuf.") {
+		// the well-known types have their own JSON mapping, protojson checks them
+		return "", ""
+	}
+	var object map[string]json.RawMessage
+	if jsonType(raw) != "an object" || json.Unmarshal(raw, &object) != nil {
+		return path, "expected a JSON object, got " + jsonType(raw)
+	}
+
+	fields := message.Fields()
+	present := make(map[protoreflect.FieldNumber]bool, len(object))
+	for _, name := range sortedKeys(object) {
+		fieldPath := joinPath(path, name)
+		descriptor := fields.ByJSONName(name)
+		if descriptor == nil {
+			descriptor = fields.ByTextName(name)
+		}
+		if descriptor == nil {
+			return fieldPath, fmt.Sprintf("unknown field, %s has no field %q", message.FullName(), name)
+		}
+		present[descriptor.Number()] = true
+		if field, reason = validateField(descriptor, object[name], fieldPath); reason != "" {
+			return field, reason
+		}
+	}
+	for i := 0; i < fields.Len(); i++ {
+		if descriptor := fields.Get(i); descriptor.Cardinality() == protoreflect.Required && !present[descriptor.Number()] {
+			return joinPath(path, descriptor.JSONName()), "missing required field"
+		}
+	}
+	return "", ""
+}
+
+// validateField checks the JSON value of a field, including every element of lists and maps
+func validateField(descriptor protoreflect.FieldDescriptor, raw json.RawMessage, path string) (field, reason string) {
+	if isNull(raw) {
+		return "", ""
+	}
+	switch {
+	case descriptor.IsMap():
+		var entries map[string]json.RawMessage
+		if jsonType(raw) != "an object" || json.Unmarshal(raw, &entries) != nil {
+			return path, "expected a JSON object, got " + jsonType(raw)
+		}
+		for _, key := range sortedKeys(entries) {
+			if field, reason = validateValue(descriptor.MapValue(), entries[key], fmt.Sprintf("%s[%q]", path, key)); reason != "" {
+				return field, reason
+			}
+		}
+	case descriptor.IsList():
+		var elements []json.RawMessage
+		if jsonType(raw) != "an array" || json.Unmarshal(raw, &elements) != nil {
+			return path, "expected a JSON array, got " + jsonType(raw)
+		}
+		for i, element := range elements {
+			if field, reason = validateValue(descriptor, element, fmt.Sprintf("%s[%d]", path, i)); reason != "" {
+				return field, reason
+			}
+		}
+	default:
+		return validateValue(descriptor, raw, path)
+	}
+	return "", ""
+}
+
+// validateValue checks a single JSON value of a field against the field kind
+func validateValue(descriptor protoreflect.FieldDescriptor, raw json.RawMessage, path string) (field, reason string) {
+	got := jsonType(raw)
+	switch kind := descriptor.Kind(); kind {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return validateMessage(descriptor.Message(), raw, path)
+	case protoreflect.EnumKind:
+		if descriptor.Enum().FullName() == "google.protobuf.NullValue" {
+			return "", ""
+		}
+		if got == "a string" {
+			var name string
+			_ = json.Unmarshal(raw, &name)
+			if descriptor.Enum().Values().ByName(protoreflect.Name(name)) == nil {
+				return path, fmt.Sprintf("%q is not a value of %s", name, descriptor.Enum().FullName())
+			}
+		} else if got != "a number" {
+			return path, fmt.Sprintf("expected a %s name or number, got %s", descriptor.Enum().FullName(), got)
+		}
+	case protoreflect.BoolKind:
+		if got != "a boolean" {
+			return path, "expected a boolean, got " + got
+		}
+	case protoreflect.StringKind:
+		if got != "a string" {
+			return path, "expected a string, got " + got
+		}
+	case protoreflect.BytesKind:
+		if got != "a string" {
+			return path, "expected a base64 string, got " + got
+		}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		// numbers may be quoted, and NaN and infinities are strings
+		if got != "a number" && got != "a string" {
+			return path, fmt.Sprintf("expected a %s, got %s", kind, got)
+		}
+	default:
+		// integers, 64-bit ones are usually quoted
+		if got != "a number" && got != "a string" {
+			return path, fmt.Sprintf("expected an integer (%s), got %s", kind, got)
+		}
+		if !validInteger(kind, raw) {
+			return path, fmt.Sprintf("%s is not a valid %s", raw, kind)
+		}
+	}
+	return "", ""
+}
+
+// validInteger reports whether a JSON number or quoted number fits an integer kind
+func validInteger(kind protoreflect.Kind, raw json.RawMessage) bool {
+	value := strings.Trim(string(bytes.TrimSpace(raw)), `"`)
+	// protojson also accepts integral numbers with a fraction or exponent, e.g. 1.0 or 1e3
+	if number, err := strconv.ParseFloat(value, 64); err == nil && number == math.Trunc(number) && math.Abs(number) < 1<<63 {
+		value = strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	var err error
+	switch kind {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		_, err = strconv.ParseInt(value, 10, 32)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		_, err = strconv.ParseUint(value, 10, 32)
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		_, err = strconv.ParseUint(value, 10, 64)
+	default:
+		_, err = strconv.ParseInt(value, 10, 64)
+	}
+	return err == nil
+}
+
+// jsonType names the type of a JSON value for error messages
+func jsonType(raw json.RawMessage) string {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return "nothing"
+	}
+	switch trimmed[0] {
+	case '{':
+		return "an object"
+	case '[':
+		return "an array"
+	case '"':
+		return "a string"
+	case 't', 'f':
+		return "a boolean"
+	case 'n':
+		return "null"
+	default:
+		return "a number"
+	}
+}
+
+// sortedKeys returns the keys of a JSON object in order, so the first invalid field reported is stable
+func sortedKeys(object map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isNull(raw json.RawMessage) bool {
+	return string(bytes.TrimSpace(raw)) == "null"
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"testing"
+)
+
+const validateProto = `syntax = "proto3";
+package shop;
+
+enum Size { SIZE_UNSET = 0; SMALL = 1; }
+message Item { string name = 1; int32 count = 2; }
+message Order {
+  string id = 1;
+  Size size = 2;
+  repeated Item items = 3;
+  map<string, int64> totals = 4;
+  bool gift = 5;
+}
+service Shop { rpc Place(Order) returns (Order); }
+`
+
+// placeMethod compiles validateProto and returns Shop.Place
+func placeMethod(t *testing.T) protoreflect.MethodDescriptor {
+	t.Helper()
+	compiler := protocompile.Compiler{Resolver: &protocompile.SourceResolver{
+		Accessor: protocompile.SourceAccessorFromMap(map[string]string{"shop.proto": validateProto}),
+	}}
+	files, err := compiler.Compile(context.Background(), "shop.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files[0].Services().ByName("Shop").Methods().ByName("Place")
+}
+
+func TestParseInput(t *testing.T) {
+	method := placeMethod(t)
+	input, err := ParseInput(method, []byte(`{"id": "1", "size": "SMALL", "items": [{"name": "a", "count": 2}], "totals": {"eur": "12"}, "gift": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := input.Get(method.Input().Fields().ByName("items")).List().Len(); got != 1 {
+		t.Fatalf("parsed %d items, want 1", got)
+	}
+	if _, err := ParseInput(method, []byte("  ")); err != nil {
+		t.Fatalf("empty input fails with %v, want the empty message", err)
+	}
+}
+
+func TestParseInputNamesInvalidField(t *testing.T) {
+	method := placeMethod(t)
+	for _, test := range []struct {
+		input, field, reason string
+	}{
+		{input: `{"id": "1", "colour": "red"}`, field: "colour", reason: `unknown field, shop.Order has no field "colour"`},
+		{input: `{"items": [{"name": "a"}, {"nmae": "b"}]}`, field: "items[1].nmae", reason: `unknown field, shop.Item has no field "nmae"`},
+		{input: `{"id": 1}`, field: "id", reason: "expected a string, got a number"},
+		{input: `{"gift": "yes"}`, field: "gift", reason: "expected a boolean, got a string"},
+		{input: `{"items": {"name": "a"}}`, field: "items", reason: "expected a JSON array, got an object"},
+		{input: `{"items": [{"count": 1.5}]}`, field: "items[0].count", reason: "1.5 is not a valid int32"},
+		{input: `{"totals": {"eur": true}}`, field: `totals["eur"]`, reason: "expected an integer (int64), got a boolean"},
+		{input: `{"size": "HUGE"}`, field: "size", reason: `"HUGE" is not a value of shop.Size`},
+		{input: `[]`, reason: "expected a JSON object, got an array"},
+	} {
+		_, err := ParseInput(method, []byte(test.input))
+		var inputErr *InputError
+		if !errors.As(err, &inputErr) || !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ParseInput(%s) fails with %v, want an InputError", test.input, err)
+			continue
+		}
+		if inputErr.Field != test.field || inputErr.Reason != test.reason {
+			t.Errorf("ParseInput(%s) rejects field %q: %s, want %q: %s", test.input, inputErr.Field, inputErr.Reason, test.field, test.reason)
+		}
+	}
+}